@@ -2,4 +2,6 @@ module github.com/Ramykaz/Distributed-Systems-/06-commit-log
 
 go 1.25.2
 
-require github.com/gorilla/mux v1.8.1 // indirect
+require github.com/Ramykaz/Distributed-Systems-/commitlog v0.0.0
+
+replace github.com/Ramykaz/Distributed-Systems-/commitlog => ../commitlog
@@ -2,48 +2,30 @@ package main
 
 import (
     "encoding/json"
+    "errors"
+    "flag"
     "fmt"
     "net/http"
+    "os"
     "strconv"
-    "sync"
-)
-
-// Record represents a single log entry
-type Record struct {
-    Offset int    `json:"offset"`
-    Value  string `json:"value"`
-}
 
-// CommitLog stores all records
-type CommitLog struct {
-    mu      sync.Mutex
-    records []Record
-}
+    "github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
 
-// Produce adds a record to the log
-func (c *CommitLog) Produce(value string) Record {
-    c.mu.Lock()
-    defer c.mu.Unlock()
-    record := Record{
-        Offset: len(c.records),
-        Value:  value,
-    }
-    c.records = append(c.records, record)
-    return record
-}
+func main() {
+    dataDir := flag.String("data", "", "directory to store the log in (in-memory if empty)")
+    flag.Parse()
 
-// Consume returns a record by offset
-func (c *CommitLog) Consume(offset int) (Record, bool) {
-    c.mu.Lock()
-    defer c.mu.Unlock()
-    if offset < 0 || offset >= len(c.records) {
-        return Record{}, false
+    // Pick a storage backend
+    var log commitlog.Log = commitlog.NewMemoryLog()
+    if *dataDir != "" {
+        fileLog, err := commitlog.OpenFileLog(*dataDir, commitlog.Config{})
+        if err != nil {
+            fmt.Println("Failed to open log:", err)
+            os.Exit(1)
+        }
+        log = fileLog
     }
-    return c.records[offset], true
-}
-
-func main() {
-    log := &CommitLog{}
 
     // Produce endpoint
     http.HandleFunc("/produce", func(w http.ResponseWriter, r *http.Request) {
@@ -61,7 +43,16 @@ func main() {
             return
         }
 
-        record := log.Produce(req.Value)
+        offset, err := log.Append(commitlog.Record{Value: req.Value})
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        record, err := log.Read(offset)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(record)
     })
@@ -85,11 +76,16 @@ func main() {
             return
         }
 
-        record, ok := log.Consume(offset)
-        if !ok {
+        record, err := log.Read(offset)
+        var oor *commitlog.ErrOffsetOutOfRange
+        if errors.As(err, &oor) {
             http.Error(w, "Offset not found", http.StatusNotFound)
             return
         }
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
 
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(record)
@@ -102,11 +98,14 @@ func main() {
             return
         }
 
-        log.mu.Lock()
-        defer log.mu.Unlock()
+        records, err := commitlog.List(log)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
 
         w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(log.records)
+        json.NewEncoder(w).Encode(records)
     })
 
     fmt.Println("Commit log server running at http://localhost:8080")
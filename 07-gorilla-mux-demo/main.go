@@ -2,57 +2,47 @@ package main
 
 import (
     "encoding/json"
+    "errors"
+    "flag"
     "fmt"
     "net/http"
+    "os"
     "strconv"
-    "sync"
 
+    "github.com/Ramykaz/Distributed-Systems-/commitlog"
     "github.com/gorilla/mux"
 )
 
-// Record represents a log entry
-type Record struct {
-    Offset int    `json:"offset"`
-    Value  string `json:"value"`
-}
-
-// CommitLog with mutex for thread-safe access
-type CommitLog struct {
-    mu      sync.Mutex
-    records []Record
-}
-
-// Produce adds a record safely
-func (c *CommitLog) Produce(value string) Record {
-    c.mu.Lock()
-    defer c.mu.Unlock()
-    record := Record{
-        Offset: len(c.records),
-        Value:  value,
+// writeRecord looks up offset and writes it as JSON
+func writeRecord(w http.ResponseWriter, log commitlog.Log, offset int) {
+    record, err := log.Read(offset)
+    var oor *commitlog.ErrOffsetOutOfRange
+    if errors.As(err, &oor) {
+        http.Error(w, "Offset not found", http.StatusNotFound)
+        return
     }
-    c.records = append(c.records, record)
-    return record
-}
-
-// Consume by offset safely
-func (c *CommitLog) Consume(offset int) (Record, bool) {
-    c.mu.Lock()
-    defer c.mu.Unlock()
-    if offset < 0 || offset >= len(c.records) {
-        return Record{}, false
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
     }
-    return c.records[offset], true
-}
-
-// List all records
-func (c *CommitLog) List() []Record {
-    c.mu.Lock()
-    defer c.mu.Unlock()
-    return c.records
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(record)
 }
 
 func main() {
-    log := &CommitLog{}
+    dataDir := flag.String("data", "", "directory to store the log in (in-memory if empty)")
+    flag.Parse()
+
+    // Pick a storage backend
+    var log commitlog.Log = commitlog.NewMemoryLog()
+    if *dataDir != "" {
+        fileLog, err := commitlog.OpenFileLog(*dataDir, commitlog.Config{})
+        if err != nil {
+            fmt.Println("Failed to open log:", err)
+            os.Exit(1)
+        }
+        log = fileLog
+    }
     r := mux.NewRouter()
 
     // POST /produce
@@ -64,9 +54,12 @@ func main() {
             http.Error(w, err.Error(), http.StatusBadRequest)
             return
         }
-        record := log.Produce(req.Value)
-        w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(record)
+        offset, err := log.Append(commitlog.Record{Value: req.Value})
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        writeRecord(w, log, offset)
     }).Methods("POST")
 
     // GET /consume?offset=0
@@ -81,13 +74,7 @@ func main() {
             http.Error(w, "Invalid offset", http.StatusBadRequest)
             return
         }
-        record, ok := log.Consume(offset)
-        if !ok {
-            http.Error(w, "Offset not found", http.StatusNotFound)
-            return
-        }
-        w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(record)
+        writeRecord(w, log, offset)
     }).Methods("GET")
 
     // GET /consume/{offset} (URL parameter)
@@ -99,19 +86,18 @@ func main() {
             http.Error(w, "Invalid offset", http.StatusBadRequest)
             return
         }
-        record, ok := log.Consume(offset)
-        if !ok {
-            http.Error(w, "Offset not found", http.StatusNotFound)
-            return
-        }
-        w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(record)
+        writeRecord(w, log, offset)
     }).Methods("GET")
 
     // GET /records
     r.HandleFunc("/records", func(w http.ResponseWriter, r *http.Request) {
+        records, err := commitlog.List(log)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
         w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(log.List())
+        json.NewEncoder(w).Encode(records)
     }).Methods("GET")
 
     fmt.Println("Lesson 7 Gorilla Mux server running at http://localhost:8080")
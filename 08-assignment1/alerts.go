@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// duration is a time.Duration written as a string such as "5m" in JSON.
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// lagRule fires an alert for a partition whose consumer lag stays over
+// its thresholds for For.
+type lagRule struct {
+	Name string `json:"name"`
+	// Group is a path.Match pattern of the groups the rule watches;
+	// every group if empty.
+	Group string `json:"group,omitempty"`
+	// MaxRecords and MaxLag are the thresholds; a partition over either
+	// is lagging. Zero disables a threshold.
+	MaxRecords int      `json:"max_records,omitempty"`
+	MaxLag     duration `json:"max_lag,omitempty"`
+	For        duration `json:"for,omitempty"`
+	// Webhook receives a JSON lagAlert when the alert fires and when it
+	// resolves.
+	Webhook string `json:"webhook"`
+}
+
+func (r lagRule) matches(group string) bool {
+	if r.Group == "" {
+		return true
+	}
+	ok, _ := path.Match(r.Group, group)
+	return ok
+}
+
+func (r lagRule) lagging(pl partitionLag) bool {
+	return r.MaxRecords > 0 && pl.Lag > r.MaxRecords ||
+		r.MaxLag > 0 && pl.LagSeconds > time.Duration(r.MaxLag).Seconds()
+}
+
+// loadLagRules reads a JSON array of rules.
+func loadLagRules(file string) ([]lagRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []lagRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	names := make(map[string]bool)
+	for i, r := range rules {
+		switch {
+		case r.Name == "":
+			return nil, fmt.Errorf("%s: rule %d has no name", file, i)
+		case names[r.Name]:
+			return nil, fmt.Errorf("%s: rule %s appears twice", file, r.Name)
+		case r.Webhook == "":
+			return nil, fmt.Errorf("%s: rule %s has no webhook", file, r.Name)
+		case r.MaxRecords <= 0 && r.MaxLag <= 0:
+			return nil, fmt.Errorf("%s: rule %s has neither max_records nor max_lag", file, r.Name)
+		}
+		if _, err := path.Match(r.Group, ""); err != nil {
+			return nil, fmt.Errorf("%s: rule %s: %w", file, r.Name, err)
+		}
+		names[r.Name] = true
+	}
+	return rules, nil
+}
+
+// lagAlert is the body POSTed to a rule's webhook.
+type lagAlert struct {
+	Status     string    `json:"status"` // "firing" or "resolved"
+	Rule       string    `json:"rule"`
+	Group      string    `json:"group"`
+	Topic      string    `json:"topic"`
+	Partition  int       `json:"partition"`
+	Lag        int       `json:"lag"`
+	LagSeconds float64   `json:"lag_seconds"`
+	MaxRecords int       `json:"max_records,omitempty"`
+	MaxLag     duration  `json:"max_lag,omitempty"`
+	Since      time.Time `json:"since"`
+	At         time.Time `json:"at"`
+}
+
+var (
+	lagAlertsFiring = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "commitlog_lag_alerts_firing",
+		Help: "1 for each partition a lag alert rule is currently firing for.",
+	}, []string{"rule", "group", "topic", "partition"})
+
+	lagAlertsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "commitlog_lag_alert_notifications_total",
+		Help: "Lag alert webhook notifications, by rule, status and result.",
+	}, []string{"rule", "status", "result"})
+)
+
+type alertKey struct {
+	rule      string
+	group     string
+	topic     string
+	partition int
+}
+
+// alertState tracks a partition that is over a rule's thresholds.
+type alertState struct {
+	since  time.Time
+	firing bool
+}
+
+type notification struct {
+	rule  lagRule
+	alert lagAlert
+}
+
+// lagAlerter checks every group's lag against the rules on an interval.
+// Notifications are sent one at a time, in order, so a partition's
+// resolved alert never arrives before its firing one.
+type lagAlerter struct {
+	rules  []lagRule
+	client *http.Client
+	states map[alertKey]*alertState
+	queue  chan notification
+}
+
+func newLagAlerter(rules []lagRule) *lagAlerter {
+	return &lagAlerter{
+		rules:  rules,
+		client: &http.Client{Timeout: 10 * time.Second},
+		states: make(map[alertKey]*alertState),
+		queue:  make(chan notification, 256),
+	}
+}
+
+func (a *lagAlerter) run(interval time.Duration) {
+	go func() {
+		for n := range a.queue {
+			a.notify(n.rule, n.alert)
+		}
+	}()
+	for range time.Tick(interval) {
+		a.check(time.Now())
+	}
+}
+
+func (a *lagAlerter) send(rule lagRule, alert lagAlert) {
+	select {
+	case a.queue <- notification{rule, alert}:
+	default:
+		lagAlertsSent.WithLabelValues(rule.Name, alert.Status, "dropped").Inc()
+		log.Printf("lag alert %s %s for %s %s-%d: queue full, dropped", rule.Name, alert.Status, alert.Group, alert.Topic, alert.Partition)
+	}
+}
+
+// check fires alerts for partitions that have lagged for their rule's
+// For, and resolves those no longer lagging.
+func (a *lagAlerter) check(now time.Time) {
+	seen := make(map[alertKey]bool)
+	for _, group := range groups.list() {
+		lags, err := groupLag(group, now)
+		if err != nil {
+			continue
+		}
+		for _, rule := range a.rules {
+			if !rule.matches(group) {
+				continue
+			}
+			for _, pl := range lags {
+				if !rule.lagging(pl) {
+					continue
+				}
+				k := alertKey{rule.Name, group, pl.Topic, pl.Partition}
+				seen[k] = true
+				st := a.states[k]
+				if st == nil {
+					st = &alertState{since: now}
+					a.states[k] = st
+				}
+				if !st.firing && now.Sub(st.since) >= time.Duration(rule.For) {
+					st.firing = true
+					lagAlertsFiring.WithLabelValues(k.labels()...).Set(1)
+					a.send(rule, a.alert("firing", rule, k, pl, st, now))
+				}
+			}
+		}
+	}
+	// Partitions no longer lagging, or whose group or topic is gone.
+	for k, st := range a.states {
+		if seen[k] {
+			continue
+		}
+		delete(a.states, k)
+		if !st.firing {
+			continue
+		}
+		lagAlertsFiring.DeleteLabelValues(k.labels()...)
+		pl := partitionLag{Topic: k.topic, Partition: k.partition}
+		if lags, err := groupLag(k.group, now); err == nil {
+			for _, l := range lags {
+				if l.Topic == k.topic && l.Partition == k.partition {
+					pl = l
+				}
+			}
+		}
+		rule := a.rule(k.rule)
+		a.send(rule, a.alert("resolved", rule, k, pl, st, now))
+	}
+}
+
+func (a *lagAlerter) rule(name string) lagRule {
+	for _, r := range a.rules {
+		if r.Name == name {
+			return r
+		}
+	}
+	return lagRule{}
+}
+
+func (a *lagAlerter) alert(status string, rule lagRule, k alertKey, pl partitionLag, st *alertState, now time.Time) lagAlert {
+	return lagAlert{
+		Status:     status,
+		Rule:       rule.Name,
+		Group:      k.group,
+		Topic:      k.topic,
+		Partition:  k.partition,
+		Lag:        pl.Lag,
+		LagSeconds: pl.LagSeconds,
+		MaxRecords: rule.MaxRecords,
+		MaxLag:     rule.MaxLag,
+		Since:      st.since.UTC(),
+		At:         now.UTC(),
+	}
+}
+
+func (k alertKey) labels() []string {
+	return []string{k.rule, k.group, k.topic, strconv.Itoa(k.partition)}
+}
+
+// notify POSTs alert to the rule's webhook, retrying with backoff.
+func (a *lagAlerter) notify(rule lagRule, alert lagAlert) {
+	body, _ := json.Marshal(alert)
+	backoff := time.Second
+	var err error
+	for attempt := 0; attempt < 4; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = a.post(rule.Webhook, body); err == nil {
+			lagAlertsSent.WithLabelValues(rule.Name, alert.Status, "ok").Inc()
+			return
+		}
+	}
+	lagAlertsSent.WithLabelValues(rule.Name, alert.Status, "failed").Inc()
+	log.Printf("lag alert %s %s for %s %s-%d: %v", rule.Name, alert.Status, alert.Group, alert.Topic, alert.Partition, err)
+}
+
+func (a *lagAlerter) post(url string, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
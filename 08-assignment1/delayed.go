@@ -0,0 +1,261 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// delayedDir holds the log of scheduled records in the data directory.
+const delayedDir = "delayed"
+
+// Keys of the entries in the delayed log. A scheduled entry holds a
+// scheduledRecord; a delivered entry holds the offset of the scheduled
+// entry it settles.
+const (
+	delayedScheduled = "scheduled"
+	delayedDelivered = "delivered"
+)
+
+const (
+	// delayedRetry is how long delivery waits after failing to append.
+	delayedRetry = time.Second
+	// delayedCompactInterval is how often settled entries are dropped
+	// from the front of the delayed log.
+	delayedCompactInterval = time.Minute
+)
+
+var delayedPending = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "commitlog_delayed_records",
+	Help: "Records scheduled for later delivery that are not yet due.",
+})
+
+// scheduledRecord is a record held back until DeliverAt.
+type scheduledRecord struct {
+	Topic     string           `json:"topic"`
+	Partition int              `json:"partition"`
+	Record    commitlog.Record `json:"record"`
+	DeliverAt time.Time        `json:"deliver_at"`
+}
+
+// dueRecord is a pending scheduledRecord and the offset of its entry in
+// the delayed log.
+type dueRecord struct {
+	id int
+	scheduledRecord
+}
+
+// dueHeap orders pending records by due time, then by when they were
+// scheduled.
+type dueHeap []dueRecord
+
+func (h dueHeap) Len() int { return len(h) }
+func (h dueHeap) Less(i, j int) bool {
+	if !h[i].DeliverAt.Equal(h[j].DeliverAt) {
+		return h[i].DeliverAt.Before(h[j].DeliverAt)
+	}
+	return h[i].id < h[j].id
+}
+func (h dueHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *dueHeap) Push(x any)   { *h = append(*h, x.(dueRecord)) }
+func (h *dueHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// delayedQueue holds records produced with a deliver_at time and appends
+// each to its partition once it is due, in order of due time. Until then
+// consumers can't see them. Scheduled records are kept in their own log,
+// so they survive restarts; a record is marked delivered only after it
+// is appended, so a crash in between delivers it twice.
+type delayedQueue struct {
+	log  commitlog.Log
+	wake chan struct{}
+
+	mu      sync.Mutex
+	pending dueHeap
+}
+
+var delayed *delayedQueue
+
+// openDelayed opens the delayed log, in memory without a data directory,
+// and starts delivering the records it holds.
+func openDelayed(dir string) (*delayedQueue, error) {
+	q := &delayedQueue{wake: make(chan struct{}, 1)}
+	if dir == "" {
+		q.log = commitlog.NewMemoryLog()
+	} else {
+		l, err := commitlog.OpenFileLog(filepath.Join(dir, delayedDir), commitlog.Config{Sync: topics.cfg.Sync})
+		if err != nil {
+			return nil, err
+		}
+		q.log = l
+	}
+	if err := q.replay(); err != nil {
+		q.log.Close()
+		return nil, fmt.Errorf("delayed records: %w", err)
+	}
+	go q.run()
+	return q, nil
+}
+
+// replay rebuilds the pending records from the delayed log.
+func (q *delayedQueue) replay() error {
+	recs, err := commitlog.List(q.log)
+	if err != nil {
+		return err
+	}
+	pending := make(map[int]scheduledRecord)
+	for _, rec := range recs {
+		switch rec.Key {
+		case delayedScheduled:
+			var s scheduledRecord
+			if err := json.Unmarshal([]byte(rec.Value), &s); err != nil {
+				return fmt.Errorf("entry %d: %w", rec.Offset, err)
+			}
+			pending[rec.Offset] = s
+		case delayedDelivered:
+			id, err := strconv.Atoi(rec.Value)
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", rec.Offset, err)
+			}
+			delete(pending, id)
+		}
+	}
+	for id, s := range pending {
+		q.pending = append(q.pending, dueRecord{id, s})
+	}
+	heap.Init(&q.pending)
+	delayedPending.Set(float64(len(q.pending)))
+	return nil
+}
+
+// schedule stores recs, all due at the same time, for later delivery.
+func (q *delayedQueue) schedule(recs []scheduledRecord) error {
+	entries := make([]commitlog.Record, len(recs))
+	for i, s := range recs {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		entries[i] = commitlog.Record{Key: delayedScheduled, Value: string(data)}
+	}
+	// Holding mu across the append keeps compact from dropping the
+	// entries before they are pending.
+	q.mu.Lock()
+	ids, err := commitlog.AppendBatch(q.log, entries)
+	for i, id := range ids {
+		heap.Push(&q.pending, dueRecord{id, recs[i]})
+	}
+	delayedPending.Set(float64(len(q.pending)))
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+// run delivers records as they fall due.
+func (q *delayedQueue) run() {
+	compact := time.NewTicker(delayedCompactInterval)
+	defer compact.Stop()
+	for {
+		select {
+		case <-compact.C:
+			q.compact()
+		default:
+		}
+		q.mu.Lock()
+		var next dueRecord
+		due, wait := false, time.Duration(0)
+		if len(q.pending) > 0 {
+			wait = time.Until(q.pending[0].DeliverAt)
+			if due = wait <= 0; due {
+				next = heap.Pop(&q.pending).(dueRecord)
+			}
+		}
+		q.mu.Unlock()
+
+		if !due {
+			var timer *time.Timer
+			var fire <-chan time.Time
+			if wait > 0 {
+				timer = time.NewTimer(wait)
+				fire = timer.C
+			}
+			select {
+			case <-q.wake:
+			case <-fire:
+			case <-compact.C:
+				q.compact()
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			continue
+		}
+		err := q.deliver(next)
+		q.mu.Lock()
+		if err != nil {
+			heap.Push(&q.pending, next)
+		}
+		delayedPending.Set(float64(len(q.pending)))
+		q.mu.Unlock()
+		if err != nil {
+			log.Printf("delayed records: delivering to %s/%d: %v", next.Topic, next.Partition, err)
+			time.Sleep(delayedRetry)
+		}
+	}
+}
+
+// deliver appends a due record to its partition and marks it delivered.
+// A record whose topic or partition no longer exists is dropped.
+func (q *delayedQueue) deliver(d dueRecord) error {
+	l, err := topics.partition(d.Topic, d.Partition)
+	switch {
+	case errors.Is(err, errTopicNotFound) || errors.Is(err, errPartitionNotFound):
+		log.Printf("delayed records: dropping record for %s/%d: %v", d.Topic, d.Partition, err)
+	case err != nil:
+		return err
+	default:
+		// The record is stamped with when it is delivered, so
+		// timestamps keep following offsets.
+		rec := d.Record
+		rec.Timestamp = time.Time{}
+		if _, err := l.Append(rec); err != nil {
+			return err
+		}
+		recordsAppended.WithLabelValues(d.Topic).Inc()
+		bytesAppended.WithLabelValues(d.Topic).Add(float64(len(rec.Key) + len(rec.Value)))
+	}
+	if _, err := q.log.Append(commitlog.Record{Key: delayedDelivered, Value: strconv.Itoa(d.id)}); err != nil {
+		log.Printf("delayed records: marking entry %d delivered: %v", d.id, err)
+	}
+	return nil
+}
+
+// compact drops the entries before the oldest pending record.
+func (q *delayedQueue) compact() {
+	q.mu.Lock()
+	keep := q.log.EndOffset()
+	for _, d := range q.pending {
+		keep = min(keep, d.id)
+	}
+	q.mu.Unlock()
+	if err := q.log.DeleteBefore(keep); err != nil {
+		log.Printf("delayed records: compacting: %v", err)
+	}
+}
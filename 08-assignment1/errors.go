@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// Error codes for request problems; log errors use the codes from
+// commitlog.ErrorCode.
+const (
+	CodeBadRequest        = "bad_request"
+	CodeInvalidOffset     = "invalid_offset"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeTopicNotFound     = "topic_not_found"
+	CodeTopicExists       = "topic_exists"
+	CodeInvalidTopic      = "invalid_topic"
+	CodePartitionNotFound = "partition_not_found"
+	CodeGroupNotFound     = "group_not_found"
+
+	CodeSubscriptionNotFound = "subscription_not_found"
+	CodeInvalidSubscription  = "invalid_subscription"
+
+	CodeSearchDisabled = "search_disabled"
+	CodeInvalidQuery   = "invalid_query"
+)
+
+// serverErrors maps the server's own errors to a status and code.
+var serverErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{errTopicNotFound, http.StatusNotFound, CodeTopicNotFound},
+	{errTopicExists, http.StatusConflict, CodeTopicExists},
+	{errInvalidTopic, http.StatusBadRequest, CodeInvalidTopic},
+	{errPartitionNotFound, http.StatusNotFound, CodePartitionNotFound},
+	{errInvalidPartition, http.StatusBadRequest, CodeBadRequest},
+	{errGroupNotFound, http.StatusNotFound, CodeGroupNotFound},
+	{errSubscriptionNotFound, http.StatusNotFound, CodeSubscriptionNotFound},
+	{errInvalidSubscription, http.StatusBadRequest, CodeInvalidSubscription},
+	{errSearchDisabled, http.StatusNotFound, CodeSearchDisabled},
+	{errInvalidQuery, http.StatusBadRequest, CodeInvalidQuery},
+}
+
+// apiError is the body of every error response:
+//
+//	{"error": {"code": "offset_out_of_range", "message": "...", ...}}
+type apiError struct {
+	Code        string `json:"code"`
+	Message     string `json:"message"`
+	Offset      *int   `json:"offset,omitempty"`
+	StartOffset *int   `json:"start_offset,omitempty"`
+	EndOffset   *int   `json:"end_offset,omitempty"`
+}
+
+// writeError writes a log error in the JSON error envelope, choosing the
+// status from its code.
+func writeError(w http.ResponseWriter, err error) {
+	status, body := toAPIError(err)
+	writeErrorBody(w, status, body)
+}
+
+// toAPIError returns the status and body of the response to err.
+func toAPIError(err error) (int, apiError) {
+	for _, se := range serverErrors {
+		if errors.Is(err, se.err) {
+			return se.status, apiError{Code: se.code, Message: err.Error()}
+		}
+	}
+	body := apiError{Code: commitlog.ErrorCode(err), Message: err.Error()}
+	status := http.StatusInternalServerError
+	switch body.Code {
+	case commitlog.CodeOffsetOutOfRange:
+		status = http.StatusNotFound
+	case commitlog.CodeTruncated:
+		status = http.StatusGone
+	case commitlog.CodeClosed:
+		status = http.StatusServiceUnavailable
+	}
+	var oor *commitlog.ErrOffsetOutOfRange
+	if errors.As(err, &oor) {
+		body.Offset, body.StartOffset, body.EndOffset = &oor.Offset, &oor.Start, &oor.End
+	}
+	return status, body
+}
+
+// writeErrorCode writes a JSON error that has no underlying Go error.
+func writeErrorCode(w http.ResponseWriter, status int, code, message string) {
+	writeErrorBody(w, status, apiError{Code: code, Message: message})
+}
+
+func writeErrorBody(w http.ResponseWriter, status int, body apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorEnvelope{body})
+}
+
+// errorEnvelope wraps an apiError as it is sent.
+type errorEnvelope struct {
+	Error apiError `json:"error"`
+}
+
+func methodNotAllowed(w http.ResponseWriter) {
+	writeErrorCode(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+		// wantRange is offset, start and end for offset errors.
+		wantRange []int
+	}{
+		{fmt.Errorf("%w: orders", errTopicNotFound), http.StatusNotFound, CodeTopicNotFound, nil},
+		{fmt.Errorf("%w: orders", errTopicExists), http.StatusConflict, CodeTopicExists, nil},
+		{errInvalidPartition, http.StatusBadRequest, CodeBadRequest, nil},
+		{fmt.Errorf("%w: orders/3", errPartitionNotFound), http.StatusNotFound, CodePartitionNotFound, nil},
+		{errGroupNotFound, http.StatusNotFound, CodeGroupNotFound, nil},
+		{errSubscriptionNotFound, http.StatusNotFound, CodeSubscriptionNotFound, nil},
+		{&commitlog.ErrOffsetOutOfRange{Offset: 9, Start: 2, End: 5}, http.StatusNotFound, commitlog.CodeOffsetOutOfRange, []int{9, 2, 5}},
+		{&commitlog.ErrOffsetOutOfRange{Offset: 1, Start: 2, End: 5}, http.StatusGone, commitlog.CodeTruncated, []int{1, 2, 5}},
+		{fmt.Errorf("reading: %w", &commitlog.ErrOffsetOutOfRange{Offset: 5, Start: 0, End: 5}), http.StatusNotFound, commitlog.CodeOffsetOutOfRange, []int{5, 0, 5}},
+		{fmt.Errorf("reading: %w", commitlog.ErrTruncated), http.StatusGone, commitlog.CodeTruncated, nil},
+		{commitlog.ErrClosed, http.StatusServiceUnavailable, commitlog.CodeClosed, nil},
+		{commitlog.ErrCorrupt, http.StatusInternalServerError, commitlog.CodeCorrupt, nil},
+		{errors.New("disk on fire"), http.StatusInternalServerError, commitlog.CodeInternal, nil},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		writeError(w, tt.err)
+		e := errorBody(t, w, tt.wantStatus)
+		if e.Code != tt.wantCode || e.Message != tt.err.Error() {
+			t.Errorf("writeError(%v) = %+v, want code %s", tt.err, e, tt.wantCode)
+		}
+		if tt.wantRange == nil {
+			if e.Offset != nil || e.StartOffset != nil || e.EndOffset != nil {
+				t.Errorf("writeError(%v) has offset fields: %s", tt.err, w.Body)
+			}
+			continue
+		}
+		if e.Offset == nil || e.StartOffset == nil || e.EndOffset == nil {
+			t.Errorf("writeError(%v) is missing offset fields: %s", tt.err, w.Body)
+			continue
+		}
+		if got := []int{*e.Offset, *e.StartOffset, *e.EndOffset}; fmt.Sprint(got) != fmt.Sprint(tt.wantRange) {
+			t.Errorf("writeError(%v) offset, start, end = %v, want %v", tt.err, got, tt.wantRange)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// groupsFile records committed consumer group offsets in the data
+// directory.
+const groupsFile = "groups.json"
+
+var errGroupNotFound = errors.New("group not found")
+
+// committedOffset is the position a consumer group has committed for one
+// partition: the next offset it will read.
+type committedOffset struct {
+	Topic       string    `json:"topic"`
+	Partition   int       `json:"partition"`
+	Offset      int       `json:"offset"`
+	Metadata    string    `json:"metadata,omitempty"`
+	CommittedAt time.Time `json:"committed_at"`
+}
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+// groupStore holds committed offsets for every consumer group, saving
+// them to groupsFile after each change when the server has a data
+// directory.
+type groupStore struct {
+	path string
+
+	mu     sync.Mutex
+	groups map[string]map[partitionKey]committedOffset
+}
+
+func openGroups(dir string) (*groupStore, error) {
+	s := &groupStore{groups: make(map[string]map[partitionKey]committedOffset)}
+	if dir == "" {
+		return s, nil
+	}
+	s.path = filepath.Join(dir, groupsFile)
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved map[string][]committedOffset
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("%s: %w", groupsFile, err)
+	}
+	for group, offsets := range saved {
+		s.groups[group] = make(map[partitionKey]committedOffset)
+		for _, c := range offsets {
+			s.groups[group][partitionKey{c.Topic, c.Partition}] = c
+		}
+	}
+	return s, nil
+}
+
+// save writes groups to disk. Changes are made to a copy of s.groups
+// that replaces it once saved, so a failed save leaves s.groups as it is
+// on disk. s.mu must be held.
+func (s *groupStore) save(groups map[string]map[partitionKey]committedOffset) error {
+	if s.path == "" {
+		return nil
+	}
+	saved := make(map[string][]committedOffset, len(groups))
+	for group, offsets := range groups {
+		saved[group] = sortedOffsets(offsets)
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return commitlog.WriteFileAtomic(s.path, data)
+}
+
+// sortedOffsets returns a group's offsets ordered by topic and partition.
+func sortedOffsets(group map[partitionKey]committedOffset) []committedOffset {
+	offsets := make([]committedOffset, 0, len(group))
+	for _, c := range group {
+		offsets = append(offsets, c)
+	}
+	sort.Slice(offsets, func(i, j int) bool {
+		if offsets[i].Topic != offsets[j].Topic {
+			return offsets[i].Topic < offsets[j].Topic
+		}
+		return offsets[i].Partition < offsets[j].Partition
+	})
+	return offsets
+}
+
+func (s *groupStore) commit(group string, c committedOffset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offsets := maps.Clone(s.groups[group])
+	if offsets == nil {
+		offsets = make(map[partitionKey]committedOffset)
+	}
+	offsets[partitionKey{c.Topic, c.Partition}] = c
+	next := maps.Clone(s.groups)
+	next[group] = offsets
+	if err := s.save(next); err != nil {
+		return err
+	}
+	s.groups = next
+	return nil
+}
+
+func (s *groupStore) offsets(group string) ([]committedOffset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[group]; !ok {
+		return nil, fmt.Errorf("%w: %s", errGroupNotFound, group)
+	}
+	return sortedOffsets(s.groups[group]), nil
+}
+
+func (s *groupStore) list() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.groups))
+	for group := range s.groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// forgetTopic drops offsets committed for a deleted topic, and any group
+// left with none.
+func (s *groupStore) forgetTopic(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := make(map[string]map[partitionKey]committedOffset, len(s.groups))
+	for group, offsets := range s.groups {
+		kept := make(map[partitionKey]committedOffset, len(offsets))
+		for k, c := range offsets {
+			if k.topic != name {
+				kept[k] = c
+			}
+		}
+		if len(kept) > 0 {
+			next[group] = kept
+		}
+	}
+	if err := s.save(next); err != nil {
+		return err
+	}
+	s.groups = next
+	return nil
+}
+
+var groups *groupStore
+
+func handleGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"groups": groups.list()})
+}
+
+// groupPartition is a committed offset alongside the partition's current
+// end offset.
+type groupPartition struct {
+	committedOffset
+	EndOffset int `json:"end_offset"`
+}
+
+// handleGroup describes a group: its committed offset for each partition
+// and where that partition currently ends.
+func handleGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	group := r.PathValue("group")
+	offsets, err := groups.offsets(group)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	res := struct {
+		Group      string           `json:"group"`
+		Partitions []groupPartition `json:"partitions"`
+	}{Group: group, Partitions: []groupPartition{}}
+	for _, c := range offsets {
+		gp := groupPartition{committedOffset: c}
+		if l, err := topics.partition(c.Topic, c.Partition); err == nil {
+			gp.EndOffset = l.EndOffset()
+		}
+		res.Partitions = append(res.Partitions, gp)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// handleCommitOffset records {"topic", "partition", "offset", "metadata"}
+// as the group's position in that partition.
+func handleCommitOffset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	var c committedOffset
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+	if c.Topic == "" {
+		c.Topic = defaultTopic
+	}
+	l, err := topics.partition(c.Topic, c.Partition)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// A group may commit the end offset: it has read everything so far.
+	if c.Offset < 0 || c.Offset > l.EndOffset() {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidOffset, "Invalid offset")
+		return
+	}
+	c.CommittedAt = time.Now().UTC()
+	if err := groups.commit(r.PathValue("group"), c); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupStoreCommitSaves(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openGroups(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.commit("g", committedOffset{Topic: "a", Offset: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.commit("g", committedOffset{Topic: "b", Offset: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openGroups(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offsets, err := reopened.offsets("g")
+	if err != nil || len(offsets) != 2 || offsets[0].Offset != 3 || offsets[1].Offset != 5 {
+		t.Fatalf("offsets after reopening = %+v, %v", offsets, err)
+	}
+
+	if err := reopened.forgetTopic("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.forgetTopic("b"); err != nil {
+		t.Fatal(err)
+	}
+	if groups := reopened.list(); len(groups) != 0 {
+		t.Fatalf("groups after forgetting their topics = %v", groups)
+	}
+}
+
+// A commit or forgetTopic that fails to save must leave the offsets as
+// they were, so reads don't show what the caller was told failed.
+func TestGroupStoreFailedSave(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openGroups(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.commit("g", committedOffset{Topic: "a", Offset: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.path = filepath.Join(dir, "missing", groupsFile)
+	if err := s.commit("g", committedOffset{Topic: "a", Offset: 7}); err == nil {
+		t.Fatal("commit succeeded without saving")
+	}
+	if err := s.commit("h", committedOffset{Topic: "a", Offset: 1}); err == nil {
+		t.Fatal("commit to a new group succeeded without saving")
+	}
+	if err := s.forgetTopic("a"); err == nil {
+		t.Fatal("forgetTopic succeeded without saving")
+	}
+	offsets, err := s.offsets("g")
+	if err != nil || len(offsets) != 1 || offsets[0].Offset != 3 {
+		t.Fatalf("offsets after failed saves = %+v, %v", offsets, err)
+	}
+	if groups := s.list(); len(groups) != 1 {
+		t.Fatalf("groups after failed saves = %v", groups)
+	}
+	if _, err := os.Stat(s.path); err == nil {
+		t.Fatal("failed save left a file")
+	}
+}
+
+func TestCommitOffset(t *testing.T) {
+	setup(t)
+	produce(t, "a", "b", "c")
+
+	tests := []struct {
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{`{"offset": 2}`, http.StatusOK, ""},
+		// A group that has read everything commits the end offset.
+		{`{"offset": 3}`, http.StatusOK, ""},
+		{`{"offset": 4}`, http.StatusBadRequest, CodeInvalidOffset},
+		{`{"offset": -1}`, http.StatusBadRequest, CodeInvalidOffset},
+		{`{"topic": "missing", "offset": 0}`, http.StatusNotFound, CodeTopicNotFound},
+		{`{"partition": 1, "offset": 0}`, http.StatusNotFound, CodePartitionNotFound},
+	}
+	for _, tt := range tests {
+		w := serve(handleCommitOffset, http.MethodPost, "/groups/g/offsets", tt.body, "group", "g")
+		if tt.wantCode == "" {
+			var c committedOffset
+			decode(t, w, tt.wantStatus, &c)
+			continue
+		}
+		if e := errorBody(t, w, tt.wantStatus); e.Code != tt.wantCode {
+			t.Errorf("commit %s = %+v, want %s", tt.body, e, tt.wantCode)
+		}
+	}
+	// Only the accepted commits count.
+	offsets, err := groups.offsets("g")
+	if err != nil || len(offsets) != 1 || offsets[0].Offset != 3 {
+		t.Fatalf("offsets = %+v, %v, want 3", offsets, err)
+	}
+}
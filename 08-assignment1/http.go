@@ -1,118 +1,576 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
-	"sync"
+	"strings"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/frametcp"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/kafka"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/objstore"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-type Record struct {
-	Value  string `json:"value"`
-	Offset int    `json:"offset"`
-}
+// topics holds the logs the server serves. Requests choose one with the
+// topic and partition query parameters; without them they use partition
+// 0 of the default topic, as before topics existed.
+var topics *registry
 
-type CommitLog struct {
-	mu      sync.RWMutex
-	records []Record
-}
+var errInvalidPartition = errors.New("Invalid partition")
 
-func (c *CommitLog) Append(record Record) (int, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	record.Offset = len(c.records)
-	c.records = append(c.records, record)
-	return record.Offset, nil
+// requestTopic returns the topic named by ?topic=, or the default topic.
+func requestTopic(r *http.Request) (*topic, error) {
+	return topics.get(r.URL.Query().Get("topic"))
 }
 
-func (c *CommitLog) Read(offset int) (Record, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	if offset < 0 || offset >= len(c.records) {
-		return Record{}, http.ErrNoLocation
+// requestPartition parses ?partition=; ok is false when it is absent.
+func requestPartition(r *http.Request) (p int, ok bool, err error) {
+	s := r.URL.Query().Get("partition")
+	if s == "" {
+		return 0, false, nil
 	}
-	return c.records[offset], nil
-}
-
-func (c *CommitLog) List() []Record {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return append([]Record{}, c.records...) // Return copy
+	p, err = strconv.Atoi(s)
+	if err != nil {
+		return 0, false, errInvalidPartition
+	}
+	return p, true, nil
 }
 
-func (c *CommitLog) Clear() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.records = []Record{}
+// requestLog returns the partition log a read or admin request is for.
+func requestLog(r *http.Request) (*commitlog.Tailable, error) {
+	p, _, err := requestPartition(r)
+	if err != nil {
+		return nil, err
+	}
+	return topics.partition(r.URL.Query().Get("topic"), p)
 }
 
-var commitLog = &CommitLog{}
+// maxWait caps how long a consume request may long-poll.
+const maxWait = 30 * time.Second
 
+// handleProduce appends {"record": {...}} and returns its partition and
+// offset. With a future "deliver_at" the record is held back until then
+// and only its partition is returned, with 202 Accepted.
 func handleProduce(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Record Record `json:"record"`
+		Record    commitlog.Record `json:"record"`
+		DeliverAt time.Time        `json:"deliver_at"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeErrorCode(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+	t, err := requestTopic(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	p, ok, err := requestPartition(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !ok {
+		p = t.partitionFor(req.Record.Key)
+	}
+	l, err := topics.partition(t.name, p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.DeliverAt.After(time.Now()) {
+		s := scheduledRecord{Topic: t.name, Partition: p, Record: req.Record, DeliverAt: req.DeliverAt}
+		if err := delayed.schedule([]scheduledRecord{s}); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeScheduled(w, struct {
+			Partition int       `json:"partition"`
+			DeliverAt time.Time `json:"deliver_at"`
+		}{p, req.DeliverAt})
+		return
+	}
+	offset, err := l.Append(req.Record)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	recordsAppended.WithLabelValues(t.name).Inc()
+	bytesAppended.WithLabelValues(t.name).Add(float64(len(req.Record.Key) + len(req.Record.Value)))
+	res := struct {
+		Partition int `json:"partition"`
+		Offset    int `json:"offset"`
+	}{Partition: p, Offset: offset}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// handleProduceBatch appends {"records": [...]} and returns their
+// partitions and offsets. Records keep their order within a partition;
+// without ?partition= each is placed by its key like a single produce.
+// A future "deliver_at" holds them all back until then, as for a single
+// produce.
+func handleProduceBatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Records   []commitlog.Record `json:"records"`
+		DeliverAt time.Time          `json:"deliver_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+	t, err := requestTopic(r)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
-	offset, _ := commitLog.Append(req.Record)
+	p, ok, err := requestPartition(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	partitions := make([]int, len(req.Records))
+	byPartition := map[int][]int{} // partition -> indexes into req.Records
+	var order []int
+	for i, rec := range req.Records {
+		partitions[i] = p
+		if !ok {
+			partitions[i] = t.partitionFor(rec.Key)
+		}
+		if _, seen := byPartition[partitions[i]]; !seen {
+			order = append(order, partitions[i])
+		}
+		byPartition[partitions[i]] = append(byPartition[partitions[i]], i)
+	}
+	if req.DeliverAt.After(time.Now()) {
+		for _, p := range order {
+			if _, err := topics.partition(t.name, p); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+		scheduled := make([]scheduledRecord, len(req.Records))
+		for i, rec := range req.Records {
+			scheduled[i] = scheduledRecord{Topic: t.name, Partition: partitions[i], Record: rec, DeliverAt: req.DeliverAt}
+		}
+		if err := delayed.schedule(scheduled); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeScheduled(w, struct {
+			Partitions []int     `json:"partitions"`
+			DeliverAt  time.Time `json:"deliver_at"`
+		}{partitions, req.DeliverAt})
+		return
+	}
+	offsets := make([]int, len(req.Records))
+	for _, p := range order {
+		l, err := topics.partition(t.name, p)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		idx := byPartition[p]
+		recs := make([]commitlog.Record, len(idx))
+		for j, i := range idx {
+			recs[j] = req.Records[i]
+		}
+		got, err := l.AppendBatch(recs)
+		for j, off := range got {
+			offsets[idx[j]] = off
+			recordsAppended.WithLabelValues(t.name).Inc()
+			bytesAppended.WithLabelValues(t.name).Add(float64(len(recs[j].Key) + len(recs[j].Value)))
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+	}
 	res := struct {
-		Offset int `json:"offset"`
-	}{Offset: offset}
+		Partitions []int `json:"partitions"`
+		Offsets    []int `json:"offsets"`
+	}{Partitions: partitions, Offsets: offsets}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(res)
 }
 
+// writeScheduled answers a produce whose records are held back for
+// later delivery.
+func writeScheduled(w http.ResponseWriter, res any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(res)
+}
+
+// parseWait reads the optional long-poll duration from the query string.
+func parseWait(r *http.Request) (time.Duration, error) {
+	s := r.URL.Query().Get("wait")
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errors.New("Invalid wait duration")
+	}
+	return min(d, maxWait), nil
+}
+
+// waitFor long-polls until offset has been appended, wait elapses or the
+// client goes away. The caller reads the log either way.
+func waitFor(r *http.Request, l *commitlog.Tailable, offset int, wait time.Duration) {
+	if wait <= 0 || offset < l.EndOffset() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	longPollWaiters.Inc()
+	defer longPollWaiters.Dec()
+	l.Wait(ctx, offset)
+}
+
 func handleConsume(w http.ResponseWriter, r *http.Request) {
+	l, err := requestLog(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 	offsetStr := r.URL.Query().Get("offset")
 	offset, err := strconv.Atoi(offsetStr)
 	if err != nil {
-		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidOffset, "Invalid offset")
 		return
 	}
-	record, err := commitLog.Read(offset)
+	wait, err := parseWait(r)
 	if err != nil {
-		http.Error(w, "Offset out of range", http.StatusNotFound)
+		writeErrorCode(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+	waitFor(r, l, offset, wait)
+	record, err := l.Read(offset)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(record)
 }
 
+// handleList returns every record, or with ?from=N up to max records
+// starting at N, long-polling for wait if there are none yet. A client
+// accepting commitlog.FramesContentType gets them as frames, up to
+// max_bytes, instead of JSON.
 func handleList(w http.ResponseWriter, r *http.Request) {
-	records := commitLog.List()
+	l, err := requestLog(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("from") == "" {
+		records, err := commitlog.List(l)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]commitlog.Record{"records": records})
+		return
+	}
+
+	from, err := strconv.Atoi(q.Get("from"))
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidOffset, "Invalid offset")
+		return
+	}
+	max := 0
+	if s := q.Get("max"); s != "" {
+		if max, err = strconv.Atoi(s); err != nil {
+			writeErrorCode(w, http.StatusBadRequest, CodeBadRequest, "Invalid max")
+			return
+		}
+	}
+	maxBytes := int64(defaultFrameBytes)
+	if s := q.Get("max_bytes"); s != "" {
+		if maxBytes, err = strconv.ParseInt(s, 10, 64); err != nil || maxBytes <= 0 {
+			writeErrorCode(w, http.StatusBadRequest, CodeBadRequest, "Invalid max_bytes")
+			return
+		}
+		maxBytes = min(maxBytes, maxFrameBytes)
+	}
+	wait, err := parseWait(r)
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+	waitFor(r, l, from, wait)
+	if start, end := l.StartOffset(), l.EndOffset(); from < start || from > end {
+		writeError(w, &commitlog.ErrOffsetOutOfRange{Offset: from, Start: start, End: end})
+		return
+	}
+	if acceptsFrames(r) {
+		writeFrames(w, l, from, max, maxBytes)
+		return
+	}
+	records, err := commitlog.ReadRange(l, from, max)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string][]Record{"records": records})
+	if records == nil {
+		records = []commitlog.Record{}
+	}
+	json.NewEncoder(w).Encode(map[string][]commitlog.Record{"records": records})
+}
+
+// Limits on the bytes of records in a response of frames.
+const (
+	defaultFrameBytes = 16 << 20
+	maxFrameBytes     = 64 << 20
+)
+
+// acceptsFrames reports whether the client asked for records as frames
+// rather than JSON.
+func acceptsFrames(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept") {
+		if strings.Contains(v, commitlog.FramesContentType) {
+			return true
+		}
+	}
+	return false
 }
 
-func handleClear(w http.ResponseWriter, r *http.Request) {
-	commitLog.Clear()
-	w.WriteHeader(http.StatusOK)
+// writeFrames sends records from offset from as frames copied from the
+// segment files, with the offset to continue from in X-Next-Offset. The
+// response has a Content-Length so the copy can use sendfile.
+func writeFrames(w http.ResponseWriter, l *commitlog.Tailable, from, max int, maxBytes int64) {
+	f, err := commitlog.ReadFrames(l, from, max, maxBytes)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", commitlog.FramesContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(f.Size(), 10))
+	w.Header().Set("X-Next-Offset", strconv.Itoa(f.Next()))
+	// An error now can't be reported; the client sees a body shorter
+	// than its Content-Length.
+	f.WriteTo(w)
 }
 
+// frameSource serves the server's partitions to frametcp clients, the
+// raw TCP counterpart of a GET /records for frames.
+type frameSource struct{}
+
+func (frameSource) Partition(name string, p int) (*commitlog.Tailable, bool) {
+	l, err := topics.partition(name, p)
+	return l, err == nil
+}
+
+// handleAdmin applies op to the partition and offset in the query string
+// and reports the resulting range of the partition.
+func handleAdmin(op func(l commitlog.Log, offset int) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l, err := requestLog(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+		if err != nil {
+			writeErrorCode(w, http.StatusBadRequest, CodeInvalidOffset, "Invalid offset")
+			return
+		}
+		if err := op(l, offset); err != nil {
+			writeError(w, err)
+			return
+		}
+		res := struct {
+			StartOffset int `json:"start_offset"`
+			EndOffset   int `json:"end_offset"`
+		}{l.StartOffset(), l.EndOffset()}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+var (
+	produceHandler = instrument("produce", handleProduce)
+	consumeHandler = instrument("consume", handleConsume)
+	listHandler    = instrument("list", handleList)
+	batchHandler   = instrument("produce_batch", handleProduceBatch)
+	streamHandler  = instrument("stream", handleStream)
+	deleteHandler  = instrument("delete_before", handleAdmin(commitlog.Log.DeleteBefore))
+	truncHandler   = instrument("truncate_after", handleAdmin(commitlog.Log.TruncateAfter))
+	topicsHandler  = instrument("topics", handleTopics)
+	topicHandler   = instrument("topic", handleTopic)
+	groupsHandler  = instrument("groups", handleGroups)
+	groupHandler   = instrument("group", handleGroup)
+	commitHandler  = instrument("commit_offset", handleCommitOffset)
+	lagHandler     = instrument("group_lag", handleGroupLag)
+	subsHandler    = instrument("subscriptions", handleSubscriptions)
+	subHandler     = instrument("subscription", handleSubscription)
+	searchHandler  = instrument("search", handleSearch)
+)
+
 func main() {
+	dataDir := flag.String("data", "", "directory to persist the log in (in-memory if empty)")
+	segmentBytes := flag.Int64("segment-bytes", commitlog.DefaultMaxSegmentBytes, "size at which a new log segment is started")
+	syncMode := flag.String("sync", "os", "fsync policy: os, always or periodic")
+	syncInterval := flag.Duration("sync-interval", 100*time.Millisecond, "fsync interval for -sync=periodic")
+	syncRecords := flag.Int("sync-records", 0, "with -sync=periodic, also fsync once this many records are pending")
+	tierDir := flag.String("tier-dir", "", "offload closed segments to this directory")
+	tierS3 := flag.String("tier-s3-endpoint", "", "offload closed segments to this S3-compatible endpoint; credentials come from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	tierBucket := flag.String("tier-s3-bucket", "", "bucket for -tier-s3-endpoint")
+	tierRegion := flag.String("tier-s3-region", "us-east-1", "region for -tier-s3-endpoint")
+	tierLocal := flag.Int("tier-local-segments", 2, "closed segments per partition kept on local disk when offloading")
+	tierCache := flag.Int("tier-cache-segments", commitlog.DefaultCacheSegments, "offloaded segments per partition cached on local disk for reads")
+	lagAlerts := flag.String("lag-alerts", "", "JSON file of consumer lag alert rules")
+	lagInterval := flag.Duration("lag-check-interval", 15*time.Second, "how often consumer lag is checked against -lag-alerts")
+	searchEnabled := flag.Bool("search", false, "index records for full-text search at /search")
+	kafkaAddr := flag.String("kafka-addr", "", "also serve the Kafka protocol on this address, e.g. :9092")
+	kafkaAdvertise := flag.String("kafka-advertise", "", "host:port Kafka clients are told to connect to (default: the -kafka-addr listener)")
+	framesAddr := flag.String("frames-addr", "", "also serve records as frames over raw TCP on this address, e.g. :9093")
+	flag.Parse()
+
+	mode, err := commitlog.ParseSyncMode(*syncMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var store commitlog.ObjectStore
+	switch {
+	case *tierDir != "" && *tierS3 != "":
+		log.Fatal("-tier-dir and -tier-s3-endpoint are mutually exclusive")
+	case *tierDir != "":
+		store, err = objstore.NewDir(*tierDir)
+	case *tierS3 != "":
+		store, err = objstore.NewS3(objstore.S3Config{
+			Endpoint:  *tierS3,
+			Bucket:    *tierBucket,
+			Region:    *tierRegion,
+			AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		})
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if store != nil && *dataDir == "" {
+		log.Fatal("tiered storage needs -data")
+	}
+	topics, err = openRegistry(*dataDir, commitlog.Config{
+		MaxSegmentBytes: *segmentBytes,
+		Sync: commitlog.SyncPolicy{
+			Mode:     mode,
+			Interval: *syncInterval,
+			Records:  *syncRecords,
+		},
+		Tier: commitlog.TierConfig{
+			Store:         store,
+			LocalSegments: *tierLocal,
+			CacheSegments: *tierCache,
+		},
+	})
+	if err != nil {
+		log.Fatalf("failed to open %s: %v", *dataDir, err)
+	}
+	groups, err = openGroups(*dataDir)
+	if err != nil {
+		log.Fatalf("failed to open %s: %v", *dataDir, err)
+	}
+	subscriptions, err = openSubscriptions(*dataDir)
+	if err != nil {
+		log.Fatalf("failed to open %s: %v", *dataDir, err)
+	}
+	delayed, err = openDelayed(*dataDir)
+	if err != nil {
+		log.Fatalf("failed to open %s: %v", *dataDir, err)
+	}
+	if *searchEnabled {
+		search, err = openSearch(*dataDir)
+		if err != nil {
+			log.Fatalf("failed to open %s: %v", *dataDir, err)
+		}
+	}
+	prometheus.MustRegister(logCollector{}, lagCollector{})
+	if *lagAlerts != "" {
+		rules, err := loadLagRules(*lagAlerts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go newLagAlerter(rules).run(*lagInterval)
+	}
+	if *kafkaAddr != "" {
+		srv := kafka.NewServer(kafkaBroker{}, *kafkaAdvertise)
+		go func() { log.Fatal(srv.ListenAndServe(*kafkaAddr)) }()
+		log.Printf("Kafka protocol on %s", *kafkaAddr)
+	}
+	if *framesAddr != "" {
+		srv := frametcp.NewServer(frameSource{})
+		go func() { log.Fatal(srv.ListenAndServe(*framesAddr)) }()
+		log.Printf("Frames over TCP on %s", *framesAddr)
+	}
+
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
-			handleProduce(w, r)
+			produceHandler(w, r)
 		case http.MethodGet:
-			handleConsume(w, r)
+			consumeHandler(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			methodNotAllowed(w)
 		}
 	})
 	http.HandleFunc("/records", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			handleList(w, r)
-		case http.MethodDelete:
-			handleClear(w, r)
+			listHandler(w, r)
+		case http.MethodPost:
+			batchHandler(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			methodNotAllowed(w)
+		}
+	})
+	http.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		streamHandler(w, r)
+	})
+	http.HandleFunc("/admin/delete-before", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		deleteHandler(w, r)
+	})
+	http.HandleFunc("/admin/truncate-after", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
 		}
+		truncHandler(w, r)
 	})
+	http.HandleFunc("/topics", topicsHandler)
+	http.HandleFunc("/topics/{name}", topicHandler)
+	http.HandleFunc("/groups", groupsHandler)
+	http.HandleFunc("/groups/{group}", groupHandler)
+	http.HandleFunc("/groups/{group}/offsets", commitHandler)
+	http.HandleFunc("/groups/{group}/lag", lagHandler)
+	http.HandleFunc("/subscriptions", subsHandler)
+	http.HandleFunc("/subscriptions/{id}", subHandler)
+	http.HandleFunc("/search", searchHandler)
+	http.Handle("/metrics", promhttp.Handler())
 	log.Println("Server running on :8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
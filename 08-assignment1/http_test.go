@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// setup points the server's stores at fresh in-memory ones, as main does
+// without -data.
+func setup(t *testing.T) {
+	t.Helper()
+	var err error
+	if topics, err = openRegistry("", commitlog.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if groups, err = openGroups(""); err != nil {
+		t.Fatal(err)
+	}
+	if subscriptions, err = openSubscriptions(""); err != nil {
+		t.Fatal(err)
+	}
+	if delayed, err = openDelayed(""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, info := range subscriptions.list() {
+			subscriptions.delete(info.ID)
+		}
+		topics.close()
+	})
+}
+
+// serve sends a request to h and returns the response. pathValues are
+// the route's wildcards, name then value.
+func serve(h http.HandlerFunc, method, target, body string, pathValues ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(pathValues); i += 2 {
+		r.SetPathValue(pathValues[i], pathValues[i+1])
+	}
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+// decode decodes a JSON response into v, failing the test on a status
+// other than want.
+func decode(t *testing.T, w *httptest.ResponseRecorder, want int, v any) {
+	t.Helper()
+	if w.Code != want {
+		t.Fatalf("status = %d, want %d: %s", w.Code, want, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+}
+
+// errorBody decodes a JSON error response.
+func errorBody(t *testing.T, w *httptest.ResponseRecorder, want int) apiError {
+	t.Helper()
+	var body struct {
+		Error apiError `json:"error"`
+	}
+	decode(t, w, want, &body)
+	return body.Error
+}
+
+// produce appends values to partition 0 of the default topic.
+func produce(t *testing.T, values ...string) {
+	t.Helper()
+	for _, v := range values {
+		w := serve(handleProduce, http.MethodPost, "/?partition=0", fmt.Sprintf(`{"record": {"value": %q}}`, v))
+		if w.Code != http.StatusOK {
+			t.Fatalf("produce %q = %d: %s", v, w.Code, w.Body)
+		}
+	}
+}
+
+// list returns the values of every record in partition 0 of the default
+// topic.
+func list(t *testing.T) []string {
+	t.Helper()
+	var res struct {
+		Records []commitlog.Record `json:"records"`
+	}
+	decode(t, serve(handleList, http.MethodGet, "/records", ""), http.StatusOK, &res)
+	var values []string
+	for _, rec := range res.Records {
+		values = append(values, rec.Value)
+	}
+	return values
+}
+
+func TestAdmin(t *testing.T) {
+	setup(t)
+	produce(t, "a", "b", "c", "d", "e")
+
+	var rng struct {
+		StartOffset int `json:"start_offset"`
+		EndOffset   int `json:"end_offset"`
+	}
+	decode(t, serve(handleAdmin(commitlog.Log.DeleteBefore), http.MethodPost, "/admin/delete-before?offset=2", ""), http.StatusOK, &rng)
+	if rng.StartOffset != 2 || rng.EndOffset != 5 {
+		t.Fatalf("after delete-before 2: range = %+v, want [2, 5)", rng)
+	}
+	e := errorBody(t, serve(handleConsume, http.MethodGet, "/?offset=1", ""), http.StatusGone)
+	if e.Code != commitlog.CodeTruncated || *e.StartOffset != 2 {
+		t.Fatalf("consume of a deleted offset = %+v", e)
+	}
+
+	decode(t, serve(handleAdmin(commitlog.Log.TruncateAfter), http.MethodPost, "/admin/truncate-after?offset=3", ""), http.StatusOK, &rng)
+	if rng.StartOffset != 2 || rng.EndOffset != 4 {
+		t.Fatalf("after truncate-after 3: range = %+v, want [2, 4)", rng)
+	}
+	if values := list(t); strings.Join(values, "") != "cd" {
+		t.Fatalf("records = %v, want [c d]", values)
+	}
+	// The next append reuses the truncated offset.
+	produce(t, "f")
+	if values := list(t); strings.Join(values, "") != "cdf" {
+		t.Fatalf("records = %v, want [c d f]", values)
+	}
+
+	if e := errorBody(t, serve(handleAdmin(commitlog.Log.DeleteBefore), http.MethodPost, "/admin/delete-before?offset=x", ""), http.StatusBadRequest); e.Code != CodeInvalidOffset {
+		t.Fatalf("delete-before with a bad offset = %+v", e)
+	}
+	if e := errorBody(t, serve(handleAdmin(commitlog.Log.TruncateAfter), http.MethodPost, "/admin/truncate-after?offset=0&partition=3", ""), http.StatusNotFound); e.Code != CodePartitionNotFound {
+		t.Fatalf("truncate-after of a missing partition = %+v", e)
+	}
+}
+
+func TestProduceDeliverAt(t *testing.T) {
+	setup(t)
+	now := time.Now()
+	for _, r := range []struct {
+		value string
+		in    time.Duration
+	}{{"late", 300 * time.Millisecond}, {"early", 100 * time.Millisecond}, {"middle", 200 * time.Millisecond}} {
+		body := fmt.Sprintf(`{"record": {"value": %q}, "deliver_at": %q}`, r.value, now.Add(r.in).Format(time.RFC3339Nano))
+		var res struct {
+			Partition int `json:"partition"`
+		}
+		decode(t, serve(handleProduce, http.MethodPost, "/", body), http.StatusAccepted, &res)
+	}
+	batch := fmt.Sprintf(`{"records": [{"value": "first"}, {"value": "second"}], "deliver_at": %q}`, now.Add(200*time.Millisecond).Format(time.RFC3339Nano))
+	var res struct {
+		Partitions []int `json:"partitions"`
+	}
+	decode(t, serve(handleProduceBatch, http.MethodPost, "/records", batch), http.StatusAccepted, &res)
+	// A deliver_at in the past is no reason to wait.
+	body := fmt.Sprintf(`{"record": {"value": "now"}, "deliver_at": %q}`, now.Add(-time.Hour).Format(time.RFC3339Nano))
+	if w := serve(handleProduce, http.MethodPost, "/", body); w.Code != http.StatusOK {
+		t.Fatalf("produce due in the past = %d: %s", w.Code, w.Body)
+	}
+	if values := list(t); len(values) != 1 {
+		t.Fatalf("records before any are due = %v, want only [now]", values)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(list(t)) < 6 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Records due at the same time keep the order they were produced
+	// in.
+	want := "now early middle first second late"
+	if values := strings.Join(list(t), " "); values != want {
+		t.Fatalf("records = %s, want %s", values, want)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/kafka"
+)
+
+// kafkaBroker serves the server's topics and consumer group offsets to
+// Kafka clients.
+type kafkaBroker struct{}
+
+func (kafkaBroker) Topics() []kafka.Topic {
+	var ts []kafka.Topic
+	for _, t := range topics.list() {
+		ts = append(ts, kafka.Topic{Name: t.name, Partitions: len(t.partitions)})
+	}
+	return ts
+}
+
+func (kafkaBroker) Partition(name string, p int) (*commitlog.Tailable, bool) {
+	l, err := topics.partition(name, p)
+	return l, err == nil
+}
+
+func (kafkaBroker) Append(name string, p int, recs []commitlog.Record) ([]int, error) {
+	l, err := topics.partition(name, p)
+	if err != nil {
+		return nil, kafka.ErrUnknownTopicOrPartition
+	}
+	offsets, err := l.AppendBatch(recs)
+	for j := range offsets {
+		recordsAppended.WithLabelValues(name).Inc()
+		bytesAppended.WithLabelValues(name).Add(float64(len(recs[j].Key) + len(recs[j].Value)))
+	}
+	return offsets, err
+}
+
+func (kafkaBroker) CommitOffset(group string, o kafka.GroupOffset) error {
+	return groups.commit(group, committedOffset{
+		Topic:       o.Topic,
+		Partition:   o.Partition,
+		Offset:      o.Offset,
+		Metadata:    o.Metadata,
+		CommittedAt: time.Now().UTC(),
+	})
+}
+
+func (kafkaBroker) GroupOffsets(group string) []kafka.GroupOffset {
+	offsets, err := groups.offsets(group)
+	if errors.Is(err, errGroupNotFound) {
+		return nil
+	}
+	var out []kafka.GroupOffset
+	for _, c := range offsets {
+		out = append(out, kafka.GroupOffset{Topic: c.Topic, Partition: c.Partition, Offset: c.Offset, Metadata: c.Metadata})
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// partitionLag is how far a group is behind in one partition.
+type partitionLag struct {
+	Topic           string `json:"topic"`
+	Partition       int    `json:"partition"`
+	CommittedOffset int    `json:"committed_offset"`
+	EndOffset       int    `json:"end_offset"`
+	// Lag is the number of records the group has yet to consume.
+	Lag int `json:"lag"`
+	// LagSeconds is the age of the oldest record the group has yet to
+	// consume, zero when it is caught up.
+	LagSeconds float64 `json:"lag_seconds"`
+	// OldestUnconsumed is that record's timestamp.
+	OldestUnconsumed *time.Time `json:"oldest_unconsumed,omitempty"`
+}
+
+// groupLag computes a group's lag in every partition it has committed
+// an offset for. Partitions of deleted topics are skipped.
+func groupLag(group string, now time.Time) ([]partitionLag, error) {
+	offsets, err := groups.offsets(group)
+	if err != nil {
+		return nil, err
+	}
+	lags := make([]partitionLag, 0, len(offsets))
+	for _, c := range offsets {
+		l, err := topics.partition(c.Topic, c.Partition)
+		if err != nil {
+			continue
+		}
+		pl := partitionLag{
+			Topic:           c.Topic,
+			Partition:       c.Partition,
+			CommittedOffset: c.Offset,
+			EndOffset:       l.EndOffset(),
+		}
+		pl.Lag = max(pl.EndOffset-c.Offset, 0)
+		if pl.Lag > 0 {
+			// Records below the start offset are gone; the oldest
+			// the group can still read is at the start.
+			if rec, err := l.Read(max(c.Offset, l.StartOffset())); err == nil {
+				ts := rec.Timestamp.UTC()
+				pl.OldestUnconsumed = &ts
+				pl.LagSeconds = max(now.Sub(rec.Timestamp).Seconds(), 0)
+			}
+		}
+		lags = append(lags, pl)
+	}
+	return lags, nil
+}
+
+// handleGroupLag reports a group's lag per partition, with totals.
+func handleGroupLag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	group := r.PathValue("group")
+	lags, err := groupLag(group, time.Now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	res := struct {
+		Group         string         `json:"group"`
+		TotalLag      int            `json:"total_lag"`
+		MaxLagSeconds float64        `json:"max_lag_seconds"`
+		Partitions    []partitionLag `json:"partitions"`
+	}{Group: group, Partitions: lags}
+	for _, pl := range lags {
+		res.TotalLag += pl.Lag
+		res.MaxLagSeconds = max(res.MaxLagSeconds, pl.LagSeconds)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+var (
+	lagDesc = prometheus.NewDesc("commitlog_consumer_lag",
+		"Records a consumer group has yet to consume in a partition.", lagLabels, nil)
+	lagSecondsDesc = prometheus.NewDesc("commitlog_consumer_lag_seconds",
+		"Age of the oldest record a consumer group has yet to consume in a partition.", lagLabels, nil)
+
+	lagLabels = []string{"group", "topic", "partition"}
+)
+
+// lagCollector reports every group's lag on each scrape.
+type lagCollector struct{}
+
+func (lagCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lagDesc
+	ch <- lagSecondsDesc
+}
+
+func (lagCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	for _, group := range groups.list() {
+		lags, err := groupLag(group, now)
+		if err != nil {
+			continue
+		}
+		for _, pl := range lags {
+			labels := []string{group, pl.Topic, strconv.Itoa(pl.Partition)}
+			ch <- prometheus.MustNewConstMetric(lagDesc, prometheus.GaugeValue, float64(pl.Lag), labels...)
+			ch <- prometheus.MustNewConstMetric(lagSecondsDesc, prometheus.GaugeValue, pl.LagSeconds, labels...)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGroupLag(t *testing.T) {
+	setup(t)
+	produce(t, "a", "b", "c", "d", "e")
+	if w := serve(handleCommitOffset, http.MethodPost, "/groups/g/offsets", `{"offset": 2}`, "group", "g"); w.Code != http.StatusOK {
+		t.Fatalf("commit = %d: %s", w.Code, w.Body)
+	}
+	oldest, err := topics.partition(defaultTopic, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := oldest.Read(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type lagResponse struct {
+		Group         string         `json:"group"`
+		TotalLag      int            `json:"total_lag"`
+		MaxLagSeconds float64        `json:"max_lag_seconds"`
+		Partitions    []partitionLag `json:"partitions"`
+	}
+	var res lagResponse
+	decode(t, serve(handleGroupLag, http.MethodGet, "/groups/g/lag", "", "group", "g"), http.StatusOK, &res)
+	if res.Group != "g" || res.TotalLag != 3 || len(res.Partitions) != 1 {
+		t.Fatalf("lag = %+v, want 3 records in one partition", res)
+	}
+	pl := res.Partitions[0]
+	if pl.Topic != defaultTopic || pl.CommittedOffset != 2 || pl.EndOffset != 5 || pl.Lag != 3 {
+		t.Fatalf("partition lag = %+v, want committed 2, end 5, lag 3", pl)
+	}
+	// The oldest record the group has yet to consume is the one at its
+	// committed offset.
+	if pl.OldestUnconsumed == nil || !pl.OldestUnconsumed.Equal(rec.Timestamp) {
+		t.Fatalf("oldest unconsumed = %v, want %v", pl.OldestUnconsumed, rec.Timestamp)
+	}
+	if pl.LagSeconds < 0 || pl.LagSeconds > time.Since(rec.Timestamp).Seconds() || res.MaxLagSeconds != pl.LagSeconds {
+		t.Fatalf("lag seconds = %v, max %v", pl.LagSeconds, res.MaxLagSeconds)
+	}
+
+	// Caught up, a group has no lag and no oldest record.
+	serve(handleCommitOffset, http.MethodPost, "/groups/g/offsets", `{"offset": 5}`, "group", "g")
+	res = lagResponse{}
+	decode(t, serve(handleGroupLag, http.MethodGet, "/groups/g/lag", "", "group", "g"), http.StatusOK, &res)
+	if pl := res.Partitions[0]; res.TotalLag != 0 || pl.Lag != 0 || pl.LagSeconds != 0 || pl.OldestUnconsumed != nil {
+		t.Fatalf("lag when caught up = %+v", res)
+	}
+
+	if e := errorBody(t, serve(handleGroupLag, http.MethodGet, "/groups/nobody/lag", "", "group", "nobody"), http.StatusNotFound); e.Code != CodeGroupNotFound {
+		t.Fatalf("lag of a missing group = %+v", e)
+	}
+}
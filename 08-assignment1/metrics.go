@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "commitlog_http_requests_total",
+		Help: "HTTP requests handled, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "commitlog_http_request_duration_seconds",
+		Help:    "HTTP request latency, by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	recordsAppended = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "commitlog_records_appended_total",
+		Help: "Records appended, by topic.",
+	}, []string{"topic"})
+
+	bytesAppended = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "commitlog_bytes_appended_total",
+		Help: "Record key and value bytes appended, by topic.",
+	}, []string{"topic"})
+
+	longPollWaiters = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "commitlog_long_poll_waiters",
+		Help: "Consume requests and streams currently waiting for new records.",
+	})
+)
+
+var (
+	endOffsetDesc = prometheus.NewDesc("commitlog_end_offset",
+		"Offset the next appended record will receive.", partitionLabels, nil)
+	startOffsetDesc = prometheus.NewDesc("commitlog_start_offset",
+		"Lowest offset still held by the partition.", partitionLabels, nil)
+	segmentsDesc = prometheus.NewDesc("commitlog_segments",
+		"Segment files making up the partition; zero when it is held in memory.", partitionLabels, nil)
+	diskBytesDesc = prometheus.NewDesc("commitlog_disk_bytes",
+		"Bytes used on disk by the partition's segments.", partitionLabels, nil)
+	offloadedSegmentsDesc = prometheus.NewDesc("commitlog_offloaded_segments",
+		"Segments of the partition offloaded to the object store.", partitionLabels, nil)
+	offloadedBytesDesc = prometheus.NewDesc("commitlog_offloaded_bytes",
+		"Bytes of the partition held in the object store.", partitionLabels, nil)
+	offloadFailingDesc = prometheus.NewDesc("commitlog_offload_failing",
+		"1 if the partition's last attempt to offload a segment failed.", partitionLabels, nil)
+
+	partitionLabels = []string{"topic", "partition"}
+)
+
+// logCollector reports the offsets and disk usage of every partition.
+// Topics come and go, so the gauges are collected on each scrape.
+type logCollector struct{}
+
+func (logCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- endOffsetDesc
+	ch <- startOffsetDesc
+	ch <- segmentsDesc
+	ch <- diskBytesDesc
+	ch <- offloadedSegmentsDesc
+	ch <- offloadedBytesDesc
+	ch <- offloadFailingDesc
+}
+
+func (logCollector) Collect(ch chan<- prometheus.Metric) {
+	tiered := topics.cfg.Tier.Store != nil
+	for _, t := range topics.list() {
+		for p, l := range t.partitions {
+			labels := []string{t.name, strconv.Itoa(p)}
+			var stats commitlog.Stats
+			if fl, ok := l.Log.(*commitlog.FileLog); ok {
+				stats = fl.Stats()
+			}
+			ch <- prometheus.MustNewConstMetric(endOffsetDesc, prometheus.GaugeValue, float64(l.EndOffset()), labels...)
+			ch <- prometheus.MustNewConstMetric(startOffsetDesc, prometheus.GaugeValue, float64(l.StartOffset()), labels...)
+			ch <- prometheus.MustNewConstMetric(segmentsDesc, prometheus.GaugeValue, float64(stats.Segments), labels...)
+			ch <- prometheus.MustNewConstMetric(diskBytesDesc, prometheus.GaugeValue, float64(stats.Bytes), labels...)
+			if tiered {
+				failing := 0.0
+				if stats.OffloadErr != nil {
+					failing = 1
+				}
+				ch <- prometheus.MustNewConstMetric(offloadedSegmentsDesc, prometheus.GaugeValue, float64(stats.OffloadedSegments), labels...)
+				ch <- prometheus.MustNewConstMetric(offloadedBytesDesc, prometheus.GaugeValue, float64(stats.OffloadedBytes), labels...)
+				ch <- prometheus.MustNewConstMetric(offloadFailingDesc, prometheus.GaugeValue, failing, labels...)
+			}
+		}
+	}
+}
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ReadFrom lets io.Copy reach the connection, so copies from files can
+// use sendfile.
+func (r *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := r.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(struct{ io.Writer }{r.ResponseWriter}, src)
+}
+
+// instrument records request count and latency for route.
+func instrument(route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h(rec, r)
+		status := strconv.Itoa(rec.status)
+		httpRequests.WithLabelValues(route, r.Method, status).Inc()
+		httpDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var registerCollectors sync.Once
+
+// scrape returns the samples served on /metrics, keyed by name and
+// labels as they are written, such as
+// commitlog_end_offset{partition="0",topic="default"}.
+func scrape(t *testing.T) map[string]float64 {
+	t.Helper()
+	registerCollectors.Do(func() { prometheus.MustRegister(logCollector{}, lagCollector{}) })
+	w := serve(promhttp.Handler().ServeHTTP, http.MethodGet, "/metrics", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d: %s", w.Code, w.Body)
+	}
+	samples := map[string]float64{}
+	sc := bufio.NewScanner(w.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("sample %q: %v", line, err)
+		}
+		samples[line[:i]] = v
+	}
+	return samples
+}
+
+func TestMetrics(t *testing.T) {
+	setup(t)
+	// The counters are the process's own, so only their increase is
+	// down to this test.
+	before := scrape(t)
+
+	for _, v := range []string{"a", "bcd"} {
+		body := fmt.Sprintf(`{"record": {"key": "k", "value": %q}}`, v)
+		if w := serve(produceHandler, http.MethodPost, "/?partition=0", body); w.Code != http.StatusOK {
+			t.Fatalf("produce = %d: %s", w.Code, w.Body)
+		}
+	}
+	if w := serve(consumeHandler, http.MethodGet, "/?offset=0", ""); w.Code != http.StatusOK {
+		t.Fatalf("consume = %d: %s", w.Code, w.Body)
+	}
+	if w := serve(consumeHandler, http.MethodGet, "/?offset=5", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("consume past the end = %d: %s", w.Code, w.Body)
+	}
+	if w := serve(handleCommitOffset, http.MethodPost, "/groups/g/offsets", `{"offset": 1}`, "group", "g"); w.Code != http.StatusOK {
+		t.Fatalf("commit = %d: %s", w.Code, w.Body)
+	}
+
+	after := scrape(t)
+	increases := []struct {
+		sample string
+		want   float64
+	}{
+		{`commitlog_http_requests_total{method="POST",route="produce",status="200"}`, 2},
+		{`commitlog_http_requests_total{method="GET",route="consume",status="200"}`, 1},
+		{`commitlog_http_requests_total{method="GET",route="consume",status="404"}`, 1},
+		{`commitlog_http_request_duration_seconds_count{method="GET",route="consume",status="404"}`, 1},
+		{`commitlog_records_appended_total{topic="default"}`, 2},
+		{`commitlog_bytes_appended_total{topic="default"}`, 6},
+	}
+	for _, tt := range increases {
+		if _, ok := after[tt.sample]; !ok {
+			t.Errorf("no sample %s", tt.sample)
+			continue
+		}
+		if got := after[tt.sample] - before[tt.sample]; got != tt.want {
+			t.Errorf("%s rose by %v, want %v", tt.sample, got, tt.want)
+		}
+	}
+	gauges := []struct {
+		sample string
+		want   float64
+	}{
+		{`commitlog_end_offset{partition="0",topic="default"}`, 2},
+		{`commitlog_start_offset{partition="0",topic="default"}`, 0},
+		// The group has consumed the first record of two.
+		{`commitlog_consumer_lag{group="g",partition="0",topic="default"}`, 1},
+	}
+	for _, tt := range gauges {
+		if got, ok := after[tt.sample]; !ok || got != tt.want {
+			t.Errorf("%s = %v (present %v), want %v", tt.sample, got, ok, tt.want)
+		}
+	}
+	if _, ok := after[`commitlog_consumer_lag_seconds{group="g",partition="0",topic="default"}`]; !ok {
+		t.Error("no lag seconds for the group")
+	}
+}
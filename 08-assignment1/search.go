@@ -0,0 +1,579 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// searchDir holds one index file per partition, <topic>-<partition>.json,
+// in the data directory.
+const searchDir = "search"
+
+const (
+	defaultSearchMax = 20
+	maxSearchMax     = 100
+	// searchBatch is how many records an indexer reads at a time.
+	searchBatch = 500
+	// maxTermLength skips tokens too long to be worth indexing, such as
+	// base64 blobs.
+	maxTermLength = 100
+
+	searchSyncInterval = time.Second
+	searchSaveInterval = 30 * time.Second
+
+	// BM25 ranking parameters.
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+var (
+	errSearchDisabled = errors.New("search is not enabled; start the server with -search")
+	errInvalidQuery   = errors.New("invalid query")
+)
+
+// posting is one record holding a term, and how many times it does.
+type posting struct {
+	Offset int `json:"o"`
+	Freq   int `json:"f"`
+}
+
+// partitionIndex is the inverted index of one partition: the records
+// holding each term, in offset order.
+type partitionIndex struct {
+	mu sync.RWMutex
+	// Next is the first offset not yet indexed.
+	Next     int                  `json:"next"`
+	Postings map[string][]posting `json:"postings"`
+	// Lengths is the number of terms in each indexed record, by offset,
+	// and TotalLength their sum.
+	Lengths     map[int]int `json:"lengths"`
+	TotalLength int         `json:"total_length"`
+	dirty       bool
+}
+
+func newPartitionIndex() *partitionIndex {
+	return &partitionIndex{Postings: make(map[string][]posting), Lengths: make(map[int]int)}
+}
+
+// add indexes recs, which must follow on from what is indexed.
+func (x *partitionIndex) add(recs []commitlog.Record) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, rec := range recs {
+		if rec.Offset < x.Next {
+			continue
+		}
+		freq := map[string]int{}
+		n := 0
+		for _, text := range []string{rec.Key, rec.Value} {
+			for _, term := range terms(text) {
+				freq[term]++
+				n++
+			}
+		}
+		for term, f := range freq {
+			x.Postings[term] = append(x.Postings[term], posting{rec.Offset, f})
+		}
+		x.Lengths[rec.Offset] = n
+		x.TotalLength += n
+		x.Next = rec.Offset + 1
+	}
+	x.dirty = true
+}
+
+// reset empties the index so it is rebuilt from offset next.
+func (x *partitionIndex) reset(next int) {
+	x.Postings, x.Lengths, x.TotalLength, x.Next = make(map[string][]posting), make(map[int]int), 0, next
+	x.dirty = true
+}
+
+// prune forgets the records below start, which retention has removed.
+func (x *partitionIndex) prune(start int) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for off, n := range x.Lengths {
+		if off < start {
+			x.TotalLength -= n
+			delete(x.Lengths, off)
+			x.dirty = true
+		}
+	}
+	for term, ps := range x.Postings {
+		i := sort.Search(len(ps), func(i int) bool { return ps[i].Offset >= start })
+		switch {
+		case i == len(ps):
+			delete(x.Postings, term)
+		case i > 0:
+			x.Postings[term] = append([]posting(nil), ps[i:]...)
+		}
+	}
+}
+
+// topicIndex indexes one topic, with an indexer goroutine per partition.
+type topicIndex struct {
+	topic      *topic
+	partitions []*partitionIndex
+	cancel     context.CancelFunc
+	done       sync.WaitGroup
+}
+
+// searchIndex indexes every topic's records as they are appended. With a
+// data directory each partition's index is saved to searchDir
+// periodically, and on startup an index is loaded and caught up with its
+// partition, or rebuilt from the partition's segments if it is missing.
+type searchIndex struct {
+	dir string
+
+	mu     sync.Mutex
+	topics map[string]*topicIndex
+}
+
+// search is nil unless the server was started with -search.
+var search *searchIndex
+
+// openSearch starts indexing the server's topics.
+func openSearch(dir string) (*searchIndex, error) {
+	s := &searchIndex{topics: make(map[string]*topicIndex)}
+	if dir != "" {
+		s.dir = filepath.Join(dir, searchDir)
+		if err := os.MkdirAll(s.dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	s.sync()
+	go s.run()
+	return s, nil
+}
+
+// run keeps the indexed topics in step with the registry and saves the
+// indexes.
+func (s *searchIndex) run() {
+	syncTick := time.NewTicker(searchSyncInterval)
+	defer syncTick.Stop()
+	saveTick := time.NewTicker(searchSaveInterval)
+	defer saveTick.Stop()
+	for {
+		select {
+		case <-syncTick.C:
+			s.sync()
+		case <-saveTick.C:
+			s.save()
+		}
+	}
+}
+
+// sync starts indexing new topics and drops the indexes of deleted ones.
+// A topic deleted and created again is a new *topic and is indexed from
+// scratch.
+func (s *searchIndex) sync() {
+	current := map[string]*topic{}
+	for _, t := range topics.list() {
+		current[t.name] = t
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, ti := range s.topics {
+		if current[name] != ti.topic {
+			ti.cancel()
+			ti.done.Wait()
+			delete(s.topics, name)
+			s.removeFiles(name, len(ti.partitions))
+		}
+	}
+	for name, t := range current {
+		if _, ok := s.topics[name]; !ok {
+			s.topics[name] = s.start(t)
+		}
+	}
+}
+
+// start loads t's saved indexes and starts its indexers.
+func (s *searchIndex) start(t *topic) *topicIndex {
+	ctx, cancel := context.WithCancel(context.Background())
+	ti := &topicIndex{topic: t, cancel: cancel}
+	for p, l := range t.partitions {
+		x, err := s.load(t.name, p)
+		if err != nil {
+			log.Printf("search: rebuilding index of %s/%d: %v", t.name, p, err)
+			x = newPartitionIndex()
+		}
+		ti.partitions = append(ti.partitions, x)
+		ti.done.Add(1)
+		go func() {
+			defer ti.done.Done()
+			s.index(ctx, x, l)
+		}()
+	}
+	return ti
+}
+
+// index adds l's records to x as they are appended.
+func (s *searchIndex) index(ctx context.Context, x *partitionIndex, l *commitlog.Tailable) {
+	truncations := l.Truncations()
+	for {
+		n := l.Truncations()
+		start, end := l.StartOffset(), l.EndOffset()
+		x.mu.Lock()
+		if n != truncations || x.Next > end {
+			// TruncateAfter removed indexed records, and their offsets
+			// may have been reused already. An index loaded from disk
+			// is past the end if the log was truncated before a restart.
+			truncations = n
+			x.reset(start)
+		}
+		x.Next = max(x.Next, start)
+		next := x.Next
+		x.mu.Unlock()
+
+		// Wake up now and then to notice truncation, which doesn't move
+		// the end forward.
+		wctx, cancel := context.WithTimeout(ctx, searchSyncInterval)
+		err := l.Wait(wctx, next)
+		cancel()
+		if ctx.Err() != nil || errors.Is(err, commitlog.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		recs, err := commitlog.ReadRange(l, next, searchBatch)
+		if err != nil || len(recs) == 0 {
+			// Most likely a concurrent DeleteBefore or TruncateAfter.
+			if !sleepCtx(ctx, searchSyncInterval) {
+				return
+			}
+			continue
+		}
+		x.add(recs)
+	}
+}
+
+func (s *searchIndex) path(name string, p int) string {
+	return filepath.Join(s.dir, name+"-"+strconv.Itoa(p)+".json")
+}
+
+// load reads a saved partition index. A missing file gives an empty
+// index, which the indexer builds from the start of the partition.
+func (s *searchIndex) load(name string, p int) (*partitionIndex, error) {
+	x := newPartitionIndex()
+	if s.dir == "" {
+		return x, nil
+	}
+	data, err := os.ReadFile(s.path(name, p))
+	if os.IsNotExist(err) {
+		return x, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// save prunes the indexes of records retention has removed and writes
+// the ones that changed.
+func (s *searchIndex) save() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, ti := range s.topics {
+		for p, x := range ti.partitions {
+			x.prune(ti.topic.partitions[p].StartOffset())
+			if s.dir == "" {
+				continue
+			}
+			x.mu.Lock()
+			var data []byte
+			var err error
+			if x.dirty {
+				data, err = json.Marshal(x)
+				x.dirty = false
+			}
+			x.mu.Unlock()
+			if err == nil && data != nil {
+				err = commitlog.WriteFileAtomic(s.path(name, p), data)
+			}
+			if err != nil {
+				log.Printf("search: saving index of %s/%d: %v", name, p, err)
+			}
+		}
+	}
+}
+
+func (s *searchIndex) removeFiles(name string, partitions int) {
+	if s.dir == "" {
+		return
+	}
+	for p := 0; p < partitions; p++ {
+		if err := os.Remove(s.path(name, p)); err != nil && !os.IsNotExist(err) {
+			log.Printf("search: %v", err)
+		}
+	}
+}
+
+// isJoiner reports whether r joins the parts of an identifier such as
+// "req-42ab" or "db.timeout".
+func isJoiner(r rune) bool {
+	return strings.ContainsRune("-_.:/@", r)
+}
+
+func isTermRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// terms splits text into lowercase search terms: every run of letters
+// and digits, plus every longer word they are joined into by "-_.:/@",
+// so "error in req-42ab" gives error, in, req, 42ab and req-42ab.
+func terms(text string) []string {
+	var out []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !isTermRune(r) && !isJoiner(r) }) {
+		word = strings.ToLower(strings.TrimFunc(word, isJoiner))
+		parts := strings.FieldsFunc(word, func(r rune) bool { return !isTermRune(r) })
+		for _, part := range parts {
+			if len(part) <= maxTermLength {
+				out = append(out, part)
+			}
+		}
+		if len(parts) > 1 && len(word) <= maxTermLength {
+			out = append(out, word)
+		}
+	}
+	return out
+}
+
+// queryTerms returns the terms of a query. Each word is one term: an
+// identifier such as req-42ab matches only records holding all of it.
+func queryTerms(q string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, word := range strings.Fields(q) {
+		word = strings.ToLower(strings.TrimFunc(word, func(r rune) bool { return !isTermRune(r) }))
+		parts := strings.FieldsFunc(word, func(r rune) bool { return !isTermRune(r) })
+		var term string
+		switch {
+		case len(parts) == 0:
+			continue
+		case len(parts) == 1:
+			term = parts[0]
+		default:
+			term = word
+		}
+		if !seen[term] {
+			seen[term] = true
+			out = append(out, term)
+		}
+	}
+	return out
+}
+
+// searchHit is a record matching a query.
+type searchHit struct {
+	Partition int              `json:"partition"`
+	Offset    int              `json:"offset"`
+	Score     float64          `json:"score"`
+	Record    commitlog.Record `json:"record"`
+}
+
+// query returns the records of a topic holding every term, best first,
+// and whether every partition's index had caught up with its end. Ties
+// go to the newest record.
+func (s *searchIndex) query(name string, terms []string) ([]searchHit, bool, error) {
+	t, err := topics.get(name)
+	if err != nil {
+		return nil, false, err
+	}
+	s.mu.Lock()
+	ti := s.topics[t.name]
+	s.mu.Unlock()
+	if ti == nil || ti.topic != t {
+		// Created since the last sync; nothing is indexed yet.
+		return nil, false, nil
+	}
+
+	// Gather each partition's matches with the statistics BM25 ranks
+	// them by, counted across the whole topic.
+	type match struct {
+		partition, offset, length int
+		freqs                     []int
+	}
+	var matches []match
+	docs, totalLength := 0, 0
+	df := make([]int, len(terms))
+	complete := true
+	for p, x := range ti.partitions {
+		start := t.partitions[p].StartOffset()
+		x.mu.RLock()
+		if x.Next < t.partitions[p].EndOffset() {
+			complete = false
+		}
+		// Records below start are counted until the next prune.
+		docs += len(x.Lengths)
+		totalLength += x.TotalLength
+		lists := make([][]posting, len(terms))
+		for i, term := range terms {
+			ps := x.Postings[term]
+			lists[i] = ps[sort.Search(len(ps), func(i int) bool { return ps[i].Offset >= start }):]
+			df[i] += len(lists[i])
+		}
+		for _, m := range intersect(lists) {
+			matches = append(matches, match{p, m[0].Offset, x.Lengths[m[0].Offset], freqs(m)})
+		}
+		x.mu.RUnlock()
+	}
+	if len(matches) == 0 {
+		return nil, complete, nil
+	}
+
+	avgLength := float64(totalLength) / float64(docs)
+	hits := make([]searchHit, len(matches))
+	for i, m := range matches {
+		score := 0.0
+		for j, f := range m.freqs {
+			idf := math.Log(1 + (float64(docs-df[j])+0.5)/(float64(df[j])+0.5))
+			tf := float64(f) * (bm25K1 + 1) / (float64(f) + bm25K1*(1-bm25B+bm25B*float64(m.length)/avgLength))
+			score += idf * tf
+		}
+		hits[i] = searchHit{Partition: m.partition, Offset: m.offset, Score: math.Round(score*1e4) / 1e4}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Offset != b.Offset {
+			return a.Offset > b.Offset
+		}
+		return a.Partition < b.Partition
+	})
+	return hits, complete, nil
+}
+
+// intersect returns, for each offset in every list, its posting from
+// each list. The lists are in offset order.
+func intersect(lists [][]posting) [][]posting {
+	if len(lists) == 0 {
+		return nil
+	}
+	var out [][]posting
+	idx := make([]int, len(lists))
+	for idx[0] < len(lists[0]) {
+		off := lists[0][idx[0]].Offset
+		all := true
+		for i := 1; i < len(lists); i++ {
+			ps := lists[i]
+			for idx[i] < len(ps) && ps[idx[i]].Offset < off {
+				idx[i]++
+			}
+			if idx[i] == len(ps) {
+				return out
+			}
+			if ps[idx[i]].Offset != off {
+				all = false
+			}
+		}
+		if all {
+			m := make([]posting, len(lists))
+			for i, ps := range lists {
+				m[i] = ps[idx[i]]
+			}
+			out = append(out, m)
+		}
+		idx[0]++
+	}
+	return out
+}
+
+func freqs(ps []posting) []int {
+	fs := make([]int, len(ps))
+	for i, p := range ps {
+		fs[i] = p.Freq
+	}
+	return fs
+}
+
+// handleSearch serves GET /search?q=...&topic=, returning the matching
+// records best first. Every word of q must match. Results are paged with
+// ?max= (default 20, at most 100) and ?skip=; next_skip is set when there
+// are more. complete is false while the index is still catching up with
+// the topic, for instance while it is rebuilt after a restart.
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	if search == nil {
+		writeError(w, errSearchDisabled)
+		return
+	}
+	q := r.URL.Query()
+	terms := queryTerms(q.Get("q"))
+	if len(terms) == 0 {
+		writeError(w, fmt.Errorf("%w: q needs at least one word", errInvalidQuery))
+		return
+	}
+	limit, skip := defaultSearchMax, 0
+	var err error
+	if s := q.Get("max"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 {
+			writeErrorCode(w, http.StatusBadRequest, CodeBadRequest, "Invalid max")
+			return
+		}
+		limit = min(limit, maxSearchMax)
+	}
+	if s := q.Get("skip"); s != "" {
+		if skip, err = strconv.Atoi(s); err != nil || skip < 0 {
+			writeErrorCode(w, http.StatusBadRequest, CodeBadRequest, "Invalid skip")
+			return
+		}
+	}
+	t, err := requestTopic(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	hits, complete, err := search.query(t.name, terms)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := struct {
+		Topic    string      `json:"topic"`
+		Query    string      `json:"query"`
+		Total    int         `json:"total"`
+		Complete bool        `json:"complete"`
+		Results  []searchHit `json:"results"`
+		NextSkip *int        `json:"next_skip,omitempty"`
+	}{Topic: t.name, Query: q.Get("q"), Total: len(hits), Complete: complete, Results: []searchHit{}}
+	page := hits[min(skip, len(hits)):min(skip+limit, len(hits))]
+	for _, h := range page {
+		rec, err := t.partitions[h.Partition].Read(h.Offset)
+		if err != nil {
+			// Removed since the index was pruned.
+			continue
+		}
+		h.Record = rec
+		res.Results = append(res.Results, h)
+	}
+	if next := skip + limit; next < len(hits) {
+		res.NextSkip = &next
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// openTestSearch indexes the server's topics, saving the indexes under
+// dir if it isn't empty. Unlike openSearch it doesn't sync or save in
+// the background; the test calls sync and save itself.
+func openTestSearch(t *testing.T, dir string) *searchIndex {
+	t.Helper()
+	s := &searchIndex{topics: make(map[string]*topicIndex)}
+	if dir != "" {
+		s.dir = filepath.Join(dir, searchDir)
+		if err := os.MkdirAll(s.dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.sync()
+	search = s
+	t.Cleanup(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, ti := range s.topics {
+			ti.cancel()
+			ti.done.Wait()
+		}
+		search = nil
+	})
+	return s
+}
+
+// waitSearch waits until a search of the default topic for q gives the
+// records at want, best first, with the index caught up.
+func waitSearch(t *testing.T, q string, want ...int) {
+	t.Helper()
+	var got []int
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hits, complete, err := search.query(defaultTopic, queryTerms(q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = got[:0]
+		for _, h := range hits {
+			got = append(got, h.Offset)
+		}
+		if complete && slices.Equal(got, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("search for %q = %v (complete %v), want %v", q, got, complete, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"error in req-42ab", "error in req 42ab req-42ab"},
+		{"Timeout talking to DB.Primary:5432", "timeout talking to db primary 5432 db.primary:5432"},
+		{"see (db.timeout).", "see db timeout db.timeout"},
+		{"user_id=7 @ alice@example.com", "user id user_id 7 alice example com alice@example.com"},
+		{"-- ...", ""},
+		{"ok " + strings.Repeat("x", maxTermLength+1), "ok"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(terms(tt.text), " "); got != tt.want {
+			t.Errorf("terms(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestQueryTerms(t *testing.T) {
+	tests := []struct {
+		q    string
+		want string
+	}{
+		// An identifier is one term, so it matches only records holding
+		// all of it.
+		{"req-42ab", "req-42ab"},
+		{"Error error ERROR", "error"},
+		{"(db.timeout) failed!", "db.timeout failed"},
+		{"-- !!", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(queryTerms(tt.q), " "); got != tt.want {
+			t.Errorf("queryTerms(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	list := func(offsets ...int) []posting {
+		var ps []posting
+		for _, o := range offsets {
+			ps = append(ps, posting{Offset: o, Freq: o + 1})
+		}
+		return ps
+	}
+	tests := []struct {
+		name  string
+		lists [][]posting
+		want  []int
+	}{
+		{"no lists", nil, nil},
+		{"one list", [][]posting{list(1, 4)}, []int{1, 4}},
+		{"overlapping", [][]posting{list(1, 3, 5, 7), list(2, 3, 7, 9)}, []int{3, 7}},
+		{"three lists", [][]posting{list(1, 2, 3, 4), list(2, 4), list(0, 4, 8)}, []int{4}},
+		{"disjoint", [][]posting{list(1, 3), list(2, 4)}, nil},
+		{"one empty", [][]posting{list(1, 3), nil}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, m := range intersect(tt.lists) {
+				if len(m) != len(tt.lists) {
+					t.Fatalf("match %v has %d postings, want one per list", m, len(m))
+				}
+				for _, p := range m {
+					if p.Offset != m[0].Offset || p.Freq != p.Offset+1 {
+						t.Fatalf("match %v mixes postings of different records", m)
+					}
+				}
+				got = append(got, m[0].Offset)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("intersect = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	setup(t)
+	openTestSearch(t, "")
+	produce(t,
+		"disk full on node one while writing the error log",
+		"error error error",
+		"disk full",
+		"nothing to see here",
+		"disk full",
+	)
+	// The record holding the term most often, and shortest, ranks first.
+	waitSearch(t, "error", 1, 0)
+	// Every word must match; equal scores go to the newest record.
+	waitSearch(t, "disk full", 4, 2, 0)
+	waitSearch(t, "missing")
+}
+
+func TestSearchPaging(t *testing.T) {
+	setup(t)
+	openTestSearch(t, "")
+	produce(t, "match 0", "match 1", "other", "match 3", "match 4", "match 5")
+	waitSearch(t, "match", 5, 4, 3, 1, 0)
+
+	type page struct {
+		Total    int         `json:"total"`
+		Complete bool        `json:"complete"`
+		Results  []searchHit `json:"results"`
+		NextSkip *int        `json:"next_skip"`
+	}
+	offsets := func(p page) []int {
+		var out []int
+		for _, h := range p.Results {
+			out = append(out, h.Offset)
+		}
+		return out
+	}
+	var p page
+	decode(t, serve(handleSearch, http.MethodGet, "/search?q=match&max=2", ""), http.StatusOK, &p)
+	if p.Total != 5 || !p.Complete || !slices.Equal(offsets(p), []int{5, 4}) || p.NextSkip == nil || *p.NextSkip != 2 {
+		t.Fatalf("first page = %+v", p)
+	}
+	if p.Results[0].Record.Value != "match 5" {
+		t.Fatalf("first result holds %+v, want the record", p.Results[0].Record)
+	}
+	p = page{}
+	decode(t, serve(handleSearch, http.MethodGet, "/search?q=match&max=2&skip=4", ""), http.StatusOK, &p)
+	if !slices.Equal(offsets(p), []int{0}) || p.NextSkip != nil {
+		t.Fatalf("last page = %+v", p)
+	}
+	p = page{}
+	decode(t, serve(handleSearch, http.MethodGet, "/search?q=match&skip=10", ""), http.StatusOK, &p)
+	if p.Total != 5 || len(p.Results) != 0 || p.NextSkip != nil {
+		t.Fatalf("page past the end = %+v", p)
+	}
+
+	// A topic created since the last sync has nothing indexed yet.
+	if _, err := topics.create("fresh", 1); err != nil {
+		t.Fatal(err)
+	}
+	p = page{}
+	decode(t, serve(handleSearch, http.MethodGet, "/search?q=match&topic=fresh", ""), http.StatusOK, &p)
+	if p.Complete {
+		t.Fatalf("search of a topic not indexed yet = %+v, want it incomplete", p)
+	}
+
+	for _, target := range []string{"/search?q=match&max=0", "/search?q=match&skip=-1", "/search?q=--"} {
+		if w := serve(handleSearch, http.MethodGet, target, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", target, w.Code)
+		}
+	}
+}
+
+func TestSearchPrune(t *testing.T) {
+	setup(t)
+	s := openTestSearch(t, "")
+	produce(t, "pear", "pear tree", "pear", "plum")
+	waitSearch(t, "pear", 2, 0, 1)
+
+	l, err := topics.partition(defaultTopic, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.DeleteBefore(2); err != nil {
+		t.Fatal(err)
+	}
+	// Records retention removed are left out at once, and forgotten at
+	// the next save.
+	waitSearch(t, "pear", 2)
+	s.save()
+	x := s.topics[defaultTopic].partitions[0]
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if len(x.Lengths) != 2 || x.TotalLength != 2 {
+		t.Fatalf("after pruning: lengths %v, total %d, want those of offsets 2 and 3", x.Lengths, x.TotalLength)
+	}
+	if ps := x.Postings["pear"]; len(ps) != 1 || ps[0].Offset != 2 {
+		t.Fatalf("postings of pear after pruning = %v", ps)
+	}
+	if _, ok := x.Postings["tree"]; ok {
+		t.Fatal("a term held only by removed records is still indexed")
+	}
+}
+
+func TestSearchTruncate(t *testing.T) {
+	setup(t)
+	openTestSearch(t, "")
+	produce(t, "apple", "cherry", "cherry")
+	waitSearch(t, "cherry", 2, 1)
+
+	// The truncated offsets are reused before the indexer next looks,
+	// so the log ends past what was indexed again.
+	l, err := topics.partition(defaultTopic, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.TruncateAfter(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.AppendBatch([]commitlog.Record{{Value: "banana"}, {Value: "banana"}, {Value: "banana"}}); err != nil {
+		t.Fatal(err)
+	}
+	waitSearch(t, "cherry")
+	waitSearch(t, "banana", 3, 2, 1)
+	waitSearch(t, "apple", 0)
+}
+
+func TestSearchRebuild(t *testing.T) {
+	setup(t)
+	dir := t.TempDir()
+	var err error
+	topics.close()
+	if topics, err = openRegistry(dir, commitlog.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	s := openTestSearch(t, dir)
+	produce(t, "first boot", "second boot")
+	waitSearch(t, "boot", 1, 0)
+	s.save()
+	path := s.path(defaultTopic, 0)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("index not saved: %v", err)
+	}
+
+	// Restart with the index lost: it is rebuilt from the partition.
+	topics.close()
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if topics, err = openRegistry(dir, commitlog.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	openTestSearch(t, dir)
+	waitSearch(t, "boot", 1, 0)
+	waitSearch(t, "second", 1)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// heartbeatInterval is how often an idle stream sends a comment line so
+// proxies and clients can tell it is still alive.
+const heartbeatInterval = 15 * time.Second
+
+// handleStream sends records of a partition from ?offset=N onwards as
+// server-sent events, one per record with the offset as the event id,
+// until the client disconnects or the partition is deleted. A
+// Last-Event-ID header resumes after that offset. A record that can't be
+// read ends the stream with an "error" event, its data the JSON error
+// envelope of an error response.
+func handleStream(w http.ResponseWriter, r *http.Request) {
+	l, err := requestLog(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		if last, idErr := strconv.Atoi(id); idErr == nil {
+			offset, err = last+1, nil
+		}
+	}
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidOffset, "Invalid offset")
+		return
+	}
+	if start, end := l.StartOffset(), l.EndOffset(); offset < start || offset > end {
+		writeError(w, &commitlog.ErrOffsetOutOfRange{Offset: offset, Start: start, End: end})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErrorCode(w, http.StatusInternalServerError, commitlog.CodeInternal, "Streaming unsupported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx := r.Context()
+	for {
+		for offset < l.EndOffset() {
+			rec, err := l.Read(offset)
+			if err != nil {
+				_, body := toAPIError(err)
+				data, _ := json.Marshal(errorEnvelope{body})
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+				flusher.Flush()
+				return
+			}
+			data, _ := json.Marshal(rec)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", rec.Offset, data)
+			offset++
+		}
+		flusher.Flush()
+
+		waitCtx, cancel := context.WithTimeout(ctx, heartbeatInterval)
+		longPollWaiters.Inc()
+		err := l.Wait(waitCtx, offset)
+		longPollWaiters.Dec()
+		cancel()
+		if ctx.Err() != nil || errors.Is(err, commitlog.ErrClosed) {
+			return
+		}
+		if err != nil {
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
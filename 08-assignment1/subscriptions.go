@@ -0,0 +1,578 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// subscriptionsFile records webhook subscriptions and their acknowledged
+// offsets in the data directory.
+const subscriptionsFile = "subscriptions.json"
+
+const (
+	defaultBatchSize   = 100
+	maxBatchSize       = 1000
+	defaultMaxAttempts = 5
+	// deadLetterSuffix names a topic's default dead-letter topic.
+	deadLetterSuffix = ".dead-letter"
+
+	minDeliveryBackoff = time.Second
+	maxDeliveryBackoff = time.Minute
+)
+
+var (
+	errSubscriptionNotFound = errors.New("subscription not found")
+	errInvalidSubscription  = errors.New("invalid subscription")
+)
+
+// subscriptionFilter selects the records a subscription delivers. Every
+// set field must match; records that don't are skipped but still
+// acknowledged.
+type subscriptionFilter struct {
+	Key           string `json:"key,omitempty"`
+	KeyPrefix     string `json:"key_prefix,omitempty"`
+	ValueContains string `json:"value_contains,omitempty"`
+}
+
+func (f subscriptionFilter) match(rec commitlog.Record) bool {
+	return (f.Key == "" || rec.Key == f.Key) &&
+		strings.HasPrefix(rec.Key, f.KeyPrefix) &&
+		strings.Contains(rec.Value, f.ValueContains)
+}
+
+// subscription pushes a topic's records to a webhook, in order within
+// each partition.
+type subscription struct {
+	ID              string             `json:"id"`
+	URL             string             `json:"url"`
+	Topic           string             `json:"topic"`
+	BatchSize       int                `json:"batch_size"`
+	Filter          subscriptionFilter `json:"filter"`
+	MaxAttempts     int                `json:"max_attempts"`
+	DeadLetterTopic string             `json:"dead_letter_topic"`
+	CreatedAt       time.Time          `json:"created_at"`
+	// Acked is, per partition, the next offset to deliver: the webhook
+	// has acknowledged everything before it.
+	Acked []int `json:"acked_offsets,omitempty"`
+}
+
+// deliveryStatus is how delivery to one partition is going. It is not
+// saved across restarts.
+type deliveryStatus struct {
+	Attempts      int        `json:"attempts,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastDelivery  *time.Time `json:"last_delivery,omitempty"`
+	DeadLettered  int        `json:"dead_lettered"`
+	RetryingSince *time.Time `json:"retrying_since,omitempty"`
+}
+
+// activeSub is a subscription with its running delivery goroutines.
+type activeSub struct {
+	subscription
+	status []deliveryStatus
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+// subscriptionStore holds every subscription, saving them to
+// subscriptionsFile after each change when the server has a data
+// directory.
+type subscriptionStore struct {
+	path   string
+	client *http.Client
+
+	mu   sync.Mutex
+	subs map[string]*activeSub
+}
+
+var subscriptions *subscriptionStore
+
+var (
+	deliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "commitlog_subscription_deliveries_total",
+		Help: "Webhook delivery attempts, by subscription and result.",
+	}, []string{"subscription", "result"})
+
+	deadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "commitlog_subscription_dead_lettered_total",
+		Help: "Records moved to a dead-letter topic after delivery kept failing, by subscription.",
+	}, []string{"subscription"})
+)
+
+// openSubscriptions loads the saved subscriptions and starts delivering
+// them. Subscriptions whose topic no longer exists are dropped.
+func openSubscriptions(dir string) (*subscriptionStore, error) {
+	s := &subscriptionStore{
+		client: &http.Client{Timeout: 30 * time.Second},
+		subs:   make(map[string]*activeSub),
+	}
+	if dir == "" {
+		return s, nil
+	}
+	s.path = filepath.Join(dir, subscriptionsFile)
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved []subscription
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("%s: %w", subscriptionsFile, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range saved {
+		t, err := topics.get(sub.Topic)
+		if err != nil {
+			continue
+		}
+		s.startLocked(sub, t)
+	}
+	return s, nil
+}
+
+// saveLocked writes every subscription to disk. s.mu must be held.
+func (s *subscriptionStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	saved := make([]subscription, 0, len(s.subs))
+	for _, a := range s.sortedLocked() {
+		saved = append(saved, a.subscription)
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return commitlog.WriteFileAtomic(s.path, data)
+}
+
+func (s *subscriptionStore) sortedLocked() []*activeSub {
+	subs := make([]*activeSub, 0, len(s.subs))
+	for _, a := range s.subs {
+		subs = append(subs, a)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs
+}
+
+// startLocked starts a goroutine per partition delivering sub. s.mu must
+// be held.
+func (s *subscriptionStore) startLocked(sub subscription, t *topic) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &activeSub{
+		subscription: sub,
+		status:       make([]deliveryStatus, len(t.partitions)),
+		cancel:       cancel,
+	}
+	s.subs[sub.ID] = a
+	for p, l := range t.partitions {
+		a.done.Add(1)
+		go func() {
+			defer a.done.Done()
+			s.deliver(ctx, a, p, l)
+		}()
+	}
+}
+
+// create validates and fills in defaults for sub, then starts it. A nil
+// start delivers only records appended from now on.
+func (s *subscriptionStore) create(sub subscription, start *int) (subscriptionInfo, error) {
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return subscriptionInfo{}, fmt.Errorf("%w: url must be an absolute http or https URL", errInvalidSubscription)
+	}
+	if sub.Topic == "" {
+		sub.Topic = defaultTopic
+	}
+	t, err := topics.get(sub.Topic)
+	if err != nil {
+		return subscriptionInfo{}, err
+	}
+	switch {
+	case sub.BatchSize == 0:
+		sub.BatchSize = defaultBatchSize
+	case sub.BatchSize < 0 || sub.BatchSize > maxBatchSize:
+		return subscriptionInfo{}, fmt.Errorf("%w: batch_size must be between 1 and %d", errInvalidSubscription, maxBatchSize)
+	}
+	switch {
+	case sub.MaxAttempts == 0:
+		sub.MaxAttempts = defaultMaxAttempts
+	case sub.MaxAttempts < 0:
+		return subscriptionInfo{}, fmt.Errorf("%w: max_attempts must be positive", errInvalidSubscription)
+	}
+	if sub.DeadLetterTopic == "" {
+		sub.DeadLetterTopic = sub.Topic + deadLetterSuffix
+	}
+	if sub.DeadLetterTopic == sub.Topic || !topicName.MatchString(sub.DeadLetterTopic) {
+		return subscriptionInfo{}, fmt.Errorf("%w: invalid dead_letter_topic %q", errInvalidSubscription, sub.DeadLetterTopic)
+	}
+	if start != nil && *start < 0 {
+		return subscriptionInfo{}, fmt.Errorf("%w: start_offset must not be negative", errInvalidSubscription)
+	}
+
+	sub.ID = newSubscriptionID()
+	sub.CreatedAt = time.Now().UTC()
+	sub.Acked = make([]int, len(t.partitions))
+	for p, l := range t.partitions {
+		if start == nil {
+			sub.Acked[p] = l.EndOffset()
+		} else {
+			sub.Acked[p] = min(max(*start, l.StartOffset()), l.EndOffset())
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.startLocked(sub, t)
+	if err := s.saveLocked(); err != nil {
+		return subscriptionInfo{}, err
+	}
+	return s.subs[sub.ID].infoLocked(), nil
+}
+
+func newSubscriptionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// delete stops a subscription and forgets it.
+func (s *subscriptionStore) delete(id string) error {
+	s.mu.Lock()
+	a, ok := s.subs[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", errSubscriptionNotFound, id)
+	}
+	delete(s.subs, id)
+	err := s.saveLocked()
+	s.mu.Unlock()
+
+	// Wait outside the lock: a delivery goroutine may be acknowledging.
+	a.cancel()
+	a.done.Wait()
+	return err
+}
+
+// forgetTopic deletes the subscriptions to a deleted topic.
+func (s *subscriptionStore) forgetTopic(name string) {
+	s.mu.Lock()
+	var ids []string
+	for id, a := range s.subs {
+		if a.Topic == name {
+			ids = append(ids, id)
+		}
+	}
+	s.mu.Unlock()
+	for _, id := range ids {
+		s.delete(id)
+	}
+}
+
+// ack records that everything before next in partition p was delivered.
+func (s *subscriptionStore) ack(a *activeSub, p, next int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a.Acked[p] = next
+	if s.subs[a.ID] == a {
+		if err := s.saveLocked(); err != nil {
+			log.Printf("subscription %s: saving acknowledged offset: %v", a.ID, err)
+		}
+	}
+}
+
+// setStatus applies fn to partition p's delivery status.
+func (s *subscriptionStore) setStatus(a *activeSub, p int, fn func(*deliveryStatus)) {
+	s.mu.Lock()
+	fn(&a.status[p])
+	s.mu.Unlock()
+}
+
+func (s *subscriptionStore) acked(a *activeSub, p int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return a.Acked[p]
+}
+
+// deliver pushes partition p's records to the webhook until ctx is done
+// or the partition is closed.
+func (s *subscriptionStore) deliver(ctx context.Context, a *activeSub, p int, l *commitlog.Tailable) {
+	for {
+		off := s.acked(a, p)
+		// Retention may have removed undelivered records, and
+		// TruncateAfter the acknowledged ones; carry on from what the
+		// partition holds.
+		if start, end := l.StartOffset(), l.EndOffset(); off < start || off > end {
+			off = min(max(off, start), end)
+			s.ack(a, p, off)
+		}
+		if err := l.Wait(ctx, off); err != nil {
+			return
+		}
+		recs, err := commitlog.ReadRange(l, off, a.BatchSize)
+		if err != nil || len(recs) == 0 {
+			// Most likely a concurrent DeleteBefore or TruncateAfter;
+			// the next pass picks a new offset.
+			if !sleepCtx(ctx, minDeliveryBackoff) {
+				return
+			}
+			continue
+		}
+		next := recs[len(recs)-1].Offset + 1
+
+		var batch []commitlog.Record
+		for _, rec := range recs {
+			if a.Filter.match(rec) {
+				batch = append(batch, rec)
+			}
+		}
+		if len(batch) > 0 && !s.deliverBatch(ctx, a, p, batch) {
+			return
+		}
+		s.ack(a, p, next)
+	}
+}
+
+// deliverBatch POSTs batch until the webhook accepts it or MaxAttempts
+// is used up, when the batch is moved to the dead-letter topic. It
+// returns false if ctx was cancelled first.
+func (s *subscriptionStore) deliverBatch(ctx context.Context, a *activeSub, p int, batch []commitlog.Record) bool {
+	body, _ := json.Marshal(struct {
+		Subscription string             `json:"subscription"`
+		Topic        string             `json:"topic"`
+		Partition    int                `json:"partition"`
+		Records      []commitlog.Record `json:"records"`
+	}{a.ID, a.Topic, p, batch})
+
+	backoff := minDeliveryBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.post(ctx, a.URL, body)
+		if ctx.Err() != nil {
+			return false
+		}
+		now := time.Now().UTC()
+		if err == nil {
+			deliveries.WithLabelValues(a.ID, "ok").Inc()
+			s.setStatus(a, p, func(st *deliveryStatus) {
+				st.Attempts, st.LastError, st.RetryingSince = 0, "", nil
+				st.LastDelivery = &now
+			})
+			return true
+		}
+		deliveries.WithLabelValues(a.ID, "failed").Inc()
+		s.setStatus(a, p, func(st *deliveryStatus) {
+			st.Attempts, st.LastError = attempt, err.Error()
+			if st.RetryingSince == nil {
+				st.RetryingSince = &now
+			}
+		})
+		if attempt >= a.MaxAttempts {
+			if err := s.deadLetter(a, p, batch, attempt, err); err != nil {
+				// Without a dead-letter topic the records would be
+				// lost; keep retrying them instead.
+				log.Printf("subscription %s: dead-lettering partition %d: %v", a.ID, p, err)
+			} else {
+				s.setStatus(a, p, func(st *deliveryStatus) {
+					st.Attempts, st.RetryingSince = 0, nil
+					st.DeadLettered += len(batch)
+				})
+				return true
+			}
+		}
+		if !sleepCtx(ctx, backoff) {
+			return false
+		}
+		backoff = min(backoff*2, maxDeliveryBackoff)
+	}
+}
+
+func (s *subscriptionStore) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// deadLetter appends batch to the subscription's dead-letter topic,
+// creating it with one partition if needed. Each record keeps its key;
+// its value describes the original record and the last delivery error.
+func (s *subscriptionStore) deadLetter(a *activeSub, p int, batch []commitlog.Record, attempts int, cause error) error {
+	t, err := topics.get(a.DeadLetterTopic)
+	if errors.Is(err, errTopicNotFound) {
+		t, err = topics.create(a.DeadLetterTopic, 1)
+		if errors.Is(err, errTopicExists) {
+			t, err = topics.get(a.DeadLetterTopic)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	for _, rec := range batch {
+		value, _ := json.Marshal(struct {
+			Subscription string           `json:"subscription"`
+			Topic        string           `json:"topic"`
+			Partition    int              `json:"partition"`
+			Record       commitlog.Record `json:"record"`
+			Attempts     int              `json:"attempts"`
+			Error        string           `json:"error"`
+		}{a.ID, a.Topic, p, rec, attempts, cause.Error()})
+		dl := commitlog.Record{Key: rec.Key, Value: string(value)}
+		l, err := topics.partition(t.name, t.partitionFor(dl.Key))
+		if err != nil {
+			return err
+		}
+		if _, err := l.Append(dl); err != nil {
+			return err
+		}
+		recordsAppended.WithLabelValues(t.name).Inc()
+		bytesAppended.WithLabelValues(t.name).Add(float64(len(dl.Key) + len(dl.Value)))
+		deadLettered.WithLabelValues(a.ID).Inc()
+	}
+	return nil
+}
+
+// sleepCtx sleeps for d, returning false if ctx is done first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// subscriptionInfo is a subscription with its delivery progress in each
+// partition.
+type subscriptionInfo struct {
+	subscription
+	Partitions []subscriptionPartition `json:"partitions"`
+}
+
+type subscriptionPartition struct {
+	Partition   int `json:"partition"`
+	AckedOffset int `json:"acked_offset"`
+	EndOffset   int `json:"end_offset"`
+	deliveryStatus
+}
+
+// infoLocked describes a. subscriptions.mu must be held.
+func (a *activeSub) infoLocked() subscriptionInfo {
+	info := subscriptionInfo{subscription: a.subscription}
+	info.Acked = nil // reported per partition instead
+	for p, acked := range a.Acked {
+		sp := subscriptionPartition{Partition: p, AckedOffset: acked, deliveryStatus: a.status[p]}
+		if l, err := topics.partition(a.Topic, p); err == nil {
+			sp.EndOffset = l.EndOffset()
+		}
+		info.Partitions = append(info.Partitions, sp)
+	}
+	return info
+}
+
+func (s *subscriptionStore) list() []subscriptionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := []subscriptionInfo{}
+	for _, a := range s.sortedLocked() {
+		infos = append(infos, a.infoLocked())
+	}
+	return infos
+}
+
+func (s *subscriptionStore) get(id string) (subscriptionInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.subs[id]
+	if !ok {
+		return subscriptionInfo{}, fmt.Errorf("%w: %s", errSubscriptionNotFound, id)
+	}
+	return a.infoLocked(), nil
+}
+
+// handleSubscriptions lists subscriptions, or creates one from
+//
+//	{"url", "topic", "start_offset", "batch_size", "filter",
+//	 "max_attempts", "dead_letter_topic"}
+//
+// Without start_offset only records appended from now on are delivered.
+func handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]subscriptionInfo{"subscriptions": subscriptions.list()})
+	case http.MethodPost:
+		var req struct {
+			subscription
+			StartOffset *int `json:"start_offset"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorCode(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+			return
+		}
+		info, err := subscriptions.create(req.subscription, req.StartOffset)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(info)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func handleSubscription(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		info, err := subscriptions.get(id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	case http.MethodDelete:
+		if err := subscriptions.delete(id); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// webhook is a subscriber that fails the first failures deliveries and
+// accepts the rest, recording the batches it was sent.
+type webhook struct {
+	*httptest.Server
+	failures int
+
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func newWebhook(t *testing.T, failures int) *webhook {
+	h := &webhook{failures: failures}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Records []commitlog.Record `json:"records"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		var values []string
+		for _, rec := range body.Records {
+			values = append(values, rec.Value)
+		}
+		h.mu.Lock()
+		h.batches = append(h.batches, values)
+		fail := len(h.batches) <= h.failures
+		h.mu.Unlock()
+		if fail {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(h.Close)
+	return h
+}
+
+func (h *webhook) sent() [][]string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.batches
+}
+
+// subscribe creates a subscription to the default topic from offset 0.
+func subscribe(t *testing.T, body string) subscriptionInfo {
+	t.Helper()
+	var info subscriptionInfo
+	decode(t, serve(handleSubscriptions, http.MethodPost, "/subscriptions", body), http.StatusCreated, &info)
+	return info
+}
+
+// waitAcked waits until the subscription has acknowledged offset in
+// partition 0, and returns it.
+func waitAcked(t *testing.T, id string, offset int) subscriptionInfo {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		info, err := subscriptions.get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Partitions[0].AckedOffset >= offset {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("subscription never acknowledged offset %d: %+v", offset, info.Partitions[0])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscriptionRetry(t *testing.T) {
+	setup(t)
+	produce(t, "a", "b")
+	hook := newWebhook(t, 1)
+	info := subscribe(t, fmt.Sprintf(`{"url": %q, "start_offset": 0, "max_attempts": 3}`, hook.URL))
+
+	info = waitAcked(t, info.ID, 2)
+	// The failed batch is sent again, whole, before anything after it.
+	if sent := fmt.Sprint(hook.sent()); sent != "[[a b] [a b]]" {
+		t.Fatalf("webhook got %s, want [a b] twice", sent)
+	}
+	st := info.Partitions[0].deliveryStatus
+	if st.Attempts != 0 || st.LastError != "" || st.RetryingSince != nil || st.LastDelivery == nil || st.DeadLettered != 0 {
+		t.Fatalf("status after a successful retry = %+v", st)
+	}
+	if _, err := topics.get(defaultTopic + deadLetterSuffix); err == nil {
+		t.Fatal("a retried batch was dead-lettered")
+	}
+}
+
+func TestSubscriptionDeadLetter(t *testing.T) {
+	setup(t)
+	produce(t, "a", "b")
+	hook := newWebhook(t, 2)
+	info := subscribe(t, fmt.Sprintf(`{"url": %q, "start_offset": 0, "max_attempts": 2}`, hook.URL))
+
+	// After max_attempts the batch is dead-lettered and acknowledged,
+	// and delivery goes on with the next records.
+	info = waitAcked(t, info.ID, 2)
+	if st := info.Partitions[0].deliveryStatus; st.DeadLettered != 2 || st.Attempts != 0 || st.RetryingSince != nil {
+		t.Fatalf("status after dead-lettering = %+v", st)
+	}
+	produce(t, "c")
+	waitAcked(t, info.ID, 3)
+	if sent := fmt.Sprint(hook.sent()); sent != "[[a b] [a b] [c]]" {
+		t.Fatalf("webhook got %s, want [a b] twice, then [c]", sent)
+	}
+
+	dl, err := topics.get(info.DeadLetterTopic)
+	if err != nil {
+		t.Fatalf("dead-letter topic %s: %v", info.DeadLetterTopic, err)
+	}
+	recs, err := commitlog.List(dl.partitions[0])
+	if err != nil || len(recs) != 2 {
+		t.Fatalf("dead-lettered records = %v, %v, want 2", recs, err)
+	}
+	for i, rec := range recs {
+		var entry struct {
+			Subscription string           `json:"subscription"`
+			Topic        string           `json:"topic"`
+			Partition    int              `json:"partition"`
+			Record       commitlog.Record `json:"record"`
+			Attempts     int              `json:"attempts"`
+			Error        string           `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(rec.Value), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Subscription != info.ID || entry.Topic != defaultTopic || entry.Record.Offset != i ||
+			entry.Attempts != 2 || entry.Error == "" {
+			t.Fatalf("dead-lettered record %d = %+v", i, entry)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// defaultTopic is used by requests that don't name a topic. It always
+// exists and cannot be deleted.
+const defaultTopic = "default"
+
+// topicsFile records the topics and their partition counts in the data
+// directory.
+const topicsFile = "topics.json"
+
+var (
+	errTopicNotFound     = errors.New("topic not found")
+	errTopicExists       = errors.New("topic already exists")
+	errPartitionNotFound = errors.New("partition not found")
+	errInvalidTopic      = errors.New("invalid topic")
+
+	topicName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,200}$`)
+)
+
+// topic is a named set of partitions, each its own log.
+type topic struct {
+	name       string
+	partitions []*commitlog.Tailable
+	next       atomic.Uint64 // round-robin partition for unkeyed records
+}
+
+// partitionFor picks the partition for a record: by hash of its key, or
+// round-robin when it has none.
+func (t *topic) partitionFor(key string) int {
+	n := len(t.partitions)
+	if key == "" {
+		return int(t.next.Add(1) % uint64(n))
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// topicInfo is the JSON description of a topic.
+type topicInfo struct {
+	Name       string          `json:"name"`
+	Partitions []partitionInfo `json:"partitions"`
+}
+
+type partitionInfo struct {
+	Partition   int `json:"partition"`
+	StartOffset int `json:"start_offset"`
+	EndOffset   int `json:"end_offset"`
+}
+
+func (t *topic) info() topicInfo {
+	info := topicInfo{Name: t.name}
+	for i, p := range t.partitions {
+		info.Partitions = append(info.Partitions, partitionInfo{
+			Partition:   i,
+			StartOffset: p.StartOffset(),
+			EndOffset:   p.EndOffset(),
+		})
+	}
+	return info
+}
+
+// registry holds the server's topics. With a data directory each
+// partition is a FileLog in <dir>/<topic>-<partition>; otherwise
+// partitions are kept in memory.
+type registry struct {
+	dir string
+	cfg commitlog.Config
+
+	mu     sync.RWMutex
+	topics map[string]*topic
+}
+
+func openRegistry(dir string, cfg commitlog.Config) (*registry, error) {
+	r := &registry{dir: dir, cfg: cfg, topics: make(map[string]*topic)}
+	counts := map[string]int{}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		if err := migrateRootLog(dir); err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(filepath.Join(dir, topicsFile))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &counts); err != nil {
+				return nil, fmt.Errorf("%s: %w", topicsFile, err)
+			}
+		}
+	}
+	if counts[defaultTopic] == 0 {
+		counts[defaultTopic] = 1
+	}
+	for name, n := range counts {
+		t, err := r.openTopic(name, n)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		r.topics[name] = t
+	}
+	return r, r.save()
+}
+
+// migrateRootLog moves segments written directly into the data
+// directory by earlier versions into the default topic's partition.
+func migrateRootLog(dir string) error {
+	files, err := commitlog.SegmentFiles(dir)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	dst := filepath.Join(dir, defaultTopic+"-0")
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	names := []string{"start-offset"}
+	for _, f := range files {
+		names = append(names, filepath.Base(f.StorePath), filepath.Base(f.IndexPath))
+	}
+	for _, name := range names {
+		err := os.Rename(filepath.Join(dir, name), filepath.Join(dst, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *registry) partitionDir(name string, p int) string {
+	return filepath.Join(r.dir, name+"-"+strconv.Itoa(p))
+}
+
+// tierPrefix is where a partition's segments go in the tiered store.
+func (r *registry) tierPrefix(name string, p int) string {
+	return name + "-" + strconv.Itoa(p) + "/"
+}
+
+func (r *registry) openTopic(name string, partitions int) (*topic, error) {
+	t := &topic{name: name}
+	for p := 0; p < partitions; p++ {
+		var l commitlog.Log = commitlog.NewMemoryLog()
+		if r.dir != "" {
+			cfg := r.cfg
+			cfg.Tier.Prefix = r.tierPrefix(name, p)
+			fl, err := commitlog.OpenFileLog(r.partitionDir(name, p), cfg)
+			if err != nil {
+				for _, pl := range t.partitions {
+					pl.Close()
+				}
+				return nil, fmt.Errorf("topic %s partition %d: %w", name, p, err)
+			}
+			l = fl
+		}
+		t.partitions = append(t.partitions, commitlog.NewTailable(l))
+	}
+	return t, nil
+}
+
+// save writes the topic list to the data directory. The caller must not
+// hold r.mu for writing.
+func (r *registry) save() error {
+	if r.dir == "" {
+		return nil
+	}
+	r.mu.RLock()
+	counts := make(map[string]int, len(r.topics))
+	for name, t := range r.topics {
+		counts[name] = len(t.partitions)
+	}
+	r.mu.RUnlock()
+	data, err := json.MarshalIndent(counts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return commitlog.WriteFileAtomic(filepath.Join(r.dir, topicsFile), data)
+}
+
+func (r *registry) get(name string) (*topic, error) {
+	if name == "" {
+		name = defaultTopic
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.topics[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errTopicNotFound, name)
+	}
+	return t, nil
+}
+
+// partition returns the log for partition p of the named topic.
+func (r *registry) partition(name string, p int) (*commitlog.Tailable, error) {
+	t, err := r.get(name)
+	if err != nil {
+		return nil, err
+	}
+	if p < 0 || p >= len(t.partitions) {
+		return nil, fmt.Errorf("%w: %s/%d", errPartitionNotFound, t.name, p)
+	}
+	return t.partitions[p], nil
+}
+
+func (r *registry) list() []*topic {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	topics := make([]*topic, 0, len(r.topics))
+	for _, t := range r.topics {
+		topics = append(topics, t)
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].name < topics[j].name })
+	return topics
+}
+
+func (r *registry) create(name string, partitions int) (*topic, error) {
+	if !topicName.MatchString(name) {
+		return nil, fmt.Errorf("%w: names may only contain letters, digits, '.', '_' and '-'", errInvalidTopic)
+	}
+	if partitions < 1 {
+		return nil, fmt.Errorf("%w: a topic needs at least one partition", errInvalidTopic)
+	}
+	r.mu.Lock()
+	if _, ok := r.topics[name]; ok {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", errTopicExists, name)
+	}
+	t, err := r.openTopic(name, partitions)
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	r.topics[name] = t
+	r.mu.Unlock()
+	return t, r.save()
+}
+
+// delete closes and removes a topic and its data.
+func (r *registry) delete(name string) error {
+	if name == defaultTopic {
+		return fmt.Errorf("%w: the default topic cannot be deleted", errInvalidTopic)
+	}
+	r.mu.Lock()
+	t, ok := r.topics[name]
+	if !ok {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s", errTopicNotFound, name)
+	}
+	delete(r.topics, name)
+	r.mu.Unlock()
+
+	if err := r.save(); err != nil {
+		return err
+	}
+	for p, l := range t.partitions {
+		l.Close()
+		if r.dir != "" {
+			if err := os.RemoveAll(r.partitionDir(name, p)); err != nil {
+				return err
+			}
+		}
+		if store := r.cfg.Tier.Store; store != nil {
+			if err := commitlog.DeleteObjects(context.Background(), store, r.tierPrefix(name, p)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *registry) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.topics {
+		for _, l := range t.partitions {
+			l.Close()
+		}
+	}
+}
+
+func handleTopics(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var infos []topicInfo
+		for _, t := range topics.list() {
+			infos = append(infos, t.info())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]topicInfo{"topics": infos})
+	case http.MethodPost:
+		var req struct {
+			Name       string `json:"name"`
+			Partitions int    `json:"partitions"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorCode(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+			return
+		}
+		if req.Partitions == 0 {
+			req.Partitions = 1
+		}
+		t, err := topics.create(req.Name, req.Partitions)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(t.info())
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func handleTopic(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	switch r.Method {
+	case http.MethodGet:
+		t, err := topics.get(name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.info())
+	case http.MethodDelete:
+		if err := topics.delete(name); err != nil {
+			writeError(w, err)
+			return
+		}
+		// The topic is gone either way, so the delete still succeeds.
+		if err := groups.forgetTopic(name); err != nil {
+			log.Printf("topic %s: forgetting committed offsets: %v", name, err)
+		}
+		subscriptions.forgetTopic(name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w)
+	}
+}
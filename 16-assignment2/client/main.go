@@ -21,12 +21,15 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to connect: %v", err)
 	}
-	defer conn.Close()
+	defer func() { conn.Close() }()
 
 	client := pb.NewKeyValueStoreClient(conn)
 	reader := bufio.NewReader(os.Stdin)
+	// The context of each key as last read or written, sent with the next
+	// put of the key so it replaces what was seen.
+	contexts := make(map[string]*pb.VectorClock)
 
-	fmt.Println("Commands: put <key> <value> | get <key> | list | exit")
+	fmt.Println("Commands: put <key> <value> [one|quorum|all] | get <key> [one|quorum|all] | list | leave | exit")
 
 	for {
 		fmt.Print("> ")
@@ -39,25 +42,59 @@ func main() {
 		parts := strings.Split(cmdLine, " ")
 		switch parts[0] {
 		case "put":
-			if len(parts) != 3 {
-				fmt.Println("Usage: put <key> <value>")
+			if len(parts) < 3 || len(parts) > 4 {
+				fmt.Println("Usage: put <key> <value> [one|quorum|all]")
 				continue
 			}
-			_, err := client.Put(context.Background(), &pb.KeyValue{Key: parts[1], Value: parts[2]})
-			if err != nil {
+			consistency, ok := parseConsistency(parts[3:])
+			if !ok {
+				fmt.Println("Usage: put <key> <value> [one|quorum|all]")
+				continue
+			}
+			kv := &pb.KeyValue{Key: parts[1], Value: parts[2], Consistency: consistency, Context: contexts[parts[1]]}
+			ack, err := client.Put(context.Background(), kv)
+			if err == nil && !ack.Success && ack.Leader != "" {
+				// Writes go to the leader: switch to it and retry.
+				fmt.Printf("Redirected to leader %s\n", ack.Leader)
+				conn.Close()
+				conn, err = grpc.Dial(ack.Leader, grpc.WithInsecure())
+				if err != nil {
+					log.Fatalf("Failed to connect: %v", err)
+				}
+				client = pb.NewKeyValueStoreClient(conn)
+				ack, err = client.Put(context.Background(), kv)
+			}
+			switch {
+			case err != nil:
 				fmt.Printf("Error: %v\n", err)
-			} else {
-				fmt.Println("Stored and replicated")
+			case !ack.Success:
+				fmt.Printf("Error: not stored; leader is now %q\n", ack.Leader)
+			default:
+				contexts[parts[1]] = ack.Context
+				fmt.Println("Stored")
 			}
 
 		case "get":
-			if len(parts) != 2 {
-				fmt.Println("Usage: get <key>")
+			if len(parts) < 2 || len(parts) > 3 {
+				fmt.Println("Usage: get <key> [one|quorum|all]")
 				continue
 			}
-			res, err := client.Get(context.Background(), &pb.Key{Key: parts[1]})
+			consistency, ok := parseConsistency(parts[2:])
+			if !ok {
+				fmt.Println("Usage: get <key> [one|quorum|all]")
+				continue
+			}
+			res, err := client.Get(context.Background(), &pb.Key{Key: parts[1], Consistency: consistency})
 			if err != nil {
 				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			contexts[parts[1]] = res.Context
+			if len(res.Siblings) > 1 {
+				fmt.Printf("%s has %d conflicting values (put a new one to replace them all):\n", parts[1], len(res.Siblings))
+				for _, sib := range res.Siblings {
+					fmt.Printf("  %s  (write %d taken by %s)\n", sib.Value, sib.Counter, sib.Node)
+				}
 			} else {
 				fmt.Printf("%s = %s\n", parts[1], res.Value)
 			}
@@ -76,12 +113,33 @@ func main() {
 				fmt.Printf("%s = %s\n", kv.Key, kv.Value)
 			}
 
+		case "leave":
+			// Takes the node off the hash ring, in quorum replication.
+			// It hands its keys over and stops.
+			addr := fmt.Sprintf("localhost:%s", port)
+			if _, err := pb.NewMembershipClient(conn).Leave(context.Background(), &pb.Member{Addr: addr}); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			fmt.Printf("%s left the ring\n", addr)
+			return
+
 		case "exit":
 			fmt.Println("Bye!")
 			return
 
 		default:
-			fmt.Println("Commands: put/get/list/exit")
+			fmt.Println("Commands: put/get/list/leave/exit")
 		}
 	}
 }
+
+// parseConsistency parses an optional consistency level argument; with
+// none the server's default applies.
+func parseConsistency(args []string) (pb.Consistency, bool) {
+	if len(args) == 0 {
+		return pb.Consistency_CONSISTENCY_DEFAULT, true
+	}
+	c, ok := pb.Consistency_value["CONSISTENCY_"+strings.ToUpper(args[0])]
+	return pb.Consistency(c), ok
+}
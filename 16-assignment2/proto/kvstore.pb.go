@@ -21,17 +21,204 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
-type KeyValue struct {
+// How many of a key's owners a request waits for, in quorum
+// replication. The server's -w and -r flags set what CONSISTENCY_DEFAULT
+// means.
+type Consistency int32
+
+const (
+	Consistency_CONSISTENCY_DEFAULT Consistency = 0
+	Consistency_CONSISTENCY_ONE     Consistency = 1
+	Consistency_CONSISTENCY_QUORUM  Consistency = 2
+	Consistency_CONSISTENCY_ALL     Consistency = 3
+)
+
+// Enum value maps for Consistency.
+var (
+	Consistency_name = map[int32]string{
+		0: "CONSISTENCY_DEFAULT",
+		1: "CONSISTENCY_ONE",
+		2: "CONSISTENCY_QUORUM",
+		3: "CONSISTENCY_ALL",
+	}
+	Consistency_value = map[string]int32{
+		"CONSISTENCY_DEFAULT": 0,
+		"CONSISTENCY_ONE":     1,
+		"CONSISTENCY_QUORUM":  2,
+		"CONSISTENCY_ALL":     3,
+	}
+)
+
+func (x Consistency) Enum() *Consistency {
+	p := new(Consistency)
+	*p = x
+	return p
+}
+
+func (x Consistency) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Consistency) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_kvstore_proto_enumTypes[0].Descriptor()
+}
+
+func (Consistency) Type() protoreflect.EnumType {
+	return &file_proto_kvstore_proto_enumTypes[0]
+}
+
+func (x Consistency) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Consistency.Descriptor instead.
+func (Consistency) EnumDescriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{0}
+}
+
+// VectorClock counts, for each node, the writes it took that a value
+// follows from.
+type VectorClock struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
-	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Counters      map[string]uint64      `protobuf:"bytes,1,rep,name=counters,proto3" json:"counters,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VectorClock) Reset() {
+	*x = VectorClock{}
+	mi := &file_proto_kvstore_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VectorClock) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VectorClock) ProtoMessage() {}
+
+func (x *VectorClock) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VectorClock.ProtoReflect.Descriptor instead.
+func (*VectorClock) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *VectorClock) GetCounters() map[string]uint64 {
+	if x != nil {
+		return x.Counters
+	}
+	return nil
+}
+
+// Sibling is one of a key's values in quorum replication. A key has more
+// than one after writes that didn't know of each other.
+type Sibling struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Value string                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	// The context the value was written with: the writes it replaces.
+	Context *VectorClock `protobuf:"bytes,2,opt,name=context,proto3" json:"context,omitempty"`
+	// The value's own write: the node that took it, and that node's count
+	// of the writes it took.
+	Node          string `protobuf:"bytes,3,opt,name=node,proto3" json:"node,omitempty"`
+	Counter       uint64 `protobuf:"varint,4,opt,name=counter,proto3" json:"counter,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Sibling) Reset() {
+	*x = Sibling{}
+	mi := &file_proto_kvstore_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Sibling) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Sibling) ProtoMessage() {}
+
+func (x *Sibling) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Sibling.ProtoReflect.Descriptor instead.
+func (*Sibling) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Sibling) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *Sibling) GetContext() *VectorClock {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
+func (x *Sibling) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *Sibling) GetCounter() uint64 {
+	if x != nil {
+		return x.Counter
+	}
+	return 0
+}
+
+type KeyValue struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Key         string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value       string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Consistency Consistency            `protobuf:"varint,4,opt,name=consistency,proto3,enum=kvstore.Consistency" json:"consistency,omitempty"`
+	// For Put in quorum replication: the context from a Get of the key.
+	// The write replaces the values the context covers; without it, the
+	// write is kept alongside the key's current values.
+	Context *VectorClock `protobuf:"bytes,5,opt,name=context,proto3" json:"context,omitempty"`
+	// For Replicate: the write as the node that took it stored it.
+	Sibling *Sibling `protobuf:"bytes,6,opt,name=sibling,proto3" json:"sibling,omitempty"`
+	// Set on requests one node sends another on behalf of a client, and on
+	// the Replicate a coordinator sends an owner. A node that by its view of
+	// the ring doesn't own the key fails it as unavailable rather than
+	// serve it or forward it on, so that only owners count toward a
+	// quorum.
+	Forwarded     bool `protobuf:"varint,7,opt,name=forwarded,proto3" json:"forwarded,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *KeyValue) Reset() {
 	*x = KeyValue{}
-	mi := &file_proto_kvstore_proto_msgTypes[0]
+	mi := &file_proto_kvstore_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -43,7 +230,7 @@ func (x *KeyValue) String() string {
 func (*KeyValue) ProtoMessage() {}
 
 func (x *KeyValue) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_kvstore_proto_msgTypes[0]
+	mi := &file_proto_kvstore_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -56,7 +243,7 @@ func (x *KeyValue) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use KeyValue.ProtoReflect.Descriptor instead.
 func (*KeyValue) Descriptor() ([]byte, []int) {
-	return file_proto_kvstore_proto_rawDescGZIP(), []int{0}
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *KeyValue) GetKey() string {
@@ -73,16 +260,47 @@ func (x *KeyValue) GetValue() string {
 	return ""
 }
 
+func (x *KeyValue) GetConsistency() Consistency {
+	if x != nil {
+		return x.Consistency
+	}
+	return Consistency_CONSISTENCY_DEFAULT
+}
+
+func (x *KeyValue) GetContext() *VectorClock {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
+func (x *KeyValue) GetSibling() *Sibling {
+	if x != nil {
+		return x.Sibling
+	}
+	return nil
+}
+
+func (x *KeyValue) GetForwarded() bool {
+	if x != nil {
+		return x.Forwarded
+	}
+	return false
+}
+
 type Key struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Key         string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Consistency Consistency            `protobuf:"varint,2,opt,name=consistency,proto3,enum=kvstore.Consistency" json:"consistency,omitempty"`
+	// As in KeyValue.
+	Forwarded     bool `protobuf:"varint,3,opt,name=forwarded,proto3" json:"forwarded,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Key) Reset() {
 	*x = Key{}
-	mi := &file_proto_kvstore_proto_msgTypes[1]
+	mi := &file_proto_kvstore_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -94,7 +312,7 @@ func (x *Key) String() string {
 func (*Key) ProtoMessage() {}
 
 func (x *Key) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_kvstore_proto_msgTypes[1]
+	mi := &file_proto_kvstore_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -107,7 +325,7 @@ func (x *Key) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Key.ProtoReflect.Descriptor instead.
 func (*Key) Descriptor() ([]byte, []int) {
-	return file_proto_kvstore_proto_rawDescGZIP(), []int{1}
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *Key) GetKey() string {
@@ -117,16 +335,35 @@ func (x *Key) GetKey() string {
 	return ""
 }
 
+func (x *Key) GetConsistency() Consistency {
+	if x != nil {
+		return x.Consistency
+	}
+	return Consistency_CONSISTENCY_DEFAULT
+}
+
+func (x *Key) GetForwarded() bool {
+	if x != nil {
+		return x.Forwarded
+	}
+	return false
+}
+
 type Value struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Value         string                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The key's value, if it has exactly one.
+	Value string `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	// In quorum replication, all the key's values.
+	Siblings []*Sibling `protobuf:"bytes,3,rep,name=siblings,proto3" json:"siblings,omitempty"`
+	// The context to Put with to replace all of siblings.
+	Context       *VectorClock `protobuf:"bytes,4,opt,name=context,proto3" json:"context,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Value) Reset() {
 	*x = Value{}
-	mi := &file_proto_kvstore_proto_msgTypes[2]
+	mi := &file_proto_kvstore_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -138,7 +375,7 @@ func (x *Value) String() string {
 func (*Value) ProtoMessage() {}
 
 func (x *Value) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_kvstore_proto_msgTypes[2]
+	mi := &file_proto_kvstore_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -151,7 +388,7 @@ func (x *Value) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Value.ProtoReflect.Descriptor instead.
 func (*Value) Descriptor() ([]byte, []int) {
-	return file_proto_kvstore_proto_rawDescGZIP(), []int{2}
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *Value) GetValue() string {
@@ -161,16 +398,36 @@ func (x *Value) GetValue() string {
 	return ""
 }
 
+func (x *Value) GetSiblings() []*Sibling {
+	if x != nil {
+		return x.Siblings
+	}
+	return nil
+}
+
+func (x *Value) GetContext() *VectorClock {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
 type Ack struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Success bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	// Set when a follower refuses a write: the address of the leader to
+	// send it to instead.
+	Leader string `protobuf:"bytes,2,opt,name=leader,proto3" json:"leader,omitempty"`
+	// In quorum replication, the context for a following Put that
+	// replaces the stored write.
+	Context       *VectorClock `protobuf:"bytes,3,opt,name=context,proto3" json:"context,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Ack) Reset() {
 	*x = Ack{}
-	mi := &file_proto_kvstore_proto_msgTypes[3]
+	mi := &file_proto_kvstore_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -182,7 +439,7 @@ func (x *Ack) String() string {
 func (*Ack) ProtoMessage() {}
 
 func (x *Ack) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_kvstore_proto_msgTypes[3]
+	mi := &file_proto_kvstore_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -195,7 +452,7 @@ func (x *Ack) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Ack.ProtoReflect.Descriptor instead.
 func (*Ack) Descriptor() ([]byte, []int) {
-	return file_proto_kvstore_proto_rawDescGZIP(), []int{3}
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *Ack) GetSuccess() bool {
@@ -205,6 +462,20 @@ func (x *Ack) GetSuccess() bool {
 	return false
 }
 
+func (x *Ack) GetLeader() string {
+	if x != nil {
+		return x.Leader
+	}
+	return ""
+}
+
+func (x *Ack) GetContext() *VectorClock {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
 type Empty struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -213,7 +484,7 @@ type Empty struct {
 
 func (x *Empty) Reset() {
 	*x = Empty{}
-	mi := &file_proto_kvstore_proto_msgTypes[4]
+	mi := &file_proto_kvstore_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -225,7 +496,7 @@ func (x *Empty) String() string {
 func (*Empty) ProtoMessage() {}
 
 func (x *Empty) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_kvstore_proto_msgTypes[4]
+	mi := &file_proto_kvstore_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -238,29 +509,883 @@ func (x *Empty) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Empty.ProtoReflect.Descriptor instead.
 func (*Empty) Descriptor() ([]byte, []int) {
-	return file_proto_kvstore_proto_rawDescGZIP(), []int{4}
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{6}
 }
 
-var File_proto_kvstore_proto protoreflect.FileDescriptor
+type TreeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Positions of tree nodes, numbered breadth first from 0 at the root.
+	Nodes []uint32 `protobuf:"varint,1,rep,packed,name=nodes,proto3" json:"nodes,omitempty"`
+	// The owners of the range whose tree to read, sorted.
+	Owners        []string `protobuf:"bytes,2,rep,name=owners,proto3" json:"owners,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
 
-const file_proto_kvstore_proto_rawDesc = "" +
-	"\n" +
-	"\x13proto/kvstore.proto\x12\akvstore\"2\n" +
-	"\bKeyValue\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value\"\x17\n" +
-	"\x03Key\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\"\x1d\n" +
-	"\x05Value\x12\x14\n" +
-	"\x05value\x18\x01 \x01(\tR\x05value\"\x1f\n" +
-	"\x03Ack\x12\x18\n" +
-	"\asuccess\x18\x01 \x01(\bR\asuccess\"\a\n" +
-	"\x05Empty2\xb7\x01\n" +
-	"\rKeyValueStore\x12&\n" +
-	"\x03Put\x12\x11.kvstore.KeyValue\x1a\f.kvstore.Ack\x12#\n" +
-	"\x03Get\x12\f.kvstore.Key\x1a\x0e.kvstore.Value\x12+\n" +
-	"\x04List\x12\x0e.kvstore.Empty\x1a\x11.kvstore.KeyValue0\x01\x12,\n" +
-	"\tReplicate\x12\x11.kvstore.KeyValue\x1a\f.kvstore.AckB2Z0distributed-systems/16-assignment2/proto;kvstoreb\x06proto3"
+func (x *TreeRequest) Reset() {
+	*x = TreeRequest{}
+	mi := &file_proto_kvstore_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TreeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TreeRequest) ProtoMessage() {}
+
+func (x *TreeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TreeRequest.ProtoReflect.Descriptor instead.
+func (*TreeRequest) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *TreeRequest) GetNodes() []uint32 {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *TreeRequest) GetOwners() []string {
+	if x != nil {
+		return x.Owners
+	}
+	return nil
+}
+
+type TreeReply struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The hashes of the requested nodes, in order.
+	Hashes        [][]byte `protobuf:"bytes,1,rep,name=hashes,proto3" json:"hashes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TreeReply) Reset() {
+	*x = TreeReply{}
+	mi := &file_proto_kvstore_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TreeReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TreeReply) ProtoMessage() {}
+
+func (x *TreeReply) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TreeReply.ProtoReflect.Descriptor instead.
+func (*TreeReply) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *TreeReply) GetHashes() [][]byte {
+	if x != nil {
+		return x.Hashes
+	}
+	return nil
+}
+
+type KeyDigest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Digest        []byte                 `protobuf:"bytes,2,opt,name=digest,proto3" json:"digest,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyDigest) Reset() {
+	*x = KeyDigest{}
+	mi := &file_proto_kvstore_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyDigest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyDigest) ProtoMessage() {}
+
+func (x *KeyDigest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyDigest.ProtoReflect.Descriptor instead.
+func (*KeyDigest) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *KeyDigest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *KeyDigest) GetDigest() []byte {
+	if x != nil {
+		return x.Digest
+	}
+	return nil
+}
+
+type LeafRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Leaves, numbered from 0, whose keys to compare.
+	Leaves []uint32 `protobuf:"varint,1,rep,packed,name=leaves,proto3" json:"leaves,omitempty"`
+	// The digests of the asking replica's keys in those leaves.
+	Digests []*KeyDigest `protobuf:"bytes,2,rep,name=digests,proto3" json:"digests,omitempty"`
+	// The asking replica. Only keys it owns are sent.
+	Replica string `protobuf:"bytes,3,opt,name=replica,proto3" json:"replica,omitempty"`
+	// The owners of the range the leaves are of, sorted.
+	Owners        []string `protobuf:"bytes,4,rep,name=owners,proto3" json:"owners,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LeafRequest) Reset() {
+	*x = LeafRequest{}
+	mi := &file_proto_kvstore_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LeafRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LeafRequest) ProtoMessage() {}
+
+func (x *LeafRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LeafRequest.ProtoReflect.Descriptor instead.
+func (*LeafRequest) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *LeafRequest) GetLeaves() []uint32 {
+	if x != nil {
+		return x.Leaves
+	}
+	return nil
+}
+
+func (x *LeafRequest) GetDigests() []*KeyDigest {
+	if x != nil {
+		return x.Digests
+	}
+	return nil
+}
+
+func (x *LeafRequest) GetReplica() string {
+	if x != nil {
+		return x.Replica
+	}
+	return ""
+}
+
+func (x *LeafRequest) GetOwners() []string {
+	if x != nil {
+		return x.Owners
+	}
+	return nil
+}
+
+type Member struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Addr          string                 `protobuf:"bytes,1,opt,name=addr,proto3" json:"addr,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Member) Reset() {
+	*x = Member{}
+	mi := &file_proto_kvstore_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Member) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Member) ProtoMessage() {}
+
+func (x *Member) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Member.ProtoReflect.Descriptor instead.
+func (*Member) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Member) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+type Members struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Addrs         []string               `protobuf:"bytes,1,rep,name=addrs,proto3" json:"addrs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Members) Reset() {
+	*x = Members{}
+	mi := &file_proto_kvstore_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Members) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Members) ProtoMessage() {}
+
+func (x *Members) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Members.ProtoReflect.Descriptor instead.
+func (*Members) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Members) GetAddrs() []string {
+	if x != nil {
+		return x.Addrs
+	}
+	return nil
+}
+
+type LogEntry struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Index uint64                 `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Term  uint64                 `protobuf:"varint,2,opt,name=term,proto3" json:"term,omitempty"`
+	// Unset for the no-op entry a new leader appends.
+	Command       *KeyValue `protobuf:"bytes,3,opt,name=command,proto3" json:"command,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogEntry) Reset() {
+	*x = LogEntry{}
+	mi := &file_proto_kvstore_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogEntry) ProtoMessage() {}
+
+func (x *LogEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogEntry.ProtoReflect.Descriptor instead.
+func (*LogEntry) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *LogEntry) GetIndex() uint64 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *LogEntry) GetTerm() uint64 {
+	if x != nil {
+		return x.Term
+	}
+	return 0
+}
+
+func (x *LogEntry) GetCommand() *KeyValue {
+	if x != nil {
+		return x.Command
+	}
+	return nil
+}
+
+type VoteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Term          uint64                 `protobuf:"varint,1,opt,name=term,proto3" json:"term,omitempty"`
+	CandidateId   string                 `protobuf:"bytes,2,opt,name=candidate_id,json=candidateId,proto3" json:"candidate_id,omitempty"`
+	LastLogIndex  uint64                 `protobuf:"varint,3,opt,name=last_log_index,json=lastLogIndex,proto3" json:"last_log_index,omitempty"`
+	LastLogTerm   uint64                 `protobuf:"varint,4,opt,name=last_log_term,json=lastLogTerm,proto3" json:"last_log_term,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VoteRequest) Reset() {
+	*x = VoteRequest{}
+	mi := &file_proto_kvstore_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VoteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VoteRequest) ProtoMessage() {}
+
+func (x *VoteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VoteRequest.ProtoReflect.Descriptor instead.
+func (*VoteRequest) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *VoteRequest) GetTerm() uint64 {
+	if x != nil {
+		return x.Term
+	}
+	return 0
+}
+
+func (x *VoteRequest) GetCandidateId() string {
+	if x != nil {
+		return x.CandidateId
+	}
+	return ""
+}
+
+func (x *VoteRequest) GetLastLogIndex() uint64 {
+	if x != nil {
+		return x.LastLogIndex
+	}
+	return 0
+}
+
+func (x *VoteRequest) GetLastLogTerm() uint64 {
+	if x != nil {
+		return x.LastLogTerm
+	}
+	return 0
+}
+
+type VoteReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Term          uint64                 `protobuf:"varint,1,opt,name=term,proto3" json:"term,omitempty"`
+	VoteGranted   bool                   `protobuf:"varint,2,opt,name=vote_granted,json=voteGranted,proto3" json:"vote_granted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VoteReply) Reset() {
+	*x = VoteReply{}
+	mi := &file_proto_kvstore_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VoteReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VoteReply) ProtoMessage() {}
+
+func (x *VoteReply) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VoteReply.ProtoReflect.Descriptor instead.
+func (*VoteReply) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *VoteReply) GetTerm() uint64 {
+	if x != nil {
+		return x.Term
+	}
+	return 0
+}
+
+func (x *VoteReply) GetVoteGranted() bool {
+	if x != nil {
+		return x.VoteGranted
+	}
+	return false
+}
+
+type AppendRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Term          uint64                 `protobuf:"varint,1,opt,name=term,proto3" json:"term,omitempty"`
+	LeaderId      string                 `protobuf:"bytes,2,opt,name=leader_id,json=leaderId,proto3" json:"leader_id,omitempty"`
+	PrevLogIndex  uint64                 `protobuf:"varint,3,opt,name=prev_log_index,json=prevLogIndex,proto3" json:"prev_log_index,omitempty"`
+	PrevLogTerm   uint64                 `protobuf:"varint,4,opt,name=prev_log_term,json=prevLogTerm,proto3" json:"prev_log_term,omitempty"`
+	Entries       []*LogEntry            `protobuf:"bytes,5,rep,name=entries,proto3" json:"entries,omitempty"`
+	LeaderCommit  uint64                 `protobuf:"varint,6,opt,name=leader_commit,json=leaderCommit,proto3" json:"leader_commit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AppendRequest) Reset() {
+	*x = AppendRequest{}
+	mi := &file_proto_kvstore_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AppendRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AppendRequest) ProtoMessage() {}
+
+func (x *AppendRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AppendRequest.ProtoReflect.Descriptor instead.
+func (*AppendRequest) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *AppendRequest) GetTerm() uint64 {
+	if x != nil {
+		return x.Term
+	}
+	return 0
+}
+
+func (x *AppendRequest) GetLeaderId() string {
+	if x != nil {
+		return x.LeaderId
+	}
+	return ""
+}
+
+func (x *AppendRequest) GetPrevLogIndex() uint64 {
+	if x != nil {
+		return x.PrevLogIndex
+	}
+	return 0
+}
+
+func (x *AppendRequest) GetPrevLogTerm() uint64 {
+	if x != nil {
+		return x.PrevLogTerm
+	}
+	return 0
+}
+
+func (x *AppendRequest) GetEntries() []*LogEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *AppendRequest) GetLeaderCommit() uint64 {
+	if x != nil {
+		return x.LeaderCommit
+	}
+	return 0
+}
+
+type AppendReply struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Term    uint64                 `protobuf:"varint,1,opt,name=term,proto3" json:"term,omitempty"`
+	Success bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	// On failure, where the leader should retry from: the first index of
+	// the conflicting term, or the follower's next index if its log is
+	// too short (conflict_term 0).
+	ConflictIndex uint64 `protobuf:"varint,3,opt,name=conflict_index,json=conflictIndex,proto3" json:"conflict_index,omitempty"`
+	ConflictTerm  uint64 `protobuf:"varint,4,opt,name=conflict_term,json=conflictTerm,proto3" json:"conflict_term,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AppendReply) Reset() {
+	*x = AppendReply{}
+	mi := &file_proto_kvstore_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AppendReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AppendReply) ProtoMessage() {}
+
+func (x *AppendReply) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AppendReply.ProtoReflect.Descriptor instead.
+func (*AppendReply) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *AppendReply) GetTerm() uint64 {
+	if x != nil {
+		return x.Term
+	}
+	return 0
+}
+
+func (x *AppendReply) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *AppendReply) GetConflictIndex() uint64 {
+	if x != nil {
+		return x.ConflictIndex
+	}
+	return 0
+}
+
+func (x *AppendReply) GetConflictTerm() uint64 {
+	if x != nil {
+		return x.ConflictTerm
+	}
+	return 0
+}
+
+type SnapshotRequest struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Term              uint64                 `protobuf:"varint,1,opt,name=term,proto3" json:"term,omitempty"`
+	LeaderId          string                 `protobuf:"bytes,2,opt,name=leader_id,json=leaderId,proto3" json:"leader_id,omitempty"`
+	LastIncludedIndex uint64                 `protobuf:"varint,3,opt,name=last_included_index,json=lastIncludedIndex,proto3" json:"last_included_index,omitempty"`
+	LastIncludedTerm  uint64                 `protobuf:"varint,4,opt,name=last_included_term,json=lastIncludedTerm,proto3" json:"last_included_term,omitempty"`
+	Data              []byte                 `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *SnapshotRequest) Reset() {
+	*x = SnapshotRequest{}
+	mi := &file_proto_kvstore_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SnapshotRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotRequest) ProtoMessage() {}
+
+func (x *SnapshotRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotRequest.ProtoReflect.Descriptor instead.
+func (*SnapshotRequest) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *SnapshotRequest) GetTerm() uint64 {
+	if x != nil {
+		return x.Term
+	}
+	return 0
+}
+
+func (x *SnapshotRequest) GetLeaderId() string {
+	if x != nil {
+		return x.LeaderId
+	}
+	return ""
+}
+
+func (x *SnapshotRequest) GetLastIncludedIndex() uint64 {
+	if x != nil {
+		return x.LastIncludedIndex
+	}
+	return 0
+}
+
+func (x *SnapshotRequest) GetLastIncludedTerm() uint64 {
+	if x != nil {
+		return x.LastIncludedTerm
+	}
+	return 0
+}
+
+func (x *SnapshotRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type SnapshotReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Term          uint64                 `protobuf:"varint,1,opt,name=term,proto3" json:"term,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SnapshotReply) Reset() {
+	*x = SnapshotReply{}
+	mi := &file_proto_kvstore_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SnapshotReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotReply) ProtoMessage() {}
+
+func (x *SnapshotReply) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotReply.ProtoReflect.Descriptor instead.
+func (*SnapshotReply) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *SnapshotReply) GetTerm() uint64 {
+	if x != nil {
+		return x.Term
+	}
+	return 0
+}
+
+var File_proto_kvstore_proto protoreflect.FileDescriptor
+
+const file_proto_kvstore_proto_rawDesc = "" +
+	"\n" +
+	"\x13proto/kvstore.proto\x12\akvstore\"\x8a\x01\n" +
+	"\vVectorClock\x12>\n" +
+	"\bcounters\x18\x01 \x03(\v2\".kvstore.VectorClock.CountersEntryR\bcounters\x1a;\n" +
+	"\rCountersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x04R\x05value:\x028\x01\"}\n" +
+	"\aSibling\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\tR\x05value\x12.\n" +
+	"\acontext\x18\x02 \x01(\v2\x14.kvstore.VectorClockR\acontext\x12\x12\n" +
+	"\x04node\x18\x03 \x01(\tR\x04node\x12\x18\n" +
+	"\acounter\x18\x04 \x01(\x04R\acounter\"\xea\x01\n" +
+	"\bKeyValue\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\x126\n" +
+	"\vconsistency\x18\x04 \x01(\x0e2\x14.kvstore.ConsistencyR\vconsistency\x12.\n" +
+	"\acontext\x18\x05 \x01(\v2\x14.kvstore.VectorClockR\acontext\x12*\n" +
+	"\asibling\x18\x06 \x01(\v2\x10.kvstore.SiblingR\asibling\x12\x1c\n" +
+	"\tforwarded\x18\a \x01(\bR\tforwardedJ\x04\b\x03\x10\x04\"m\n" +
+	"\x03Key\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x126\n" +
+	"\vconsistency\x18\x02 \x01(\x0e2\x14.kvstore.ConsistencyR\vconsistency\x12\x1c\n" +
+	"\tforwarded\x18\x03 \x01(\bR\tforwarded\"\x81\x01\n" +
+	"\x05Value\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\tR\x05value\x12,\n" +
+	"\bsiblings\x18\x03 \x03(\v2\x10.kvstore.SiblingR\bsiblings\x12.\n" +
+	"\acontext\x18\x04 \x01(\v2\x14.kvstore.VectorClockR\acontextJ\x04\b\x02\x10\x03\"g\n" +
+	"\x03Ack\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x16\n" +
+	"\x06leader\x18\x02 \x01(\tR\x06leader\x12.\n" +
+	"\acontext\x18\x03 \x01(\v2\x14.kvstore.VectorClockR\acontext\"\a\n" +
+	"\x05Empty\";\n" +
+	"\vTreeRequest\x12\x14\n" +
+	"\x05nodes\x18\x01 \x03(\rR\x05nodes\x12\x16\n" +
+	"\x06owners\x18\x02 \x03(\tR\x06owners\"#\n" +
+	"\tTreeReply\x12\x16\n" +
+	"\x06hashes\x18\x01 \x03(\fR\x06hashes\"5\n" +
+	"\tKeyDigest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x16\n" +
+	"\x06digest\x18\x02 \x01(\fR\x06digest\"\x85\x01\n" +
+	"\vLeafRequest\x12\x16\n" +
+	"\x06leaves\x18\x01 \x03(\rR\x06leaves\x12,\n" +
+	"\adigests\x18\x02 \x03(\v2\x12.kvstore.KeyDigestR\adigests\x12\x18\n" +
+	"\areplica\x18\x03 \x01(\tR\areplica\x12\x16\n" +
+	"\x06owners\x18\x04 \x03(\tR\x06owners\"\x1c\n" +
+	"\x06Member\x12\x12\n" +
+	"\x04addr\x18\x01 \x01(\tR\x04addr\"\x1f\n" +
+	"\aMembers\x12\x14\n" +
+	"\x05addrs\x18\x01 \x03(\tR\x05addrs\"a\n" +
+	"\bLogEntry\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x04R\x05index\x12\x12\n" +
+	"\x04term\x18\x02 \x01(\x04R\x04term\x12+\n" +
+	"\acommand\x18\x03 \x01(\v2\x11.kvstore.KeyValueR\acommand\"\x8e\x01\n" +
+	"\vVoteRequest\x12\x12\n" +
+	"\x04term\x18\x01 \x01(\x04R\x04term\x12!\n" +
+	"\fcandidate_id\x18\x02 \x01(\tR\vcandidateId\x12$\n" +
+	"\x0elast_log_index\x18\x03 \x01(\x04R\flastLogIndex\x12\"\n" +
+	"\rlast_log_term\x18\x04 \x01(\x04R\vlastLogTerm\"B\n" +
+	"\tVoteReply\x12\x12\n" +
+	"\x04term\x18\x01 \x01(\x04R\x04term\x12!\n" +
+	"\fvote_granted\x18\x02 \x01(\bR\vvoteGranted\"\xdc\x01\n" +
+	"\rAppendRequest\x12\x12\n" +
+	"\x04term\x18\x01 \x01(\x04R\x04term\x12\x1b\n" +
+	"\tleader_id\x18\x02 \x01(\tR\bleaderId\x12$\n" +
+	"\x0eprev_log_index\x18\x03 \x01(\x04R\fprevLogIndex\x12\"\n" +
+	"\rprev_log_term\x18\x04 \x01(\x04R\vprevLogTerm\x12+\n" +
+	"\aentries\x18\x05 \x03(\v2\x11.kvstore.LogEntryR\aentries\x12#\n" +
+	"\rleader_commit\x18\x06 \x01(\x04R\fleaderCommit\"\x87\x01\n" +
+	"\vAppendReply\x12\x12\n" +
+	"\x04term\x18\x01 \x01(\x04R\x04term\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12%\n" +
+	"\x0econflict_index\x18\x03 \x01(\x04R\rconflictIndex\x12#\n" +
+	"\rconflict_term\x18\x04 \x01(\x04R\fconflictTerm\"\xb4\x01\n" +
+	"\x0fSnapshotRequest\x12\x12\n" +
+	"\x04term\x18\x01 \x01(\x04R\x04term\x12\x1b\n" +
+	"\tleader_id\x18\x02 \x01(\tR\bleaderId\x12.\n" +
+	"\x13last_included_index\x18\x03 \x01(\x04R\x11lastIncludedIndex\x12,\n" +
+	"\x12last_included_term\x18\x04 \x01(\x04R\x10lastIncludedTerm\x12\x12\n" +
+	"\x04data\x18\x05 \x01(\fR\x04data\"#\n" +
+	"\rSnapshotReply\x12\x12\n" +
+	"\x04term\x18\x01 \x01(\x04R\x04term*h\n" +
+	"\vConsistency\x12\x17\n" +
+	"\x13CONSISTENCY_DEFAULT\x10\x00\x12\x13\n" +
+	"\x0fCONSISTENCY_ONE\x10\x01\x12\x16\n" +
+	"\x12CONSISTENCY_QUORUM\x10\x02\x12\x13\n" +
+	"\x0fCONSISTENCY_ALL\x10\x032\xb7\x01\n" +
+	"\rKeyValueStore\x12&\n" +
+	"\x03Put\x12\x11.kvstore.KeyValue\x1a\f.kvstore.Ack\x12#\n" +
+	"\x03Get\x12\f.kvstore.Key\x1a\x0e.kvstore.Value\x12+\n" +
+	"\x04List\x12\x0e.kvstore.Empty\x1a\x11.kvstore.KeyValue0\x01\x12,\n" +
+	"\tReplicate\x12\x11.kvstore.KeyValue\x1a\f.kvstore.Ack2~\n" +
+	"\vAntiEntropy\x126\n" +
+	"\n" +
+	"TreeHashes\x12\x14.kvstore.TreeRequest\x1a\x12.kvstore.TreeReply\x127\n" +
+	"\n" +
+	"DiffLeaves\x12\x14.kvstore.LeafRequest\x1a\x11.kvstore.KeyValue0\x012a\n" +
+	"\n" +
+	"Membership\x12)\n" +
+	"\x04Join\x12\x0f.kvstore.Member\x1a\x10.kvstore.Members\x12(\n" +
+	"\x05Leave\x12\x0f.kvstore.Member\x1a\x0e.kvstore.Empty2\xc3\x01\n" +
+	"\x04Raft\x127\n" +
+	"\vRequestVote\x12\x14.kvstore.VoteRequest\x1a\x12.kvstore.VoteReply\x12=\n" +
+	"\rAppendEntries\x12\x16.kvstore.AppendRequest\x1a\x14.kvstore.AppendReply\x12C\n" +
+	"\x0fInstallSnapshot\x12\x18.kvstore.SnapshotRequest\x1a\x16.kvstore.SnapshotReplyB2Z0distributed-systems/16-assignment2/proto;kvstoreb\x06proto3"
 
 var (
 	file_proto_kvstore_proto_rawDescOnce sync.Once
@@ -274,28 +1399,72 @@ func file_proto_kvstore_proto_rawDescGZIP() []byte {
 	return file_proto_kvstore_proto_rawDescData
 }
 
-var file_proto_kvstore_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_proto_kvstore_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_kvstore_proto_msgTypes = make([]protoimpl.MessageInfo, 21)
 var file_proto_kvstore_proto_goTypes = []any{
-	(*KeyValue)(nil), // 0: kvstore.KeyValue
-	(*Key)(nil),      // 1: kvstore.Key
-	(*Value)(nil),    // 2: kvstore.Value
-	(*Ack)(nil),      // 3: kvstore.Ack
-	(*Empty)(nil),    // 4: kvstore.Empty
+	(Consistency)(0),        // 0: kvstore.Consistency
+	(*VectorClock)(nil),     // 1: kvstore.VectorClock
+	(*Sibling)(nil),         // 2: kvstore.Sibling
+	(*KeyValue)(nil),        // 3: kvstore.KeyValue
+	(*Key)(nil),             // 4: kvstore.Key
+	(*Value)(nil),           // 5: kvstore.Value
+	(*Ack)(nil),             // 6: kvstore.Ack
+	(*Empty)(nil),           // 7: kvstore.Empty
+	(*TreeRequest)(nil),     // 8: kvstore.TreeRequest
+	(*TreeReply)(nil),       // 9: kvstore.TreeReply
+	(*KeyDigest)(nil),       // 10: kvstore.KeyDigest
+	(*LeafRequest)(nil),     // 11: kvstore.LeafRequest
+	(*Member)(nil),          // 12: kvstore.Member
+	(*Members)(nil),         // 13: kvstore.Members
+	(*LogEntry)(nil),        // 14: kvstore.LogEntry
+	(*VoteRequest)(nil),     // 15: kvstore.VoteRequest
+	(*VoteReply)(nil),       // 16: kvstore.VoteReply
+	(*AppendRequest)(nil),   // 17: kvstore.AppendRequest
+	(*AppendReply)(nil),     // 18: kvstore.AppendReply
+	(*SnapshotRequest)(nil), // 19: kvstore.SnapshotRequest
+	(*SnapshotReply)(nil),   // 20: kvstore.SnapshotReply
+	nil,                     // 21: kvstore.VectorClock.CountersEntry
 }
 var file_proto_kvstore_proto_depIdxs = []int32{
-	0, // 0: kvstore.KeyValueStore.Put:input_type -> kvstore.KeyValue
-	1, // 1: kvstore.KeyValueStore.Get:input_type -> kvstore.Key
-	4, // 2: kvstore.KeyValueStore.List:input_type -> kvstore.Empty
-	0, // 3: kvstore.KeyValueStore.Replicate:input_type -> kvstore.KeyValue
-	3, // 4: kvstore.KeyValueStore.Put:output_type -> kvstore.Ack
-	2, // 5: kvstore.KeyValueStore.Get:output_type -> kvstore.Value
-	0, // 6: kvstore.KeyValueStore.List:output_type -> kvstore.KeyValue
-	3, // 7: kvstore.KeyValueStore.Replicate:output_type -> kvstore.Ack
-	4, // [4:8] is the sub-list for method output_type
-	0, // [0:4] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	21, // 0: kvstore.VectorClock.counters:type_name -> kvstore.VectorClock.CountersEntry
+	1,  // 1: kvstore.Sibling.context:type_name -> kvstore.VectorClock
+	0,  // 2: kvstore.KeyValue.consistency:type_name -> kvstore.Consistency
+	1,  // 3: kvstore.KeyValue.context:type_name -> kvstore.VectorClock
+	2,  // 4: kvstore.KeyValue.sibling:type_name -> kvstore.Sibling
+	0,  // 5: kvstore.Key.consistency:type_name -> kvstore.Consistency
+	2,  // 6: kvstore.Value.siblings:type_name -> kvstore.Sibling
+	1,  // 7: kvstore.Value.context:type_name -> kvstore.VectorClock
+	1,  // 8: kvstore.Ack.context:type_name -> kvstore.VectorClock
+	10, // 9: kvstore.LeafRequest.digests:type_name -> kvstore.KeyDigest
+	3,  // 10: kvstore.LogEntry.command:type_name -> kvstore.KeyValue
+	14, // 11: kvstore.AppendRequest.entries:type_name -> kvstore.LogEntry
+	3,  // 12: kvstore.KeyValueStore.Put:input_type -> kvstore.KeyValue
+	4,  // 13: kvstore.KeyValueStore.Get:input_type -> kvstore.Key
+	7,  // 14: kvstore.KeyValueStore.List:input_type -> kvstore.Empty
+	3,  // 15: kvstore.KeyValueStore.Replicate:input_type -> kvstore.KeyValue
+	8,  // 16: kvstore.AntiEntropy.TreeHashes:input_type -> kvstore.TreeRequest
+	11, // 17: kvstore.AntiEntropy.DiffLeaves:input_type -> kvstore.LeafRequest
+	12, // 18: kvstore.Membership.Join:input_type -> kvstore.Member
+	12, // 19: kvstore.Membership.Leave:input_type -> kvstore.Member
+	15, // 20: kvstore.Raft.RequestVote:input_type -> kvstore.VoteRequest
+	17, // 21: kvstore.Raft.AppendEntries:input_type -> kvstore.AppendRequest
+	19, // 22: kvstore.Raft.InstallSnapshot:input_type -> kvstore.SnapshotRequest
+	6,  // 23: kvstore.KeyValueStore.Put:output_type -> kvstore.Ack
+	5,  // 24: kvstore.KeyValueStore.Get:output_type -> kvstore.Value
+	3,  // 25: kvstore.KeyValueStore.List:output_type -> kvstore.KeyValue
+	6,  // 26: kvstore.KeyValueStore.Replicate:output_type -> kvstore.Ack
+	9,  // 27: kvstore.AntiEntropy.TreeHashes:output_type -> kvstore.TreeReply
+	3,  // 28: kvstore.AntiEntropy.DiffLeaves:output_type -> kvstore.KeyValue
+	13, // 29: kvstore.Membership.Join:output_type -> kvstore.Members
+	7,  // 30: kvstore.Membership.Leave:output_type -> kvstore.Empty
+	16, // 31: kvstore.Raft.RequestVote:output_type -> kvstore.VoteReply
+	18, // 32: kvstore.Raft.AppendEntries:output_type -> kvstore.AppendReply
+	20, // 33: kvstore.Raft.InstallSnapshot:output_type -> kvstore.SnapshotReply
+	23, // [23:34] is the sub-list for method output_type
+	12, // [12:23] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
 }
 
 func init() { file_proto_kvstore_proto_init() }
@@ -308,13 +1477,14 @@ func file_proto_kvstore_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_kvstore_proto_rawDesc), len(file_proto_kvstore_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   5,
+			NumEnums:      1,
+			NumMessages:   21,
 			NumExtensions: 0,
-			NumServices:   1,
+			NumServices:   4,
 		},
 		GoTypes:           file_proto_kvstore_proto_goTypes,
 		DependencyIndexes: file_proto_kvstore_proto_depIdxs,
+		EnumInfos:         file_proto_kvstore_proto_enumTypes,
 		MessageInfos:      file_proto_kvstore_proto_msgTypes,
 	}.Build()
 	File_proto_kvstore_proto = out.File
@@ -237,3 +237,477 @@ var KeyValueStore_ServiceDesc = grpc.ServiceDesc{
 	},
 	Metadata: "proto/kvstore.proto",
 }
+
+const (
+	AntiEntropy_TreeHashes_FullMethodName = "/kvstore.AntiEntropy/TreeHashes"
+	AntiEntropy_DiffLeaves_FullMethodName = "/kvstore.AntiEntropy/DiffLeaves"
+)
+
+// AntiEntropyClient is the client API for AntiEntropy service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AntiEntropyClient interface {
+	TreeHashes(ctx context.Context, in *TreeRequest, opts ...grpc.CallOption) (*TreeReply, error)
+	// DiffLeaves streams every sibling of the keys in the leaves that the
+	// asking replica owns and whose digest differs from its own, one
+	// KeyValue each.
+	DiffLeaves(ctx context.Context, in *LeafRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[KeyValue], error)
+}
+
+type antiEntropyClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAntiEntropyClient(cc grpc.ClientConnInterface) AntiEntropyClient {
+	return &antiEntropyClient{cc}
+}
+
+func (c *antiEntropyClient) TreeHashes(ctx context.Context, in *TreeRequest, opts ...grpc.CallOption) (*TreeReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TreeReply)
+	err := c.cc.Invoke(ctx, AntiEntropy_TreeHashes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *antiEntropyClient) DiffLeaves(ctx context.Context, in *LeafRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[KeyValue], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AntiEntropy_ServiceDesc.Streams[0], AntiEntropy_DiffLeaves_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[LeafRequest, KeyValue]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AntiEntropy_DiffLeavesClient = grpc.ServerStreamingClient[KeyValue]
+
+// AntiEntropyServer is the server API for AntiEntropy service.
+// All implementations must embed UnimplementedAntiEntropyServer
+// for forward compatibility.
+type AntiEntropyServer interface {
+	TreeHashes(context.Context, *TreeRequest) (*TreeReply, error)
+	// DiffLeaves streams every sibling of the keys in the leaves that the
+	// asking replica owns and whose digest differs from its own, one
+	// KeyValue each.
+	DiffLeaves(*LeafRequest, grpc.ServerStreamingServer[KeyValue]) error
+	mustEmbedUnimplementedAntiEntropyServer()
+}
+
+// UnimplementedAntiEntropyServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAntiEntropyServer struct{}
+
+func (UnimplementedAntiEntropyServer) TreeHashes(context.Context, *TreeRequest) (*TreeReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TreeHashes not implemented")
+}
+func (UnimplementedAntiEntropyServer) DiffLeaves(*LeafRequest, grpc.ServerStreamingServer[KeyValue]) error {
+	return status.Errorf(codes.Unimplemented, "method DiffLeaves not implemented")
+}
+func (UnimplementedAntiEntropyServer) mustEmbedUnimplementedAntiEntropyServer() {}
+func (UnimplementedAntiEntropyServer) testEmbeddedByValue()                     {}
+
+// UnsafeAntiEntropyServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AntiEntropyServer will
+// result in compilation errors.
+type UnsafeAntiEntropyServer interface {
+	mustEmbedUnimplementedAntiEntropyServer()
+}
+
+func RegisterAntiEntropyServer(s grpc.ServiceRegistrar, srv AntiEntropyServer) {
+	// If the following call pancis, it indicates UnimplementedAntiEntropyServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&AntiEntropy_ServiceDesc, srv)
+}
+
+func _AntiEntropy_TreeHashes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TreeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AntiEntropyServer).TreeHashes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AntiEntropy_TreeHashes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AntiEntropyServer).TreeHashes(ctx, req.(*TreeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AntiEntropy_DiffLeaves_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(LeafRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AntiEntropyServer).DiffLeaves(m, &grpc.GenericServerStream[LeafRequest, KeyValue]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AntiEntropy_DiffLeavesServer = grpc.ServerStreamingServer[KeyValue]
+
+// AntiEntropy_ServiceDesc is the grpc.ServiceDesc for AntiEntropy service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AntiEntropy_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kvstore.AntiEntropy",
+	HandlerType: (*AntiEntropyServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "TreeHashes",
+			Handler:    _AntiEntropy_TreeHashes_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "DiffLeaves",
+			Handler:       _AntiEntropy_DiffLeaves_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/kvstore.proto",
+}
+
+const (
+	Membership_Join_FullMethodName  = "/kvstore.Membership/Join"
+	Membership_Leave_FullMethodName = "/kvstore.Membership/Leave"
+)
+
+// MembershipClient is the client API for Membership service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MembershipClient interface {
+	// Join adds a node to the ring, and returns the nodes in it.
+	Join(ctx context.Context, in *Member, opts ...grpc.CallOption) (*Members, error)
+	// Leave removes a node from the ring. A node told to remove itself
+	// hands its keys over to their new owners and stops.
+	Leave(ctx context.Context, in *Member, opts ...grpc.CallOption) (*Empty, error)
+}
+
+type membershipClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMembershipClient(cc grpc.ClientConnInterface) MembershipClient {
+	return &membershipClient{cc}
+}
+
+func (c *membershipClient) Join(ctx context.Context, in *Member, opts ...grpc.CallOption) (*Members, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Members)
+	err := c.cc.Invoke(ctx, Membership_Join_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *membershipClient) Leave(ctx context.Context, in *Member, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, Membership_Leave_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MembershipServer is the server API for Membership service.
+// All implementations must embed UnimplementedMembershipServer
+// for forward compatibility.
+type MembershipServer interface {
+	// Join adds a node to the ring, and returns the nodes in it.
+	Join(context.Context, *Member) (*Members, error)
+	// Leave removes a node from the ring. A node told to remove itself
+	// hands its keys over to their new owners and stops.
+	Leave(context.Context, *Member) (*Empty, error)
+	mustEmbedUnimplementedMembershipServer()
+}
+
+// UnimplementedMembershipServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMembershipServer struct{}
+
+func (UnimplementedMembershipServer) Join(context.Context, *Member) (*Members, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Join not implemented")
+}
+func (UnimplementedMembershipServer) Leave(context.Context, *Member) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Leave not implemented")
+}
+func (UnimplementedMembershipServer) mustEmbedUnimplementedMembershipServer() {}
+func (UnimplementedMembershipServer) testEmbeddedByValue()                    {}
+
+// UnsafeMembershipServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MembershipServer will
+// result in compilation errors.
+type UnsafeMembershipServer interface {
+	mustEmbedUnimplementedMembershipServer()
+}
+
+func RegisterMembershipServer(s grpc.ServiceRegistrar, srv MembershipServer) {
+	// If the following call pancis, it indicates UnimplementedMembershipServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Membership_ServiceDesc, srv)
+}
+
+func _Membership_Join_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Member)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MembershipServer).Join(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Membership_Join_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MembershipServer).Join(ctx, req.(*Member))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Membership_Leave_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Member)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MembershipServer).Leave(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Membership_Leave_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MembershipServer).Leave(ctx, req.(*Member))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Membership_ServiceDesc is the grpc.ServiceDesc for Membership service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Membership_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kvstore.Membership",
+	HandlerType: (*MembershipServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Join",
+			Handler:    _Membership_Join_Handler,
+		},
+		{
+			MethodName: "Leave",
+			Handler:    _Membership_Leave_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/kvstore.proto",
+}
+
+const (
+	Raft_RequestVote_FullMethodName     = "/kvstore.Raft/RequestVote"
+	Raft_AppendEntries_FullMethodName   = "/kvstore.Raft/AppendEntries"
+	Raft_InstallSnapshot_FullMethodName = "/kvstore.Raft/InstallSnapshot"
+)
+
+// RaftClient is the client API for Raft service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RaftClient interface {
+	RequestVote(ctx context.Context, in *VoteRequest, opts ...grpc.CallOption) (*VoteReply, error)
+	AppendEntries(ctx context.Context, in *AppendRequest, opts ...grpc.CallOption) (*AppendReply, error)
+	InstallSnapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (*SnapshotReply, error)
+}
+
+type raftClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRaftClient(cc grpc.ClientConnInterface) RaftClient {
+	return &raftClient{cc}
+}
+
+func (c *raftClient) RequestVote(ctx context.Context, in *VoteRequest, opts ...grpc.CallOption) (*VoteReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VoteReply)
+	err := c.cc.Invoke(ctx, Raft_RequestVote_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *raftClient) AppendEntries(ctx context.Context, in *AppendRequest, opts ...grpc.CallOption) (*AppendReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AppendReply)
+	err := c.cc.Invoke(ctx, Raft_AppendEntries_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *raftClient) InstallSnapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (*SnapshotReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SnapshotReply)
+	err := c.cc.Invoke(ctx, Raft_InstallSnapshot_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RaftServer is the server API for Raft service.
+// All implementations must embed UnimplementedRaftServer
+// for forward compatibility.
+type RaftServer interface {
+	RequestVote(context.Context, *VoteRequest) (*VoteReply, error)
+	AppendEntries(context.Context, *AppendRequest) (*AppendReply, error)
+	InstallSnapshot(context.Context, *SnapshotRequest) (*SnapshotReply, error)
+	mustEmbedUnimplementedRaftServer()
+}
+
+// UnimplementedRaftServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRaftServer struct{}
+
+func (UnimplementedRaftServer) RequestVote(context.Context, *VoteRequest) (*VoteReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RequestVote not implemented")
+}
+func (UnimplementedRaftServer) AppendEntries(context.Context, *AppendRequest) (*AppendReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AppendEntries not implemented")
+}
+func (UnimplementedRaftServer) InstallSnapshot(context.Context, *SnapshotRequest) (*SnapshotReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InstallSnapshot not implemented")
+}
+func (UnimplementedRaftServer) mustEmbedUnimplementedRaftServer() {}
+func (UnimplementedRaftServer) testEmbeddedByValue()              {}
+
+// UnsafeRaftServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RaftServer will
+// result in compilation errors.
+type UnsafeRaftServer interface {
+	mustEmbedUnimplementedRaftServer()
+}
+
+func RegisterRaftServer(s grpc.ServiceRegistrar, srv RaftServer) {
+	// If the following call pancis, it indicates UnimplementedRaftServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Raft_ServiceDesc, srv)
+}
+
+func _Raft_RequestVote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RaftServer).RequestVote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Raft_RequestVote_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RaftServer).RequestVote(ctx, req.(*VoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Raft_AppendEntries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AppendRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RaftServer).AppendEntries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Raft_AppendEntries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RaftServer).AppendEntries(ctx, req.(*AppendRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Raft_InstallSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RaftServer).InstallSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Raft_InstallSnapshot_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RaftServer).InstallSnapshot(ctx, req.(*SnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Raft_ServiceDesc is the grpc.ServiceDesc for Raft service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Raft_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kvstore.Raft",
+	HandlerType: (*RaftServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RequestVote",
+			Handler:    _Raft_RequestVote_Handler,
+		},
+		{
+			MethodName: "AppendEntries",
+			Handler:    _Raft_AppendEntries_Handler,
+		},
+		{
+			MethodName: "InstallSnapshot",
+			Handler:    _Raft_InstallSnapshot_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/kvstore.proto",
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	pb "distributed-systems/16-assignment2/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// antiEntropyTimeout bounds one exchange with a peer.
+const antiEntropyTimeout = time.Minute
+
+var (
+	antiEntropyRounds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kvstore_anti_entropy_rounds_total",
+		Help: "Anti-entropy exchanges with a peer, by whether they completed.",
+	}, []string{"result"})
+	antiEntropyRepaired = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kvstore_anti_entropy_writes_repaired_total",
+		Help: "Writes this replica was missing and got from a peer by anti-entropy.",
+	})
+)
+
+// antiEntropy serves this replica's Merkle trees and keys to peers
+// comparing theirs, and now and then compares its own with a peer's, for
+// each key range they both own, taking the writes it is missing. Since every
+// replica does so with its peers, writes that fail to replicate and
+// whose hints are lost reach every owner in the end.
+type antiEntropy struct {
+	pb.UnimplementedAntiEntropyServer
+	s *server
+}
+
+// TreeHashes returns the hashes of the requested nodes of a range's
+// tree, that of an empty tree if this replica doesn't own the range.
+func (ae *antiEntropy) TreeHashes(ctx context.Context, req *pb.TreeRequest) (*pb.TreeReply, error) {
+	ae.s.mu.Lock()
+	defer ae.s.mu.Unlock()
+	tree := ae.s.treesLocked().tree(req.Owners)
+	reply := &pb.TreeReply{Hashes: make([][]byte, len(req.Nodes))}
+	for i, node := range req.Nodes {
+		reply.Hashes[i] = bytes.Clone(tree.hash(node))
+	}
+	return reply, nil
+}
+
+// DiffLeaves streams the siblings of the keys in the requested leaves of
+// a range's tree that the asking replica has different writes for, or
+// none. Nothing is sent unless the asking replica owns the range.
+func (ae *antiEntropy) DiffLeaves(req *pb.LeafRequest, stream pb.AntiEntropy_DiffLeavesServer) error {
+	if !slices.Contains(req.Owners, req.Replica) {
+		return nil
+	}
+	theirs := make(map[string][]byte, len(req.Digests))
+	for _, d := range req.Digests {
+		theirs[d.Key] = d.Digest
+	}
+	var diff []*pb.KeyValue
+	ae.s.mu.Lock()
+	tree := ae.s.treesLocked().tree(req.Owners)
+	for _, leaf := range req.Leaves {
+		for key, d := range tree.keys(leaf) {
+			if bytes.Equal(theirs[key], d[:]) {
+				continue
+			}
+			for _, sib := range ae.s.siblings[key] {
+				diff = append(diff, &pb.KeyValue{Key: key, Value: sib.Value, Sibling: sib})
+			}
+		}
+	}
+	ae.s.mu.Unlock()
+
+	for _, kv := range diff {
+		if err := stream.Send(kv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run exchanges with a random peer every interval.
+func (ae *antiEntropy) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		peers := ae.s.quorum.peers()
+		if len(peers) == 0 {
+			continue
+		}
+		peer := peers[rand.N(len(peers))]
+		ctx, cancel := context.WithTimeout(context.Background(), antiEntropyTimeout)
+		repaired, err := ae.exchange(ctx, peer)
+		cancel()
+		if err != nil {
+			antiEntropyRounds.WithLabelValues("failed").Inc()
+			log.Printf("Anti-entropy with %s failed: %v", peer, err)
+			continue
+		}
+		antiEntropyRounds.WithLabelValues("completed").Inc()
+		if repaired > 0 {
+			log.Printf("Anti-entropy with %s repaired %d writes", peer, repaired)
+		}
+	}
+}
+
+// exchange compares the trees of each range this replica and peer both
+// own, and takes the writes peer has in them that this replica lacks. It
+// returns how many it took.
+func (ae *antiEntropy) exchange(ctx context.Context, peer string) (int, error) {
+	m := ae.s.quorum.member(peer)
+	if m == nil {
+		return 0, fmt.Errorf("%s left the ring", peer)
+	}
+	var shared [][]string
+	ae.s.mu.Lock()
+	for _, owners := range ae.s.treesLocked().owned {
+		if slices.Contains(owners, peer) {
+			shared = append(shared, owners)
+		}
+	}
+	ae.s.mu.Unlock()
+	repaired := 0
+	for _, owners := range shared {
+		n, err := ae.exchangeRange(ctx, m.antiEntropy, owners)
+		repaired += n
+		if err != nil {
+			return repaired, err
+		}
+	}
+	return repaired, nil
+}
+
+// exchangeRange compares the trees of the range owned by owners with a
+// peer's, from the root down to the leaves that differ, and takes the
+// writes the peer has in them that this replica lacks.
+func (ae *antiEntropy) exchangeRange(ctx context.Context, client pb.AntiEntropyClient, owners []string) (int, error) {
+	nodes := []uint32{0}
+	for level := 0; level <= merkleDepth && len(nodes) > 0; level++ {
+		reply, err := client.TreeHashes(ctx, &pb.TreeRequest{Nodes: nodes, Owners: owners})
+		if err != nil {
+			return 0, err
+		}
+		var differ []uint32
+		ae.s.mu.Lock()
+		tree := ae.s.treesLocked().tree(owners)
+		for i, node := range nodes {
+			if i >= len(reply.Hashes) || !bytes.Equal(reply.Hashes[i], tree.hash(node)) {
+				differ = append(differ, node)
+			}
+		}
+		ae.s.mu.Unlock()
+		if level == merkleDepth {
+			nodes = differ
+			break
+		}
+		nodes = nodes[:0]
+		for _, node := range differ {
+			nodes = append(nodes, 2*node+1, 2*node+2)
+		}
+	}
+	if len(nodes) == 0 {
+		return 0, nil
+	}
+
+	req := &pb.LeafRequest{Replica: ae.s.quorum.id, Owners: owners}
+	ae.s.mu.Lock()
+	tree := ae.s.treesLocked().tree(owners)
+	for _, node := range nodes {
+		leaf := node - merkleFirstLeaf
+		req.Leaves = append(req.Leaves, leaf)
+		for key, d := range tree.keys(leaf) {
+			req.Digests = append(req.Digests, &pb.KeyDigest{Key: key, Digest: d[:]})
+		}
+	}
+	ae.s.mu.Unlock()
+
+	stream, err := client.DiffLeaves(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	repaired := 0
+	for {
+		kv, err := stream.Recv()
+		if err == io.EOF {
+			return repaired, nil
+		}
+		if err != nil {
+			return repaired, err
+		}
+		if kv.Sibling != nil && ae.s.addLocal(kv.Key, kv.Sibling) {
+			antiEntropyRepaired.Inc()
+			repaired++
+		}
+	}
+}
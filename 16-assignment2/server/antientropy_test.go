@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+
+	pb "distributed-systems/16-assignment2/proto"
+)
+
+// root returns the root hash of node i's tree of the range owned by
+// owners.
+func (c *quorumRing) root(i int, owners []string) []byte {
+	s := c.nodes[i].kv
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return bytes.Clone(s.treesLocked().tree(owners).hash(0))
+}
+
+func TestAntiEntropyExchange(t *testing.T) {
+	c := newQuorumRing(t, 4, 2)
+	a, b := c.nodes[0], c.nodes[1]
+	ctx := context.Background()
+
+	// a holds a write of each key it owns. b already holds some of those
+	// it shares with a, and a write of its own to one, concurrent with a's.
+	var shared, unshared []string
+	stray := ""
+	for i := range 200 {
+		key := fmt.Sprintf("k%d", i)
+		owners := a.kv.quorum.owners(key)
+		switch {
+		case slices.Contains(owners, a.addr) && slices.Contains(owners, b.addr):
+			shared = append(shared, key)
+		case slices.Contains(owners, a.addr):
+			unshared = append(unshared, key)
+		case slices.Contains(owners, b.addr) && stray == "":
+			stray = key
+		default:
+			continue
+		}
+		a.kv.addLocal(key, sibling(a.addr, 1, key, nil))
+	}
+	if len(shared) < 10 || len(unshared) == 0 || stray == "" {
+		t.Fatalf("keys: %d shared, %d only a's, stray %q", len(shared), len(unshared), stray)
+	}
+	inSync := shared[:5]
+	for _, key := range inSync {
+		b.kv.addLocal(key, sibling(a.addr, 1, key, nil))
+	}
+	conflicting := shared[5]
+	b.kv.addLocal(conflicting, sibling(b.addr, 1, "b's", nil))
+
+	repaired, err := b.ae.exchange(ctx, a.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len(shared) - len(inSync); repaired != want {
+		t.Fatalf("b repaired %d writes, want %d", repaired, want)
+	}
+	// Only the keys of the ranges both own reach b.
+	for _, key := range shared {
+		if !slices.ContainsFunc(b.kv.local(key), func(s *pb.Sibling) bool { return s.Node == a.addr }) {
+			t.Fatalf("b lacks a's write of shared key %s: %v", key, b.kv.local(key))
+		}
+	}
+	for _, key := range append(unshared, stray) {
+		if sibs := b.kv.local(key); len(sibs) > 0 {
+			t.Fatalf("b got %s, which a and b don't both own: %v", key, sibs)
+		}
+	}
+	if got := len(b.kv.local(conflicting)); got != 2 {
+		t.Fatalf("b has %d siblings of the key written concurrently, want 2", got)
+	}
+
+	// a takes b's concurrent write in turn, after which the trees of the
+	// ranges they share are equal and there is nothing more to repair.
+	if repaired, err := a.ae.exchange(ctx, b.addr); err != nil || repaired != 1 {
+		t.Fatalf("a's exchange = %d, %v, want 1 write repaired", repaired, err)
+	}
+	a.kv.mu.Lock()
+	owned := a.kv.treesLocked().owned
+	a.kv.mu.Unlock()
+	for _, owners := range owned {
+		if slices.Contains(owners, b.addr) && !bytes.Equal(c.root(0, owners), c.root(1, owners)) {
+			t.Fatalf("trees of range %v differ after exchanging both ways", owners)
+		}
+	}
+	if repaired, err := b.ae.exchange(ctx, a.addr); err != nil || repaired != 0 {
+		t.Fatalf("exchange after repairing = %d, %v, want nothing repaired", repaired, err)
+	}
+}
+
+func TestDiffLeavesOwnersOnly(t *testing.T) {
+	c := newQuorumRing(t, 3, 2)
+	a := c.nodes[0]
+	var owners []string
+	for i := 0; owners == nil; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if o := a.kv.quorum.owners(key); slices.Contains(o, a.addr) {
+			owners = o
+			a.kv.addLocal(key, sibling(a.addr, 1, key, nil))
+		}
+	}
+	other := c.nodes[1].addr
+	if slices.Contains(owners, other) {
+		other = c.nodes[2].addr
+	}
+	leaves := make([]uint32, merkleLeaves)
+	for i := range leaves {
+		leaves[i] = uint32(i)
+	}
+
+	m := c.nodes[1].kv.quorum.member(a.addr)
+	for _, replica := range []string{owners[0], owners[1], other} {
+		stream, err := m.antiEntropy.DiffLeaves(context.Background(), &pb.LeafRequest{Leaves: leaves, Replica: replica, Owners: owners})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got int
+		for {
+			if _, err := stream.Recv(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			got++
+		}
+		want := 0
+		if slices.Contains(owners, replica) {
+			want = 1
+		}
+		if got != want {
+			t.Fatalf("DiffLeaves asked by %s for the range of %v sent %d keys, want %d", replica, owners, got, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	pb "distributed-systems/16-assignment2/proto"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// A key's values in quorum replication are kept as siblings, each
+// tagged with its own write, the dot (node, counter), and with the
+// context it was written with: a vector clock of the writes the client
+// had seen. A write replaces the siblings whose dots its context covers;
+// any others were written without its knowledge, so they are concurrent
+// with it and both are kept. Since the decision rests on the dot and
+// not on a clock that includes it, two writes that reach the same node
+// without a context stay siblings too. That needs a node never to reuse
+// a dot, even after a restart has lost the siblings that showed which
+// counters it had taken, so its counter is kept on disk.
+
+// covers reports whether clock includes the write counter of node.
+func covers(clock *pb.VectorClock, node string, counter uint64) bool {
+	return clock.GetCounters()[node] >= counter
+}
+
+// mergeClocks returns the clock that covers everything a and b do.
+func mergeClocks(a, b *pb.VectorClock) *pb.VectorClock {
+	merged := &pb.VectorClock{Counters: make(map[string]uint64)}
+	for _, c := range []*pb.VectorClock{a, b} {
+		for node, n := range c.GetCounters() {
+			merged.Counters[node] = max(merged.Counters[node], n)
+		}
+	}
+	return merged
+}
+
+// clockOf returns the clock covering a sibling and everything it
+// replaced.
+func clockOf(s *pb.Sibling) *pb.VectorClock {
+	clock := mergeClocks(s.Context, nil)
+	clock.Counters[s.Node] = max(clock.Counters[s.Node], s.Counter)
+	return clock
+}
+
+// addSibling returns siblings with sib added and the siblings it
+// replaces removed, and whether that changed anything: sib is dropped if
+// it is already there or was replaced by one of siblings. siblings is
+// not modified.
+func addSibling(siblings []*pb.Sibling, sib *pb.Sibling) ([]*pb.Sibling, bool) {
+	for _, s := range siblings {
+		if s.Node == sib.Node && s.Counter == sib.Counter || covers(s.Context, sib.Node, sib.Counter) {
+			return siblings, false
+		}
+	}
+	kept := make([]*pb.Sibling, 0, len(siblings)+1)
+	for _, s := range siblings {
+		if !covers(sib.Context, s.Node, s.Counter) {
+			kept = append(kept, s)
+		}
+	}
+	return append(kept, sib), true
+}
+
+// mergeSiblings returns the siblings of a key after both a and b.
+func mergeSiblings(a, b []*pb.Sibling) []*pb.Sibling {
+	for _, s := range b {
+		a, _ = addSibling(a, s)
+	}
+	return a
+}
+
+// contextOf returns the context that replaces all of siblings.
+func contextOf(siblings []*pb.Sibling) *pb.VectorClock {
+	ctx := &pb.VectorClock{Counters: make(map[string]uint64)}
+	for _, s := range siblings {
+		ctx = mergeClocks(ctx, clockOf(s))
+	}
+	return ctx
+}
+
+// newSibling returns a write of value taken by node with context, given
+// the siblings node holds for the key.
+func newSibling(node, value string, context *pb.VectorClock, siblings []*pb.Sibling) *pb.Sibling {
+	// A node's counter must grow with every write it takes. Its earlier
+	// writes to the key are among its siblings or covered by their
+	// contexts.
+	counter := context.GetCounters()[node]
+	for _, s := range siblings {
+		counter = max(counter, clockOf(s).Counters[node])
+	}
+	return &pb.Sibling{Value: value, Context: mergeClocks(context, nil), Node: node, Counter: counter + 1}
+}
+
+// counterFile holds a node's dot counter in the data directory.
+const counterFile = "counter.json"
+
+// dotBlock is how many counters a node reserves on disk at a time.
+const dotBlock = 1024
+
+// dotCounter hands out the counters of a node's dots, each greater than
+// any handed out before, across restarts. Rather than write every
+// counter to disk it reserves them a block at a time, and after a
+// restart starts past the last block reserved.
+type dotCounter struct {
+	path string
+
+	mu   sync.Mutex
+	last uint64
+	// limit is the highest counter reserved on disk.
+	limit uint64
+}
+
+// dotLimit is the contents of the counter file.
+type dotLimit struct {
+	Limit uint64 `json:"limit"`
+}
+
+// openDotCounter opens the counter kept at path, creating it if needed.
+func openDotCounter(path string) (*dotCounter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	var l dotLimit
+	if err := readJSON(path, &l); err != nil {
+		return nil, err
+	}
+	return &dotCounter{path: path, last: l.Limit, limit: l.Limit}, nil
+}
+
+// take returns a counter not handed out before, at least atLeast.
+func (c *dotCounter) take(atLeast uint64) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	next := max(c.last+1, atLeast)
+	if next > c.limit {
+		data, err := json.Marshal(dotLimit{Limit: next + dotBlock})
+		if err != nil {
+			return 0, err
+		}
+		if err := commitlog.WriteFileAtomic(c.path, data); err != nil {
+			return 0, err
+		}
+		c.limit = next + dotBlock
+	}
+	c.last = next
+	return next, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	pb "distributed-systems/16-assignment2/proto"
+)
+
+// dots returns the dots of siblings, sorted, to compare sets of
+// siblings.
+func dots(siblings []*pb.Sibling) []string {
+	var ds []string
+	for _, s := range siblings {
+		ds = append(ds, fmt.Sprintf("%s:%d", s.Node, s.Counter))
+	}
+	slices.Sort(ds)
+	return ds
+}
+
+func TestAddSibling(t *testing.T) {
+	a1 := sibling("a", 1, "x", nil)
+	b1 := sibling("b", 1, "y", nil)
+	tests := []struct {
+		name     string
+		siblings []*pb.Sibling
+		add      *pb.Sibling
+		want     []string
+		changed  bool
+	}{
+		{"first write", nil, a1, []string{"a:1"}, true},
+		{"already held", []*pb.Sibling{a1}, sibling("a", 1, "x", nil), []string{"a:1"}, false},
+		{"written after seeing it", []*pb.Sibling{a1}, sibling("b", 1, "z", map[string]uint64{"a": 1}), []string{"b:1"}, true},
+		{"the node's next write", []*pb.Sibling{a1}, sibling("a", 2, "z", map[string]uint64{"a": 1}), []string{"a:2"}, true},
+		{"concurrent", []*pb.Sibling{a1}, b1, []string{"a:1", "b:1"}, true},
+		{"concurrent without a context, on the same node", []*pb.Sibling{a1}, sibling("a", 2, "z", nil), []string{"a:1", "a:2"}, true},
+		{"replacing one of two", []*pb.Sibling{a1, b1}, sibling("c", 1, "z", map[string]uint64{"a": 1}), []string{"b:1", "c:1"}, true},
+		{"replacing both", []*pb.Sibling{a1, b1}, sibling("c", 1, "z", map[string]uint64{"a": 1, "b": 1}), []string{"c:1"}, true},
+		{"replaced already", []*pb.Sibling{sibling("b", 2, "z", map[string]uint64{"a": 1})}, a1, []string{"b:2"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := slices.Clone(tt.siblings)
+			got, changed := addSibling(tt.siblings, tt.add)
+			if !slices.Equal(dots(got), tt.want) || changed != tt.changed {
+				t.Fatalf("addSibling = %v, %v, want %v, %v", dots(got), changed, tt.want, tt.changed)
+			}
+			if !slices.Equal(tt.siblings, before) {
+				t.Fatal("addSibling modified the siblings passed in")
+			}
+		})
+	}
+}
+
+func TestMergeSiblings(t *testing.T) {
+	a1 := sibling("a", 1, "x", nil)
+	b1 := sibling("b", 1, "y", nil)
+	b2 := sibling("b", 2, "z", map[string]uint64{"a": 1, "b": 1})
+	c1 := sibling("c", 1, "w", map[string]uint64{"a": 1})
+	tests := []struct {
+		name string
+		a, b []*pb.Sibling
+		want []string
+	}{
+		{"one side empty", []*pb.Sibling{a1, b1}, nil, []string{"a:1", "b:1"}},
+		{"the same", []*pb.Sibling{a1}, []*pb.Sibling{a1}, []string{"a:1"}},
+		{"concurrent", []*pb.Sibling{a1}, []*pb.Sibling{b1}, []string{"a:1", "b:1"}},
+		{"one side later", []*pb.Sibling{a1, b1}, []*pb.Sibling{b2}, []string{"b:2"}},
+		{"partly later", []*pb.Sibling{a1, b1}, []*pb.Sibling{c1}, []string{"b:1", "c:1"}},
+		{"later and concurrent", []*pb.Sibling{b2}, []*pb.Sibling{a1, c1}, []string{"b:2", "c:1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Replicas merging each other's siblings agree either way.
+			if got := dots(mergeSiblings(tt.a, tt.b)); !slices.Equal(got, tt.want) {
+				t.Fatalf("mergeSiblings(a, b) = %v, want %v", got, tt.want)
+			}
+			if got := dots(mergeSiblings(tt.b, tt.a)); !slices.Equal(got, tt.want) {
+				t.Fatalf("mergeSiblings(b, a) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSibling(t *testing.T) {
+	tests := []struct {
+		name     string
+		context  map[string]uint64
+		siblings []*pb.Sibling
+		want     uint64
+	}{
+		{"first write", nil, nil, 1},
+		{"after the node's own write", map[string]uint64{"a": 1}, []*pb.Sibling{sibling("a", 1, "x", nil)}, 2},
+		{"blind, beside the node's own write", nil, []*pb.Sibling{sibling("a", 3, "x", nil)}, 4},
+		{"the node's write known only from a context", map[string]uint64{"a": 5}, nil, 6},
+		{"the node's write replaced by another's", nil, []*pb.Sibling{sibling("b", 1, "y", map[string]uint64{"a": 2})}, 3},
+		{"after another node's write", map[string]uint64{"b": 4}, []*pb.Sibling{sibling("b", 4, "y", nil)}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var context *pb.VectorClock
+			if tt.context != nil {
+				context = &pb.VectorClock{Counters: tt.context}
+			}
+			sib := newSibling("a", "v", context, tt.siblings)
+			if sib.Node != "a" || sib.Counter != tt.want || sib.Value != "v" {
+				t.Fatalf("newSibling = %s:%d %q, want a:%d", sib.Node, sib.Counter, sib.Value, tt.want)
+			}
+			// It replaces what its context covers and nothing else.
+			got, _ := addSibling(tt.siblings, sib)
+			for _, s := range tt.siblings {
+				replaced := !slices.Contains(got, s)
+				if want := covers(context, s.Node, s.Counter); replaced != want {
+					t.Fatalf("%s:%d replaced = %v, want %v", s.Node, s.Counter, replaced, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDotCounter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), counterFile)
+	c, err := openDotCounter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	take := func(c *dotCounter, atLeast uint64) uint64 {
+		t.Helper()
+		n, err := c.take(atLeast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	for want := uint64(1); want <= 3; want++ {
+		if got := take(c, 1); got != want {
+			t.Fatalf("take(1) = %d, want %d", got, want)
+		}
+	}
+	if got := take(c, 10); got != 10 {
+		t.Fatalf("take(10) = %d, want 10", got)
+	}
+	if got := take(c, 2*dotBlock); got != 2*dotBlock {
+		t.Fatalf("take(%d) = %d", 2*dotBlock, got)
+	}
+
+	// After a restart, the counters go on past every one taken before.
+	reopened, err := openDotCounter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := take(reopened, 1); got <= 2*dotBlock {
+		t.Fatalf("take(1) after reopening = %d, want past %d", got, 2*dotBlock)
+	}
+}
+
+func TestBlindWriteAfterRestart(t *testing.T) {
+	c := newQuorumRing(t, 3, 3)
+	ctx := context.Background()
+	if _, err := c.nodes[0].kv.Put(ctx, &pb.KeyValue{Key: "k", Value: "1", Consistency: pb.Consistency_CONSISTENCY_ALL}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The restarted node has lost its siblings of the key, and with them
+	// the counter of its last write to it. A write it takes without a
+	// context is concurrent with that one, and kept beside it.
+	c.restart(0)
+	s := c.nodes[0].kv
+	for _, other := range c.nodes[1:] {
+		if _, err := s.quorum.addMember(other.addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Put(ctx, &pb.KeyValue{Key: "k", Value: "2", Consistency: pb.Consistency_CONSISTENCY_ALL}); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{1, 2} {
+		if got := c.nodes[i].kv.local("k"); len(got) != 2 {
+			t.Fatalf("node %d holds %v, want both writes", i, dots(got))
+		}
+	}
+	v, err := s.Get(ctx, &pb.Key{Key: "k", Consistency: pb.Consistency_CONSISTENCY_ALL})
+	if err != nil || len(v.Siblings) != 2 {
+		t.Fatalf("Get at ALL = %v, %v, want both writes as siblings", v, err)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	pb "distributed-systems/16-assignment2/proto"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/protobuf/proto"
+)
+
+// hintsDir holds a file of hints for each peer in the data directory.
+const hintsDir = "hints"
+
+// hintRetryInterval is how often hints are offered to their replica.
+const hintRetryInterval = time.Second
+
+var (
+	hintsPending = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kvstore_hints_pending",
+		Help: "Writes waiting to be handed off to a replica that missed them.",
+	}, []string{"peer"})
+	hintBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kvstore_hint_bytes",
+		Help: "Size of the hints waiting for a replica.",
+	}, []string{"peer"})
+	hintsDelivered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kvstore_hints_delivered_total",
+		Help: "Hints handed off to their replica.",
+	}, []string{"peer"})
+	hintsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kvstore_hints_dropped_total",
+		Help: "Hints dropped undelivered, because the replica's hints were full or the hint expired.",
+	}, []string{"peer", "reason"})
+)
+
+// hint is a write a replica missed.
+type hint struct {
+	at    time.Time
+	write *pb.KeyValue
+	size  int64 // of its frame in the file
+}
+
+// hintQueue holds the writes one replica failed to store, and hands them
+// off in the order they failed once it can be reached again. The hints
+// are kept in a file of frames, as the Raft log is, each holding the
+// time the write failed, as big-endian Unix nanoseconds, and the write.
+// They are also kept in memory, which maxBytes bounds: once the hints
+// reach it, further failed writes are dropped, as are hints older than
+// ttl. A replica that misses those writes needs repairing some other
+// way. A hint is removed from the file only after it is delivered, so a
+// crash in between delivers it twice, which the replica ignores.
+type hintQueue struct {
+	peer     string
+	path     string
+	client   pb.KeyValueStoreClient
+	maxBytes int64
+	ttl      time.Duration
+
+	mu     sync.Mutex
+	file   *os.File
+	hints  []hint
+	size   int64
+	closed bool
+	done   chan struct{}
+}
+
+// openHints opens the hints for peer in dir and starts handing them off.
+func openHints(dir, peer string, client pb.KeyValueStoreClient, maxBytes int64, ttl time.Duration) (*hintQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	q := &hintQueue{
+		peer:     peer,
+		path:     filepath.Join(dir, strings.ReplaceAll(peer, ":", "_")),
+		client:   client,
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		done:     make(chan struct{}),
+	}
+	f, err := os.OpenFile(q.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	payloads, size := readFrames(f, info.Size())
+	for _, payload := range payloads {
+		h, err := decodeHint(payload)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("hints for %s: %w", peer, err)
+		}
+		q.hints = append(q.hints, h)
+		q.size += h.size
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	q.file = f
+	q.updateMetrics()
+	go q.run()
+	return q, nil
+}
+
+func decodeHint(payload []byte) (hint, error) {
+	if len(payload) < 8 {
+		return hint{}, fmt.Errorf("short hint of %d bytes", len(payload))
+	}
+	write := new(pb.KeyValue)
+	if err := proto.Unmarshal(payload[8:], write); err != nil {
+		return hint{}, err
+	}
+	at := time.Unix(0, int64(binary.BigEndian.Uint64(payload)))
+	return hint{at: at, write: write, size: int64(8 + len(payload))}, nil
+}
+
+func encodeHint(buf []byte, h hint) ([]byte, error) {
+	write, err := proto.Marshal(h.write)
+	if err != nil {
+		return nil, err
+	}
+	payload := binary.BigEndian.AppendUint64(nil, uint64(h.at.UnixNano()))
+	return appendFrame(buf, append(payload, write...)), nil
+}
+
+func (q *hintQueue) updateMetrics() {
+	hintsPending.WithLabelValues(q.peer).Set(float64(len(q.hints)))
+	hintBytes.WithLabelValues(q.peer).Set(float64(q.size))
+}
+
+// add stores a write the replica failed to store.
+func (q *hintQueue) add(write *pb.KeyValue) error {
+	h := hint{at: time.Now(), write: write}
+	frame, err := encodeHint(nil, h)
+	if err != nil {
+		return err
+	}
+	h.size = int64(len(frame))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return fmt.Errorf("hints for %s are closed", q.peer)
+	}
+	if q.size+h.size > q.maxBytes {
+		hintsDropped.WithLabelValues(q.peer, "full").Inc()
+		return fmt.Errorf("hints for %s are full at %d bytes", q.peer, q.size)
+	}
+	if _, err := q.file.Write(frame); err != nil {
+		return err
+	}
+	if err := q.file.Sync(); err != nil {
+		return err
+	}
+	q.hints = append(q.hints, h)
+	q.size += h.size
+	q.updateMetrics()
+	return nil
+}
+
+// run offers the hints to the replica until it takes them, or the
+// hints are closed.
+func (q *hintQueue) run() {
+	ticker := time.NewTicker(hintRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.handOff()
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// close stops handing off the hints and deletes them, for a replica
+// that left the ring.
+func (q *hintQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.done)
+	q.file.Close()
+	if err := os.Remove(q.path); err != nil {
+		log.Printf("Removing hints for %s: %v", q.peer, err)
+	}
+	hintsPending.DeleteLabelValues(q.peer)
+	hintBytes.DeleteLabelValues(q.peer)
+}
+
+// handOff drops expired hints and delivers the rest in order, stopping
+// at the first the replica fails to store.
+func (q *hintQueue) handOff() {
+	q.mu.Lock()
+	removed := 0
+	for len(q.hints) > 0 && time.Since(q.hints[0].at) > q.ttl {
+		q.remove()
+		hintsDropped.WithLabelValues(q.peer, "expired").Inc()
+		removed++
+	}
+	q.mu.Unlock()
+
+	for {
+		q.mu.Lock()
+		if len(q.hints) == 0 {
+			q.mu.Unlock()
+			break
+		}
+		h := q.hints[0]
+		q.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+		_, err := q.client.Replicate(ctx, h.write)
+		cancel()
+		if err != nil {
+			break
+		}
+		q.mu.Lock()
+		q.remove()
+		q.mu.Unlock()
+		hintsDelivered.WithLabelValues(q.peer).Inc()
+		removed++
+	}
+
+	if removed > 0 {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.closed {
+			return
+		}
+		if err := q.rewrite(); err != nil {
+			log.Printf("Rewriting hints for %s: %v", q.peer, err)
+		}
+		q.updateMetrics()
+	}
+}
+
+// remove drops the first hint from memory.
+func (q *hintQueue) remove() {
+	q.size -= q.hints[0].size
+	q.hints = q.hints[1:]
+}
+
+// rewrite replaces the file with the hints still pending.
+func (q *hintQueue) rewrite() error {
+	var buf []byte
+	for _, h := range q.hints {
+		var err error
+		if buf, err = encodeHint(buf, h); err != nil {
+			return err
+		}
+	}
+	if err := commitlog.WriteFileAtomic(q.path, buf); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	q.file.Close()
+	q.file = f
+	return nil
+}
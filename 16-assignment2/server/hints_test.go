@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "distributed-systems/16-assignment2/proto"
+	"google.golang.org/grpc"
+)
+
+// fakeReplica is the replica of a hint queue. It records the keys of
+// the writes it stores, and fails them while it is down.
+type fakeReplica struct {
+	pb.KeyValueStoreClient
+	mu   sync.Mutex
+	down bool
+	// failOnce fails the next write of each key in it.
+	failOnce map[string]bool
+	keys     []string
+}
+
+func (f *fakeReplica) Replicate(ctx context.Context, kv *pb.KeyValue, _ ...grpc.CallOption) (*pb.Ack, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down || f.failOnce[kv.Key] {
+		delete(f.failOnce, kv.Key)
+		return nil, errors.New("replica unreachable")
+	}
+	f.keys = append(f.keys, kv.Key)
+	return &pb.Ack{Success: true}, nil
+}
+
+func (f *fakeReplica) setDown(down bool) {
+	f.mu.Lock()
+	f.down = down
+	f.mu.Unlock()
+}
+
+func (f *fakeReplica) stored() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.keys)
+}
+
+func (q *hintQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.hints)
+}
+
+// openTestHints opens hints in dir for a replica, closing them when the
+// test ends.
+func openTestHints(t *testing.T, dir string, replica *fakeReplica, maxBytes int64, ttl time.Duration) *hintQueue {
+	t.Helper()
+	q, err := openHints(dir, "127.0.0.1:7000", replica, maxBytes, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(q.close)
+	return q
+}
+
+func addHints(t *testing.T, q *hintQueue, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if err := q.add(&pb.KeyValue{Key: key, Sibling: sibling("a", 1, key, nil)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// drained reports whether q has no hints left, in memory or in its
+// file.
+func drained(q *hintQueue) bool {
+	info, err := os.Stat(q.path)
+	return q.pending() == 0 && err == nil && info.Size() == 0
+}
+
+// waitFor waits a few hand-off rounds for cond to hold.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * hintRetryInterval)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHintsHandOffInOrder(t *testing.T) {
+	replica := &fakeReplica{down: true, failOnce: map[string]bool{"k2": true}}
+	q := openTestHints(t, t.TempDir(), replica, 1<<20, time.Hour)
+	keys := []string{"k0", "k1", "k2", "k3", "k4"}
+	addHints(t, q, keys...)
+
+	time.Sleep(hintRetryInterval + 100*time.Millisecond)
+	if got := replica.stored(); len(got) != 0 || q.pending() != len(keys) {
+		t.Fatalf("while the replica is down: %v stored, %d pending", got, q.pending())
+	}
+
+	// A write the replica fails holds back the ones after it, so they
+	// are stored in the order they were missed.
+	replica.setDown(false)
+	waitFor(t, "the hints to be handed off", func() bool { return drained(q) })
+	if got := replica.stored(); !slices.Equal(got, keys) {
+		t.Fatalf("stored %v, want %v", got, keys)
+	}
+}
+
+func TestHintsReopen(t *testing.T) {
+	dir := t.TempDir()
+	q := openTestHints(t, dir, &fakeReplica{down: true}, 1<<20, time.Hour)
+	addHints(t, q, "k0", "k1", "k2")
+
+	// The file a crash leaves, with a write torn at its end.
+	data, err := os.ReadFile(q.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed := t.TempDir()
+	torn := append(data, data[:len(data)/6]...)
+	if err := os.WriteFile(filepath.Join(crashed, filepath.Base(q.path)), torn, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	replica := &fakeReplica{}
+	reopened := openTestHints(t, crashed, replica, 1<<20, time.Hour)
+	if got := reopened.pending(); got != 3 {
+		t.Fatalf("reopened with %d hints, want 3", got)
+	}
+	waitFor(t, "the reopened hints to be handed off", func() bool { return drained(reopened) })
+	if got := strings.Join(replica.stored(), " "); got != "k0 k1 k2" {
+		t.Fatalf("stored %s, want k0 k1 k2", got)
+	}
+}
+
+func TestHintsFull(t *testing.T) {
+	frame, err := encodeHint(nil, hint{at: time.Now(), write: &pb.KeyValue{Key: "k0", Sibling: sibling("a", 1, "k0", nil)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica := &fakeReplica{down: true}
+	q := openTestHints(t, t.TempDir(), replica, int64(2*len(frame)), time.Hour)
+	addHints(t, q, "k0", "k1")
+	if err := q.add(&pb.KeyValue{Key: "k2", Sibling: sibling("a", 1, "k2", nil)}); err == nil || !strings.Contains(err.Error(), "full") {
+		t.Fatalf("adding beyond the limit = %v, want the hints full", err)
+	}
+
+	// Handing hints off makes room for more.
+	replica.setDown(false)
+	waitFor(t, "the hints to be handed off", func() bool { return drained(q) })
+	replica.setDown(true)
+	addHints(t, q, "k3", "k4")
+	if got := q.pending(); got != 2 {
+		t.Fatalf("%d hints pending after making room, want 2", got)
+	}
+}
+
+func TestHintsExpire(t *testing.T) {
+	replica := &fakeReplica{down: true}
+	q := openTestHints(t, t.TempDir(), replica, 1<<20, 10*time.Millisecond)
+	for i := range 3 {
+		addHints(t, q, fmt.Sprintf("k%d", i))
+	}
+	time.Sleep(20 * time.Millisecond)
+	replica.setDown(false)
+	waitFor(t, "the hints to expire", func() bool { return drained(q) })
+	if got := replica.stored(); len(got) != 0 {
+		t.Fatalf("expired hints were handed off: %v", got)
+	}
+}
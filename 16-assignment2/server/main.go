@@ -2,51 +2,68 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	pb "distributed-systems/16-assignment2/proto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// server replicates the store either through Raft, when raft is set, or
+// leaderless with read and write quorums, when quorum is.
 type server struct {
 	pb.UnimplementedKeyValueStoreServer
-	mu    sync.Mutex
-	store map[string]string
-	peers []string
+	mu       sync.Mutex
+	store    map[string]string
+	siblings map[string][]*pb.Sibling // in place of store in quorum replication
+	trees    *rangeTrees              // of siblings, for the ring they were built for
+	raft     *raftNode
+	quorum   *quorumConfig
 }
 
+// Put commits the write through Raft: it is acked once a majority of
+// the nodes have it in their logs. A follower answers with the leader's
+// address for the client to retry there. In quorum replication any node
+// takes the write.
 func (s *server) Put(ctx context.Context, kv *pb.KeyValue) (*pb.Ack, error) {
-	s.mu.Lock()
-	s.store[kv.Key] = kv.Value
-	s.mu.Unlock()
-
-	// Replicate to peers
-	for _, peer := range s.peers {
-		go func(peer string) {
-			conn, err := grpc.Dial(peer, grpc.WithInsecure())
-			if err != nil {
-				log.Printf("Failed to connect to peer %s: %v", peer, err)
-				return
-			}
-			defer conn.Close()
-
-			client := pb.NewKeyValueStoreClient(conn)
-			_, err = client.Replicate(context.Background(), kv)
-			if err != nil {
-				log.Printf("Replication to %s failed: %v", peer, err)
-			}
-		}(peer)
+	if s.quorum != nil {
+		return s.putQuorum(ctx, kv)
+	}
+	err := s.raft.propose(ctx, kv)
+	var notLeader *notLeaderError
+	switch {
+	case errors.As(err, &notLeader) && notLeader.leader != "":
+		return &pb.Ack{Success: false, Leader: notLeader.leader}, nil
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return nil, status.FromContextError(err).Err()
+	case err != nil:
+		return nil, status.Error(codes.Unavailable, err.Error())
 	}
-
 	return &pb.Ack{Success: true}, nil
 }
 
+// Get reads this node's copy of the store, which on a Raft follower may
+// not have caught up with the latest committed writes yet. In quorum
+// replication it reads from as many replicas as the consistency asks.
 func (s *server) Get(ctx context.Context, key *pb.Key) (*pb.Value, error) {
+	if s.quorum != nil {
+		return s.getQuorum(ctx, key)
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -57,10 +74,19 @@ func (s *server) Get(ctx context.Context, key *pb.Key) (*pb.Value, error) {
 	return &pb.Value{Value: value}, nil
 }
 
+// List streams this node's keys. In quorum replication those are the
+// keys it owns, and a key with siblings is sent once for each.
 func (s *server) List(_ *pb.Empty, stream pb.KeyValueStore_ListServer) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	for k, siblings := range s.siblings {
+		for _, sib := range siblings {
+			if err := stream.Send(&pb.KeyValue{Key: k, Value: sib.Value, Sibling: sib}); err != nil {
+				return err
+			}
+		}
+	}
 	for k, v := range s.store {
 		if err := stream.Send(&pb.KeyValue{Key: k, Value: v}); err != nil {
 			return err
@@ -69,40 +95,163 @@ func (s *server) List(_ *pb.Empty, stream pb.KeyValueStore_ListServer) error {
 	return nil
 }
 
+// Replicate stores a write taken by another replica, or handed over to
+// this node as a new owner of the key, in quorum replication. A write
+// sent for a quorum is refused unless this node owns the key. With Raft
+// it is refused: writes reach the other nodes through the Raft log, and
+// one applied outside it would make this node diverge.
 func (s *server) Replicate(ctx context.Context, kv *pb.KeyValue) (*pb.Ack, error) {
+	if s.quorum == nil {
+		return nil, status.Error(codes.FailedPrecondition, "writes are replicated through Raft; use Put")
+	}
+	if kv.Sibling == nil {
+		return nil, status.Error(codes.InvalidArgument, "replicated write has no sibling")
+	}
+	if kv.Forwarded && !slices.Contains(s.quorum.owners(kv.Key), s.quorum.id) {
+		return nil, status.Errorf(codes.Unavailable, "%s doesn't own %q", s.quorum.id, kv.Key)
+	}
+	s.addLocal(kv.Key, kv.Sibling)
+	return &pb.Ack{Success: true}, nil
+}
+
+// apply applies a committed write to the store.
+func (s *server) apply(kv *pb.KeyValue) {
 	s.mu.Lock()
 	s.store[kv.Key] = kv.Value
 	s.mu.Unlock()
-	log.Printf("Replicated: %s = %s", kv.Key, kv.Value)
-	return &pb.Ack{Success: true}, nil
+}
+
+func (s *server) snapshot() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.Marshal(s.store)
+}
+
+func (s *server) restore(data []byte) error {
+	store := make(map[string]string)
+	if err := json.Unmarshal(data, &store); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.store = store
+	s.mu.Unlock()
+	return nil
+}
+
+// dialPeer connects to another node. A node coming back must hear from
+// the others quickly, before its Raft election timeout in particular,
+// so reconnect attempts back off no further than a couple of Raft
+// heartbeats.
+func dialPeer(addr string) (*grpc.ClientConn, error) {
+	return grpc.Dial(addr, grpc.WithInsecure(), grpc.WithConnectParams(grpc.ConnectParams{
+		Backoff: backoff.Config{
+			BaseDelay:  heartbeatInterval,
+			Multiplier: 1.6,
+			Jitter:     0.2,
+			MaxDelay:   2 * heartbeatInterval,
+		},
+	}))
 }
 
 func main() {
-	if len(os.Args) < 3 {
-		log.Fatalf("Usage: go run main.go <port> <peer1,peer2>")
+	replication := flag.String("replication", "raft", "how writes reach the other nodes: raft or quorum")
+	dataDir := flag.String("data", "", "directory for the Raft log and snapshots, or the hints and dot counter of quorum replication (default <replication>-<port>)")
+	snapshotEvery := flag.Uint64("snapshot-every", 1000, "entries applied between snapshots of the store; 0 disables snapshots")
+	replicaCount := flag.Int("n", 3, "nodes that own each key in quorum replication")
+	vnodes := flag.Int("vnodes", 64, "points each node stands at on the hash ring")
+	writeQuorum := flag.Int("w", 0, "owners a quorum write waits for by default (default a majority of n)")
+	readQuorum := flag.Int("r", 0, "owners a quorum read waits for by default (default a majority of n)")
+	hintMaxBytes := flag.Int64("hint-max-bytes", 64<<20, "size of the hints kept for each replica, beyond which missed writes are dropped")
+	hintTTL := flag.Duration("hint-ttl", 3*time.Hour, "how long a missed write is kept for its replica")
+	readRepair := flag.String("read-repair", "async", "whether a quorum read waits for the replicas it repairs: async or blocking")
+	antiEntropyInterval := flag.Duration("anti-entropy-interval", 30*time.Second, "how often a quorum replica compares its keys with a peer's; 0 disables anti-entropy")
+	metricsAddr := flag.String("metrics-addr", "", "address to serve Prometheus metrics on at /metrics (default none)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go run . [-replication raft|quorum] [-data dir] [-snapshot-every n] [-n n] [-vnodes n] [-w n] [-r n] [-hint-max-bytes n] [-hint-ttl d] [-read-repair async|blocking] [-anti-entropy-interval d] [-metrics-addr addr] <port> <peer1,peer2>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
 	}
 
-	port := os.Args[1]
-	peerStr := os.Args[2]
+	port := flag.Arg(0)
+	peerStr := flag.Arg(1)
 	peers := []string{}
 	if peerStr != "" {
 		for _, p := range strings.Split(peerStr, ",") {
 			peers = append(peers, fmt.Sprintf("localhost:%s", p))
 		}
 	}
+	if *dataDir == "" {
+		*dataDir = filepath.Join(".", *replication+"-"+port)
+	}
 
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
+	id := fmt.Sprintf("localhost:%s", port)
+	kv := &server{store: make(map[string]string), siblings: make(map[string][]*pb.Sibling)}
 	s := grpc.NewServer()
-	pb.RegisterKeyValueStoreServer(s, &server{
-		store: make(map[string]string),
-		peers: peers,
-	})
+	pb.RegisterKeyValueStoreServer(s, kv)
+	switch *replication {
+	case "raft":
+		kv.raft, err = newRaftNode(id, peers, *dataDir, kv, *snapshotEvery)
+		if err != nil {
+			log.Fatalf("failed to start raft: %v", err)
+		}
+		pb.RegisterRaftServer(s, kv.raft)
+		log.Printf("Server running on port %s with peers %v, data in %s", port, peers, *dataDir)
+	case "quorum":
+		kv.quorum, err = newQuorumConfig(id, *replicaCount, *writeQuorum, *readQuorum, *vnodes)
+		if err != nil {
+			log.Fatalf("invalid quorums: %v", err)
+		}
+		switch *readRepair {
+		case "async":
+		case "blocking":
+			kv.quorum.blockingRepair = true
+		default:
+			log.Fatalf("unknown read repair %q: want async or blocking", *readRepair)
+		}
+		kv.quorum.hintDir = filepath.Join(*dataDir, hintsDir)
+		kv.quorum.hintMaxBytes = *hintMaxBytes
+		kv.quorum.hintTTL = *hintTTL
+		kv.quorum.counter, err = openDotCounter(filepath.Join(*dataDir, counterFile))
+		if err != nil {
+			log.Fatalf("failed to open the dot counter: %v", err)
+		}
+		for _, peer := range peers {
+			if _, err := kv.quorum.addMember(peer); err != nil {
+				log.Fatalf("failed to add peer %s: %v", peer, err)
+			}
+		}
+		ae := &antiEntropy{s: kv}
+		pb.RegisterAntiEntropyServer(s, ae)
+		if *antiEntropyInterval > 0 {
+			go ae.run(*antiEntropyInterval)
+		}
+		pb.RegisterMembershipServer(s, &membership{s: kv})
+		go kv.join(peers)
+		go func() {
+			<-kv.quorum.left
+			s.GracefulStop()
+		}()
+		log.Printf("Server running on port %s with peers %v, n=%d w=%d r=%d, data in %s", port, peers, kv.quorum.n, kv.quorum.w, kv.quorum.r, *dataDir)
+	default:
+		log.Fatalf("unknown replication %q: want raft or quorum", *replication)
+	}
+
+	if *metricsAddr != "" {
+		http.Handle("/metrics", promhttp.Handler())
+		go func() {
+			log.Fatal(http.ListenAndServe(*metricsAddr, nil))
+		}()
+	}
 
-	log.Printf("Server running on port %s with peers %v", port, peers)
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
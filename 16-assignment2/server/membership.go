@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	pb "distributed-systems/16-assignment2/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ringMembers = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kvstore_ring_members",
+		Help: "Nodes on the hash ring, as this node sees it.",
+	})
+	writesHandedOver = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kvstore_rebalance_writes_total",
+		Help: "Writes handed over to a new owner of their key after the ring changed.",
+	}, []string{"peer"})
+	writesHinted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kvstore_rebalance_writes_hinted_total",
+		Help: "Writes for a new owner of their key after the ring changed that it failed to store, and was hinted instead.",
+	}, []string{"peer"})
+)
+
+// A node joins the ring by telling the peers it was started with, which
+// tell it of the rest of the ring to tell in turn. It stays on the ring
+// until it is told to leave; a node that is down is still an owner of
+// its keys, and catches up through hints and anti-entropy. Membership is
+// not stored: a restarted node joins again through the peers it is
+// started with, so a node that left must be taken off those lists.
+//
+// Whenever the ring changes, each node hands the keys it holds over to
+// their owners that weren't owners before, and drops the keys it no
+// longer owns once their owners have stored them. A write an owner fails
+// to store is hinted, and the key kept until the ring is rebalanced
+// again; a leaving node retries until every owner has its keys, since
+// its hints go with it.
+
+// member is another node of the ring.
+type member struct {
+	conn        *grpc.ClientConn
+	kv          pb.KeyValueStoreClient
+	antiEntropy pb.AntiEntropyClient
+	membership  pb.MembershipClient
+	// hints holds the writes the node missed.
+	hints *hintQueue
+}
+
+// addMember adds addr to the ring, reporting whether it is new.
+func (q *quorumConfig) addMember(addr string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.members[addr]; ok || addr == q.id {
+		return false, nil
+	}
+	conn, err := dialPeer(addr)
+	if err != nil {
+		return false, err
+	}
+	m := &member{
+		conn:        conn,
+		kv:          pb.NewKeyValueStoreClient(conn),
+		antiEntropy: pb.NewAntiEntropyClient(conn),
+		membership:  pb.NewMembershipClient(conn),
+	}
+	m.hints, err = openHints(q.hintDir, addr, m.kv, q.hintMaxBytes, q.hintTTL)
+	if err != nil {
+		conn.Close()
+		return false, err
+	}
+	q.members[addr] = m
+	q.updateRing()
+	return true, nil
+}
+
+// removeMember takes addr off the ring, with its hints: the keys they
+// are for have other owners now. It reports whether addr was a member.
+func (q *quorumConfig) removeMember(addr string) bool {
+	q.mu.Lock()
+	m, ok := q.members[addr]
+	if ok {
+		delete(q.members, addr)
+		q.updateRing()
+	}
+	q.mu.Unlock()
+	if ok {
+		m.hints.close()
+		m.conn.Close()
+	}
+	return ok
+}
+
+// updateRing rebuilds the ring from the members. q.mu must be held.
+func (q *quorumConfig) updateRing() {
+	nodes := slices.Collect(maps.Keys(q.members))
+	if !q.leaving {
+		nodes = append(nodes, q.id)
+	}
+	q.ring = newRing(nodes, q.vnodes)
+	ringMembers.Set(float64(len(nodes)))
+}
+
+// member returns the member at addr, or nil if there is none.
+func (q *quorumConfig) member(addr string) *member {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.members[addr]
+}
+
+// peers returns the other nodes of the ring.
+func (q *quorumConfig) peers() []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return slices.Sorted(maps.Keys(q.members))
+}
+
+// owners returns the key's preference list.
+func (q *quorumConfig) owners(key string) []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.ring.preference(key, q.n)
+}
+
+// currentRing returns the ring as this node sees it now.
+func (q *quorumConfig) currentRing() *ring {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.ring
+}
+
+// forwardTo picks the owner to forward a request to: the first that
+// isn't known to be unreachable. The request isn't retried on another,
+// since a write that failed may still have been stored.
+func (q *quorumConfig) forwardTo(owners []string) *member {
+	var first *member
+	for _, owner := range owners {
+		m := q.member(owner)
+		if m == nil {
+			continue
+		}
+		if m.conn.GetState() != connectivity.TransientFailure {
+			return m
+		}
+		if first == nil {
+			first = m
+		}
+	}
+	return first
+}
+
+// membership serves the Membership service.
+type membership struct {
+	pb.UnimplementedMembershipServer
+	s *server
+}
+
+// Join adds a node to the ring and hands it the keys it now owns.
+func (ms *membership) Join(ctx context.Context, req *pb.Member) (*pb.Members, error) {
+	q := ms.s.quorum
+	added, err := q.addMember(req.Addr)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "adding %s: %v", req.Addr, err)
+	}
+	if added {
+		log.Printf("%s joined the ring", req.Addr)
+		go ms.s.rebalance()
+	}
+	reply := &pb.Members{Addrs: q.peers()}
+	q.mu.RLock()
+	if !q.leaving {
+		reply.Addrs = append(reply.Addrs, q.id)
+	}
+	q.mu.RUnlock()
+	return reply, nil
+}
+
+// Leave takes a node off the ring. This node, told to leave, tells the
+// others, hands its keys over and stops.
+func (ms *membership) Leave(ctx context.Context, req *pb.Member) (*pb.Empty, error) {
+	if req.Addr == ms.s.quorum.id {
+		ms.s.leave()
+		return &pb.Empty{}, nil
+	}
+	if ms.s.quorum.removeMember(req.Addr) {
+		log.Printf("%s left the ring", req.Addr)
+		go ms.s.rebalance()
+	}
+	return &pb.Empty{}, nil
+}
+
+// join tells the seeds that this node is on the ring, and every node
+// they know of in turn, adding those it didn't know of itself.
+func (s *server) join(seeds []string) {
+	q := s.quorum
+	asked := map[string]bool{q.id: true}
+	queue := slices.Clone(seeds)
+	changed := false
+	for len(queue) > 0 {
+		addr := queue[0]
+		queue = queue[1:]
+		m := q.member(addr)
+		if asked[addr] || m == nil {
+			continue
+		}
+		asked[addr] = true
+		ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+		reply, err := m.membership.Join(ctx, &pb.Member{Addr: q.id})
+		cancel()
+		if err != nil {
+			log.Printf("Joining the ring through %s failed: %v", addr, err)
+			continue
+		}
+		for _, other := range reply.Addrs {
+			added, err := q.addMember(other)
+			if err != nil {
+				log.Printf("Adding %s failed: %v", other, err)
+				continue
+			}
+			changed = changed || added
+			queue = append(queue, other)
+		}
+	}
+	if changed {
+		s.rebalance()
+	}
+}
+
+// leave takes this node off the ring, tells the others and hands its
+// keys over to their owners, then closes q.left. It blocks until every
+// owner has stored the keys.
+func (s *server) leave() {
+	q := s.quorum
+	q.mu.Lock()
+	if q.leaving {
+		q.mu.Unlock()
+		return
+	}
+	q.leaving = true
+	q.updateRing()
+	q.mu.Unlock()
+	log.Printf("Leaving the ring")
+
+	for _, peer := range q.peers() {
+		m := q.member(peer)
+		if m == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+		if _, err := m.membership.Leave(ctx, &pb.Member{Addr: q.id}); err != nil {
+			log.Printf("Telling %s of leaving failed: %v", peer, err)
+		}
+		cancel()
+	}
+	for !s.rebalance() {
+		log.Printf("Keys not handed over yet; retrying in %v", hintRetryInterval)
+		time.Sleep(hintRetryInterval)
+	}
+	close(q.left)
+}
+
+// rebalance hands the keys this node holds over to their owners that
+// weren't owners when it last did, or to all of them if it is no longer
+// an owner itself, in which case it drops the key once they have it. It
+// reports whether every owner stored its keys; if not, the next
+// rebalance hands them over again.
+func (s *server) rebalance() bool {
+	q := s.quorum
+	q.rebalancing.Lock()
+	defer q.rebalancing.Unlock()
+	q.mu.RLock()
+	before, after := q.balanced, q.ring
+	q.mu.RUnlock()
+	if before == after {
+		return true
+	}
+
+	s.mu.Lock()
+	keys := maps.Clone(s.siblings)
+	s.mu.Unlock()
+	moved, dropped, failed := 0, 0, 0
+	for key, siblings := range keys {
+		owners := after.preference(key, q.n)
+		owned := slices.Contains(owners, q.id)
+		prev := before.preference(key, q.n)
+		handedOver := true
+		for _, owner := range owners {
+			if owner == q.id || owned && slices.Contains(prev, owner) {
+				continue
+			}
+			if err := s.handOver(owner, key, siblings); err != nil {
+				log.Printf("Handing %q over to %s failed: %v", key, owner, err)
+				handedOver = false
+				failed++
+				continue
+			}
+			moved++
+		}
+		if !owned && handedOver && s.dropLocal(key, siblings) {
+			dropped++
+		}
+	}
+	if moved > 0 || dropped > 0 {
+		log.Printf("Rebalanced: handed %d keys over, dropped %d", moved, dropped)
+	}
+	if failed > 0 {
+		return false
+	}
+
+	q.mu.Lock()
+	q.balanced = after
+	q.mu.Unlock()
+	return true
+}
+
+// handOver sends a key's siblings to a new owner, and fails if the owner
+// didn't store them all. Those it didn't are hinted, unless this node is
+// leaving and won't be there to hand them off.
+func (s *server) handOver(owner, key string, siblings []*pb.Sibling) error {
+	q := s.quorum
+	m := q.member(owner)
+	if m == nil {
+		return fmt.Errorf("%s left the ring", owner)
+	}
+	q.mu.RLock()
+	leaving := q.leaving
+	q.mu.RUnlock()
+	var failed error
+	for _, sib := range siblings {
+		write := &pb.KeyValue{Key: key, Sibling: sib}
+		ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+		_, err := m.kv.Replicate(ctx, write)
+		cancel()
+		if err == nil {
+			writesHandedOver.WithLabelValues(owner).Inc()
+			continue
+		}
+		if leaving {
+			return err
+		}
+		if herr := m.hints.add(write); herr != nil {
+			err = fmt.Errorf("%v; not hinted: %v", err, herr)
+		} else {
+			writesHinted.WithLabelValues(owner).Inc()
+			err = fmt.Errorf("%v; hinted", err)
+		}
+		if failed == nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+// dropLocal removes a key this node no longer owns, unless it took
+// writes since its siblings were handed over.
+func (s *server) dropLocal(key string, siblings []*pb.Sibling) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.Equal(s.siblings[key], siblings) {
+		return false
+	}
+	delete(s.siblings, key)
+	s.treesLocked().update(key, nil)
+	return true
+}
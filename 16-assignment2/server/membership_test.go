@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	pb "distributed-systems/16-assignment2/proto"
+)
+
+// putKeys writes keys through node i.
+func (c *quorumRing) putKeys(i int, keys []string) {
+	c.t.Helper()
+	for _, key := range keys {
+		if _, err := c.nodes[i].kv.Put(context.Background(), &pb.KeyValue{Key: key, Value: key}); err != nil {
+			c.t.Fatalf("Put(%s) = %v", key, err)
+		}
+	}
+}
+
+// waitBalanced waits until the nodes in ring know of each other, and
+// each key is held by exactly its owners on their ring.
+func (c *quorumRing) waitBalanced(ring []int, keys []string) {
+	c.t.Helper()
+	var addrs []string
+	for _, i := range ring {
+		addrs = append(addrs, c.nodes[i].addr)
+	}
+	want := newRing(addrs, c.vnodes)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		problem := ""
+		for _, i := range ring {
+			node := c.nodes[i]
+			if peers := append(node.kv.quorum.peers(), node.addr); len(peers) != len(addrs) {
+				problem = fmt.Sprintf("node %d knows of %v", i, peers)
+			}
+			for _, key := range keys {
+				owner := slices.Contains(want.preference(key, c.n), node.addr)
+				if held := len(node.kv.local(key)) > 0; held != owner {
+					problem = fmt.Sprintf("node %d holds %s = %v, owns it = %v", i, key, held, owner)
+				}
+			}
+		}
+		if problem == "" {
+			return
+		}
+		if time.Now().After(deadline) {
+			c.t.Fatal(problem)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func testKeys(n int) []string {
+	var keys []string
+	for i := range n {
+		keys = append(keys, fmt.Sprintf("k%d", i))
+	}
+	return keys
+}
+
+func TestJoinRebalances(t *testing.T) {
+	c := newQuorumRing(t, 3, 2)
+	keys := testKeys(100)
+	c.putKeys(0, keys)
+	c.waitBalanced([]int{0, 1, 2}, keys)
+
+	// The new node is handed the keys it now owns, and the nodes it took
+	// them from drop them.
+	joined := c.start()
+	s := c.nodes[joined].kv
+	if _, err := s.quorum.addMember(c.nodes[0].addr); err != nil {
+		t.Fatal(err)
+	}
+	s.join([]string{c.nodes[0].addr})
+	c.waitBalanced([]int{0, 1, 2, joined}, keys)
+
+	v, err := s.Get(context.Background(), &pb.Key{Key: "k1"})
+	if err != nil || v.Value != "k1" {
+		t.Fatalf("Get through the new node = %v, %v", v, err)
+	}
+}
+
+func TestLeaveRebalances(t *testing.T) {
+	c := newQuorumRing(t, 4, 2)
+	keys := testKeys(100)
+	c.putKeys(0, keys)
+	c.waitBalanced([]int{0, 1, 2, 3}, keys)
+
+	// The leaving node hands its keys over and drops them; the others
+	// hand over theirs to the owners that take its place.
+	leaving := c.nodes[3]
+	leaving.kv.leave()
+	select {
+	case <-leaving.kv.quorum.left:
+	default:
+		t.Fatal("leave returned before the node had left")
+	}
+	for _, key := range keys {
+		if sibs := leaving.kv.local(key); len(sibs) > 0 {
+			t.Fatalf("the node that left still holds %s", key)
+		}
+	}
+	c.waitBalanced([]int{0, 1, 2}, keys)
+	for _, key := range keys {
+		v, err := c.nodes[1].kv.Get(context.Background(), &pb.Key{Key: key, Consistency: pb.Consistency_CONSISTENCY_ALL})
+		if err != nil || v.Value != key {
+			t.Fatalf("Get(%s) after the node left = %v, %v", key, v, err)
+		}
+	}
+}
+
+func TestLeaveWaitsForOwners(t *testing.T) {
+	c := newQuorumRing(t, 4, 2)
+	keys := testKeys(100)
+	c.putKeys(0, keys)
+	c.waitBalanced([]int{0, 1, 2, 3}, keys)
+
+	// Some of the leaving node's keys go to node 1, which is down.
+	leaving, down := c.nodes[3], c.nodes[1]
+	after := newRing([]string{c.nodes[0].addr, down.addr, c.nodes[2].addr}, c.vnodes)
+	var moving []string
+	for _, key := range keys {
+		if len(leaving.kv.local(key)) > 0 && slices.Contains(after.preference(key, c.n), down.addr) && len(down.kv.local(key)) == 0 {
+			moving = append(moving, key)
+		}
+	}
+	if len(moving) == 0 {
+		t.Fatal("no key of the leaving node moves to node 1")
+	}
+	c.stop(1)
+	go leaving.kv.leave()
+
+	// It keeps those keys, and doesn't stop, until node 1 has them.
+	time.Sleep(2 * hintRetryInterval)
+	select {
+	case <-leaving.kv.quorum.left:
+		t.Fatal("left with a new owner of its keys down")
+	default:
+	}
+	for _, key := range moving {
+		if len(leaving.kv.local(key)) == 0 {
+			t.Fatalf("dropped %s before its new owner had it", key)
+		}
+	}
+
+	c.resume(1)
+	select {
+	case <-leaving.kv.quorum.left:
+	case <-time.After(10 * time.Second):
+		t.Fatal("didn't leave once the new owner was back")
+	}
+	for _, key := range moving {
+		if len(leaving.kv.local(key)) > 0 || len(down.kv.local(key)) == 0 {
+			t.Fatalf("%s wasn't moved to its new owner", key)
+		}
+	}
+}
+
+func TestDropLocal(t *testing.T) {
+	c := newQuorumRing(t, 1, 1)
+	s := c.nodes[0].kv
+	s.addLocal("k", sibling("a", 1, "x", nil))
+	s.addLocal("j", sibling("a", 2, "y", nil))
+	handedOver := s.local("k")
+
+	// A write taken since the key was handed over keeps it.
+	s.addLocal("k", sibling("b", 1, "z", nil))
+	if s.dropLocal("k", handedOver) {
+		t.Fatal("dropped a key written to since it was handed over")
+	}
+	if got := len(s.local("k")); got != 2 {
+		t.Fatalf("%d siblings of the kept key, want 2", got)
+	}
+
+	owners := s.quorum.owners("k")
+	before := c.root(0, owners)
+	if !s.dropLocal("k", s.local("k")) {
+		t.Fatal("didn't drop a key as handed over")
+	}
+	if got := s.local("k"); len(got) != 0 {
+		t.Fatalf("siblings of a dropped key = %v", got)
+	}
+	// The dropped key is gone from the Merkle tree too.
+	if after := c.root(0, owners); slices.Equal(after, before) {
+		t.Fatal("dropping a key left its tree unchanged")
+	}
+	s.dropLocal("j", s.local("j"))
+	if root := c.root(0, owners); slices.ContainsFunc(root, func(b byte) bool { return b != 0 }) {
+		t.Fatalf("root after dropping every key = %x, want that of an empty tree", root)
+	}
+}
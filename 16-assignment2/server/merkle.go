@@ -0,0 +1,166 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+
+	pb "distributed-systems/16-assignment2/proto"
+)
+
+// merkleDepth is the depth of the Merkle tree: it has 2^merkleDepth
+// leaves.
+const merkleDepth = 10
+
+const (
+	merkleLeaves    = 1 << merkleDepth
+	merkleNodes     = 2*merkleLeaves - 1
+	merkleFirstLeaf = merkleLeaves - 1 // position of leaf 0
+)
+
+type digest = [sha256.Size]byte
+
+// merkleTree hashes the keys of a range on a replica for anti-entropy.
+// Each key falls in a leaf by a hash of the key; a leaf's hash is the XOR
+// of the digests of its keys, so a key is added, changed or removed in
+// place, and an inner node's is the hash of its children's, or zero if
+// both are, so a tree whose keys were all removed equals an empty one.
+// Nodes are numbered breadth first: the children of node i are 2i+1 and
+// 2i+2.
+type merkleTree struct {
+	nodes   [merkleNodes]digest
+	digests map[string]digest
+	leaves  [merkleLeaves]map[string]struct{}
+}
+
+func newMerkleTree() *merkleTree {
+	return &merkleTree{digests: make(map[string]digest)}
+}
+
+// leafOf returns the leaf key falls in.
+func leafOf(key string) uint32 {
+	h := sha256.Sum256([]byte(key))
+	return uint32(binary.BigEndian.Uint16(h[:])) >> (16 - merkleDepth)
+}
+
+// keyDigest identifies a key's siblings: two replicas that hold the same
+// writes of a key have the same digest for it. A sibling's write is
+// identified by its dot alone.
+func keyDigest(key string, siblings []*pb.Sibling) digest {
+	dots := slices.Clone(siblings)
+	slices.SortFunc(dots, func(a, b *pb.Sibling) int {
+		return cmp.Or(cmp.Compare(a.Node, b.Node), cmp.Compare(a.Counter, b.Counter))
+	})
+	h := sha256.New()
+	h.Write([]byte(key))
+	for _, s := range dots {
+		h.Write([]byte{0})
+		h.Write([]byte(s.Node))
+		h.Write(binary.BigEndian.AppendUint64([]byte{0}, s.Counter))
+	}
+	return digest(h.Sum(nil))
+}
+
+// update sets a key's siblings, none to remove it, and rehashes the
+// path from its leaf to the root.
+func (t *merkleTree) update(key string, siblings []*pb.Sibling) {
+	leaf := leafOf(key)
+	node := merkleFirstLeaf + leaf
+	if old, ok := t.digests[key]; ok {
+		xor(&t.nodes[node], old)
+		delete(t.digests, key)
+		delete(t.leaves[leaf], key)
+	}
+	if len(siblings) > 0 {
+		d := keyDigest(key, siblings)
+		xor(&t.nodes[node], d)
+		t.digests[key] = d
+		if t.leaves[leaf] == nil {
+			t.leaves[leaf] = make(map[string]struct{})
+		}
+		t.leaves[leaf][key] = struct{}{}
+	}
+	for node > 0 {
+		node = (node - 1) / 2
+		left, right := t.nodes[2*node+1], t.nodes[2*node+2]
+		if left == (digest{}) && right == (digest{}) {
+			t.nodes[node] = digest{}
+			continue
+		}
+		t.nodes[node] = sha256.Sum256(append(left[:], right[:]...))
+	}
+}
+
+func xor(d *digest, other digest) {
+	for i := range d {
+		d[i] ^= other[i]
+	}
+}
+
+// hash returns the hash of a node, nil if there is no such node.
+func (t *merkleTree) hash(node uint32) []byte {
+	if node >= merkleNodes {
+		return nil
+	}
+	return t.nodes[node][:]
+}
+
+// keys returns the keys in leaf with their digests.
+func (t *merkleTree) keys(leaf uint32) map[string]digest {
+	keys := make(map[string]digest)
+	if leaf < merkleLeaves {
+		for key := range t.leaves[leaf] {
+			keys[key] = t.digests[key]
+		}
+	}
+	return keys
+}
+
+// rangeTrees are a replica's Merkle trees, one for each key range of the
+// ring it owns, so that two replicas compare only the keys they both
+// should hold. They are built for one ring and rebuilt when it changes.
+type rangeTrees struct {
+	ring *ring
+	n    int
+	// owned are the owners of each range this replica owns.
+	owned [][]string
+	trees map[string]*merkleTree // by rangeID
+}
+
+// emptyTree is the tree of a range a replica doesn't own. It is never
+// updated.
+var emptyTree = newMerkleTree()
+
+// newRangeTrees builds the trees of the ranges id owns on r, each key
+// owned by n nodes, from a replica's siblings.
+func newRangeTrees(r *ring, n int, id string, siblings map[string][]*pb.Sibling) *rangeTrees {
+	t := &rangeTrees{ring: r, n: n, trees: make(map[string]*merkleTree)}
+	for _, owners := range r.ranges(n) {
+		if slices.Contains(owners, id) {
+			t.owned = append(t.owned, owners)
+			t.trees[rangeID(owners)] = newMerkleTree()
+		}
+	}
+	for key, sibs := range siblings {
+		t.update(key, sibs)
+	}
+	return t
+}
+
+// update sets a key's siblings in the tree of its range, if this replica
+// owns it.
+func (t *rangeTrees) update(key string, siblings []*pb.Sibling) {
+	if tree, ok := t.trees[rangeID(t.ring.preference(key, t.n))]; ok {
+		tree.update(key, siblings)
+	}
+}
+
+// tree returns the tree of the range owned by owners, empty if this
+// replica doesn't own it.
+func (t *rangeTrees) tree(owners []string) *merkleTree {
+	if tree, ok := t.trees[rangeID(owners)]; ok {
+		return tree
+	}
+	return emptyTree
+}
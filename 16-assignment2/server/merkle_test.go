@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	pb "distributed-systems/16-assignment2/proto"
+)
+
+func TestMerkleTreeUpdate(t *testing.T) {
+	tree := newMerkleTree()
+	empty := tree.nodes
+
+	tree.update("a", []*pb.Sibling{sibling("n1", 1, "x", nil)})
+	added := tree.nodes
+	if added == empty {
+		t.Fatal("adding a key left the tree unchanged")
+	}
+	leaf := leafOf("a")
+	if keys := tree.keys(leaf); len(keys) != 1 || keys["a"] != keyDigest("a", []*pb.Sibling{sibling("n1", 1, "x", nil)}) {
+		t.Fatalf("keys of a's leaf = %v", keys)
+	}
+	if keys := tree.keys((leaf + 1) % merkleLeaves); len(keys) != 0 {
+		t.Fatalf("keys of another leaf = %v", keys)
+	}
+
+	// Only the path from a's leaf to the root changes with a's writes.
+	tree.update("a", []*pb.Sibling{sibling("n1", 1, "x", nil), sibling("n2", 1, "y", nil)})
+	for node := range merkleNodes {
+		onPath := false
+		for n := merkleFirstLeaf + leaf; ; n = (n - 1) / 2 {
+			onPath = onPath || n == uint32(node)
+			if n == 0 {
+				break
+			}
+		}
+		if changed := tree.nodes[node] != added[node]; changed != onPath {
+			t.Fatalf("node %d changed = %v, on a's path = %v", node, changed, onPath)
+		}
+	}
+
+	// Removing every key leaves the tree as it started.
+	tree.update("b", []*pb.Sibling{sibling("n1", 2, "z", nil)})
+	tree.update("a", nil)
+	tree.update("b", nil)
+	if tree.nodes != empty {
+		t.Fatal("tree after removing every key differs from an empty one")
+	}
+	if keys := tree.keys(leaf); len(keys) != 0 {
+		t.Fatalf("keys of a's leaf after removing it = %v", keys)
+	}
+}
+
+func TestMerkleTreeOrder(t *testing.T) {
+	var keys []string
+	for i := range 100 {
+		keys = append(keys, fmt.Sprintf("k%d", i))
+	}
+	forward, backward := newMerkleTree(), newMerkleTree()
+	for i, key := range keys {
+		forward.update(key, []*pb.Sibling{sibling("n1", uint64(i+1), key, nil)})
+	}
+	for i, key := range slices.Backward(keys) {
+		backward.update(key, []*pb.Sibling{sibling("n2", 1, "old", nil)})
+		backward.update(key, []*pb.Sibling{sibling("n1", uint64(i+1), key, nil)})
+	}
+	if forward.nodes != backward.nodes {
+		t.Fatal("trees of the same writes, made in different orders, differ")
+	}
+}
+
+func TestKeyDigest(t *testing.T) {
+	a, b := sibling("n1", 1, "x", nil), sibling("n2", 3, "y", map[string]uint64{"n1": 1})
+	d := keyDigest("k", []*pb.Sibling{a, b})
+	tests := []struct {
+		name     string
+		key      string
+		siblings []*pb.Sibling
+		same     bool
+	}{
+		{"siblings in another order", "k", []*pb.Sibling{b, a}, true},
+		{"the same dots with other values", "k", []*pb.Sibling{sibling("n1", 1, "other", nil), sibling("n2", 3, "", nil)}, true},
+		{"another key", "k2", []*pb.Sibling{a, b}, false},
+		{"a sibling missing", "k", []*pb.Sibling{a}, false},
+		{"another counter", "k", []*pb.Sibling{a, sibling("n2", 4, "y", nil)}, false},
+		{"another node", "k", []*pb.Sibling{a, sibling("n3", 3, "y", nil)}, false},
+	}
+	for _, tt := range tests {
+		if got := keyDigest(tt.key, tt.siblings) == d; got != tt.same {
+			t.Errorf("%s: same digest = %v, want %v", tt.name, got, tt.same)
+		}
+	}
+}
+
+func TestRangeTrees(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d"}
+	r := newRing(nodes, 8)
+	siblings := make(map[string][]*pb.Sibling)
+	for i := range 200 {
+		key := fmt.Sprintf("k%d", i)
+		siblings[key] = []*pb.Sibling{sibling("a", uint64(i+1), key, nil)}
+	}
+	trees := newRangeTrees(r, 2, "a", siblings)
+
+	for _, owners := range trees.owned {
+		if !slices.Contains(owners, "a") {
+			t.Fatalf("a has a tree for %v", owners)
+		}
+	}
+	if len(trees.owned) != len(trees.trees) {
+		t.Fatalf("%d ranges owned, %d trees", len(trees.owned), len(trees.trees))
+	}
+	// Each key a owns is in the tree of its range, and only there.
+	for key := range siblings {
+		owners := r.preference(key, 2)
+		for _, rng := range r.ranges(2) {
+			_, in := trees.tree(rng).keys(leafOf(key))[key]
+			if want := slices.Contains(owners, "a") && rangeID(rng) == rangeID(owners); in != want {
+				t.Fatalf("%s, owned by %v, in the tree of %v = %v", key, owners, rng, in)
+			}
+		}
+	}
+	if root := trees.tree([]string{"b", "c"}).hash(0); root == nil || slices.ContainsFunc(root, func(b byte) bool { return b != 0 }) {
+		t.Fatalf("root of a range a doesn't own = %x, want zero", root)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	pb "distributed-systems/16-assignment2/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// replicaTimeout bounds a Replicate or Get sent to another replica.
+const replicaTimeout = time.Second
+
+// In quorum replication the nodes form a consistent-hash ring, and each
+// key is kept by the N nodes of its preference list on it, with no
+// leader: the owner a client sends a request to coordinates it, and a
+// node that doesn't own the key forwards the request to one that does.
+// A Put is stored locally as a new sibling of the key and sent to the
+// other owners with Replicate, and acked once W of them have it; an
+// owner that fails to store it is handed it later as a hint. A Get asks
+// the other owners for their siblings and merges those of the first R
+// to answer, counting the coordinator's own. With R + W > N a read sees
+// every acked write. An owner that answers a Get without some of the
+// writes it returns is sent them, by read repair; writes an owner missed
+// and never got otherwise reach it through anti-entropy.
+//
+// While their views of the ring differ, a node can be sent a request as
+// an owner of a key that it doesn't think it owns. It fails the request,
+// as it might not hold the key, rather than count toward the quorum.
+
+// quorumConfig is the state of a node in quorum replication.
+type quorumConfig struct {
+	id string
+	// n is how many nodes own each key, and w and r the default write and
+	// read quorums among them.
+	n, w, r int
+	// vnodes is how many points each node stands at on the ring.
+	vnodes int
+	// blockingRepair makes a Get wait for its read repairs.
+	blockingRepair bool
+	// Where the hints for each member are kept, at most hintMaxBytes of
+	// them, each for up to hintTTL.
+	hintDir      string
+	hintMaxBytes int64
+	hintTTL      time.Duration
+	// counter hands out the counters of the dots of the writes this node
+	// takes.
+	counter *dotCounter
+
+	mu sync.RWMutex
+	// members are the other nodes of the ring.
+	members map[string]*member
+	ring    *ring
+	// leaving is set once this node has taken itself off the ring.
+	leaving bool
+	// left is closed once it has handed its keys over, to stop it.
+	left chan struct{}
+
+	// rebalancing serializes rebalance, and balanced is the ring the
+	// node's keys were last handed over for.
+	rebalancing sync.Mutex
+	balanced    *ring
+}
+
+func newQuorumConfig(id string, n, w, r, vnodes int) (*quorumConfig, error) {
+	q := &quorumConfig{
+		id:      id,
+		n:       n,
+		w:       w,
+		r:       r,
+		vnodes:  vnodes,
+		members: make(map[string]*member),
+		left:    make(chan struct{}),
+	}
+	if q.w == 0 {
+		q.w = n/2 + 1
+	}
+	if q.r == 0 {
+		q.r = n/2 + 1
+	}
+	if n < 1 || vnodes < 1 {
+		return nil, fmt.Errorf("need at least 1 replica and 1 virtual node per node, got n=%d vnodes=%d", n, vnodes)
+	}
+	if q.w < 1 || q.w > n || q.r < 1 || q.r > n {
+		return nil, fmt.Errorf("quorums must be between 1 and %d replicas, got w=%d r=%d", n, q.w, q.r)
+	}
+	q.ring = newRing([]string{id}, vnodes)
+	q.balanced = q.ring
+	return q, nil
+}
+
+// replicas returns how many of a key's owners a request at consistency
+// c waits for, def for CONSISTENCY_DEFAULT. While the ring has fewer
+// than N nodes, a key has fewer owners.
+func replicas(c pb.Consistency, def, owners int) int {
+	switch c {
+	case pb.Consistency_CONSISTENCY_ONE:
+		return 1
+	case pb.Consistency_CONSISTENCY_QUORUM:
+		return owners/2 + 1
+	case pb.Consistency_CONSISTENCY_ALL:
+		return owners
+	}
+	return min(def, owners)
+}
+
+// addLocal adds sib to the key's siblings on this replica, reporting
+// whether it was new.
+func (s *server) addLocal(key string, sib *pb.Sibling) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addLocked(key, sib)
+}
+
+// addLocked is addLocal with s.mu held.
+func (s *server) addLocked(key string, sib *pb.Sibling) bool {
+	siblings, changed := addSibling(s.siblings[key], sib)
+	if changed {
+		s.siblings[key] = siblings
+		s.treesLocked().update(key, siblings)
+	}
+	return changed
+}
+
+// treesLocked returns the Merkle trees of the ranges this replica owns,
+// rebuilding them if the ring changed since they were built. s.mu must
+// be held.
+func (s *server) treesLocked() *rangeTrees {
+	q := s.quorum
+	if r := q.currentRing(); s.trees == nil || s.trees.ring != r {
+		s.trees = newRangeTrees(r, q.n, q.id, s.siblings)
+	}
+	return s.trees
+}
+
+// local returns this replica's siblings of key.
+func (s *server) local(key string) []*pb.Sibling {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.siblings[key]
+}
+
+// valueOf returns the answer to a Get of a key with siblings.
+func valueOf(siblings []*pb.Sibling) *pb.Value {
+	v := &pb.Value{Siblings: siblings, Context: contextOf(siblings)}
+	if len(siblings) == 1 {
+		v.Value = siblings[0].Value
+	}
+	return v
+}
+
+// putQuorum coordinates a write, acking once W owners have stored it.
+// Replication to the rest carries on after the ack. A write that fails
+// may still be stored on some owners.
+func (s *server) putQuorum(ctx context.Context, kv *pb.KeyValue) (*pb.Ack, error) {
+	q := s.quorum
+	owners := q.owners(kv.Key)
+	if !slices.Contains(owners, q.id) {
+		if kv.Forwarded {
+			return nil, status.Errorf(codes.Unavailable, "%s doesn't own %q", q.id, kv.Key)
+		}
+		m := q.forwardTo(owners)
+		if m == nil {
+			return nil, status.Error(codes.Unavailable, "no owner of the key to forward to")
+		}
+		return m.kv.Put(ctx, &pb.KeyValue{Key: kv.Key, Value: kv.Value, Consistency: kv.Consistency, Context: kv.Context, Forwarded: true})
+	}
+	peers := slices.DeleteFunc(owners, func(o string) bool { return o == q.id })
+	w := replicas(kv.Consistency, q.w, len(peers)+1)
+
+	s.mu.Lock()
+	sib := newSibling(q.id, kv.Value, kv.Context, s.siblings[kv.Key])
+	counter, err := q.counter.take(sib.Counter)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, status.Errorf(codes.Internal, "taking a dot: %v", err)
+	}
+	sib.Counter = counter
+	s.addLocked(kv.Key, sib)
+	s.mu.Unlock()
+	write := &pb.KeyValue{Key: kv.Key, Sibling: sib}
+
+	acks := make(chan error, len(peers))
+	for _, peer := range peers {
+		go func() {
+			m := q.member(peer)
+			if m == nil {
+				acks <- fmt.Errorf("%s left the ring", peer)
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+			defer cancel()
+			_, err := m.kv.Replicate(ctx, &pb.KeyValue{Key: kv.Key, Sibling: sib, Forwarded: true})
+			if err != nil {
+				// The peer gets the write later, from its hints.
+				if herr := m.hints.add(write); herr != nil {
+					log.Printf("Replication to %s failed: %v; not hinted: %v", peer, err, herr)
+				}
+			}
+			acks <- err
+		}()
+	}
+	stored, pending := 1, len(peers)
+	for stored < w && stored+pending >= w {
+		select {
+		case err := <-acks:
+			pending--
+			if err == nil {
+				stored++
+			}
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if stored < w {
+		failed := len(peers) - pending - (stored - 1)
+		return nil, status.Errorf(codes.Unavailable, "write failed on %d of %d replicas, leaving fewer than the %d required", failed, len(peers)+1, w)
+	}
+	return &pb.Ack{Success: true, Context: clockOf(sib)}, nil
+}
+
+// getQuorum coordinates a read, returning the siblings of R owners
+// merged, and repairs those of the R that lack some of them.
+func (s *server) getQuorum(ctx context.Context, key *pb.Key) (*pb.Value, error) {
+	q := s.quorum
+	owners := q.owners(key.Key)
+	if !slices.Contains(owners, q.id) {
+		if key.Forwarded {
+			return nil, status.Errorf(codes.Unavailable, "%s doesn't own %q", q.id, key.Key)
+		}
+		m := q.forwardTo(owners)
+		if m == nil {
+			return nil, status.Error(codes.Unavailable, "no owner of the key to forward to")
+		}
+		return m.kv.Get(ctx, &pb.Key{Key: key.Key, Consistency: key.Consistency, Forwarded: true})
+	}
+	peers := slices.DeleteFunc(owners, func(o string) bool { return o == q.id })
+	r := replicas(key.Consistency, q.r, len(peers)+1)
+	siblings := s.local(key.Key)
+	if r == 1 {
+		return valueOf(siblings), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, replicaTimeout)
+	defer cancel()
+	type reply struct {
+		peer string
+		v    *pb.Value
+	}
+	replies := make(chan reply, len(peers))
+	for _, peer := range peers {
+		go func() {
+			m := q.member(peer)
+			if m == nil {
+				replies <- reply{peer, nil}
+				return
+			}
+			// A replica asked at consistency ONE answers from its own
+			// copy.
+			v, err := m.kv.Get(ctx, &pb.Key{Key: key.Key, Consistency: pb.Consistency_CONSISTENCY_ONE, Forwarded: true})
+			if err != nil {
+				log.Printf("Read from %s failed: %v", peer, err)
+			}
+			replies <- reply{peer, v}
+		}()
+	}
+	answers := map[string][]*pb.Sibling{q.id: siblings}
+	for range peers {
+		rep := <-replies
+		if rep.v == nil {
+			continue
+		}
+		answers[rep.peer] = rep.v.Siblings
+		siblings = mergeSiblings(siblings, rep.v.Siblings)
+		if len(answers) == r {
+			s.readRepair(key.Key, siblings, answers)
+			return valueOf(siblings), nil
+		}
+	}
+	return nil, status.Errorf(codes.Unavailable, "read from %d of the %d replicas required", len(answers), r)
+}
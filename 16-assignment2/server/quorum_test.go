@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	pb "distributed-systems/16-assignment2/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// quorumNode is one node of a ring run in the test's process.
+type quorumNode struct {
+	addr string
+	// dir is the node's data directory, kept across restarts.
+	dir  string
+	kv   *server
+	ae   *antiEntropy
+	grpc *grpc.Server
+}
+
+// quorumRing is a ring of nodes on localhost in quorum replication,
+// without anti-entropy running on its own.
+type quorumRing struct {
+	t      *testing.T
+	n      int
+	vnodes int
+	nodes  []*quorumNode
+}
+
+// newQuorumRing starts size nodes, each key owned by n of them, that all
+// know of each other.
+func newQuorumRing(t *testing.T, size, n int) *quorumRing {
+	t.Helper()
+	c := &quorumRing{t: t, n: n, vnodes: 16}
+	for range size {
+		c.start()
+	}
+	for _, node := range c.nodes {
+		for _, other := range c.nodes {
+			if _, err := node.kv.quorum.addMember(other.addr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		node.kv.quorum.balanced = node.kv.quorum.ring
+	}
+	return c
+}
+
+// start starts a node that knows only of itself, and returns its index.
+func (c *quorumRing) start() int {
+	c.t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	node := &quorumNode{addr: lis.Addr().String(), dir: c.t.TempDir()}
+	c.nodes = append(c.nodes, node)
+	c.serve(node, lis)
+	return len(c.nodes) - 1
+}
+
+// restart restarts node i as a node that knows only of itself, keeping
+// what it has on disk and its address. The siblings it held are lost,
+// as are its hints, which the test's temporary directories don't keep.
+func (c *quorumRing) restart(i int) {
+	c.t.Helper()
+	node := c.nodes[i]
+	c.stop(i)
+	for _, peer := range node.kv.quorum.peers() {
+		node.kv.quorum.removeMember(peer)
+	}
+	lis, err := net.Listen("tcp", node.addr)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.serve(node, lis)
+}
+
+// serve runs node on lis, with its state starting afresh but for its
+// data directory.
+func (c *quorumRing) serve(node *quorumNode, lis net.Listener) {
+	c.t.Helper()
+	q, err := newQuorumConfig(node.addr, c.n, 0, 0, c.vnodes)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	q.hintDir = filepath.Join(c.t.TempDir(), hintsDir)
+	q.hintMaxBytes = 1 << 20
+	q.hintTTL = time.Hour
+	if q.counter, err = openDotCounter(filepath.Join(node.dir, counterFile)); err != nil {
+		c.t.Fatal(err)
+	}
+	node.kv = &server{store: make(map[string]string), siblings: make(map[string][]*pb.Sibling), quorum: q}
+	node.ae = &antiEntropy{s: node.kv}
+	node.grpc = grpc.NewServer()
+	pb.RegisterKeyValueStoreServer(node.grpc, node.kv)
+	pb.RegisterAntiEntropyServer(node.grpc, node.ae)
+	pb.RegisterMembershipServer(node.grpc, &membership{s: node.kv})
+	go node.grpc.Serve(lis)
+	c.t.Cleanup(func() {
+		node.grpc.Stop()
+		for _, peer := range q.peers() {
+			q.removeMember(peer)
+		}
+	})
+}
+
+// stop stops node i answering the others, as if it went down.
+func (c *quorumRing) stop(i int) {
+	c.nodes[i].grpc.Stop()
+}
+
+// resume brings node i back after stop, with everything it held.
+func (c *quorumRing) resume(i int) {
+	c.t.Helper()
+	node := c.nodes[i]
+	lis, err := net.Listen("tcp", node.addr)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	node.grpc = grpc.NewServer()
+	pb.RegisterKeyValueStoreServer(node.grpc, node.kv)
+	pb.RegisterAntiEntropyServer(node.grpc, node.ae)
+	pb.RegisterMembershipServer(node.grpc, &membership{s: node.kv})
+	go node.grpc.Serve(lis)
+	c.t.Cleanup(node.grpc.Stop)
+}
+
+// sibling returns a write of value with dot node:counter, taken with
+// context if it isn't nil.
+func sibling(node string, counter uint64, value string, context map[string]uint64) *pb.Sibling {
+	sib := &pb.Sibling{Node: node, Counter: counter, Value: value}
+	if context != nil {
+		sib.Context = &pb.VectorClock{Counters: context}
+	}
+	return sib
+}
+
+func TestReplicas(t *testing.T) {
+	tests := []struct {
+		c           pb.Consistency
+		def, owners int
+		want        int
+	}{
+		{pb.Consistency_CONSISTENCY_DEFAULT, 2, 3, 2},
+		{pb.Consistency_CONSISTENCY_DEFAULT, 3, 2, 2},
+		{pb.Consistency_CONSISTENCY_ONE, 2, 3, 1},
+		{pb.Consistency_CONSISTENCY_QUORUM, 1, 3, 2},
+		{pb.Consistency_CONSISTENCY_QUORUM, 1, 4, 3},
+		{pb.Consistency_CONSISTENCY_QUORUM, 3, 1, 1},
+		{pb.Consistency_CONSISTENCY_ALL, 1, 3, 3},
+		{pb.Consistency_CONSISTENCY_ALL, 3, 2, 2},
+	}
+	for _, tt := range tests {
+		if got := replicas(tt.c, tt.def, tt.owners); got != tt.want {
+			t.Errorf("replicas(%v, %d, %d) = %d, want %d", tt.c, tt.def, tt.owners, got, tt.want)
+		}
+	}
+}
+
+func TestQuorumUnavailable(t *testing.T) {
+	c := newQuorumRing(t, 3, 3)
+	s := c.nodes[0].kv
+	ctx := context.Background()
+	ack, err := s.Put(ctx, &pb.KeyValue{Key: "k", Value: "1"})
+	if err != nil || !ack.Success {
+		t.Fatalf("Put with every owner up = %v, %v", ack, err)
+	}
+	v, err := s.Get(ctx, &pb.Key{Key: "k", Consistency: pb.Consistency_CONSISTENCY_ALL})
+	if err != nil || v.Value != "1" {
+		t.Fatalf("Get at ALL with every owner up = %v, %v", v, err)
+	}
+
+	// With one owner of three up, neither quorum of two can be met.
+	c.stop(1)
+	c.stop(2)
+	if ack, err := s.Put(ctx, &pb.KeyValue{Key: "k", Value: "2", Context: ack.Context}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Put with W=2 and one owner up = %v, %v, want Unavailable", ack, err)
+	}
+	if v, err := s.Get(ctx, &pb.Key{Key: "k"}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Get with R=2 and one owner up = %v, %v, want Unavailable", v, err)
+	}
+
+	// At consistency ONE the coordinator alone will do. A write that
+	// failed its quorum is still stored where it could be, and read back.
+	if _, err := s.Put(ctx, &pb.KeyValue{Key: "j", Value: "3", Consistency: pb.Consistency_CONSISTENCY_ONE}); err != nil {
+		t.Fatalf("Put at ONE with one owner up = %v", err)
+	}
+	v, err = s.Get(ctx, &pb.Key{Key: "k", Consistency: pb.Consistency_CONSISTENCY_ONE})
+	if err != nil || v.Value != "2" {
+		t.Fatalf("Get at ONE with one owner up = %v, %v, want the failed write", v, err)
+	}
+}
+
+func TestQuorumOwnersOnly(t *testing.T) {
+	c := newQuorumRing(t, 3, 2)
+	ctx := context.Background()
+
+	// Node 1 has heard of a node joining that node 0 hasn't, and by its
+	// view no longer owns some keys node 0 sends it as an owner.
+	joined := c.start()
+	if _, err := c.nodes[1].kv.quorum.addMember(c.nodes[joined].addr); err != nil {
+		t.Fatal(err)
+	}
+	key := ""
+	for _, k := range testKeys(1000) {
+		coordinator, replica := c.nodes[0].kv.quorum.owners(k), c.nodes[1].kv.quorum.owners(k)
+		if slices.Contains(coordinator, c.nodes[0].addr) && slices.Contains(coordinator, c.nodes[1].addr) && !slices.Contains(replica, c.nodes[1].addr) {
+			key = k
+			break
+		}
+	}
+	if key == "" {
+		t.Fatal("no key that node 1 stopped owning")
+	}
+
+	if _, err := c.nodes[1].kv.Put(ctx, &pb.KeyValue{Key: key, Value: "1", Forwarded: true}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("forwarded Put to a node that doesn't own the key = %v, want Unavailable", err)
+	}
+	if _, err := c.nodes[1].kv.Get(ctx, &pb.Key{Key: key, Forwarded: true}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("forwarded Get to a node that doesn't own the key = %v, want Unavailable", err)
+	}
+	// So a quorum of both owners by node 0's view can't be met.
+	if _, err := c.nodes[0].kv.Put(ctx, &pb.KeyValue{Key: key, Value: "1", Consistency: pb.Consistency_CONSISTENCY_ALL}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Put at ALL counting a node that doesn't own the key = %v, want Unavailable", err)
+	}
+	if got := c.nodes[1].kv.local(key); len(got) != 0 {
+		t.Fatalf("a node that doesn't own the key stored %v", dots(got))
+	}
+	if _, err := c.nodes[0].kv.Get(ctx, &pb.Key{Key: key, Consistency: pb.Consistency_CONSISTENCY_ALL}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Get at ALL counting a node that doesn't own the key = %v, want Unavailable", err)
+	}
+}
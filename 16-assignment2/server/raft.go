@@ -0,0 +1,742 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	pb "distributed-systems/16-assignment2/proto"
+	"google.golang.org/grpc"
+)
+
+const (
+	heartbeatInterval  = 75 * time.Millisecond
+	electionTimeoutMin = 300 * time.Millisecond
+	electionTimeoutMax = 600 * time.Millisecond
+	// rpcTimeout bounds votes and appends; snapshots, which carry the
+	// whole store, get snapshotTimeout.
+	rpcTimeout      = 250 * time.Millisecond
+	snapshotTimeout = 10 * time.Second
+	// maxAppendEntries is how many entries one AppendEntries carries, so
+	// a lagging follower catches up in bounded steps.
+	maxAppendEntries = 256
+)
+
+type role int
+
+const (
+	follower role = iota
+	candidate
+	leader
+)
+
+func (r role) String() string {
+	switch r {
+	case candidate:
+		return "candidate"
+	case leader:
+		return "leader"
+	}
+	return "follower"
+}
+
+// errLeadershipLost is returned for a write whose entry was appended by a
+// leader that lost its leadership before the entry committed. The write
+// may or may not have been applied.
+var errLeadershipLost = errors.New("leadership lost before the write committed")
+
+// errStopped is returned by a node that has been stopped.
+var errStopped = errors.New("raft node stopped")
+
+// notLeaderError is returned for a write sent to a node that is not the
+// leader. leader is empty while no leader is known.
+type notLeaderError struct {
+	leader string
+}
+
+func (e *notLeaderError) Error() string {
+	if e.leader == "" {
+		return "no leader elected"
+	}
+	return "not the leader; the leader is " + e.leader
+}
+
+// stateMachine is what Raft replicates: commands are applied to it in
+// log order, and its state is what snapshots hold.
+type stateMachine interface {
+	apply(kv *pb.KeyValue)
+	snapshot() ([]byte, error)
+	restore(data []byte) error
+}
+
+// waiter is a write waiting for its entry to be applied.
+type waiter struct {
+	term uint64
+	done chan error
+}
+
+// raftNode runs Raft among a fixed set of nodes. Writes are appended to
+// the leader's log and applied to the state machine once a majority has
+// stored them; followers learn the leader from its heartbeats. Every
+// snapshotEvery applied entries the state machine is snapshotted and the
+// log before it dropped. A follower too far behind for the leader's log
+// is sent the snapshot instead.
+//
+// Everything Raft must remember across restarts is written to storage
+// before the node acts on it or answers; a node that can't write its
+// storage exits.
+type raftNode struct {
+	pb.UnimplementedRaftServer
+
+	id            string
+	peers         []string
+	conns         []*grpc.ClientConn
+	clients       map[string]pb.RaftClient
+	storage       *raftStorage
+	sm            stateMachine
+	snapshotEvery uint64
+
+	mu       sync.Mutex
+	role     role
+	term     uint64
+	votedFor string
+	leader   string
+	// log[0] stands for the snapshot, holding its index and term; the
+	// entries after it follow.
+	log          []*pb.LogEntry
+	snapshotData []byte
+	commitIndex  uint64
+	lastApplied  uint64
+	deadline     time.Time // when a follower or candidate starts an election
+	nextIndex    map[string]uint64
+	matchIndex   map[string]uint64
+	trigger      map[string]chan struct{}
+	applied      *sync.Cond // signalled when entries commit or a snapshot arrives
+	// installed is a snapshot received from the leader, waiting to be
+	// restored into the state machine.
+	installed *snapshot
+	waiters   map[uint64]waiter
+	// stopped is set, and done closed, once the node is stopped.
+	stopped bool
+	done    chan struct{}
+}
+
+// newRaftNode starts Raft on node id among peers, with its state in
+// storage, restoring sm from the latest snapshot.
+func newRaftNode(id string, peers []string, dir string, sm stateMachine, snapshotEvery uint64) (*raftNode, error) {
+	storage, hs, snap, entries, err := openRaftStorage(dir)
+	if err != nil {
+		return nil, err
+	}
+	if snap.Data != nil {
+		if err := sm.restore(snap.Data); err != nil {
+			return nil, err
+		}
+	}
+	rf := &raftNode{
+		id:            id,
+		peers:         peers,
+		clients:       make(map[string]pb.RaftClient),
+		storage:       storage,
+		sm:            sm,
+		snapshotEvery: snapshotEvery,
+		term:          hs.Term,
+		votedFor:      hs.VotedFor,
+		log:           append([]*pb.LogEntry{{Index: snap.Index, Term: snap.Term}}, entries...),
+		snapshotData:  snap.Data,
+		commitIndex:   snap.Index,
+		lastApplied:   snap.Index,
+		nextIndex:     make(map[string]uint64),
+		matchIndex:    make(map[string]uint64),
+		trigger:       make(map[string]chan struct{}),
+		waiters:       make(map[uint64]waiter),
+		done:          make(chan struct{}),
+	}
+	rf.applied = sync.NewCond(&rf.mu)
+	for _, peer := range peers {
+		conn, err := dialPeer(peer)
+		if err != nil {
+			rf.closeConns()
+			storage.close()
+			return nil, err
+		}
+		rf.conns = append(rf.conns, conn)
+		rf.clients[peer] = pb.NewRaftClient(conn)
+		rf.trigger[peer] = make(chan struct{}, 1)
+	}
+	rf.resetDeadline()
+
+	go rf.run()
+	go rf.applier()
+	for _, peer := range peers {
+		go rf.replicator(peer)
+	}
+	return rf, nil
+}
+
+// stop shuts the node down: it stops taking part in elections and
+// replication, fails the writes waiting on it and closes its storage, so
+// another node can be started on the same directory. RPCs it is sent
+// afterwards fail.
+func (rf *raftNode) stop() {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.stopped {
+		return
+	}
+	rf.stopped = true
+	close(rf.done)
+	rf.role = follower
+	for index, w := range rf.waiters {
+		w.done <- errStopped
+		delete(rf.waiters, index)
+	}
+	rf.applied.Broadcast()
+	rf.closeConns()
+	if err := rf.storage.close(); err != nil {
+		log.Printf("raft: closing storage: %v", err)
+	}
+}
+
+func (rf *raftNode) closeConns() {
+	for _, conn := range rf.conns {
+		conn.Close()
+	}
+}
+
+func (rf *raftNode) snapshotIndex() uint64 { return rf.log[0].Index }
+func (rf *raftNode) lastIndex() uint64     { return rf.log[len(rf.log)-1].Index }
+func (rf *raftNode) lastTerm() uint64      { return rf.log[len(rf.log)-1].Term }
+
+// entry returns the entry at index, which must be in the log or be the
+// snapshot's index.
+func (rf *raftNode) entry(index uint64) *pb.LogEntry {
+	return rf.log[index-rf.snapshotIndex()]
+}
+
+// quorum is the number of nodes that make a majority.
+func (rf *raftNode) quorum() int {
+	return (len(rf.peers)+1)/2 + 1
+}
+
+func (rf *raftNode) resetDeadline() {
+	timeout := electionTimeoutMin + rand.N(electionTimeoutMax-electionTimeoutMin)
+	rf.deadline = time.Now().Add(timeout)
+}
+
+// persistState stores the term and vote.
+func (rf *raftNode) persistState() {
+	if err := rf.storage.saveState(hardState{Term: rf.term, VotedFor: rf.votedFor}); err != nil {
+		log.Fatalf("raft: saving state: %v", err)
+	}
+}
+
+// run starts elections when the leader has been silent too long.
+func (rf *raftNode) run() {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rf.done:
+			return
+		case <-ticker.C:
+		}
+		rf.mu.Lock()
+		if !rf.stopped && rf.role != leader && time.Now().After(rf.deadline) {
+			rf.startElection()
+		}
+		rf.mu.Unlock()
+	}
+}
+
+// becomeFollower steps down to follower, moving to term if it is later
+// than the current one. Writes waiting on this node as leader fail. It
+// doesn't put off the election deadline: a candidate that can't win
+// mustn't hold back elections just by asking.
+func (rf *raftNode) becomeFollower(term uint64) {
+	if term > rf.term {
+		rf.term, rf.votedFor, rf.leader = term, "", ""
+		rf.persistState()
+	}
+	if rf.role != follower {
+		log.Printf("raft: %s steps down to follower in term %d", rf.id, rf.term)
+	}
+	rf.role = follower
+	for index, w := range rf.waiters {
+		w.done <- errLeadershipLost
+		delete(rf.waiters, index)
+	}
+}
+
+func (rf *raftNode) startElection() {
+	rf.role = candidate
+	rf.term++
+	rf.votedFor = rf.id
+	rf.leader = ""
+	rf.persistState()
+	rf.resetDeadline()
+	log.Printf("raft: %s starts an election for term %d", rf.id, rf.term)
+
+	req := &pb.VoteRequest{
+		Term:         rf.term,
+		CandidateId:  rf.id,
+		LastLogIndex: rf.lastIndex(),
+		LastLogTerm:  rf.lastTerm(),
+	}
+	votes := 1
+	if votes >= rf.quorum() {
+		rf.becomeLeader()
+		return
+	}
+	for _, peer := range rf.peers {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+			defer cancel()
+			reply, err := rf.clients[peer].RequestVote(ctx, req)
+			if err != nil {
+				return
+			}
+			rf.mu.Lock()
+			defer rf.mu.Unlock()
+			if rf.stopped {
+				return
+			}
+			if reply.Term > rf.term {
+				rf.becomeFollower(reply.Term)
+				return
+			}
+			if rf.role != candidate || rf.term != req.Term || !reply.VoteGranted {
+				return
+			}
+			if votes++; votes == rf.quorum() {
+				rf.becomeLeader()
+			}
+		}()
+	}
+}
+
+// becomeLeader takes over as leader and appends a no-op entry, which
+// commits the entries of earlier terms along with it.
+func (rf *raftNode) becomeLeader() {
+	rf.role = leader
+	rf.leader = rf.id
+	log.Printf("raft: %s is leader for term %d", rf.id, rf.term)
+	for _, peer := range rf.peers {
+		rf.nextIndex[peer] = rf.lastIndex() + 1
+		rf.matchIndex[peer] = 0
+	}
+	rf.appendLocal(&pb.LogEntry{Index: rf.lastIndex() + 1, Term: rf.term})
+}
+
+// appendLocal adds an entry to the leader's log and sends it on.
+func (rf *raftNode) appendLocal(e *pb.LogEntry) {
+	if err := rf.storage.append([]*pb.LogEntry{e}); err != nil {
+		log.Fatalf("raft: appending to the log: %v", err)
+	}
+	rf.log = append(rf.log, e)
+	rf.advanceCommit()
+	rf.signalPeers()
+}
+
+func (rf *raftNode) signalPeers() {
+	for _, ch := range rf.trigger {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// propose appends kv to the log and waits until it is applied.
+func (rf *raftNode) propose(ctx context.Context, kv *pb.KeyValue) error {
+	rf.mu.Lock()
+	if rf.stopped {
+		rf.mu.Unlock()
+		return errStopped
+	}
+	if rf.role != leader {
+		rf.mu.Unlock()
+		return &notLeaderError{leader: rf.leader}
+	}
+	e := &pb.LogEntry{Index: rf.lastIndex() + 1, Term: rf.term, Command: kv}
+	done := make(chan error, 1)
+	rf.waiters[e.Index] = waiter{term: e.Term, done: done}
+	rf.appendLocal(e)
+	rf.mu.Unlock()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		rf.mu.Lock()
+		if w, ok := rf.waiters[e.Index]; ok && w.done == done {
+			delete(rf.waiters, e.Index)
+		}
+		rf.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// advanceCommit commits the latest entry of the current term stored on
+// a majority, and everything before it.
+func (rf *raftNode) advanceCommit() {
+	for n := rf.lastIndex(); n > rf.commitIndex && rf.entry(n).Term == rf.term; n-- {
+		count := 1
+		for _, peer := range rf.peers {
+			if rf.matchIndex[peer] >= n {
+				count++
+			}
+		}
+		if count >= rf.quorum() {
+			rf.commitIndex = n
+			rf.applied.Broadcast()
+			return
+		}
+	}
+}
+
+// replicator sends a peer the entries it is missing whenever there are
+// new ones, and a heartbeat otherwise, while this node is leader.
+func (rf *raftNode) replicator(peer string) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rf.done:
+			return
+		case <-rf.trigger[peer]:
+		case <-ticker.C:
+		}
+		rf.sendTo(peer)
+	}
+}
+
+func (rf *raftNode) sendTo(peer string) {
+	rf.mu.Lock()
+	if rf.role != leader {
+		rf.mu.Unlock()
+		return
+	}
+	next := rf.nextIndex[peer]
+	if next <= rf.snapshotIndex() {
+		req := &pb.SnapshotRequest{
+			Term:              rf.term,
+			LeaderId:          rf.id,
+			LastIncludedIndex: rf.snapshotIndex(),
+			LastIncludedTerm:  rf.log[0].Term,
+			Data:              rf.snapshotData,
+		}
+		rf.mu.Unlock()
+		rf.sendSnapshot(peer, req)
+		return
+	}
+	last := min(rf.lastIndex(), next+maxAppendEntries-1)
+	req := &pb.AppendRequest{
+		Term:         rf.term,
+		LeaderId:     rf.id,
+		PrevLogIndex: next - 1,
+		PrevLogTerm:  rf.entry(next - 1).Term,
+		Entries:      append([]*pb.LogEntry(nil), rf.log[next-rf.snapshotIndex():last-rf.snapshotIndex()+1]...),
+		LeaderCommit: rf.commitIndex,
+	}
+	rf.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	reply, err := rf.clients[peer].AppendEntries(ctx, req)
+	if err != nil {
+		return
+	}
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.stopped {
+		return
+	}
+	if reply.Term > rf.term {
+		rf.becomeFollower(reply.Term)
+		return
+	}
+	if rf.role != leader || rf.term != req.Term {
+		return
+	}
+	if reply.Success {
+		match := req.PrevLogIndex + uint64(len(req.Entries))
+		if match > rf.matchIndex[peer] {
+			rf.matchIndex[peer] = match
+			rf.nextIndex[peer] = match + 1
+			rf.advanceCommit()
+		}
+		if rf.nextIndex[peer] <= rf.lastIndex() {
+			rf.signal(peer)
+		}
+		return
+	}
+	rf.nextIndex[peer] = rf.retryIndex(reply)
+	rf.signal(peer)
+}
+
+// retryIndex is where to retry a follower whose log did not match: after
+// the leader's last entry of the conflicting term if it has one, or else
+// where the follower's conflict starts.
+func (rf *raftNode) retryIndex(reply *pb.AppendReply) uint64 {
+	if reply.ConflictTerm != 0 {
+		for i := len(rf.log) - 1; i > 0; i-- {
+			if rf.log[i].Term == reply.ConflictTerm {
+				return rf.log[i].Index + 1
+			}
+			if rf.log[i].Term < reply.ConflictTerm {
+				break
+			}
+		}
+	}
+	return max(reply.ConflictIndex, 1)
+}
+
+func (rf *raftNode) signal(peer string) {
+	select {
+	case rf.trigger[peer] <- struct{}{}:
+	default:
+	}
+}
+
+func (rf *raftNode) sendSnapshot(peer string, req *pb.SnapshotRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+	reply, err := rf.clients[peer].InstallSnapshot(ctx, req)
+	if err != nil {
+		return
+	}
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.stopped {
+		return
+	}
+	if reply.Term > rf.term {
+		rf.becomeFollower(reply.Term)
+		return
+	}
+	if rf.role != leader || rf.term != req.Term {
+		return
+	}
+	if req.LastIncludedIndex > rf.matchIndex[peer] {
+		rf.matchIndex[peer] = req.LastIncludedIndex
+		rf.nextIndex[peer] = req.LastIncludedIndex + 1
+		rf.advanceCommit()
+	}
+	rf.signal(peer)
+}
+
+// applier applies committed entries to the state machine in order, and
+// restores snapshots received from the leader. It is the only writer of
+// the state machine.
+func (rf *raftNode) applier() {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	for {
+		for !rf.stopped && rf.installed == nil && rf.lastApplied >= rf.commitIndex {
+			rf.applied.Wait()
+		}
+		if rf.stopped {
+			return
+		}
+		if snap := rf.installed; snap != nil {
+			rf.installed = nil
+			rf.lastApplied = snap.Index
+			rf.mu.Unlock()
+			if err := rf.sm.restore(snap.Data); err != nil {
+				log.Fatalf("raft: restoring snapshot at %d: %v", snap.Index, err)
+			}
+			rf.mu.Lock()
+			continue
+		}
+
+		entries := append([]*pb.LogEntry(nil), rf.log[rf.lastApplied+1-rf.snapshotIndex():rf.commitIndex+1-rf.snapshotIndex()]...)
+		rf.mu.Unlock()
+		for _, e := range entries {
+			if e.Command != nil {
+				rf.sm.apply(e.Command)
+			}
+		}
+		rf.mu.Lock()
+		applied := entries[len(entries)-1].Index
+		if rf.installed == nil {
+			rf.lastApplied = applied
+		}
+		for _, e := range entries {
+			if w, ok := rf.waiters[e.Index]; ok {
+				if w.term == e.Term {
+					w.done <- nil
+				} else {
+					w.done <- errLeadershipLost
+				}
+				delete(rf.waiters, e.Index)
+			}
+		}
+
+		if rf.snapshotEvery > 0 && rf.installed == nil && applied-rf.snapshotIndex() >= rf.snapshotEvery {
+			rf.mu.Unlock()
+			data, err := rf.sm.snapshot()
+			rf.mu.Lock()
+			if rf.stopped {
+				return
+			}
+			if err != nil {
+				log.Printf("raft: taking a snapshot at %d: %v", applied, err)
+				continue
+			}
+			rf.compact(applied, data)
+		}
+	}
+}
+
+// compact replaces the log up to index with a snapshot of the state
+// machine at index.
+func (rf *raftNode) compact(index uint64, data []byte) {
+	if index <= rf.snapshotIndex() {
+		return
+	}
+	snap := snapshot{Index: index, Term: rf.entry(index).Term, Data: data}
+	if err := rf.storage.saveSnapshot(snap); err != nil {
+		log.Fatalf("raft: saving snapshot: %v", err)
+	}
+	rest := rf.log[index-rf.snapshotIndex()+1:]
+	rf.log = append([]*pb.LogEntry{{Index: snap.Index, Term: snap.Term}}, rest...)
+	rf.snapshotData = data
+	if err := rf.storage.rewriteLog(rest); err != nil {
+		log.Fatalf("raft: compacting the log: %v", err)
+	}
+	log.Printf("raft: %s took a snapshot at entry %d", rf.id, index)
+}
+
+// RequestVote grants the candidate this node's vote for the term if it
+// has not voted for another and the candidate's log is at least as up to
+// date as its own.
+func (rf *raftNode) RequestVote(ctx context.Context, req *pb.VoteRequest) (*pb.VoteReply, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.stopped {
+		return nil, errStopped
+	}
+	if req.Term > rf.term {
+		rf.becomeFollower(req.Term)
+	}
+	upToDate := req.LastLogTerm > rf.lastTerm() ||
+		req.LastLogTerm == rf.lastTerm() && req.LastLogIndex >= rf.lastIndex()
+	granted := req.Term == rf.term && upToDate &&
+		(rf.votedFor == "" || rf.votedFor == req.CandidateId)
+	if granted {
+		rf.votedFor = req.CandidateId
+		rf.persistState()
+		rf.resetDeadline()
+	}
+	return &pb.VoteReply{Term: rf.term, VoteGranted: granted}, nil
+}
+
+// AppendEntries adds the leader's entries to the log if it holds the
+// entry before them, replacing any entries that conflict.
+func (rf *raftNode) AppendEntries(ctx context.Context, req *pb.AppendRequest) (*pb.AppendReply, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.stopped {
+		return nil, errStopped
+	}
+	if req.Term < rf.term {
+		return &pb.AppendReply{Term: rf.term}, nil
+	}
+	if req.Term > rf.term || rf.role != follower {
+		rf.becomeFollower(req.Term)
+	}
+	rf.leader = req.LeaderId
+	rf.resetDeadline()
+
+	prev, prevTerm, entries := req.PrevLogIndex, req.PrevLogTerm, req.Entries
+	// Entries the snapshot covers are committed, so they match.
+	for prev < rf.snapshotIndex() && len(entries) > 0 {
+		prev, prevTerm, entries = entries[0].Index, entries[0].Term, entries[1:]
+	}
+	if prev < rf.snapshotIndex() {
+		return &pb.AppendReply{Term: rf.term, Success: true}, nil
+	}
+	if prev > rf.lastIndex() {
+		return &pb.AppendReply{Term: rf.term, ConflictIndex: rf.lastIndex() + 1}, nil
+	}
+	if rf.entry(prev).Term != prevTerm {
+		conflict := rf.entry(prev).Term
+		first := prev
+		for first > rf.snapshotIndex()+1 && rf.entry(first-1).Term == conflict {
+			first--
+		}
+		return &pb.AppendReply{Term: rf.term, ConflictIndex: first, ConflictTerm: conflict}, nil
+	}
+
+	for i, e := range entries {
+		if e.Index <= rf.lastIndex() {
+			if rf.entry(e.Index).Term == e.Term {
+				continue
+			}
+			// A conflicting entry and everything after it were never
+			// committed; the leader's replace them.
+			rf.log = rf.log[:e.Index-rf.snapshotIndex()]
+			if err := rf.storage.rewriteLog(rf.log[1:]); err != nil {
+				log.Fatalf("raft: truncating the log: %v", err)
+			}
+		}
+		if err := rf.storage.append(entries[i:]); err != nil {
+			log.Fatalf("raft: appending to the log: %v", err)
+		}
+		rf.log = append(rf.log, entries[i:]...)
+		break
+	}
+
+	// Only the entries this request vouches for are known to match the
+	// leader's, so the commit index can't pass the last of them.
+	if commit := min(req.LeaderCommit, prev+uint64(len(entries))); commit > rf.commitIndex {
+		rf.commitIndex = commit
+		rf.applied.Broadcast()
+	}
+	return &pb.AppendReply{Term: rf.term, Success: true}, nil
+}
+
+// InstallSnapshot replaces the log up to the snapshot with the leader's
+// snapshot, for a follower too far behind to be sent entries.
+func (rf *raftNode) InstallSnapshot(ctx context.Context, req *pb.SnapshotRequest) (*pb.SnapshotReply, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.stopped {
+		return nil, errStopped
+	}
+	if req.Term < rf.term {
+		return &pb.SnapshotReply{Term: rf.term}, nil
+	}
+	if req.Term > rf.term || rf.role != follower {
+		rf.becomeFollower(req.Term)
+	}
+	rf.leader = req.LeaderId
+	rf.resetDeadline()
+	if req.LastIncludedIndex <= rf.commitIndex {
+		return &pb.SnapshotReply{Term: rf.term}, nil
+	}
+
+	snap := snapshot{Index: req.LastIncludedIndex, Term: req.LastIncludedTerm, Data: req.Data}
+	if err := rf.storage.saveSnapshot(snap); err != nil {
+		log.Fatalf("raft: saving snapshot: %v", err)
+	}
+	// Entries after the snapshot are kept if the log agrees with it.
+	var rest []*pb.LogEntry
+	if snap.Index < rf.lastIndex() && rf.entry(snap.Index).Term == snap.Term {
+		rest = rf.log[snap.Index-rf.snapshotIndex()+1:]
+	}
+	rf.log = append([]*pb.LogEntry{{Index: snap.Index, Term: snap.Term}}, rest...)
+	rf.snapshotData = snap.Data
+	if err := rf.storage.rewriteLog(rest); err != nil {
+		log.Fatalf("raft: replacing the log: %v", err)
+	}
+	rf.commitIndex = snap.Index
+	rf.installed = &snap
+	rf.applied.Broadcast()
+	log.Printf("raft: %s installed a snapshot at entry %d from %s", rf.id, snap.Index, req.LeaderId)
+	return &pb.SnapshotReply{Term: rf.term}, nil
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "distributed-systems/16-assignment2/proto"
+	"google.golang.org/grpc"
+)
+
+// testNode is one node of a Raft cluster run in the test's process.
+type testNode struct {
+	addr string
+	dir  string
+	kv   *server
+	grpc *grpc.Server
+	raft *raftNode
+}
+
+// cluster is a Raft cluster of nodes on localhost. Nodes can be stopped
+// and started again on the same address and data directory.
+type cluster struct {
+	t             *testing.T
+	snapshotEvery uint64
+	nodes         []*testNode
+}
+
+func newCluster(t *testing.T, size int, snapshotEvery uint64) *cluster {
+	t.Helper()
+	c := &cluster{t: t, snapshotEvery: snapshotEvery}
+	listeners := make([]net.Listener, size)
+	for i := range listeners {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners[i] = lis
+		c.nodes = append(c.nodes, &testNode{
+			addr: lis.Addr().String(),
+			dir:  filepath.Join(t.TempDir(), fmt.Sprint(i)),
+		})
+	}
+	for i, lis := range listeners {
+		c.serve(i, lis)
+	}
+	t.Cleanup(func() {
+		for i := range c.nodes {
+			c.stop(i)
+		}
+	})
+	return c
+}
+
+// serve starts node i on lis.
+func (c *cluster) serve(i int, lis net.Listener) {
+	c.t.Helper()
+	n := c.nodes[i]
+	var peers []string
+	for _, other := range c.nodes {
+		if other != n {
+			peers = append(peers, other.addr)
+		}
+	}
+	n.kv = &server{store: make(map[string]string)}
+	rf, err := newRaftNode(n.addr, peers, n.dir, n.kv, c.snapshotEvery)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	n.kv.raft, n.raft = rf, rf
+	n.grpc = grpc.NewServer()
+	pb.RegisterKeyValueStoreServer(n.grpc, n.kv)
+	pb.RegisterRaftServer(n.grpc, rf)
+	go n.grpc.Serve(lis)
+}
+
+// start starts a stopped node again.
+func (c *cluster) start(i int) {
+	c.t.Helper()
+	lis, err := net.Listen("tcp", c.nodes[i].addr)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.serve(i, lis)
+}
+
+// stop stops node i, as if its process exited.
+func (c *cluster) stop(i int) {
+	n := c.nodes[i]
+	if n.raft == nil {
+		return
+	}
+	n.grpc.Stop()
+	n.raft.stop()
+	n.raft = nil
+}
+
+// leader waits for the running nodes to agree on a leader, and returns
+// its index.
+func (c *cluster) leader() int {
+	c.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if i, ok := c.agreedLeader(); ok {
+			return i
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.t.Fatal("no leader agreed on in time")
+	return -1
+}
+
+// agreedLeader returns the node that leads in the latest term, if every
+// running node knows it as the leader.
+func (c *cluster) agreedLeader() (int, bool) {
+	leaderIdx, leaderTerm := -1, uint64(0)
+	for i, n := range c.nodes {
+		if n.raft == nil {
+			continue
+		}
+		n.raft.mu.Lock()
+		role, term := n.raft.role, n.raft.term
+		n.raft.mu.Unlock()
+		if role == leader && term >= leaderTerm {
+			leaderIdx, leaderTerm = i, term
+		}
+	}
+	if leaderIdx < 0 {
+		return -1, false
+	}
+	for _, n := range c.nodes {
+		if n.raft == nil {
+			continue
+		}
+		n.raft.mu.Lock()
+		known, term := n.raft.leader, n.raft.term
+		n.raft.mu.Unlock()
+		if known != c.nodes[leaderIdx].addr || term != leaderTerm {
+			return -1, false
+		}
+	}
+	return leaderIdx, true
+}
+
+// put writes key through node i, which must be the leader.
+func (c *cluster) put(i int, key, value string) {
+	c.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ack, err := c.nodes[i].kv.Put(ctx, &pb.KeyValue{Key: key, Value: value})
+	if err != nil || !ack.Success {
+		c.t.Fatalf("Put(%s) on node %d = %v, %v", key, i, ack, err)
+	}
+}
+
+// waitValue waits until node i has applied key with value.
+func (c *cluster) waitValue(i int, key, value string) {
+	c.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		n := c.nodes[i]
+		n.kv.mu.Lock()
+		got := n.kv.store[key]
+		n.kv.mu.Unlock()
+		if got == value {
+			return
+		}
+		if time.Now().After(deadline) {
+			c.t.Fatalf("node %d has %s = %q, want %q", i, key, got, value)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (n *testNode) term() uint64 {
+	n.raft.mu.Lock()
+	defer n.raft.mu.Unlock()
+	return n.raft.term
+}
+
+func TestRaftElection(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	first := c.leader()
+	term := c.nodes[first].term()
+
+	// The others elect a new leader, in a later term, when it goes.
+	c.stop(first)
+	second := c.leader()
+	if second == first || c.nodes[second].term() <= term {
+		t.Fatalf("after stopping leader %d in term %d: leader %d in term %d", first, term, second, c.nodes[second].term())
+	}
+
+	// On coming back it follows the new leader.
+	c.start(first)
+	if got := c.leader(); got != second {
+		t.Fatalf("leader after the old leader came back = %d, want %d", got, second)
+	}
+}
+
+func TestRaftCommitOnMajority(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	l := c.leader()
+	c.put(l, "a", "1")
+	for i := range c.nodes {
+		c.waitValue(i, "a", "1")
+	}
+
+	// With one follower gone the other still makes a majority.
+	followers := []int{(l + 1) % 3, (l + 2) % 3}
+	c.stop(followers[0])
+	c.put(l, "b", "2")
+	c.waitValue(followers[1], "b", "2")
+
+	// Without a majority nothing commits.
+	c.stop(followers[1])
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if ack, err := c.nodes[l].kv.Put(ctx, &pb.KeyValue{Key: "c", Value: "3"}); err == nil {
+		t.Fatalf("Put without a majority = %v, want an error", ack)
+	}
+	c.nodes[l].kv.mu.Lock()
+	_, applied := c.nodes[l].kv.store["c"]
+	c.nodes[l].kv.mu.Unlock()
+	if applied {
+		t.Fatal("a write was applied without a majority")
+	}
+}
+
+func TestRaftRedirect(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	l := c.leader()
+	follower := (l + 1) % 3
+	ack, err := c.nodes[follower].kv.Put(context.Background(), &pb.KeyValue{Key: "a", Value: "1"})
+	if err != nil || ack.Success || ack.Leader != c.nodes[l].addr {
+		t.Fatalf("Put on a follower = %v, %v, want a redirect to %s", ack, err, c.nodes[l].addr)
+	}
+	var notLeader *notLeaderError
+	if err := c.nodes[follower].raft.propose(context.Background(), &pb.KeyValue{Key: "a"}); !errors.As(err, &notLeader) {
+		t.Fatalf("propose on a follower = %v, want a notLeaderError", err)
+	}
+}
+
+func TestRaftSnapshotInstall(t *testing.T) {
+	c := newCluster(t, 3, 5)
+	l := c.leader()
+	lagging := (l + 1) % 3
+	c.put(l, "before", "1")
+	c.waitValue(lagging, "before", "1")
+	c.stop(lagging)
+
+	for i := range 30 {
+		c.put(l, fmt.Sprintf("k%d", i), fmt.Sprint(i))
+	}
+	// The leader has dropped the entries the lagging node is missing,
+	// so it can only catch up from the leader's snapshot.
+	_, _, _, entries, err := openRaftStorage(c.nodes[lagging].dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.nodes[l].raft.mu.Lock()
+	snapshotIndex := c.nodes[l].raft.snapshotIndex()
+	c.nodes[l].raft.mu.Unlock()
+	lastOnDisk := entries[len(entries)-1].Index
+	if snapshotIndex <= lastOnDisk+1 {
+		t.Fatalf("leader's snapshot at %d still leaves entry %d", snapshotIndex, lastOnDisk+1)
+	}
+
+	c.start(lagging)
+	for i := range 30 {
+		c.waitValue(lagging, fmt.Sprintf("k%d", i), fmt.Sprint(i))
+	}
+	c.waitValue(lagging, "before", "1")
+}
+
+func TestRaftRestart(t *testing.T) {
+	c := newCluster(t, 3, 4)
+	l := c.leader()
+	for i := range 10 {
+		c.put(l, fmt.Sprintf("k%d", i), fmt.Sprint(i))
+	}
+	for i := range c.nodes {
+		c.waitValue(i, "k9", "9")
+	}
+	term := c.nodes[l].term()
+	for i := range c.nodes {
+		c.stop(i)
+	}
+
+	// A torn write at the end of a follower's log is dropped on the
+	// next start; the leader sends the entry again.
+	follower := (l + 1) % 3
+	path := filepath.Join(c.nodes[follower].dir, logFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 {
+		t.Fatal("follower's log is empty")
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range c.nodes {
+		c.start(i)
+	}
+	l = c.leader()
+	if got := c.nodes[l].term(); got <= term {
+		t.Fatalf("term after restart = %d, want later than %d", got, term)
+	}
+	// Committed writes survive, from the snapshot or the log.
+	for n := range c.nodes {
+		for i := range 10 {
+			c.waitValue(n, fmt.Sprintf("k%d", i), fmt.Sprint(i))
+		}
+	}
+	c.put(l, "after", "1")
+	for i := range c.nodes {
+		c.waitValue(i, "after", "1")
+	}
+}
+
+func TestRaftStaleCandidate(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	l := c.leader()
+	c.put(l, "a", "1")
+	f := (l + 1) % 3
+	c.waitValue(f, "a", "1")
+	// f is left on its own, so nothing else moves its deadline.
+	for i := range c.nodes {
+		if i != f {
+			c.stop(i)
+		}
+	}
+	rf := c.nodes[f].raft
+	rf.mu.Lock()
+	rf.deadline = time.Now().Add(time.Hour)
+	deadline, term, lastTerm, lastIndex := rf.deadline, rf.term, rf.lastTerm(), rf.lastIndex()
+	rf.mu.Unlock()
+
+	// A candidate in a later term with a log behind f's is refused, and
+	// doesn't put off f's own election.
+	reply, err := rf.RequestVote(context.Background(), &pb.VoteRequest{Term: term + 1, CandidateId: "stale", LastLogTerm: lastTerm, LastLogIndex: lastIndex - 1})
+	if err != nil || reply.VoteGranted || reply.Term != term+1 {
+		t.Fatalf("vote for a stale candidate = %v, %v", reply, err)
+	}
+	rf.mu.Lock()
+	got := rf.deadline
+	rf.mu.Unlock()
+	if !got.Equal(deadline) {
+		t.Fatalf("a refused vote moved the election deadline from %v to %v", deadline, got)
+	}
+
+	// Granting a vote does.
+	reply, err = rf.RequestVote(context.Background(), &pb.VoteRequest{Term: term + 2, CandidateId: "current", LastLogTerm: lastTerm, LastLogIndex: lastIndex})
+	if err != nil || !reply.VoteGranted {
+		t.Fatalf("vote for an up-to-date candidate = %v, %v", reply, err)
+	}
+	rf.mu.Lock()
+	got = rf.deadline
+	rf.mu.Unlock()
+	if !got.Before(deadline) {
+		t.Fatal("granting a vote didn't reset the election deadline")
+	}
+}
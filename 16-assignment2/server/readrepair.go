@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	pb "distributed-systems/16-assignment2/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var readRepairs = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "kvstore_read_repairs_total",
+	Help: "Writes sent to a replica that answered a read without them.",
+}, []string{"peer"})
+
+// dot identifies a sibling's write.
+type dot struct {
+	node    string
+	counter uint64
+}
+
+// missing returns the siblings of merged that have does not hold.
+func missing(merged, have []*pb.Sibling) []*pb.Sibling {
+	held := make(map[dot]bool, len(have))
+	for _, s := range have {
+		held[dot{s.Node, s.Counter}] = true
+	}
+	var missed []*pb.Sibling
+	for _, s := range merged {
+		if !held[dot{s.Node, s.Counter}] {
+			missed = append(missed, s)
+		}
+	}
+	return missed
+}
+
+// readRepair sends each replica that answered a read of key the writes
+// it lacks of merged, the siblings the read returns. It waits for the
+// replicas to store them only if the node does blocking read repair;
+// either way a failed repair is left to hints and anti-entropy, and does
+// not fail the read. Replicas that did not answer in time are not
+// repaired.
+func (s *server) readRepair(key string, merged []*pb.Sibling, answers map[string][]*pb.Sibling) {
+	q := s.quorum
+	var wg sync.WaitGroup
+	for peer, have := range answers {
+		missed := missing(merged, have)
+		if len(missed) == 0 {
+			continue
+		}
+		if peer == q.id {
+			for _, sib := range missed {
+				s.addLocal(key, sib)
+			}
+			continue
+		}
+		m := q.member(peer)
+		if m == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, sib := range missed {
+				ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+				_, err := m.kv.Replicate(ctx, &pb.KeyValue{Key: key, Sibling: sib})
+				cancel()
+				if err != nil {
+					log.Printf("Read repair of %q on %s failed: %v", key, peer, err)
+					return
+				}
+				readRepairs.WithLabelValues(peer).Inc()
+			}
+		}()
+	}
+	if q.blockingRepair {
+		wg.Wait()
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	pb "distributed-systems/16-assignment2/proto"
+)
+
+func TestMissing(t *testing.T) {
+	a1 := sibling("a", 1, "x", nil)
+	b1 := sibling("b", 1, "y", nil)
+	tests := []struct {
+		name         string
+		merged, have []*pb.Sibling
+		want         []string
+	}{
+		{"nothing held", []*pb.Sibling{a1, b1}, nil, []string{"a:1", "b:1"}},
+		{"all held", []*pb.Sibling{a1, b1}, []*pb.Sibling{b1, a1}, nil},
+		{"one held", []*pb.Sibling{a1, b1}, []*pb.Sibling{a1}, []string{"b:1"}},
+		{"held by dot, whatever the value", []*pb.Sibling{a1}, []*pb.Sibling{sibling("a", 1, "other", nil)}, nil},
+		{"only older writes held", []*pb.Sibling{sibling("a", 2, "z", map[string]uint64{"a": 1})}, []*pb.Sibling{a1}, []string{"a:2"}},
+		{"nothing merged", nil, []*pb.Sibling{a1}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dots(missing(tt.merged, tt.have)); !slices.Equal(got, tt.want) {
+				t.Fatalf("missing = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRepair(t *testing.T) {
+	c := newQuorumRing(t, 3, 3)
+	for _, node := range c.nodes {
+		node.kv.quorum.blockingRepair = true
+	}
+	// Each replica missed a different write; the coordinator has the
+	// latest, which replaced one of them.
+	old := sibling("x", 1, "old", nil)
+	other := sibling("y", 1, "other", nil)
+	latest := sibling("x", 2, "latest", map[string]uint64{"x": 1})
+	c.nodes[0].kv.addLocal("k", latest)
+	c.nodes[1].kv.addLocal("k", old)
+	c.nodes[2].kv.addLocal("k", other)
+
+	v, err := c.nodes[0].kv.Get(context.Background(), &pb.Key{Key: "k", Consistency: pb.Consistency_CONSISTENCY_ALL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"x:2", "y:1"}
+	if got := dots(v.Siblings); !slices.Equal(got, want) {
+		t.Fatalf("Get = %v, want %v", got, want)
+	}
+	// Every replica that answered now has what the read returned.
+	for i, node := range c.nodes {
+		if got := dots(node.kv.local("k")); !slices.Equal(got, want) {
+			t.Fatalf("node %d has %v after read repair, want %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ring is a consistent-hash ring. Each node stands at vnodes points on
+// it, its virtual nodes, so that keys spread evenly and a node joining or
+// leaving moves keys from or to many nodes rather than one neighbour.
+type ring struct {
+	points []point // sorted by hash
+	nodes  int
+}
+
+type point struct {
+	hash uint64
+	node string
+}
+
+// ringHash places s on the ring.
+func ringHash(s string) uint64 {
+	h := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(h[:])
+}
+
+func newRing(nodes []string, vnodes int) *ring {
+	r := &ring{nodes: len(nodes)}
+	for _, node := range nodes {
+		for i := range vnodes {
+			r.points = append(r.points, point{ringHash(fmt.Sprintf("%s#%d", node, i)), node})
+		}
+	}
+	slices.SortFunc(r.points, func(a, b point) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.node, b.node))
+	})
+	return r
+}
+
+// preference returns the key's preference list: the first n distinct
+// nodes met walking the ring clockwise from the key, or all the nodes if
+// there are fewer.
+func (r *ring) preference(key string, n int) []string {
+	h := ringHash(key)
+	i, _ := slices.BinarySearchFunc(r.points, h, func(p point, h uint64) int {
+		return cmp.Compare(p.hash, h)
+	})
+	return r.walk(i, n)
+}
+
+// walk returns the first n distinct nodes met walking the ring clockwise
+// from point i, or all the nodes if there are fewer.
+func (r *ring) walk(i, n int) []string {
+	n = min(n, r.nodes)
+	owners := make([]string, 0, n)
+	for ; len(owners) < n; i++ {
+		node := r.points[i%len(r.points)].node
+		if !slices.Contains(owners, node) {
+			owners = append(owners, node)
+		}
+	}
+	return owners
+}
+
+// ranges returns the owners of each key range of the ring, sorted. The
+// keys up to a point, from the one before it, have the preference list
+// walked from that point, and the keys with the same owners make a
+// range, however far apart they are on the ring.
+func (r *ring) ranges(n int) [][]string {
+	var ranges [][]string
+	seen := make(map[string]bool)
+	for i := range r.points {
+		owners := r.walk(i, n)
+		slices.Sort(owners)
+		if id := rangeID(owners); !seen[id] {
+			seen[id] = true
+			ranges = append(ranges, owners)
+		}
+	}
+	slices.SortFunc(ranges, slices.Compare)
+	return ranges
+}
+
+// rangeID names the key range owned by owners, in any order.
+func rangeID(owners []string) string {
+	return strings.Join(slices.Sorted(slices.Values(owners)), ",")
+}
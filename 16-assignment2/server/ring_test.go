@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestRingPreference(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d", "e"}
+	r := newRing(nodes, 64)
+	// The ring depends on the nodes, not the order they are given in.
+	shuffled := newRing([]string{"c", "e", "a", "d", "b"}, 64)
+
+	primaries := make(map[string]int)
+	keys := 10000
+	for i := range keys {
+		key := fmt.Sprintf("k%d", i)
+		owners := r.preference(key, 3)
+		if len(owners) != 3 || len(slices.Compact(slices.Sorted(slices.Values(owners)))) != 3 {
+			t.Fatalf("preference(%s, 3) = %v, want 3 distinct nodes", key, owners)
+		}
+		if other := shuffled.preference(key, 3); !slices.Equal(owners, other) {
+			t.Fatalf("preference(%s, 3) = %v on one ring, %v on the same ring built in another order", key, owners, other)
+		}
+		if got := r.preference(key, 1); !slices.Equal(got, owners[:1]) {
+			t.Fatalf("preference(%s, 1) = %v, want the first of %v", key, got, owners)
+		}
+		primaries[owners[0]]++
+	}
+	// Virtual nodes spread the keys about evenly.
+	for _, node := range nodes {
+		if share := float64(primaries[node]) / float64(keys/len(nodes)); share < 0.6 || share > 1.4 {
+			t.Errorf("%s is first owner of %d of %d keys", node, primaries[node], keys)
+		}
+	}
+
+	if got := r.preference("k", 10); len(got) != len(nodes) {
+		t.Fatalf("preference for more nodes than the ring has = %v, want all %d", got, len(nodes))
+	}
+	if got := newRing(nil, 64).preference("k", 3); len(got) != 0 {
+		t.Fatalf("preference on an empty ring = %v", got)
+	}
+}
+
+func TestRingJoin(t *testing.T) {
+	before := newRing([]string{"a", "b", "c", "d"}, 64)
+	after := newRing([]string{"a", "b", "c", "d", "e"}, 64)
+	moved := 0
+	for i := range 10000 {
+		key := fmt.Sprintf("k%d", i)
+		old, owners := before.preference(key, 3), after.preference(key, 3)
+		// A key's owners change only by the new node taking a place in
+		// them, pushing the last one out.
+		kept := slices.DeleteFunc(slices.Clone(owners), func(n string) bool { return n == "e" })
+		if !slices.Equal(kept, old[:len(kept)]) {
+			t.Fatalf("owners of %s went from %v to %v", key, old, owners)
+		}
+		if len(kept) < len(owners) {
+			moved++
+		}
+	}
+	// The new node takes about its share of the keys, n of 5.
+	if share := float64(moved) / 10000; share < 0.45 || share > 0.75 {
+		t.Fatalf("the new node owns %d of 10000 keys", moved)
+	}
+}
+
+func TestRingRanges(t *testing.T) {
+	r := newRing([]string{"a", "b", "c", "d"}, 16)
+	ranges := r.ranges(2)
+	ids := make(map[string]bool)
+	for _, owners := range ranges {
+		if len(owners) != 2 || !slices.IsSorted(owners) || ids[rangeID(owners)] {
+			t.Fatalf("ranges = %v, want distinct pairs of sorted owners", ranges)
+		}
+		ids[rangeID(owners)] = true
+	}
+	// Every key falls in a range.
+	for i := range 1000 {
+		key := fmt.Sprintf("k%d", i)
+		if owners := r.preference(key, 2); !ids[rangeID(owners)] {
+			t.Fatalf("owners of %s, %v, are not a range of %v", key, owners, ranges)
+		}
+	}
+	if got := newRing([]string{"a", "b", "c"}, 16).ranges(3); len(got) != 1 {
+		t.Fatalf("ranges of 3 nodes each owning every key = %v, want one", got)
+	}
+}
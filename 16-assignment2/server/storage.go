@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	pb "distributed-systems/16-assignment2/proto"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"google.golang.org/protobuf/proto"
+)
+
+// Files in a node's data directory.
+const (
+	stateFile    = "state.json"
+	logFile      = "log"
+	snapshotFile = "snapshot.json"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// hardState is the Raft state that must survive a restart before a node
+// answers an RPC: its term and who it voted for in it.
+type hardState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"voted_for"`
+}
+
+// snapshot is the store's state as of log entry Index, of term Term.
+type snapshot struct {
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	Data  []byte `json:"data"`
+}
+
+// raftStorage keeps a node's Raft state in a directory: its hard state,
+// its latest snapshot, and the log entries after the snapshot. Entries
+// are stored as frames of length, CRC-32C and the encoded entry, so a
+// write torn by a crash is detected and dropped on the next start.
+type raftStorage struct {
+	dir string
+	log *os.File
+}
+
+// openRaftStorage opens the storage in dir, creating it if needed, and
+// returns what it holds.
+func openRaftStorage(dir string) (*raftStorage, hardState, snapshot, []*pb.LogEntry, error) {
+	var hs hardState
+	var snap snapshot
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, hs, snap, nil, err
+	}
+	if err := readJSON(filepath.Join(dir, stateFile), &hs); err != nil {
+		return nil, hs, snap, nil, err
+	}
+	if err := readJSON(filepath.Join(dir, snapshotFile), &snap); err != nil {
+		return nil, hs, snap, nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, hs, snap, nil, err
+	}
+	entries, size, err := readEntries(f)
+	if err != nil {
+		f.Close()
+		return nil, hs, snap, nil, err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, hs, snap, nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, hs, snap, nil, err
+	}
+
+	// A crash between saving a snapshot and rewriting the log leaves
+	// entries the snapshot covers at the front of the log.
+	for len(entries) > 0 && entries[0].Index <= snap.Index {
+		entries = entries[1:]
+	}
+	if len(entries) > 0 && entries[0].Index != snap.Index+1 {
+		f.Close()
+		return nil, hs, snap, nil, fmt.Errorf("raft log starts at entry %d, after a snapshot at %d", entries[0].Index, snap.Index)
+	}
+	return &raftStorage{dir: dir, log: f}, hs, snap, entries, nil
+}
+
+// readEntries reads the entries in f, stopping at the first torn or
+// corrupt frame, and returns them with the size of the intact log.
+func readEntries(f *os.File) ([]*pb.LogEntry, int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	payloads, size := readFrames(f, info.Size())
+	entries := make([]*pb.LogEntry, len(payloads))
+	for i, payload := range payloads {
+		entries[i] = new(pb.LogEntry)
+		if err := proto.Unmarshal(payload, entries[i]); err != nil {
+			return nil, 0, fmt.Errorf("raft log entry %d: %w", i, err)
+		}
+	}
+	return entries, size, nil
+}
+
+// readFrames reads the frames in r, which holds n bytes, up to the first
+// torn or corrupt one, and returns their payloads with the size of the
+// intact frames. A frame longer than what is left of r is corrupt, and
+// never allocated.
+func readFrames(r io.Reader, n int64) ([][]byte, int64) {
+	br := bufio.NewReader(r)
+	var payloads [][]byte
+	var size int64
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return payloads, size
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		if size+int64(len(header))+length > n {
+			return payloads, size
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return payloads, size
+		}
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:]) {
+			return payloads, size
+		}
+		payloads = append(payloads, payload)
+		size += int64(len(header) + len(payload))
+	}
+}
+
+// appendFrame encodes payload as a frame onto buf.
+func appendFrame(buf, payload []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.BigEndian.AppendUint32(buf, crc32.Checksum(payload, crcTable))
+	return append(buf, payload...)
+}
+
+// appendFrames encodes entries as frames onto buf.
+func appendFrames(buf []byte, entries []*pb.LogEntry) ([]byte, error) {
+	for _, e := range entries {
+		payload, err := proto.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		buf = appendFrame(buf, payload)
+	}
+	return buf, nil
+}
+
+// saveState durably stores the hard state.
+func (s *raftStorage) saveState(hs hardState) error {
+	data, err := json.Marshal(hs)
+	if err != nil {
+		return err
+	}
+	return commitlog.WriteFileAtomic(filepath.Join(s.dir, stateFile), data)
+}
+
+// append durably adds entries to the end of the log.
+func (s *raftStorage) append(entries []*pb.LogEntry) error {
+	buf, err := appendFrames(nil, entries)
+	if err != nil {
+		return err
+	}
+	if _, err := s.log.Write(buf); err != nil {
+		return err
+	}
+	return s.log.Sync()
+}
+
+// rewriteLog replaces the log with entries, to drop a conflicting suffix
+// or the entries a snapshot covers.
+func (s *raftStorage) rewriteLog(entries []*pb.LogEntry) error {
+	buf, err := appendFrames(nil, entries)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, logFile)
+	if err := commitlog.WriteFileAtomic(path, buf); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.log.Close()
+	s.log = f
+	return nil
+}
+
+// saveSnapshot durably stores snap in place of the previous snapshot.
+func (s *raftStorage) saveSnapshot(snap snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return commitlog.WriteFileAtomic(filepath.Join(s.dir, snapshotFile), data)
+}
+
+// close closes the log file.
+func (s *raftStorage) close() error {
+	return s.log.Close()
+}
+
+// readJSON decodes the file at path into v, leaving v as it is if there
+// is no file.
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
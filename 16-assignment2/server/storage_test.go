@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "distributed-systems/16-assignment2/proto"
+)
+
+func testEntries(from, to uint64) []*pb.LogEntry {
+	var entries []*pb.LogEntry
+	for i := from; i <= to; i++ {
+		entries = append(entries, &pb.LogEntry{Index: i, Term: 1, Command: &pb.KeyValue{Key: "k", Value: "v"}})
+	}
+	return entries
+}
+
+func TestRaftStorageReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, _, _, _, err := openRaftStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.saveState(hardState{Term: 3, VotedFor: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.append(testEntries(1, 5)); err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+
+	s, hs, snap, entries, err := openRaftStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hs != (hardState{Term: 3, VotedFor: "b"}) || snap.Index != 0 || len(entries) != 5 || entries[4].Index != 5 {
+		t.Fatalf("reopened = %+v, %+v, %d entries", hs, snap, len(entries))
+	}
+
+	// A crash after saving a snapshot but before rewriting the log leaves
+	// entries it covers, which are dropped.
+	if err := s.saveSnapshot(snapshot{Index: 3, Term: 1, Data: []byte("{}")}); err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+	s, _, snap, entries, err = openRaftStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+	if snap.Index != 3 || len(entries) != 2 || entries[0].Index != 4 {
+		t.Fatalf("after a snapshot at 3: snapshot %d, entries from %d (%d)", snap.Index, entries[0].Index, len(entries))
+	}
+}
+
+func TestRaftStorageDamagedTail(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(data []byte) []byte
+	}{
+		{"torn header", func(data []byte) []byte { return append(data, 0, 0, 0) }},
+		{"torn payload", func(data []byte) []byte { return data[:len(data)-2] }},
+		{"bad checksum", func(data []byte) []byte {
+			data[len(data)-1] ^= 0xff
+			return data
+		}},
+		// The entries are the same size, so the last starts two thirds
+		// of the way in.
+		{"length past the end", func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[len(data)-len(data)/3:], 0xfffffff0)
+			return data
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, _, _, _, err := openRaftStorage(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.append(testEntries(1, 3)); err != nil {
+				t.Fatal(err)
+			}
+			s.close()
+			path := filepath.Join(dir, logFile)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tt.damage(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			s, _, _, entries, err := openRaftStorage(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 3
+			if tt.name != "torn header" {
+				want = 2
+			}
+			if len(entries) != want {
+				t.Fatalf("entries after damage = %d, want %d", len(entries), want)
+			}
+			// The damage is cut off, so new entries follow the intact
+			// ones.
+			if err := s.append(testEntries(uint64(want)+1, uint64(want)+1)); err != nil {
+				t.Fatal(err)
+			}
+			s.close()
+			s, _, _, entries, err = openRaftStorage(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.close()
+			if len(entries) != want+1 || entries[want].Index != uint64(want)+1 {
+				t.Fatalf("entries after appending = %d, want %d", len(entries), want+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// TopicInfo describes a topic and the offset range of each partition.
+type TopicInfo struct {
+	Name       string          `json:"name"`
+	Partitions []PartitionInfo `json:"partitions"`
+}
+
+// PartitionInfo is the offset range held by one partition.
+type PartitionInfo struct {
+	Partition   int `json:"partition"`
+	StartOffset int `json:"start_offset"`
+	EndOffset   int `json:"end_offset"`
+}
+
+// GroupOffset is the offset a consumer group has committed for a
+// partition, the next one it will read.
+type GroupOffset struct {
+	Topic       string    `json:"topic"`
+	Partition   int       `json:"partition"`
+	Offset      int       `json:"offset"`
+	Metadata    string    `json:"metadata,omitempty"`
+	CommittedAt time.Time `json:"committed_at"`
+	// EndOffset is where the partition ended when the group was
+	// described; it is zero in CommitOffset results.
+	EndOffset int `json:"end_offset,omitempty"`
+}
+
+// Topics lists the server's topics.
+func (c *Client) Topics(ctx context.Context) ([]TopicInfo, error) {
+	var res struct {
+		Topics []TopicInfo `json:"topics"`
+	}
+	err := c.do(ctx, http.MethodGet, "/topics", nil, nil, &res)
+	return res.Topics, err
+}
+
+// DescribeTopic returns one topic.
+func (c *Client) DescribeTopic(ctx context.Context, name string) (TopicInfo, error) {
+	var t TopicInfo
+	err := c.do(ctx, http.MethodGet, "/topics/"+url.PathEscape(name), nil, nil, &t)
+	return t, err
+}
+
+// CreateTopic creates a topic with the given number of partitions.
+func (c *Client) CreateTopic(ctx context.Context, name string, partitions int) (TopicInfo, error) {
+	var t TopicInfo
+	req := struct {
+		Name       string `json:"name"`
+		Partitions int    `json:"partitions"`
+	}{name, partitions}
+	err := c.do(ctx, http.MethodPost, "/topics", nil, req, &t)
+	return t, err
+}
+
+// DeleteTopic deletes a topic, its records and offsets committed for it.
+func (c *Client) DeleteTopic(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/topics/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// Groups lists the consumer groups that have committed offsets.
+func (c *Client) Groups(ctx context.Context) ([]string, error) {
+	var res struct {
+		Groups []string `json:"groups"`
+	}
+	err := c.do(ctx, http.MethodGet, "/groups", nil, nil, &res)
+	return res.Groups, err
+}
+
+// DescribeGroup returns a group's committed offsets, with the current end
+// offset of each partition.
+func (c *Client) DescribeGroup(ctx context.Context, group string) ([]GroupOffset, error) {
+	var res struct {
+		Partitions []GroupOffset `json:"partitions"`
+	}
+	err := c.do(ctx, http.MethodGet, "/groups/"+url.PathEscape(group), nil, nil, &res)
+	return res.Partitions, err
+}
+
+// CommitOffset records offset as the group's position in the client's
+// topic and partition (partition 0 for AnyPartition).
+func (c *Client) CommitOffset(ctx context.Context, group string, offset int, metadata string) (GroupOffset, error) {
+	req := GroupOffset{Topic: c.topic, Partition: max(c.partition, 0), Offset: offset, Metadata: metadata}
+	var res GroupOffset
+	err := c.do(ctx, http.MethodPost, "/groups/"+url.PathEscape(group)+"/offsets", nil, req, &res)
+	return res, err
+}
+
+// PartitionLag is how far a consumer group is behind in one partition.
+type PartitionLag struct {
+	Topic           string `json:"topic"`
+	Partition       int    `json:"partition"`
+	CommittedOffset int    `json:"committed_offset"`
+	EndOffset       int    `json:"end_offset"`
+	// Lag is the number of records the group has yet to consume.
+	Lag int `json:"lag"`
+	// LagSeconds is the age of the oldest of those records.
+	LagSeconds float64 `json:"lag_seconds"`
+	// OldestUnconsumed is that record's timestamp, nil when the group
+	// is caught up.
+	OldestUnconsumed *time.Time `json:"oldest_unconsumed,omitempty"`
+}
+
+// GroupLag returns a group's lag in each partition it has committed an
+// offset for.
+func (c *Client) GroupLag(ctx context.Context, group string) ([]PartitionLag, error) {
+	var res struct {
+		Partitions []PartitionLag `json:"partitions"`
+	}
+	err := c.do(ctx, http.MethodGet, "/groups/"+url.PathEscape(group)+"/lag", nil, nil, &res)
+	return res.Partitions, err
+}
+
+// DeleteBefore removes the records before offset from the client's
+// partition (partition 0 for AnyPartition), as retention would.
+func (c *Client) DeleteBefore(ctx context.Context, offset int) error {
+	q := url.Values{"offset": {strconv.Itoa(offset)}}
+	return c.do(ctx, http.MethodPost, "/admin/delete-before", c.scope(q, true), nil, nil)
+}
@@ -0,0 +1,344 @@
+// Package client is a Go client for the commit log HTTP API served by
+// 08-assignment1.
+//
+// Every call takes a context, which bounds the call including retries.
+// Requests that fail to connect or get a 5xx response are retried with
+// exponential backoff; a retried produce may append its records twice.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// RetryPolicy controls how failed requests are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of tries, including the first. One
+	// disables retries.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry; each later retry
+	// doubles it, up to MaxBackoff. Delays are jittered.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is used by clients created without WithRetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+}
+
+// backoff returns the delay before retry number attempt (from 1).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.MinBackoff << (attempt - 1)
+	if d <= 0 || d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// Full jitter: anywhere between half and all of d.
+	return d/2 + rand.N(d/2+1)
+}
+
+// Client talks to one commit log server.
+type Client struct {
+	base  string
+	hc    *http.Client
+	retry RetryPolicy
+
+	// topic and partition scope record calls; see Topic.
+	topic     string
+	partition int
+}
+
+// AnyPartition lets the server place produced records by key. Reads
+// through a client scoped to AnyPartition use partition 0.
+const AnyPartition = -1
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests. Tail streams
+// are long-lived, so its Timeout should be zero; use contexts instead.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.hc = hc }
+}
+
+// WithRetryPolicy sets how failed requests are retried.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) { c.retry = p }
+}
+
+// New returns a client for the server at baseURL, e.g.
+// "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		base:      strings.TrimRight(baseURL, "/"),
+		hc:        http.DefaultClient,
+		retry:     DefaultRetryPolicy,
+		partition: AnyPartition,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.retry.MaxAttempts < 1 {
+		c.retry.MaxAttempts = 1
+	}
+	return c
+}
+
+// Topic returns a copy of c whose record calls (Produce, Consume,
+// Records, Tail and so on) use the given topic and partition instead of
+// the server's default topic.
+func (c *Client) Topic(name string, partition int) *Client {
+	cc := *c
+	cc.topic, cc.partition = name, partition
+	return &cc
+}
+
+// scope adds the client's topic and partition to the query q, creating
+// it if needed. Reads always name a partition; produces only when one
+// was chosen.
+func (c *Client) scope(q url.Values, read bool) url.Values {
+	if q == nil {
+		q = url.Values{}
+	}
+	if c.topic != "" {
+		q.Set("topic", c.topic)
+	}
+	if c.partition != AnyPartition {
+		q.Set("partition", strconv.Itoa(c.partition))
+	} else if read && c.topic != "" {
+		q.Set("partition", "0")
+	}
+	return q
+}
+
+// Produce appends rec and returns its offset.
+func (c *Client) Produce(ctx context.Context, rec commitlog.Record) (int, error) {
+	var res struct {
+		Offset int `json:"offset"`
+	}
+	err := c.do(ctx, http.MethodPost, "/", c.scope(nil, false), map[string]commitlog.Record{"record": rec}, &res)
+	return res.Offset, err
+}
+
+// ProduceBatch appends recs in order in one request and returns their
+// offsets.
+func (c *Client) ProduceBatch(ctx context.Context, recs []commitlog.Record) ([]int, error) {
+	var res struct {
+		Offsets []int `json:"offsets"`
+	}
+	err := c.do(ctx, http.MethodPost, "/records", c.scope(nil, false), map[string][]commitlog.Record{"records": recs}, &res)
+	return res.Offsets, err
+}
+
+// ProduceBatchPartitioned is ProduceBatch that also returns the
+// partition each record was appended to, for clients scoped to a topic
+// with AnyPartition.
+func (c *Client) ProduceBatchPartitioned(ctx context.Context, recs []commitlog.Record) (partitions, offsets []int, err error) {
+	var res struct {
+		Partitions []int `json:"partitions"`
+		Offsets    []int `json:"offsets"`
+	}
+	err = c.do(ctx, http.MethodPost, "/records", c.scope(nil, false), map[string][]commitlog.Record{"records": recs}, &res)
+	return res.Partitions, res.Offsets, err
+}
+
+// ProduceAt stores rec to be appended at deliverAt; until then consumers
+// can't see it. It returns the partition the record will be appended
+// to. A deliverAt that has passed appends rec straight away, like
+// Produce.
+func (c *Client) ProduceAt(ctx context.Context, rec commitlog.Record, deliverAt time.Time) (int, error) {
+	var res struct {
+		Partition int `json:"partition"`
+	}
+	req := struct {
+		Record    commitlog.Record `json:"record"`
+		DeliverAt time.Time        `json:"deliver_at"`
+	}{rec, deliverAt}
+	err := c.do(ctx, http.MethodPost, "/", c.scope(nil, false), req, &res)
+	return res.Partition, err
+}
+
+// ProduceBatchAt is ProduceAt for several records, all due at deliverAt.
+// Records due at the same time are delivered in the order they were
+// produced.
+func (c *Client) ProduceBatchAt(ctx context.Context, recs []commitlog.Record, deliverAt time.Time) (partitions []int, err error) {
+	var res struct {
+		Partitions []int `json:"partitions"`
+	}
+	req := struct {
+		Records   []commitlog.Record `json:"records"`
+		DeliverAt time.Time          `json:"deliver_at"`
+	}{recs, deliverAt}
+	err = c.do(ctx, http.MethodPost, "/records", c.scope(nil, false), req, &res)
+	return res.Partitions, err
+}
+
+// Consume returns the record at offset.
+func (c *Client) Consume(ctx context.Context, offset int) (commitlog.Record, error) {
+	var rec commitlog.Record
+	q := url.Values{"offset": {strconv.Itoa(offset)}}
+	err := c.do(ctx, http.MethodGet, "/", c.scope(q, true), nil, &rec)
+	return rec, err
+}
+
+// Records returns up to max records starting at from. If there are none
+// yet it waits up to wait for some to be appended, and returns an empty
+// slice if none are.
+func (c *Client) Records(ctx context.Context, from, max int, wait time.Duration) ([]commitlog.Record, error) {
+	q := url.Values{"from": {strconv.Itoa(from)}}
+	if max > 0 {
+		q.Set("max", strconv.Itoa(max))
+	}
+	if wait > 0 {
+		q.Set("wait", wait.String())
+	}
+	var res struct {
+		Records []commitlog.Record `json:"records"`
+	}
+	err := c.do(ctx, http.MethodGet, "/records", c.scope(q, true), nil, &res)
+	return res.Records, err
+}
+
+// RecordFrames is Records with the records sent as frames, which the
+// server copies straight from its segment files instead of encoding
+// JSON; catch-up reads of large ranges should use it. The server returns
+// at most about maxBytes of records, or its default if maxBytes is
+// zero, but always at least one if there are any.
+func (c *Client) RecordFrames(ctx context.Context, from, max int, maxBytes int64, wait time.Duration) ([]commitlog.Record, error) {
+	q := url.Values{"from": {strconv.Itoa(from)}}
+	if max > 0 {
+		q.Set("max", strconv.Itoa(max))
+	}
+	if maxBytes > 0 {
+		q.Set("max_bytes", strconv.FormatInt(maxBytes, 10))
+	}
+	if wait > 0 {
+		q.Set("wait", wait.String())
+	}
+	var res framedRecords
+	err := c.do(ctx, http.MethodGet, "/records", c.scope(q, true), nil, &res)
+	return res.Records, err
+}
+
+// framedRecords is the response to a /records request accepting frames.
+// A server that predates frames answers in JSON, which decodes too.
+type framedRecords struct {
+	Records []commitlog.Record `json:"records"`
+}
+
+func (f *framedRecords) decode(resp *http.Response) error {
+	if resp.Header.Get("Content-Type") != commitlog.FramesContentType {
+		if err := json.NewDecoder(resp.Body).Decode(f); err != nil {
+			return fmt.Errorf("decoding response: %w", err)
+		}
+		return nil
+	}
+	d := commitlog.NewFrameDecoder(resp.Body)
+	for {
+		rec, err := d.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decoding frames: %w", err)
+		}
+		f.Records = append(f.Records, rec)
+	}
+}
+
+// do sends a request, retrying per the client's policy, and decodes a
+// successful JSON response into out.
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	u := c.base + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < c.retry.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, c.retry.backoff(attempt)); err != nil {
+				return err
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if _, ok := out.(*framedRecords); ok {
+			req.Header.Set("Accept", commitlog.FramesContentType)
+		}
+		resp, err := c.hc.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		err = decodeResponse(resp, out)
+		if e, ok := err.(*Error); ok && e.StatusCode >= 500 {
+			lastErr = err
+			continue
+		}
+		return err
+	}
+	return lastErr
+}
+
+// decodeResponse decodes a 2xx body into out, or the error envelope of
+// any other status into an *Error. It closes the body.
+func decodeResponse(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return readError(resp)
+	}
+	if out == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if f, ok := out.(*framedRecords); ok {
+		return f.decode(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
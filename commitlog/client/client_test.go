@@ -0,0 +1,404 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/client"
+)
+
+var fastRetry = client.WithRetryPolicy(client.RetryPolicy{
+	MaxAttempts: 5,
+	MinBackoff:  time.Millisecond,
+	MaxBackoff:  5 * time.Millisecond,
+})
+
+// server is a stand-in for the commit log server's record routes, over
+// one in-memory partition.
+type server struct {
+	log *commitlog.Tailable
+
+	mu      sync.Mutex
+	batches []int // sizes of the batches produced
+}
+
+func newServer(t *testing.T) (*server, *httptest.Server) {
+	s := &server{log: commitlog.NewTailable(commitlog.NewMemoryLog())}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /records", s.produce)
+	mux.HandleFunc("GET /records", s.records)
+	mux.HandleFunc("GET /stream", s.stream)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	body := map[string]any{"code": commitlog.ErrorCode(err), "message": err.Error()}
+	var oor *commitlog.ErrOffsetOutOfRange
+	if errors.As(err, &oor) {
+		body["offset"], body["start_offset"], body["end_offset"] = oor.Offset, oor.Start, oor.End
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]any{"error": body})
+}
+
+func (s *server) produce(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Records []commitlog.Record `json:"records"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offsets, err := s.log.AppendBatch(req.Records)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	s.batches = append(s.batches, len(req.Records))
+	s.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string][]int{"offsets": offsets})
+}
+
+func (s *server) batchSizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.batches...)
+}
+
+func (s *server) records(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, _ := strconv.Atoi(q.Get("from"))
+	max, _ := strconv.Atoi(q.Get("max"))
+	wait, _ := time.ParseDuration(q.Get("wait"))
+	if start, end := s.log.StartOffset(), s.log.EndOffset(); from < start || from > end {
+		writeError(w, &commitlog.ErrOffsetOutOfRange{Offset: from, Start: start, End: end})
+		return
+	}
+	if from == s.log.EndOffset() && wait > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), wait)
+		s.log.Wait(ctx, from)
+		cancel()
+	}
+	if r.Header.Get("Accept") == commitlog.FramesContentType {
+		frames, err := commitlog.ReadFrames(s.log, from, max, 0)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer frames.Close()
+		w.Header().Set("Content-Type", commitlog.FramesContentType)
+		frames.WriteTo(w)
+		return
+	}
+	recs, err := commitlog.ReadRange(s.log, from, max)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string][]commitlog.Record{"records": recs})
+}
+
+func (s *server) stream(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if start, end := s.log.StartOffset(), s.log.EndOffset(); offset < start || offset > end {
+		writeError(w, &commitlog.ErrOffsetOutOfRange{Offset: offset, Start: start, End: end})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	for r.Context().Err() == nil {
+		for ; offset < s.log.EndOffset(); offset++ {
+			rec, err := s.log.Read(offset)
+			if err != nil {
+				return
+			}
+			data, _ := json.Marshal(rec)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", rec.Offset, data)
+		}
+		w.(http.Flusher).Flush()
+		s.log.Wait(r.Context(), offset)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var failures, calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failures.Add(-1) >= 0 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]int{"offset": 7})
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL, fastRetry)
+	failures.Store(2)
+	off, err := c.Produce(context.Background(), commitlog.Record{Value: "v"})
+	if err != nil || off != 7 {
+		t.Fatalf("Produce = %d, %v, want 7", off, err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("%d requests, want 3", n)
+	}
+
+	// Retries give up after MaxAttempts with the last error.
+	failures.Store(100)
+	calls.Store(0)
+	_, err = c.Produce(context.Background(), commitlog.Record{Value: "v"})
+	var e *client.Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Produce against a failing server = %v, want a 503 *Error", err)
+	}
+	if n := calls.Load(); n != 5 {
+		t.Fatalf("%d requests, want 5", n)
+	}
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	s, srv := newServer(t)
+	s.log.Append(commitlog.Record{Value: "a"})
+	s.log.Append(commitlog.Record{Value: "b"})
+	s.log.DeleteBefore(1)
+
+	c := client.New(srv.URL, fastRetry)
+	_, err := c.Records(context.Background(), 0, 10, 0)
+	var oor *commitlog.ErrOffsetOutOfRange
+	if !errors.As(err, &oor) || oor.Start != 1 || oor.End != 2 {
+		t.Fatalf("Records below the start = %v, want ErrOffsetOutOfRange [1, 2)", err)
+	}
+}
+
+// A context that ends during backoff ends the call with the context's
+// error, not the server's last one.
+func TestCancelDuringBackoff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL, client.WithRetryPolicy(client.RetryPolicy{
+		MaxAttempts: 5,
+		MinBackoff:  time.Hour,
+		MaxBackoff:  time.Hour,
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.Produce(ctx, commitlog.Record{Value: "v"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Produce = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestProducerBatching(t *testing.T) {
+	s, srv := newServer(t)
+	c := client.New(srv.URL, fastRetry)
+	p := c.NewProducer(client.ProducerConfig{BatchSize: 10, Linger: time.Hour})
+	defer p.Close()
+
+	var results []*client.Result
+	for i := range 25 {
+		results = append(results, p.Send(commitlog.Record{Value: strconv.Itoa(i)}))
+	}
+	// Two full batches go without waiting for the linger time; Flush
+	// sends the rest.
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		off, err := res.Wait(context.Background())
+		if err != nil || off != i {
+			t.Fatalf("record %d: Wait = %d, %v", i, off, err)
+		}
+	}
+	if got := s.batchSizes(); fmt.Sprint(got) != "[10 10 5]" {
+		t.Fatalf("batches = %v, want [10 10 5]", got)
+	}
+}
+
+func TestProducerLinger(t *testing.T) {
+	s, srv := newServer(t)
+	c := client.New(srv.URL, fastRetry)
+	p := c.NewProducer(client.ProducerConfig{BatchSize: 100, Linger: 10 * time.Millisecond})
+	defer p.Close()
+
+	var results []*client.Result
+	for i := range 3 {
+		results = append(results, p.Send(commitlog.Record{Value: strconv.Itoa(i)}))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i, res := range results {
+		if off, err := res.Wait(ctx); err != nil || off != i {
+			t.Fatalf("record %d: Wait = %d, %v", i, off, err)
+		}
+	}
+	if got := s.batchSizes(); fmt.Sprint(got) != "[3]" {
+		t.Fatalf("batches = %v, want [3]", got)
+	}
+}
+
+func TestProducerClose(t *testing.T) {
+	s, srv := newServer(t)
+	c := client.New(srv.URL, fastRetry)
+	p := c.NewProducer(client.ProducerConfig{BatchSize: 100, Linger: time.Hour})
+
+	var results []*client.Result
+	for i := range 7 {
+		results = append(results, p.Send(commitlog.Record{Value: strconv.Itoa(i)}))
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		select {
+		case <-res.Done():
+		default:
+			t.Fatalf("record %d unresolved after Close", i)
+		}
+		if off, err := res.Wait(context.Background()); err != nil || off != i {
+			t.Fatalf("record %d: Wait = %d, %v", i, off, err)
+		}
+	}
+	if end := s.log.EndOffset(); end != 7 {
+		t.Fatalf("EndOffset = %d, want 7", end)
+	}
+
+	if _, err := p.Send(commitlog.Record{Value: "late"}).Wait(context.Background()); !errors.Is(err, client.ErrProducerClosed) {
+		t.Fatalf("Send after Close = %v, want ErrProducerClosed", err)
+	}
+	if err := p.Flush(context.Background()); !errors.Is(err, client.ErrProducerClosed) {
+		t.Fatalf("Flush after Close = %v, want ErrProducerClosed", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("second Close = %v", err)
+	}
+}
+
+func TestTail(t *testing.T) {
+	modes := map[string]client.TailMode{
+		"stream":   client.TailStream,
+		"longpoll": client.TailLongPoll,
+		"frames":   client.TailFrames,
+	}
+	for name, mode := range modes {
+		t.Run(name, func(t *testing.T) {
+			s, srv := newServer(t)
+			for i := range 5 {
+				s.log.Append(commitlog.Record{Value: strconv.Itoa(i)})
+			}
+			c := client.New(srv.URL, fastRetry)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			want := 2
+			opts := client.TailOptions{Mode: mode, BatchSize: 2, Wait: time.Second}
+			for rec, err := range c.Tail(ctx, 2, opts) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if rec.Offset != want || rec.Value != strconv.Itoa(want) {
+					t.Fatalf("got %+v, want offset %d", rec, want)
+				}
+				want++
+				if want == 5 {
+					// Caught up: the tail must follow new records.
+					go func() {
+						for i := 5; i < 8; i++ {
+							s.log.Append(commitlog.Record{Value: strconv.Itoa(i)})
+						}
+					}()
+				}
+				if want == 8 {
+					break
+				}
+			}
+			if want != 8 {
+				t.Fatalf("tail ended at offset %d, want 8: %v", want, ctx.Err())
+			}
+		})
+	}
+}
+
+// An error response ends the tail with the error rather than retrying.
+func TestTailError(t *testing.T) {
+	for _, mode := range []client.TailMode{client.TailStream, client.TailLongPoll, client.TailFrames} {
+		s, srv := newServer(t)
+		s.log.Append(commitlog.Record{Value: "a"})
+		s.log.Append(commitlog.Record{Value: "b"})
+		s.log.DeleteBefore(1)
+
+		c := client.New(srv.URL, fastRetry)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var errs []error
+		for _, err := range c.Tail(ctx, 0, client.TailOptions{Mode: mode}) {
+			errs = append(errs, err)
+		}
+		cancel()
+		var oor *commitlog.ErrOffsetOutOfRange
+		if len(errs) != 1 || !errors.As(errs[0], &oor) {
+			t.Fatalf("mode %d: tail yielded %v, want one ErrOffsetOutOfRange", mode, errs)
+		}
+	}
+}
+
+// An error event ends the stream with the error it carries, typed, rather
+// than being retried.
+func TestTailStreamErrorEvent(t *testing.T) {
+	tests := []struct {
+		name, data string
+		want       func(err error) bool
+	}{
+		{"envelope", `{"error": {"code": "offset_truncated", "message": "offset 1 was removed", "offset": 1, "start_offset": 2, "end_offset": 5}}`, func(err error) bool {
+			var oor *commitlog.ErrOffsetOutOfRange
+			return errors.As(err, &oor) && oor.Offset == 1 && oor.Start == 2 && oor.End == 5
+		}},
+		// As older servers sent it.
+		{"code only", commitlog.CodeCorrupt, func(err error) bool { return errors.Is(err, commitlog.ErrCorrupt) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprintf(w, "id: 0\ndata: {\"offset\": 0, \"value\": \"a\"}\n\nevent: error\ndata: %s\n\n", tt.data)
+			}))
+			defer srv.Close()
+
+			c := client.New(srv.URL, fastRetry)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var recs []commitlog.Record
+			var errs []error
+			for rec, err := range c.Tail(ctx, 0, client.TailOptions{Mode: client.TailStream}) {
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					recs = append(recs, rec)
+				}
+			}
+			if len(recs) != 1 || recs[0].Value != "a" || len(errs) != 1 || calls.Load() != 1 {
+				t.Fatalf("tail yielded %v and %v in %d requests, want one record then one error", recs, errs, calls.Load())
+			}
+			var e *client.Error
+			if !errors.As(errs[0], &e) || e.StatusCode != 0 || !tt.want(errs[0]) {
+				t.Fatalf("error event = %#v", errs[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// Error is an error response from the server, or an error event ending
+// a stream.
+type Error struct {
+	// StatusCode is the response's status, or 0 for an error event: the
+	// stream it ends started with 200 OK.
+	StatusCode int
+	// Code is the machine-readable error code, such as
+	// commitlog.CodeOffsetOutOfRange.
+	Code    string
+	Message string
+	// Offset, StartOffset and EndOffset are set for offset errors.
+	Offset      *int
+	StartOffset *int
+	EndOffset   *int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("commitlog server: %s (%d %s)", e.Message, e.StatusCode, e.Code)
+}
+
+// Unwrap returns the commitlog error matching the code, so callers can
+// use errors.Is and errors.As as they would against a local log.
+func (e *Error) Unwrap() error {
+	switch e.Code {
+	case commitlog.CodeOffsetOutOfRange, commitlog.CodeTruncated:
+		if e.Offset != nil && e.StartOffset != nil && e.EndOffset != nil {
+			return &commitlog.ErrOffsetOutOfRange{Offset: *e.Offset, Start: *e.StartOffset, End: *e.EndOffset}
+		}
+		if e.Code == commitlog.CodeTruncated {
+			return commitlog.ErrTruncated
+		}
+	case commitlog.CodeCorrupt:
+		return commitlog.ErrCorrupt
+	case commitlog.CodeClosed:
+		return commitlog.ErrClosed
+	}
+	return nil
+}
+
+// readError builds an *Error from a non-2xx response.
+func readError(resp *http.Response) error {
+	e := &Error{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if !e.decode(data) {
+		e.Message = http.StatusText(resp.StatusCode)
+		if len(data) > 0 {
+			e.Message = string(data)
+		}
+	}
+	return e
+}
+
+// readEventError builds an *Error from the data of an error event. Older
+// servers sent only the error code.
+func readEventError(data string) error {
+	e := &Error{}
+	if !e.decode([]byte(data)) {
+		e.Code, e.Message = data, "stream ended with "+data
+	}
+	return e
+}
+
+// decode fills in e from the JSON error envelope in data, reporting
+// whether data held one.
+func (e *Error) decode(data []byte) bool {
+	var envelope struct {
+		Error struct {
+			Code        string `json:"code"`
+			Message     string `json:"message"`
+			Offset      *int   `json:"offset"`
+			StartOffset *int   `json:"start_offset"`
+			EndOffset   *int   `json:"end_offset"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &envelope) != nil || envelope.Error.Code == "" {
+		return false
+	}
+	b := envelope.Error
+	e.Code, e.Message = b.Code, b.Message
+	e.Offset, e.StartOffset, e.EndOffset = b.Offset, b.StartOffset, b.EndOffset
+	return true
+}
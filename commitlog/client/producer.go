@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// ErrProducerClosed is returned for records sent after Close.
+var ErrProducerClosed = errors.New("producer is closed")
+
+// ProducerConfig configures a Producer.
+type ProducerConfig struct {
+	// BatchSize is the number of buffered records that triggers a flush.
+	BatchSize int
+	// Linger is how long the first record of a batch waits for others
+	// before the batch is flushed anyway.
+	Linger time.Duration
+	// Timeout bounds each batch request, including retries.
+	Timeout time.Duration
+}
+
+// Producer batches records in the background and produces each batch
+// with one ProduceBatch call. Records are appended in the order they
+// were sent.
+type Producer struct {
+	c   *Client
+	cfg ProducerConfig
+
+	mu     sync.RWMutex
+	closed bool
+	in     chan pending
+	flush  chan chan struct{}
+	done   chan struct{}
+}
+
+type pending struct {
+	rec commitlog.Record
+	res *Result
+}
+
+// Result is the outcome of a record sent through a Producer.
+type Result struct {
+	done   chan struct{}
+	offset int
+	err    error
+}
+
+// Done is closed once the record has been produced or has failed.
+func (r *Result) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait blocks until the record is produced and returns its offset.
+func (r *Result) Wait(ctx context.Context) (int, error) {
+	select {
+	case <-r.done:
+		return r.offset, r.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (r *Result) resolve(offset int, err error) {
+	r.offset, r.err = offset, err
+	close(r.done)
+}
+
+// NewProducer starts a batching producer. Close it to flush and stop it.
+func (c *Client) NewProducer(cfg ProducerConfig) *Producer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Linger <= 0 {
+		cfg.Linger = 10 * time.Millisecond
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	p := &Producer{
+		c:     c,
+		cfg:   cfg,
+		in:    make(chan pending, cfg.BatchSize),
+		flush: make(chan chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Send queues rec for the next batch. It blocks only while the buffer is
+// full.
+func (p *Producer) Send(rec commitlog.Record) *Result {
+	res := &Result{done: make(chan struct{})}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		res.resolve(0, ErrProducerClosed)
+		return res
+	}
+	p.in <- pending{rec, res}
+	return res
+}
+
+// Flush produces everything sent so far and waits for it to finish.
+func (p *Producer) Flush(ctx context.Context) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrProducerClosed
+	}
+	ack := make(chan struct{})
+	select {
+	case p.flush <- ack:
+	case <-ctx.Done():
+		p.mu.RUnlock()
+		return ctx.Err()
+	}
+	p.mu.RUnlock()
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes buffered records and stops the producer.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.in)
+	p.mu.Unlock()
+	<-p.done
+	return nil
+}
+
+func (p *Producer) run() {
+	defer close(p.done)
+	var batch []pending
+	var linger <-chan time.Time
+	var timer *time.Timer
+
+	send := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, linger = nil, nil
+		}
+		if len(batch) == 0 {
+			return
+		}
+		recs := make([]commitlog.Record, len(batch))
+		for i, pd := range batch {
+			recs[i] = pd.rec
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+		offsets, err := p.c.ProduceBatch(ctx, recs)
+		cancel()
+		for i, pd := range batch {
+			if err == nil && i < len(offsets) {
+				pd.res.resolve(offsets[i], nil)
+			} else if err == nil {
+				pd.res.resolve(0, errors.New("server returned too few offsets"))
+			} else {
+				pd.res.resolve(0, err)
+			}
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case pd, ok := <-p.in:
+			if !ok {
+				send()
+				return
+			}
+			batch = append(batch, pd)
+			if len(batch) >= p.cfg.BatchSize {
+				send()
+			} else if timer == nil {
+				timer = time.NewTimer(p.cfg.Linger)
+				linger = timer.C
+			}
+		case <-linger:
+			timer, linger = nil, nil
+			send()
+		case ack := <-p.flush:
+			// Take everything already queued before flushing.
+			for drained := false; !drained; {
+				select {
+				case pd, ok := <-p.in:
+					if !ok {
+						drained = true
+						break
+					}
+					batch = append(batch, pd)
+					if len(batch) >= p.cfg.BatchSize {
+						send()
+					}
+				default:
+					drained = true
+				}
+			}
+			send()
+			close(ack)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// SearchHit is a record matching a search, with its relevance score.
+type SearchHit struct {
+	Partition int              `json:"partition"`
+	Offset    int              `json:"offset"`
+	Score     float64          `json:"score"`
+	Record    commitlog.Record `json:"record"`
+}
+
+// SearchResult is one page of a search's hits, best first.
+type SearchResult struct {
+	Topic string      `json:"topic"`
+	Query string      `json:"query"`
+	Total int         `json:"total"`
+	Hits  []SearchHit `json:"results"`
+	// Complete is false while the server's index is still catching up
+	// with the topic, so hits may be missing.
+	Complete bool `json:"complete"`
+	// NextSkip is the skip for the next page, or nil on the last one.
+	NextSkip *int `json:"next_skip,omitempty"`
+}
+
+// Search returns the records of the client's topic matching every word
+// of query, skipping the first skip hits and returning at most max (the
+// server's default if zero). The server must run with -search.
+func (c *Client) Search(ctx context.Context, query string, skip, max int) (SearchResult, error) {
+	q := url.Values{"q": {query}}
+	if c.topic != "" {
+		q.Set("topic", c.topic)
+	}
+	if skip > 0 {
+		q.Set("skip", strconv.Itoa(skip))
+	}
+	if max > 0 {
+		q.Set("max", strconv.Itoa(max))
+	}
+	var res SearchResult
+	err := c.do(ctx, http.MethodGet, "/search", q, nil, &res)
+	return res, err
+}
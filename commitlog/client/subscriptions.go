@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SubscriptionFilter selects the records a subscription delivers; every
+// set field must match.
+type SubscriptionFilter struct {
+	Key           string `json:"key,omitempty"`
+	KeyPrefix     string `json:"key_prefix,omitempty"`
+	ValueContains string `json:"value_contains,omitempty"`
+}
+
+// NewSubscription asks the server to push a topic's records to a
+// webhook. Zero fields take the server's defaults.
+type NewSubscription struct {
+	URL   string `json:"url"`
+	Topic string `json:"topic,omitempty"`
+	// StartOffset is where delivery starts in every partition; nil
+	// delivers only records appended from now on.
+	StartOffset     *int               `json:"start_offset,omitempty"`
+	BatchSize       int                `json:"batch_size,omitempty"`
+	Filter          SubscriptionFilter `json:"filter"`
+	MaxAttempts     int                `json:"max_attempts,omitempty"`
+	DeadLetterTopic string             `json:"dead_letter_topic,omitempty"`
+}
+
+// Subscription is a webhook subscription and its delivery progress.
+type Subscription struct {
+	ID              string                  `json:"id"`
+	URL             string                  `json:"url"`
+	Topic           string                  `json:"topic"`
+	BatchSize       int                     `json:"batch_size"`
+	Filter          SubscriptionFilter      `json:"filter"`
+	MaxAttempts     int                     `json:"max_attempts"`
+	DeadLetterTopic string                  `json:"dead_letter_topic"`
+	CreatedAt       time.Time               `json:"created_at"`
+	Partitions      []SubscriptionPartition `json:"partitions"`
+}
+
+// SubscriptionPartition is how delivery of one partition is going.
+type SubscriptionPartition struct {
+	Partition int `json:"partition"`
+	// AckedOffset is the next offset to deliver; the webhook has
+	// acknowledged everything before it.
+	AckedOffset int `json:"acked_offset"`
+	EndOffset   int `json:"end_offset"`
+	// Attempts and LastError describe a batch being retried.
+	Attempts      int        `json:"attempts,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	RetryingSince *time.Time `json:"retrying_since,omitempty"`
+	LastDelivery  *time.Time `json:"last_delivery,omitempty"`
+	// DeadLettered counts records moved to the dead-letter topic since
+	// the server started.
+	DeadLettered int `json:"dead_lettered"`
+}
+
+// Subscriptions lists the server's webhook subscriptions.
+func (c *Client) Subscriptions(ctx context.Context) ([]Subscription, error) {
+	var res struct {
+		Subscriptions []Subscription `json:"subscriptions"`
+	}
+	err := c.do(ctx, http.MethodGet, "/subscriptions", nil, nil, &res)
+	return res.Subscriptions, err
+}
+
+// Subscription returns one subscription.
+func (c *Client) Subscription(ctx context.Context, id string) (Subscription, error) {
+	var s Subscription
+	err := c.do(ctx, http.MethodGet, "/subscriptions/"+url.PathEscape(id), nil, nil, &s)
+	return s, err
+}
+
+// Subscribe creates a subscription.
+func (c *Client) Subscribe(ctx context.Context, req NewSubscription) (Subscription, error) {
+	var s Subscription
+	err := c.do(ctx, http.MethodPost, "/subscriptions", nil, req, &s)
+	return s, err
+}
+
+// Unsubscribe stops and deletes a subscription.
+func (c *Client) Unsubscribe(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/subscriptions/"+url.PathEscape(id), nil, nil, nil)
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// TailMode selects how Tail follows the log.
+type TailMode int
+
+const (
+	// TailStream follows the server's event stream (/stream).
+	TailStream TailMode = iota
+	// TailLongPoll repeatedly long-polls /records.
+	TailLongPoll
+	// TailFrames long-polls /records like TailLongPoll, with records
+	// sent as frames; it suits consumers catching up on a long backlog.
+	TailFrames
+)
+
+// TailOptions configures Tail.
+type TailOptions struct {
+	Mode TailMode
+	// BatchSize is the most records fetched per long-poll request.
+	BatchSize int
+	// Wait is how long each long-poll request waits for new records.
+	Wait time.Duration
+}
+
+func (o *TailOptions) setDefaults() {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 500
+	}
+	if o.Wait <= 0 {
+		o.Wait = 30 * time.Second
+	}
+}
+
+// Tail returns an iterator over the records from offset from onwards. It
+// follows the log as records are appended and ends only when ctx is done
+// or the loop breaks. Lost connections are retried with backoff
+// indefinitely; an error response from the server, such as the offset
+// having been deleted, or an error event ending the stream is yielded as
+// an *Error and ends the iteration.
+//
+//	for rec, err := range c.Tail(ctx, 0, client.TailOptions{}) {
+//		if err != nil { ... }
+//	}
+func (c *Client) Tail(ctx context.Context, from int, opts TailOptions) iter.Seq2[commitlog.Record, error] {
+	opts.setDefaults()
+	return func(yield func(commitlog.Record, error) bool) {
+		next := from
+		failures := 0
+		for ctx.Err() == nil {
+			var err error
+			if opts.Mode == TailLongPoll || opts.Mode == TailFrames {
+				err = c.pollOnce(ctx, &next, opts, yield)
+			} else {
+				err = c.streamOnce(ctx, &next, yield)
+			}
+			if errors.Is(err, errStop) || ctx.Err() != nil {
+				return
+			}
+			var e *Error
+			if errors.As(err, &e) && e.StatusCode < 500 {
+				yield(commitlog.Record{}, err)
+				return
+			}
+			if err == nil {
+				failures = 0
+				continue
+			}
+			failures++
+			sleep(ctx, c.retry.backoff(min(failures, 30)))
+		}
+	}
+}
+
+// errStop reports that the consumer broke out of the loop.
+var errStop = errors.New("stop")
+
+func (c *Client) pollOnce(ctx context.Context, next *int, opts TailOptions, yield func(commitlog.Record, error) bool) error {
+	q := c.scope(url.Values{
+		"from": {strconv.Itoa(*next)},
+		"max":  {strconv.Itoa(opts.BatchSize)},
+		"wait": {opts.Wait.String()},
+	}, true)
+	var res framedRecords
+	// One attempt: Tail does its own retrying.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/records?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if opts.Mode == TailFrames {
+		req.Header.Set("Accept", commitlog.FramesContentType)
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	if err := decodeResponse(resp, &res); err != nil {
+		return err
+	}
+	for _, rec := range res.Records {
+		*next = rec.Offset + 1
+		if !yield(rec, nil) {
+			return errStop
+		}
+	}
+	return nil
+}
+
+// streamOnce reads server-sent events until the stream ends.
+func (c *Client) streamOnce(ctx context.Context, next *int, yield func(commitlog.Record, error) bool) error {
+	q := c.scope(url.Values{"offset": {strconv.Itoa(*next)}}, true)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/stream?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	var event, data string
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			// Blank line: dispatch the event.
+			if event == "error" {
+				return readEventError(data)
+			}
+			if data != "" {
+				var rec commitlog.Record
+				if err := json.Unmarshal([]byte(data), &rec); err != nil {
+					return fmt.Errorf("decoding event: %w", err)
+				}
+				*next = rec.Offset + 1
+				if !yield(rec, nil) {
+					return errStop
+				}
+			}
+			event, data = "", ""
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data += value
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return errors.New("stream closed by server")
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/client"
+)
+
+// runTopics lists, describes, creates or deletes topics.
+func runTopics(ctx context.Context, args []string) error {
+	c := newCommand("topics", scopeServer)
+	partitions := c.fs.Int("partitions", 1, "partitions for a new topic")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	args = c.args
+	if len(args) == 0 {
+		return c.usageError("usage: logctl topics list | describe NAME | create NAME | delete NAME")
+	}
+	cl := c.client()
+
+	switch op := args[0]; {
+	case op == "list" && len(args) == 1:
+		topics, err := cl.Topics(ctx)
+		if err != nil {
+			return err
+		}
+		c.printTopics(topics...)
+	case op == "describe" && len(args) == 2:
+		t, err := cl.DescribeTopic(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		c.printTopics(t)
+	case op == "create" && len(args) == 2:
+		t, err := cl.CreateTopic(ctx, args[1], *partitions)
+		if err != nil {
+			return err
+		}
+		c.printTopics(t)
+	case op == "delete" && len(args) == 2:
+		if err := cl.DeleteTopic(ctx, args[1]); err != nil {
+			return err
+		}
+		if !c.json {
+			fmt.Fprintf(c.out, "deleted topic %s\n", args[1])
+		}
+	default:
+		return c.usageError("usage: logctl topics list | describe NAME | create NAME | delete NAME")
+	}
+	return nil
+}
+
+// printTopics prints one row per partition.
+func (c *command) printTopics(topics ...client.TopicInfo) {
+	if c.json {
+		for _, t := range topics {
+			c.emit(t)
+		}
+		return
+	}
+	tw := c.table()
+	defer tw.Flush()
+	fmt.Fprintln(tw, "TOPIC\tPARTITION\tSTART\tEND")
+	for _, t := range topics {
+		for _, p := range t.Partitions {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", t.Name, p.Partition, p.StartOffset, p.EndOffset)
+		}
+	}
+}
+
+// runGroups lists consumer groups, describes one or shows its lag.
+func runGroups(ctx context.Context, args []string) error {
+	c := newCommand("groups", scopeServer)
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	args = c.args
+	cl := c.client()
+
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		groups, err := cl.Groups(ctx)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return c.emit(groups)
+		}
+		for _, g := range groups {
+			fmt.Fprintln(c.out, g)
+		}
+	case len(args) == 2 && args[0] == "describe":
+		offsets, err := cl.DescribeGroup(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		if c.json {
+			for _, o := range offsets {
+				c.emit(o)
+			}
+			return nil
+		}
+		tw := c.table()
+		defer tw.Flush()
+		fmt.Fprintln(tw, "TOPIC\tPARTITION\tCOMMITTED\tEND\tCOMMITTED AT\tMETADATA")
+		for _, o := range offsets {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\n", o.Topic, o.Partition, o.Offset, o.EndOffset,
+				o.CommittedAt.Local().Format(time.DateTime), strconv.Quote(o.Metadata))
+		}
+	case len(args) == 2 && args[0] == "lag":
+		lags, err := cl.GroupLag(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		if c.json {
+			for _, l := range lags {
+				c.emit(l)
+			}
+			return nil
+		}
+		tw := c.table()
+		defer tw.Flush()
+		fmt.Fprintln(tw, "TOPIC\tPARTITION\tCOMMITTED\tEND\tLAG\tLAG TIME")
+		for _, l := range lags {
+			age := time.Duration(l.LagSeconds * float64(time.Second)).Round(time.Second)
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\n", l.Topic, l.Partition, l.CommittedOffset, l.EndOffset, l.Lag, age)
+		}
+	default:
+		return c.usageError("usage: logctl groups list | describe GROUP | lag GROUP")
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// errProblems reports that fsck found damage it did not repair.
+var errProblems = errors.New("problems found")
+
+// runFsck checks the segments of a log directory, or of every partition
+// under a server's data directory, and optionally repairs them. The
+// server must be stopped.
+func runFsck(ctx context.Context, args []string) error {
+	c := newCommand("fsck", scopeOffline)
+	rebuild := c.fs.Bool("rebuild-index", false, "rewrite index files that disagree with their store")
+	truncate := c.fs.Bool("truncate", false, "cut each log at its first bad record, losing it and everything after")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if len(c.args) != 1 {
+		return c.usageError("usage: logctl fsck [-rebuild-index] [-truncate] DIR")
+	}
+	dirs, err := logDirs(c.args[0])
+	if err != nil {
+		return err
+	}
+	opts := commitlog.CheckOptions{RebuildIndex: *rebuild, Truncate: *truncate}
+
+	var reports []*commitlog.CheckReport
+	for _, dir := range dirs {
+		report, err := commitlog.Check(dir, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+		reports = append(reports, report)
+	}
+	if c.json {
+		for _, r := range reports {
+			c.emit(checkJSON(r))
+		}
+	} else {
+		c.printChecks(reports, *truncate)
+	}
+
+	unrepaired := 0
+	for _, r := range reports {
+		for _, s := range r.Segments {
+			if !s.OK() && s.Repair == "" {
+				unrepaired++
+			}
+		}
+	}
+	if unrepaired > 0 {
+		return fmt.Errorf("%w: %d unrepaired segment(s); see -rebuild-index and -truncate", errProblems, unrepaired)
+	}
+	return nil
+}
+
+// printChecks prints one row per segment and a summary line per log.
+func (c *command) printChecks(reports []*commitlog.CheckReport, truncated bool) {
+	tw := c.table()
+	fmt.Fprintln(tw, "DIR\tBASE\tRECORDS\tFIRST BAD\tPROBLEM\tREPAIR")
+	for _, r := range reports {
+		for _, s := range r.Segments {
+			bad := "-"
+			if s.BadOffset >= 0 {
+				bad = fmt.Sprint(s.BadOffset)
+			}
+			problem := strings.Join(segmentProblems(s), "; ")
+			if problem == "" {
+				problem = "ok"
+			}
+			repair := s.Repair
+			if repair == "" {
+				repair = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\n", r.Dir, s.Base, s.Records, bad, problem, repair)
+		}
+	}
+	tw.Flush()
+	for _, r := range reports {
+		switch {
+		case r.FirstBadOffset >= 0 && truncated:
+			fmt.Fprintf(c.out, "%s: truncated at offset %d\n", r.Dir, r.FirstBadOffset)
+		case r.FirstBadOffset >= 0:
+			fmt.Fprintf(c.out, "%s: records from offset %d cannot be read\n", r.Dir, r.FirstBadOffset)
+		}
+	}
+}
+
+// segmentProblems describes what is wrong with a segment.
+func segmentProblems(s commitlog.SegmentCheck) []string {
+	var problems []string
+	if s.StoreErr != nil {
+		msg := s.StoreErr.Error()
+		if errors.Is(s.StoreErr, io.ErrUnexpectedEOF) {
+			msg = strings.Replace(msg, io.ErrUnexpectedEOF.Error(), "torn write", 1)
+		}
+		problems = append(problems, "store "+msg)
+	}
+	if s.IndexErr != nil {
+		problems = append(problems, s.IndexErr.Error())
+	}
+	if s.GapErr != nil {
+		problems = append(problems, s.GapErr.Error())
+	}
+	return problems
+}
+
+type checkOutput struct {
+	Dir            string          `json:"dir"`
+	OK             bool            `json:"ok"`
+	FirstBadOffset *int            `json:"first_bad_offset,omitempty"`
+	Segments       []segmentOutput `json:"segments"`
+}
+
+type segmentOutput struct {
+	Base      int      `json:"base"`
+	Records   int      `json:"records"`
+	BadOffset *int     `json:"bad_offset,omitempty"`
+	Problems  []string `json:"problems,omitempty"`
+	Repair    string   `json:"repair,omitempty"`
+}
+
+func checkJSON(r *commitlog.CheckReport) checkOutput {
+	out := checkOutput{Dir: r.Dir, OK: r.OK(), Segments: []segmentOutput{}}
+	if r.FirstBadOffset >= 0 {
+		out.FirstBadOffset = &r.FirstBadOffset
+	}
+	for _, s := range r.Segments {
+		so := segmentOutput{Base: s.Base, Records: s.Records, Problems: segmentProblems(s), Repair: s.Repair}
+		if s.BadOffset >= 0 {
+			so.BadOffset = &s.BadOffset
+		}
+		out.Segments = append(out.Segments, so)
+	}
+	return out
+}
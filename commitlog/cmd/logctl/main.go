@@ -0,0 +1,180 @@
+// Command logctl produces, consumes and inspects commit logs.
+//
+//	logctl produce [-topic T] [-partition P] [-key K] [-file F] [-delay D | -at TIME] [value...]
+//	logctl consume [-topic T] [-partition P] [-from N|start|end] [-follow]
+//	logctl records [-topic T] [-partition P] -range A:B
+//	logctl topics list | describe NAME | create NAME [-partitions N] | delete NAME
+//	logctl groups list | describe GROUP | lag GROUP
+//	logctl subscriptions list | describe ID | create URL [-topic T] [-from N] | delete ID
+//	logctl search [-topic T] [-max N] [-skip N] WORD...
+//	logctl segments inspect [-records] [-index] DIR
+//	logctl fsck [-rebuild-index] [-truncate] DIR
+//
+// Every subcommand but segments and fsck talks to the server named by
+// -server, or $LOGCTL_SERVER, or http://localhost:8080. segments and fsck
+// read a data directory directly; fsck must only be run while the server
+// is stopped. With -json
+// output is one JSON value per line instead of a table.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/client"
+)
+
+const usage = `usage: logctl <command> [flags] [args]
+
+commands:
+  produce        append values from arguments, a file or stdin
+  consume        print records from an offset, optionally following the log
+  records        print an offset range of records
+  topics         list, describe, create or delete topics
+  groups         list or describe consumer groups, or show their lag
+  subscriptions  list, describe, create or delete webhook subscriptions
+  search         find records by the words in their keys and values
+  segments       inspect segment and index files offline
+  fsck           verify segment files offline and repair damaged ones
+
+Run "logctl <command> -h" for a command's flags.
+`
+
+// errUsage reports bad arguments; the command has already said why.
+var errUsage = errors.New("usage")
+
+// scope is what a subcommand operates on, which decides its shared flags.
+type scope int
+
+const (
+	scopeOffline   scope = iota // files on disk: no shared flags but -json
+	scopeServer                 // the server: -server
+	scopePartition              // one partition: -server, -topic and -partition
+)
+
+// command holds the flags shared by every subcommand.
+type command struct {
+	fs        *flag.FlagSet
+	args      []string // positional arguments, wherever they appeared
+	server    string
+	topic     string
+	partition int
+	json      bool
+	out       io.Writer
+}
+
+// newCommand returns a command whose FlagSet has the flags shared by
+// subcommands with scope s.
+func newCommand(name string, s scope) *command {
+	c := &command{fs: flag.NewFlagSet("logctl "+name, flag.ContinueOnError), out: os.Stdout}
+	c.fs.BoolVar(&c.json, "json", false, "print JSON instead of a table")
+	if s >= scopeServer {
+		addr := os.Getenv("LOGCTL_SERVER")
+		if addr == "" {
+			addr = "http://localhost:8080"
+		}
+		c.fs.StringVar(&c.server, "server", addr, "commit log server URL; $LOGCTL_SERVER sets the default")
+	}
+	if s >= scopePartition {
+		c.fs.StringVar(&c.topic, "topic", "", "topic (default: the server's default topic)")
+		c.fs.IntVar(&c.partition, "partition", client.AnyPartition, "partition (default: by key when producing, 0 otherwise)")
+	}
+	return c
+}
+
+// parse parses flags and collects positional arguments into c.args, so
+// flags may come before or after them ("topics create t -partitions 3").
+func (c *command) parse(args []string) error {
+	for {
+		if err := c.fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return err
+			}
+			return errUsage
+		}
+		args = c.fs.Args()
+		if len(args) == 0 {
+			return nil
+		}
+		c.args = append(c.args, args[0])
+		args = args[1:]
+	}
+}
+
+func (c *command) client() *client.Client {
+	cl := client.New(c.server)
+	if c.topic != "" || c.partition != client.AnyPartition {
+		cl = cl.Topic(c.topic, c.partition)
+	}
+	return cl
+}
+
+// readPartition is the partition a read command uses.
+func (c *command) readPartition() int {
+	return max(c.partition, 0)
+}
+
+// usageError prints msg and the command's flags.
+func (c *command) usageError(format string, args ...any) error {
+	fmt.Fprintf(c.fs.Output(), format+"\n", args...)
+	c.fs.Usage()
+	return errUsage
+}
+
+// emit writes v as a line of JSON.
+func (c *command) emit(v any) error {
+	return json.NewEncoder(c.out).Encode(v)
+}
+
+// table returns a tabwriter for human-readable output; flush it when done.
+func (c *command) table() *tabwriter.Writer {
+	return tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+}
+
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"produce":       runProduce,
+	"consume":       runConsume,
+	"records":       runRecords,
+	"topics":        runTopics,
+	"groups":        runGroups,
+	"subscriptions": runSubscriptions,
+	"search":        runSearch,
+	"segments":      runSegments,
+	"fsck":          runFsck,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] != "help" && os.Args[1] != "-h" && os.Args[1] != "--help" {
+			fmt.Fprintf(os.Stderr, "logctl: unknown command %q\n\n", os.Args[1])
+		}
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := run(ctx, os.Args[2:])
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	case ctx.Err() != nil:
+		// Interrupted, e.g. ending consume -follow.
+	default:
+		fmt.Fprintln(os.Stderr, "logctl:", err)
+		os.Exit(1)
+	}
+}
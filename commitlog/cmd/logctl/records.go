@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/client"
+)
+
+// produceBatch is how many values produce sends per request.
+const produceBatch = 500
+
+// runProduce appends its arguments, or else the lines of -file or stdin,
+// as record values and prints where each landed. With -delay or -at the
+// records are held back, and it prints when they will be delivered.
+func runProduce(ctx context.Context, args []string) error {
+	c := newCommand("produce", scopePartition)
+	key := c.fs.String("key", "", "key for every record")
+	file := c.fs.String("file", "", "read values from this file, one per line (- for stdin)")
+	delay := c.fs.Duration("delay", 0, "hold the records back for this long before consumers see them")
+	at := c.fs.String("at", "", "hold the records back until this RFC 3339 time")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	values := c.args
+	if len(values) > 0 && *file != "" {
+		return c.usageError("give values as arguments or with -file, not both")
+	}
+	var deliverAt time.Time
+	switch {
+	case *delay != 0 && *at != "":
+		return c.usageError("give -delay or -at, not both")
+	case *delay < 0:
+		return c.usageError("invalid -delay %s", *delay)
+	case *delay > 0:
+		deliverAt = time.Now().Add(*delay)
+	case *at != "":
+		var err error
+		if deliverAt, err = time.Parse(time.RFC3339, *at); err != nil {
+			return c.usageError("invalid -at %q: want an RFC 3339 time", *at)
+		}
+	}
+
+	cl := c.client()
+	var tw *tabwriter.Writer
+	if !c.json {
+		tw = c.table()
+		if deliverAt.IsZero() {
+			fmt.Fprintln(tw, "PARTITION\tOFFSET")
+		} else {
+			fmt.Fprintln(tw, "PARTITION\tDELIVER_AT")
+		}
+		defer tw.Flush()
+	}
+	schedule := func(batch []commitlog.Record) error {
+		partitions, err := cl.ProduceBatchAt(ctx, batch, deliverAt)
+		if err != nil {
+			return err
+		}
+		for _, p := range partitions {
+			if c.json {
+				c.emit(struct {
+					Partition int       `json:"partition"`
+					DeliverAt time.Time `json:"deliver_at"`
+				}{p, deliverAt})
+			} else {
+				fmt.Fprintf(tw, "%d\t%s\n", p, deliverAt.Format(time.RFC3339))
+			}
+		}
+		return nil
+	}
+	send := func(batch []commitlog.Record) error {
+		if !deliverAt.IsZero() {
+			return schedule(batch)
+		}
+		partitions, offsets, err := cl.ProduceBatchPartitioned(ctx, batch)
+		if err != nil {
+			return err
+		}
+		for i, off := range offsets {
+			p := c.readPartition()
+			if i < len(partitions) {
+				p = partitions[i]
+			}
+			if c.json {
+				c.emit(struct {
+					Partition int `json:"partition"`
+					Offset    int `json:"offset"`
+				}{p, off})
+			} else {
+				fmt.Fprintf(tw, "%d\t%d\n", p, off)
+			}
+		}
+		return nil
+	}
+
+	var batch []commitlog.Record
+	add := func(v string) error {
+		batch = append(batch, commitlog.Record{Key: *key, Value: v})
+		if len(batch) < produceBatch {
+			return nil
+		}
+		err := send(batch)
+		batch = batch[:0]
+		return err
+	}
+
+	if len(values) > 0 {
+		for _, v := range values {
+			if err := add(v); err != nil {
+				return err
+			}
+		}
+	} else {
+		var in io.Reader = os.Stdin
+		if *file != "" && *file != "-" {
+			f, err := os.Open(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		sc := bufio.NewScanner(in)
+		sc.Buffer(make([]byte, 64<<10), 16<<20)
+		for sc.Scan() {
+			if err := add(sc.Text()); err != nil {
+				return err
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return err
+		}
+	}
+	if len(batch) > 0 {
+		return send(batch)
+	}
+	return nil
+}
+
+// runConsume prints records from -from up to the end of the partition,
+// or with -follow keeps printing new records until interrupted.
+func runConsume(ctx context.Context, args []string) error {
+	c := newCommand("consume", scopePartition)
+	from := c.fs.String("from", "start", "first offset: a number, start or end")
+	follow := c.fs.Bool("follow", false, "keep printing records as they are appended")
+	max := c.fs.Int("max", 0, "stop after this many records (0 for no limit)")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if len(c.args) > 0 {
+		return c.usageError("unexpected arguments: %s", strings.Join(c.args, " "))
+	}
+
+	cl := c.client()
+	part, err := c.partitionInfo(ctx, cl)
+	if err != nil {
+		return err
+	}
+	var offset int
+	switch *from {
+	case "start":
+		offset = part.StartOffset
+	case "end":
+		offset = part.EndOffset
+	default:
+		if offset, err = strconv.Atoi(*from); err != nil {
+			return c.usageError("invalid -from %q", *from)
+		}
+	}
+
+	p := c.newPrinter()
+	defer p.flush()
+	n := 0
+	if *follow {
+		for rec, err := range cl.Tail(ctx, offset, client.TailOptions{}) {
+			if err != nil {
+				return err
+			}
+			p.print(rec)
+			p.flush()
+			if n++; n == *max {
+				return nil
+			}
+		}
+		return ctx.Err()
+	}
+	for offset < part.EndOffset {
+		recs, err := cl.RecordFrames(ctx, offset, part.EndOffset-offset, 0, 0)
+		if err != nil {
+			return err
+		}
+		if len(recs) == 0 {
+			break
+		}
+		for _, rec := range recs {
+			p.print(rec)
+			if n++; n == *max {
+				return nil
+			}
+		}
+		offset = recs[len(recs)-1].Offset + 1
+	}
+	return nil
+}
+
+// runRecords prints the records in -range A:B, from A up to but not
+// including B. Either end may be left out to mean the start or end of
+// the partition.
+func runRecords(ctx context.Context, args []string) error {
+	c := newCommand("records", scopePartition)
+	rng := c.fs.String("range", ":", "offsets A:B to print, B exclusive")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	a, b, ok := strings.Cut(*rng, ":")
+	if !ok {
+		return c.usageError("invalid -range %q: want A:B", *rng)
+	}
+
+	cl := c.client()
+	part, err := c.partitionInfo(ctx, cl)
+	if err != nil {
+		return err
+	}
+	from, to := part.StartOffset, part.EndOffset
+	if a != "" {
+		if from, err = strconv.Atoi(a); err != nil {
+			return c.usageError("invalid -range %q: want A:B", *rng)
+		}
+	}
+	if b != "" {
+		if to, err = strconv.Atoi(b); err != nil {
+			return c.usageError("invalid -range %q: want A:B", *rng)
+		}
+	}
+
+	p := c.newPrinter()
+	defer p.flush()
+	for from < to {
+		recs, err := cl.RecordFrames(ctx, from, to-from, 0, 0)
+		if err != nil {
+			return err
+		}
+		if len(recs) == 0 {
+			break
+		}
+		for _, rec := range recs {
+			if rec.Offset >= to {
+				return nil
+			}
+			p.print(rec)
+		}
+		from = recs[len(recs)-1].Offset + 1
+	}
+	return nil
+}
+
+// partitionInfo returns the offset range of the partition c reads.
+func (c *command) partitionInfo(ctx context.Context, cl *client.Client) (client.PartitionInfo, error) {
+	name := c.topic
+	if name == "" {
+		name = "default"
+	}
+	t, err := cl.DescribeTopic(ctx, name)
+	if err != nil {
+		return client.PartitionInfo{}, err
+	}
+	p := c.readPartition()
+	if p >= len(t.Partitions) {
+		return client.PartitionInfo{}, fmt.Errorf("topic %s has no partition %d", name, p)
+	}
+	return t.Partitions[p], nil
+}
+
+// recordPrinter prints records as JSON lines or table rows.
+type recordPrinter struct {
+	c  *command
+	tw *tabwriter.Writer
+}
+
+func (c *command) newPrinter() *recordPrinter {
+	p := &recordPrinter{c: c}
+	if !c.json {
+		p.tw = c.table()
+		fmt.Fprintln(p.tw, "OFFSET\tTIMESTAMP\tKEY\tVALUE")
+	}
+	return p
+}
+
+func (p *recordPrinter) print(rec commitlog.Record) {
+	if p.tw == nil {
+		p.c.emit(rec)
+		return
+	}
+	ts := "-"
+	if !rec.Timestamp.IsZero() {
+		ts = rec.Timestamp.Format(time.RFC3339Nano)
+	}
+	key := rec.Key
+	if key == "" {
+		key = "-"
+	}
+	fmt.Fprintf(p.tw, "%d\t%s\t%s\t%s\n", rec.Offset, ts, key, strconv.Quote(rec.Value))
+}
+
+func (p *recordPrinter) flush() {
+	if p.tw != nil {
+		p.tw.Flush()
+	}
+}
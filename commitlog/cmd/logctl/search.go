@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runSearch prints the records of a topic matching a query, best first.
+func runSearch(ctx context.Context, args []string) error {
+	c := newCommand("search", scopeServer)
+	c.fs.StringVar(&c.topic, "topic", "", "topic (default: the server's default topic)")
+	max := c.fs.Int("max", 20, "hits to print")
+	skip := c.fs.Int("skip", 0, "hits to skip, for the next page")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if len(c.args) == 0 {
+		return c.usageError("usage: logctl search [-topic T] [-max N] [-skip N] WORD...")
+	}
+	res, err := c.client().Search(ctx, strings.Join(c.args, " "), *skip, *max)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		for _, h := range res.Hits {
+			c.emit(h)
+		}
+		return nil
+	}
+	tw := c.table()
+	fmt.Fprintln(tw, "SCORE\tPARTITION\tOFFSET\tTIMESTAMP\tKEY\tVALUE")
+	for _, h := range res.Hits {
+		key := h.Record.Key
+		if key == "" {
+			key = "-"
+		}
+		fmt.Fprintf(tw, "%.2f\t%d\t%d\t%s\t%s\t%s\n", h.Score, h.Partition, h.Offset,
+			h.Record.Timestamp.Format(time.RFC3339Nano), key, strconv.Quote(h.Record.Value))
+	}
+	tw.Flush()
+	if res.NextSkip != nil {
+		fmt.Fprintf(c.out, "%d of %d hits; next page: -skip %d\n", len(res.Hits), res.Total, *res.NextSkip)
+	}
+	if !res.Complete {
+		fmt.Fprintln(c.out, "the index is still catching up; some hits may be missing")
+	}
+	return nil
+}
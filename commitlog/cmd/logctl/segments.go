@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// segmentReport summarizes one segment's files.
+type segmentReport struct {
+	Dir        string `json:"dir"`
+	Base       int    `json:"base"`
+	StoreBytes int64  `json:"store_bytes"`
+	IndexBytes int64  `json:"index_bytes"`
+	Records    int    `json:"records"`
+	// IndexEntries is the number of positions in the index file, which
+	// should equal Records.
+	IndexEntries int  `json:"index_entries"`
+	FirstOffset  *int `json:"first_offset,omitempty"`
+	LastOffset   *int `json:"last_offset,omitempty"`
+	// Error describes the first unreadable frame, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// runSegments handles "segments inspect": it reads the segment files of
+// a log directory, or of every log directory under a server's data
+// directory, without the server running.
+func runSegments(ctx context.Context, args []string) error {
+	c := newCommand("segments", scopeOffline)
+	records := c.fs.Bool("records", false, "print every record with its store position")
+	index := c.fs.Bool("index", false, "print every index entry")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	args = c.args
+	if len(args) != 2 || args[0] != "inspect" {
+		return c.usageError("usage: logctl segments inspect [-records] [-index] DIR")
+	}
+	dirs, err := logDirs(args[1])
+	if err != nil {
+		return err
+	}
+
+	var reports []segmentReport
+	for _, dir := range dirs {
+		files, err := commitlog.SegmentFiles(dir)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			r, err := c.inspectSegment(dir, f, *records, *index)
+			if err != nil {
+				return err
+			}
+			reports = append(reports, r)
+		}
+	}
+	if c.json {
+		for _, r := range reports {
+			c.emit(r)
+		}
+		return nil
+	}
+	tw := c.table()
+	defer tw.Flush()
+	fmt.Fprintln(tw, "DIR\tBASE\tRECORDS\tOFFSETS\tSTORE BYTES\tINDEX ENTRIES\tSTATUS")
+	for _, r := range reports {
+		offsets := "-"
+		if r.FirstOffset != nil {
+			offsets = fmt.Sprintf("%d-%d", *r.FirstOffset, *r.LastOffset)
+		}
+		status := "ok"
+		switch {
+		case r.Error != "":
+			status = r.Error
+		case r.IndexEntries != r.Records:
+			status = "index has " + strconv.Itoa(r.IndexEntries) + " entries"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%d\t%d\t%s\n", r.Dir, r.Base, r.Records, offsets, r.StoreBytes, r.IndexEntries, status)
+	}
+	return nil
+}
+
+// logDirs returns dir if it holds segments, and otherwise each
+// subdirectory that does, as in a server's data directory.
+func logDirs(dir string) ([]string, error) {
+	files, err := commitlog.SegmentFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		return []string{dir}, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		sub := filepath.Join(dir, e.Name())
+		if files, err := commitlog.SegmentFiles(sub); err == nil && len(files) > 0 {
+			dirs = append(dirs, sub)
+		}
+	}
+	sort.Strings(dirs)
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no segments in %s", dir)
+	}
+	return dirs, nil
+}
+
+// inspectSegment reads one segment, printing its records and index
+// entries as asked.
+func (c *command) inspectSegment(dir string, f commitlog.SegmentFile, records, index bool) (segmentReport, error) {
+	r := segmentReport{Dir: dir, Base: f.Base, StoreBytes: f.StoreBytes, IndexBytes: f.IndexBytes}
+	if index {
+		positions, err := commitlog.ReadIndexFile(f.IndexPath)
+		if err != nil && !os.IsNotExist(err) {
+			return r, err
+		}
+		r.IndexEntries = len(positions)
+		for i, pos := range positions {
+			if c.json {
+				c.emit(struct {
+					Segment  string `json:"segment"`
+					Offset   int    `json:"offset"`
+					Position int64  `json:"position"`
+				}{f.IndexPath, f.Base + i, pos})
+			} else {
+				fmt.Fprintf(c.out, "%s\toffset %d\tposition %d\n", filepath.Base(f.IndexPath), f.Base+i, pos)
+			}
+		}
+	} else {
+		r.IndexEntries = int(f.IndexBytes / 8)
+	}
+
+	err := commitlog.ScanStore(f.StorePath, func(pos int64, rec commitlog.Record) error {
+		if r.FirstOffset == nil {
+			first := rec.Offset
+			r.FirstOffset = &first
+		}
+		last := rec.Offset
+		r.LastOffset = &last
+		r.Records++
+		if records {
+			if c.json {
+				return c.emit(struct {
+					Segment  string `json:"segment"`
+					Position int64  `json:"position"`
+					commitlog.Record
+				}{f.StorePath, pos, rec})
+			}
+			fmt.Fprintf(c.out, "%s\tposition %d\toffset %d\tkey %q\tvalue %q\n",
+				filepath.Base(f.StorePath), pos, rec.Offset, rec.Key, rec.Value)
+		}
+		return nil
+	})
+	if _, ok := err.(*commitlog.StoreError); ok {
+		r.Error = err.Error()
+		err = nil
+	}
+	return r, err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/client"
+)
+
+// runSubscriptions lists, describes, creates or deletes webhook
+// subscriptions.
+func runSubscriptions(ctx context.Context, args []string) error {
+	c := newCommand("subscriptions", scopeServer)
+	var req client.NewSubscription
+	c.fs.StringVar(&req.Topic, "topic", "", "topic for a new subscription (default: the server's default topic)")
+	from := c.fs.String("from", "", "offset a new subscription starts at in every partition (default: new records only)")
+	c.fs.IntVar(&req.BatchSize, "batch", 0, "most records per delivery (default: the server's)")
+	c.fs.IntVar(&req.MaxAttempts, "max-attempts", 0, "delivery attempts before records are dead-lettered (default: the server's)")
+	c.fs.StringVar(&req.DeadLetterTopic, "dead-letter", "", "dead-letter topic (default: TOPIC.dead-letter)")
+	c.fs.StringVar(&req.Filter.Key, "key", "", "deliver only records with this key")
+	c.fs.StringVar(&req.Filter.KeyPrefix, "key-prefix", "", "deliver only records whose key has this prefix")
+	c.fs.StringVar(&req.Filter.ValueContains, "value-contains", "", "deliver only records whose value contains this")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	const usage = "usage: logctl subscriptions list | describe ID | create URL | delete ID"
+	args = c.args
+	if len(args) == 0 {
+		return c.usageError(usage)
+	}
+	cl := c.client()
+
+	switch op := args[0]; {
+	case op == "list" && len(args) == 1:
+		subs, err := cl.Subscriptions(ctx)
+		if err != nil {
+			return err
+		}
+		c.printSubscriptions(subs...)
+	case op == "describe" && len(args) == 2:
+		s, err := cl.Subscription(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		c.printSubscriptions(s)
+	case op == "create" && len(args) == 2:
+		req.URL = args[1]
+		if *from != "" {
+			off, err := strconv.Atoi(*from)
+			if err != nil || off < 0 {
+				return c.usageError("invalid -from %q", *from)
+			}
+			req.StartOffset = &off
+		}
+		s, err := cl.Subscribe(ctx, req)
+		if err != nil {
+			return err
+		}
+		c.printSubscriptions(s)
+	case op == "delete" && len(args) == 2:
+		if err := cl.Unsubscribe(ctx, args[1]); err != nil {
+			return err
+		}
+		if !c.json {
+			fmt.Fprintf(c.out, "deleted subscription %s\n", args[1])
+		}
+	default:
+		return c.usageError(usage)
+	}
+	return nil
+}
+
+// printSubscriptions prints one row per subscribed partition.
+func (c *command) printSubscriptions(subs ...client.Subscription) {
+	if c.json {
+		for _, s := range subs {
+			c.emit(s)
+		}
+		return
+	}
+	tw := c.table()
+	defer tw.Flush()
+	fmt.Fprintln(tw, "ID\tTOPIC\tPARTITION\tACKED\tEND\tDEAD-LETTERED\tLAST DELIVERY\tURL\tERROR")
+	for _, s := range subs {
+		for _, p := range s.Partitions {
+			last := "-"
+			if p.LastDelivery != nil {
+				last = p.LastDelivery.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n", s.ID, s.Topic, p.Partition,
+				p.AckedOffset, p.EndOffset, p.DeadLettered, last, s.URL, p.LastError)
+		}
+	}
+}
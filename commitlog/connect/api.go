@@ -0,0 +1,104 @@
+package connect
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Handler serves a REST API for managing r's connectors:
+//
+//	GET    /connectors                 list connectors and their status
+//	POST   /connectors                 create a connector from a Config
+//	GET    /connectors/{name}          describe one
+//	PUT    /connectors/{name}          replace its config and restart it
+//	DELETE /connectors/{name}          stop and delete it
+//	POST   /connectors/{name}/pause    stop it until resumed
+//	POST   /connectors/{name}/resume
+//	POST   /connectors/{name}/restart  restart it, clearing a failure
+//	GET    /connector-types            list the source and sink types
+//
+// Errors use the commit log server's envelope,
+// {"error": {"code": "...", "message": "..."}}.
+func (r *Runtime) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /connectors", func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, http.StatusOK, map[string][]Status{"connectors": r.List()})
+	})
+	mux.HandleFunc("POST /connectors", func(w http.ResponseWriter, req *http.Request) {
+		var cfg Config
+		if err := json.NewDecoder(req.Body).Decode(&cfg); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		respond(w, http.StatusCreated)(r.Create(cfg))
+	})
+	mux.HandleFunc("GET /connectors/{name}", func(w http.ResponseWriter, req *http.Request) {
+		respond(w, http.StatusOK)(r.Status(req.PathValue("name")))
+	})
+	mux.HandleFunc("PUT /connectors/{name}", func(w http.ResponseWriter, req *http.Request) {
+		var cfg Config
+		if err := json.NewDecoder(req.Body).Decode(&cfg); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		cfg.Name = req.PathValue("name")
+		respond(w, http.StatusOK)(r.Update(cfg))
+	})
+	mux.HandleFunc("DELETE /connectors/{name}", func(w http.ResponseWriter, req *http.Request) {
+		if err := r.Delete(req.PathValue("name")); err != nil {
+			writeErr(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /connectors/{name}/pause", func(w http.ResponseWriter, req *http.Request) {
+		respond(w, http.StatusOK)(r.Pause(req.PathValue("name")))
+	})
+	mux.HandleFunc("POST /connectors/{name}/resume", func(w http.ResponseWriter, req *http.Request) {
+		respond(w, http.StatusOK)(r.Resume(req.PathValue("name")))
+	})
+	mux.HandleFunc("POST /connectors/{name}/restart", func(w http.ResponseWriter, req *http.Request) {
+		respond(w, http.StatusOK)(r.Restart(req.PathValue("name")))
+	})
+	mux.HandleFunc("GET /connector-types", func(w http.ResponseWriter, req *http.Request) {
+		sources, sinks := Types()
+		writeJSON(w, http.StatusOK, map[string][]string{"sources": sources, "sinks": sinks})
+	})
+	return mux
+}
+
+// respond returns a function writing a Status with the given code, or
+// the error.
+func respond(w http.ResponseWriter, code int) func(Status, error) {
+	return func(st Status, err error) {
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		writeJSON(w, code, st)
+	}
+}
+
+func writeErr(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeAPIError(w, http.StatusNotFound, "connector_not_found", err.Error())
+	case errors.Is(err, ErrExists):
+		writeAPIError(w, http.StatusConflict, "connector_exists", err.Error())
+	case errors.Is(err, ErrInvalidConfig):
+		writeAPIError(w, http.StatusBadRequest, "invalid_config", err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "internal", err.Error())
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]any{"error": map[string]string{"code": code, "message": message}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
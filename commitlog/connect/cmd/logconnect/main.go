@@ -0,0 +1,68 @@
+// Command logconnect runs source and sink connectors against a commit
+// log server and serves a REST API for managing them.
+//
+//	logconnect [-server URL] [-addr :8083] [-data DIR] [-config FILE]
+//
+// The connectors in -config, a JSON array of connect.Config, are created
+// or updated at startup; connectors added over the API are kept too.
+// Connector configs and source positions are saved in -data.
+//
+// For example, to archive the orders topic to rolling files:
+//
+//	[{"name": "orders-archive", "kind": "sink", "type": "rolling-file",
+//	  "topic": "orders", "settings": {"dir": "/data/archive"}}]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/client"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/connect"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "commit log server URL")
+	addr := flag.String("addr", ":8083", "address to serve the connector API on")
+	dataDir := flag.String("data", "", "directory to save connector state in (in-memory if empty)")
+	configFile := flag.String("config", "", "JSON file of connectors to create or update at startup")
+	flag.Parse()
+
+	rt, err := connect.NewRuntime(client.New(*server), *dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var cfgs []connect.Config
+		if err := json.Unmarshal(data, &cfgs); err != nil {
+			log.Fatalf("%s: %v", *configFile, err)
+		}
+		if err := rt.Apply(cfgs); err != nil {
+			log.Fatalf("%s: %v", *configFile, err)
+		}
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: rt.Handler()}
+	go func() {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	log.Printf("Connectors API running on %s", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	rt.Close()
+}
@@ -0,0 +1,218 @@
+// Package connect moves records between a commit log server and other
+// systems.
+//
+// A source connector reads records from somewhere else, such as a file,
+// and produces them to a topic. A sink connector consumes a topic and
+// writes its records somewhere else, such as the 16-assignment2 key-value
+// store. Both are at-least-once: a source's position and a sink's offsets
+// are checkpointed only after the records are safely written, so after a
+// crash some records may be written twice but none are lost.
+//
+// Connectors are described by a Config and run by a Runtime, which can
+// be managed over HTTP with its Handler. Source and sink types register
+// themselves with RegisterSource and RegisterSink; the built-in ones are
+//
+//	source file        tail a text file, one record per line
+//	source stdin       read lines from standard input
+//	source ndjson-dir  poll a directory for NDJSON files of records
+//	sink   rolling-file write NDJSON files that roll by size and age
+//	sink   commitlog    produce to a topic on another commit log server
+//	sink   kvstore      put keyed records into the 16-assignment2 store
+package connect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// Source reads records from outside the commit log.
+type Source interface {
+	// Start resumes reading after pos, a position previously returned
+	// by Poll, or from the beginning if pos is empty.
+	Start(pos string) error
+	// Poll returns the next records and the position just after them.
+	// It blocks until there are some, its position moves on without
+	// any, or ctx is done. A source with no more records returns io.EOF.
+	Poll(ctx context.Context) (recs []commitlog.Record, pos string, err error)
+	Close() error
+}
+
+// Sink writes records from the commit log elsewhere.
+type Sink interface {
+	// Write writes records consumed from a partition of topic. Once it
+	// returns nil they must survive a crash; they are then checkpointed
+	// and not written again. Write is called concurrently for different
+	// partitions but in offset order within each.
+	Write(ctx context.Context, topic string, partition int, recs []commitlog.Record) error
+	Close() error
+}
+
+// Kind says whether a connector is a source or a sink.
+type Kind string
+
+const (
+	KindSource Kind = "source"
+	KindSink   Kind = "sink"
+)
+
+// Config declares a connector.
+type Config struct {
+	// Name identifies the connector. Sinks commit their offsets as the
+	// consumer group "connect-" + Name.
+	Name string `json:"name"`
+	Kind Kind   `json:"kind"`
+	// Type is a registered source or sink type, such as "file".
+	Type string `json:"type"`
+	// Topic is produced to by a source or consumed by a sink. Sources
+	// use the server's default topic if it is empty; sinks need one.
+	Topic string `json:"topic,omitempty"`
+	// Settings configure the type; each type documents its own.
+	Settings json.RawMessage `json:"settings,omitempty"`
+	// Start is where a sink without committed offsets begins: "start"
+	// (the default) or "end" of each partition.
+	Start string `json:"start,omitempty"`
+	// BatchSize caps the records per Write; DefaultBatchSize if zero.
+	BatchSize int `json:"batch_size,omitempty"`
+}
+
+// DefaultBatchSize is the batch size of sinks that don't set one.
+const DefaultBatchSize = 500
+
+var (
+	// ErrNotFound is returned for a connector that does not exist.
+	ErrNotFound = errors.New("connect: connector not found")
+	// ErrExists is returned when creating a connector that exists.
+	ErrExists = errors.New("connect: connector already exists")
+	// ErrInvalidConfig is wrapped by errors describing a bad Config.
+	ErrInvalidConfig = errors.New("connect: invalid config")
+)
+
+var connectorName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,100}$`)
+
+// Validate checks c and that its type exists and accepts its settings.
+func (c Config) Validate() error {
+	if !connectorName.MatchString(c.Name) {
+		return fmt.Errorf("%w: names may only contain letters, digits, '.', '_' and '-'", ErrInvalidConfig)
+	}
+	if c.Start != "" && c.Start != "start" && c.Start != "end" {
+		return fmt.Errorf("%w: start must be \"start\" or \"end\"", ErrInvalidConfig)
+	}
+	if c.BatchSize < 0 {
+		return fmt.Errorf("%w: batch_size must not be negative", ErrInvalidConfig)
+	}
+	var err error
+	switch c.Kind {
+	case KindSource:
+		var s Source
+		if s, err = NewSource(c.Type, c.Settings); err == nil {
+			s.Close()
+		}
+	case KindSink:
+		if c.Topic == "" {
+			return fmt.Errorf("%w: a sink needs a topic", ErrInvalidConfig)
+		}
+		var s Sink
+		if s, err = NewSink(c.Type, c.Settings); err == nil {
+			s.Close()
+		}
+	default:
+		return fmt.Errorf("%w: kind must be %q or %q", ErrInvalidConfig, KindSource, KindSink)
+	}
+	return err
+}
+
+// SourceFactory builds a source from its JSON settings. It should only
+// check them: Validate builds and closes sources, so files are opened by
+// Start.
+type SourceFactory func(settings json.RawMessage) (Source, error)
+
+// SinkFactory builds a sink from its JSON settings. Like a SourceFactory
+// it should leave opening files and connections until they are needed.
+type SinkFactory func(settings json.RawMessage) (Sink, error)
+
+var (
+	typesMu     sync.RWMutex
+	sourceTypes = map[string]SourceFactory{}
+	sinkTypes   = map[string]SinkFactory{}
+)
+
+// RegisterSource makes a source type available. It panics if the type
+// is already registered.
+func RegisterSource(typ string, f SourceFactory) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	if _, ok := sourceTypes[typ]; ok {
+		panic("connect: source type registered twice: " + typ)
+	}
+	sourceTypes[typ] = f
+}
+
+// RegisterSink makes a sink type available. It panics if the type is
+// already registered.
+func RegisterSink(typ string, f SinkFactory) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	if _, ok := sinkTypes[typ]; ok {
+		panic("connect: sink type registered twice: " + typ)
+	}
+	sinkTypes[typ] = f
+}
+
+// NewSource builds a source of a registered type.
+func NewSource(typ string, settings json.RawMessage) (Source, error) {
+	typesMu.RLock()
+	f, ok := sourceTypes[typ]
+	typesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown source type %q", ErrInvalidConfig, typ)
+	}
+	return f(settings)
+}
+
+// NewSink builds a sink of a registered type.
+func NewSink(typ string, settings json.RawMessage) (Sink, error) {
+	typesMu.RLock()
+	f, ok := sinkTypes[typ]
+	typesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown sink type %q", ErrInvalidConfig, typ)
+	}
+	return f(settings)
+}
+
+// Types lists the registered source and sink types.
+func Types() (sources, sinks []string) {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	for t := range sourceTypes {
+		sources = append(sources, t)
+	}
+	for t := range sinkTypes {
+		sinks = append(sinks, t)
+	}
+	sort.Strings(sources)
+	sort.Strings(sinks)
+	return sources, sinks
+}
+
+// decodeSettings decodes a type's settings into v, rejecting unknown
+// fields so typos don't go unnoticed.
+func decodeSettings(typ string, settings json.RawMessage, v any) error {
+	if len(settings) == 0 {
+		settings = json.RawMessage("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(settings))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %s settings: %v", ErrInvalidConfig, typ, err)
+	}
+	return nil
+}
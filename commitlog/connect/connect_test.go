@@ -0,0 +1,183 @@
+package connect_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/connect"
+)
+
+func settings(t *testing.T, v any) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// poll polls src once, failing the test if it blocks for long.
+func poll(t *testing.T, src connect.Source) ([]commitlog.Record, string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	recs, pos, err := src.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recs, pos
+}
+
+func values(recs []commitlog.Record) string {
+	var vs []string
+	for _, r := range recs {
+		vs = append(vs, r.Value)
+	}
+	return strings.Join(vs, ",")
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	cfg := settings(t, map[string]string{"path": path, "key": "app", "poll_interval": "10ms"})
+	src, err := connect.NewSource("file", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "one\ntwo\nthr")
+	recs, pos := poll(t, src)
+	if values(recs) != "one,two" || recs[0].Key != "app" {
+		t.Fatalf("Poll = %+v, want one and two keyed app", recs)
+	}
+	appendFile(t, path, "ee\n")
+	if recs, _ := poll(t, src); values(recs) != "three" {
+		t.Fatalf("Poll = %+v, want the completed line", recs)
+	}
+	src.Close()
+
+	// A new source resumes from a saved position.
+	src, _ = connect.NewSource("file", cfg)
+	defer src.Close()
+	if err := src.Start(pos); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "four\n")
+	if recs, _ := poll(t, src); values(recs) != "three,four" {
+		t.Fatalf("Poll after resuming = %+v, want three and four", recs)
+	}
+
+	// A rotated file is read from the start.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "new\n")
+	if recs, _ := poll(t, src); values(recs) != "new" {
+		t.Fatalf("Poll after rotation = %+v, want new", recs)
+	}
+}
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+	cfg := settings(t, map[string]string{"dir": dir, "poll_interval": "10ms"})
+	src, err := connect.NewSource("ndjson-dir", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if err := src.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, filepath.Join(dir, "b.ndjson"), `{"key":"k3","value":"v3"}`+"\n")
+	appendFile(t, filepath.Join(dir, "a.ndjson"), `{"key":"k1","value":"v1"}`+"\n\n"+`{"value":"v2"}`+"\n")
+	appendFile(t, filepath.Join(dir, "ignored.txt"), "not json\n")
+
+	var got []commitlog.Record
+	for len(got) < 3 {
+		recs, _ := poll(t, src)
+		got = append(got, recs...)
+	}
+	if values(got) != "v1,v2,v3" || got[0].Key != "k1" {
+		t.Fatalf("records = %+v, want v1 to v3 in file name order", got)
+	}
+	// Poll once more to finish b.ndjson.
+	poll(t, src)
+	for _, name := range []string{"a.ndjson.done", "b.ndjson.done", "ignored.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRollingSink(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := connect.NewSink("rolling-file", settings(t, map[string]any{"dir": dir, "max_bytes": 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for off := 0; off < 3; off++ {
+		rec := commitlog.Record{Offset: off, Key: "k", Value: "v"}
+		if err := sink.Write(ctx, "orders", 1, []commitlog.Record{rec}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "orders-1-*.ndjson"))
+	if len(files) != 3 {
+		t.Fatalf("files = %v, want one per record with max_bytes 1", files)
+	}
+	f, err := os.Open(files[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Scan()
+	var rec commitlog.Record
+	if err := json.Unmarshal(sc.Bytes(), &rec); err != nil || rec.Offset != 2 {
+		t.Fatalf("last file holds %q, want offset 2", sc.Text())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, cfg := range []connect.Config{
+		{Name: "bad name", Kind: connect.KindSource, Type: "stdin"},
+		{Name: "x", Kind: "other", Type: "stdin"},
+		{Name: "x", Kind: connect.KindSource, Type: "nope"},
+		{Name: "x", Kind: connect.KindSink, Type: "rolling-file", Settings: json.RawMessage(`{"dir": "d"}`)},
+		{Name: "x", Kind: connect.KindSink, Topic: "t", Type: "rolling-file", Settings: json.RawMessage(`{"dri": "d"}`)},
+	} {
+		if err := cfg.Validate(); !errors.Is(err, connect.ErrInvalidConfig) {
+			t.Errorf("Validate(%+v) = %v, want ErrInvalidConfig", cfg, err)
+		}
+	}
+	ok := connect.Config{Name: "x", Kind: connect.KindSink, Topic: "t", Type: "rolling-file", Settings: json.RawMessage(`{"dir": "d"}`)}
+	if err := ok.Validate(); err != nil {
+		t.Errorf("Validate(%+v) = %v", ok, err)
+	}
+}
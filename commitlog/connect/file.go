@@ -0,0 +1,253 @@
+package connect
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+func init() {
+	RegisterSource("file", newFileSource)
+	RegisterSource("stdin", newStdinSource)
+}
+
+// defaultPollInterval is how often sources that poll look for more.
+const defaultPollInterval = 500 * time.Millisecond
+
+// maxLinesPerPoll caps the records a line-based source returns at once.
+const maxLinesPerPoll = 1000
+
+// fileSource tails a text file, producing each complete line as a
+// record value. Its position is the byte offset after the last line
+// produced. If the file shrinks it is read again from the start, and if
+// it is replaced, as by log rotation, the new file is read from the
+// start once the old one has been read to the end.
+//
+// Settings:
+//
+//	{"path": "/var/log/app.log", "key": "app", "poll_interval": "1s"}
+type fileSource struct {
+	path     string
+	key      string
+	interval time.Duration
+
+	f   *os.File
+	r   *bufio.Reader
+	off int64
+}
+
+func newFileSource(settings json.RawMessage) (Source, error) {
+	var cfg struct {
+		Path         string `json:"path"`
+		Key          string `json:"key"`
+		PollInterval string `json:"poll_interval"`
+	}
+	if err := decodeSettings("file", settings, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("%w: file settings need a path", ErrInvalidConfig)
+	}
+	interval, err := pollInterval("file", cfg.PollInterval)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSource{path: cfg.Path, key: cfg.Key, interval: interval}, nil
+}
+
+// pollInterval parses an optional poll_interval setting.
+func pollInterval(typ, s string) (time.Duration, error) {
+	if s == "" {
+		return defaultPollInterval, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: %s settings: invalid poll_interval %q", ErrInvalidConfig, typ, s)
+	}
+	return d, nil
+}
+
+func (s *fileSource) Start(pos string) error {
+	if pos != "" {
+		off, err := strconv.ParseInt(pos, 10, 64)
+		if err != nil {
+			return fmt.Errorf("connect: file source: bad position %q", pos)
+		}
+		s.off = off
+	}
+	return nil
+}
+
+func (s *fileSource) Poll(ctx context.Context) ([]commitlog.Record, string, error) {
+	for {
+		recs, err := s.readLines()
+		if err != nil {
+			return nil, "", err
+		}
+		if len(recs) > 0 {
+			return recs, strconv.FormatInt(s.off, 10), nil
+		}
+		if s.rotated() {
+			s.f.Close()
+			s.f, s.off = nil, 0
+			continue
+		}
+		select {
+		case <-time.After(s.interval):
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		}
+	}
+}
+
+// readLines returns the complete lines after s.off, opening the file if
+// it has appeared and reopening it if it was truncated.
+func (s *fileSource) readLines() ([]commitlog.Record, error) {
+	if s.f == nil {
+		f, err := os.Open(s.path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil // not created yet
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.f = f
+		s.r = nil
+	}
+	fi, err := s.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < s.off {
+		s.off = 0
+		s.r = nil
+	}
+	if s.r == nil {
+		if _, err := s.f.Seek(s.off, io.SeekStart); err != nil {
+			return nil, err
+		}
+		s.r = bufio.NewReader(s.f)
+	}
+	var recs []commitlog.Record
+	for len(recs) < maxLinesPerPoll {
+		line, err := s.r.ReadString('\n')
+		if err == io.EOF {
+			// Leave a partial line to be read again once complete.
+			s.r = nil
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.off += int64(len(line))
+		recs = append(recs, commitlog.Record{Key: s.key, Value: strings.TrimRight(line, "\r\n")})
+	}
+	return recs, nil
+}
+
+// rotated reports whether the path now names a different file from the
+// one open.
+func (s *fileSource) rotated() bool {
+	if s.f == nil {
+		return false
+	}
+	cur, err := os.Stat(s.path)
+	if err != nil {
+		return false
+	}
+	open, err := s.f.Stat()
+	return err == nil && !os.SameFile(cur, open)
+}
+
+func (s *fileSource) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Close()
+}
+
+// stdinSource produces each line of standard input as a record value,
+// and finishes at end of input. It has no position: input is not
+// replayable.
+//
+// Settings:
+//
+//	{"key": "shell"}
+type stdinSource struct {
+	key string
+}
+
+func newStdinSource(settings json.RawMessage) (Source, error) {
+	var cfg struct {
+		Key string `json:"key"`
+	}
+	if err := decodeSettings("stdin", settings, &cfg); err != nil {
+		return nil, err
+	}
+	return &stdinSource{key: cfg.Key}, nil
+}
+
+// stdinReader reads standard input once for every stdin source, which
+// would otherwise race to read it and lose lines across restarts.
+type stdinReader struct {
+	lines chan string
+	err   error // set before lines is closed
+}
+
+var stdin = sync.OnceValue(func() *stdinReader {
+	in := &stdinReader{lines: make(chan string, maxLinesPerPoll)}
+	go func() {
+		sc := bufio.NewScanner(os.Stdin)
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			in.lines <- sc.Text()
+		}
+		in.err = sc.Err()
+		close(in.lines)
+	}()
+	return in
+})
+
+func (s *stdinSource) Start(string) error { return nil }
+
+func (s *stdinSource) Poll(ctx context.Context) ([]commitlog.Record, string, error) {
+	in := stdin()
+	var recs []commitlog.Record
+	select {
+	case line, ok := <-in.lines:
+		if !ok {
+			if in.err != nil {
+				return nil, "", in.err
+			}
+			return nil, "", io.EOF
+		}
+		recs = append(recs, commitlog.Record{Key: s.key, Value: line})
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+	// Take whatever else has been read already, without waiting.
+	for len(recs) < maxLinesPerPoll {
+		select {
+		case line, ok := <-in.lines:
+			if !ok {
+				return recs, "", nil
+			}
+			recs = append(recs, commitlog.Record{Key: s.key, Value: line})
+		default:
+			return recs, "", nil
+		}
+	}
+	return recs, "", nil
+}
+
+func (s *stdinSource) Close() error { return nil }
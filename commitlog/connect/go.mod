@@ -0,0 +1,22 @@
+module github.com/Ramykaz/Distributed-Systems-/commitlog/connect
+
+go 1.25.2
+
+require (
+	distributed-systems/16-assignment2 v0.0.0
+	github.com/Ramykaz/Distributed-Systems-/commitlog v0.0.0
+	google.golang.org/grpc v1.76.0
+)
+
+require (
+	golang.org/x/net v0.43.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250804133106-a7a43d27e69b // indirect
+	google.golang.org/protobuf v1.36.10 // indirect
+)
+
+replace (
+	distributed-systems/16-assignment2 => ../../16-assignment2
+	github.com/Ramykaz/Distributed-Systems-/commitlog => ../
+)
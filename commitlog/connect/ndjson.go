@@ -0,0 +1,200 @@
+package connect
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+func init() {
+	RegisterSource("ndjson-dir", newDirSource)
+}
+
+// doneSuffix is added to the name of a file a dirSource has finished.
+const doneSuffix = ".done"
+
+// dirSource polls a directory for files of newline-delimited JSON
+// records, {"key": ..., "value": ..., "timestamp": ...}, produced in
+// name order. A finished file is renamed with a ".done" suffix, so files
+// should be written elsewhere and moved in once complete. Its position
+// is the file being read and the byte offset in it.
+//
+// Settings:
+//
+//	{"dir": "/var/spool/events", "pattern": "*.ndjson", "poll_interval": "5s"}
+type dirSource struct {
+	dir      string
+	pattern  string
+	interval time.Duration
+
+	file string // being read
+	off  int64
+	f    *os.File
+	r    *bufio.Reader
+}
+
+func newDirSource(settings json.RawMessage) (Source, error) {
+	var cfg struct {
+		Dir          string `json:"dir"`
+		Pattern      string `json:"pattern"`
+		PollInterval string `json:"poll_interval"`
+	}
+	if err := decodeSettings("ndjson-dir", settings, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("%w: ndjson-dir settings need a dir", ErrInvalidConfig)
+	}
+	if cfg.Pattern == "" {
+		cfg.Pattern = "*.ndjson"
+	}
+	if _, err := filepath.Match(cfg.Pattern, ""); err != nil {
+		return nil, fmt.Errorf("%w: ndjson-dir settings: %v", ErrInvalidConfig, err)
+	}
+	interval, err := pollInterval("ndjson-dir", cfg.PollInterval)
+	if err != nil {
+		return nil, err
+	}
+	return &dirSource{dir: cfg.Dir, pattern: cfg.Pattern, interval: interval}, nil
+}
+
+// Start takes a position "name:offset".
+func (s *dirSource) Start(pos string) error {
+	if pos == "" {
+		return nil
+	}
+	i := strings.LastIndexByte(pos, ':')
+	off, err := strconv.ParseInt(pos[i+1:], 10, 64)
+	if i < 0 || err != nil {
+		return fmt.Errorf("connect: ndjson-dir source: bad position %q", pos)
+	}
+	s.file, s.off = pos[:i], off
+	return nil
+}
+
+func (s *dirSource) position() string {
+	if s.file == "" {
+		return ""
+	}
+	return s.file + ":" + strconv.FormatInt(s.off, 10)
+}
+
+func (s *dirSource) Poll(ctx context.Context) ([]commitlog.Record, string, error) {
+	for {
+		if s.file == "" {
+			next, err := s.next()
+			if err != nil {
+				return nil, "", err
+			}
+			if next == "" {
+				select {
+				case <-time.After(s.interval):
+					continue
+				case <-ctx.Done():
+					return nil, "", ctx.Err()
+				}
+			}
+			s.file, s.off = next, 0
+		}
+		recs, eof, err := s.read()
+		if err != nil {
+			return nil, "", err
+		}
+		if len(recs) > 0 {
+			return recs, s.position(), nil
+		}
+		if eof {
+			// Every record in the file has been produced and its last
+			// position saved, so it can be set aside.
+			s.f.Close()
+			s.f, s.r = nil, nil
+			path := filepath.Join(s.dir, s.file)
+			if err := os.Rename(path, path+doneSuffix); err != nil && !os.IsNotExist(err) {
+				return nil, "", err
+			}
+			s.file, s.off = "", 0
+			return nil, "", nil
+		}
+	}
+}
+
+// next returns the first file waiting in the directory, or "".
+func (s *dirSource) next() (string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, e := range entries {
+		if ok, _ := filepath.Match(s.pattern, e.Name()); ok && e.Type().IsRegular() && !strings.HasSuffix(e.Name(), doneSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	sort.Strings(names)
+	return names[0], nil
+}
+
+// read returns the next records of the current file; eof is true once
+// it has none left.
+func (s *dirSource) read() (recs []commitlog.Record, eof bool, err error) {
+	if s.f == nil {
+		f, err := os.Open(filepath.Join(s.dir, s.file))
+		if os.IsNotExist(err) {
+			// Moved away, or renamed just before a crash.
+			return nil, true, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if _, err := f.Seek(s.off, io.SeekStart); err != nil {
+			f.Close()
+			return nil, false, err
+		}
+		s.f, s.r = f, bufio.NewReader(f)
+	}
+	for len(recs) < maxLinesPerPoll {
+		line, err := s.r.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return recs, true, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, false, err
+		}
+		lineOff := s.off
+		s.off += int64(len(line))
+		line = []byte(strings.TrimSpace(string(line)))
+		if len(line) == 0 {
+			continue
+		}
+		var rec commitlog.Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, false, fmt.Errorf("connect: %s at byte %d: %v", s.file, lineOff, err)
+		}
+		rec.Offset = 0
+		recs = append(recs, rec)
+	}
+	return recs, false, nil
+}
+
+func (s *dirSource) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Close()
+}
@@ -0,0 +1,136 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+func init() {
+	RegisterSink("rolling-file", newRollingSink)
+}
+
+const (
+	defaultRollBytes = 64 << 20
+	defaultRollAge   = time.Hour
+)
+
+// rollingSink writes each partition's records as NDJSON to files named
+// TOPIC-PARTITION-FIRSTOFFSET.ndjson, starting a new file once the
+// current one reaches max_bytes or max_age. Each batch is synced before
+// Write returns. Files are only appended to, so after a crash a file
+// may repeat records already in it; readers can skip offsets they have
+// seen.
+//
+// Settings:
+//
+//	{"dir": "/data/archive", "max_bytes": 67108864, "max_age": "1h"}
+type rollingSink struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu    sync.Mutex
+	files map[string]*rollingFile // by topic and partition
+}
+
+type rollingFile struct {
+	f       *os.File
+	size    int64
+	created time.Time
+}
+
+func newRollingSink(settings json.RawMessage) (Sink, error) {
+	var cfg struct {
+		Dir      string `json:"dir"`
+		MaxBytes int64  `json:"max_bytes"`
+		MaxAge   string `json:"max_age"`
+	}
+	if err := decodeSettings("rolling-file", settings, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("%w: rolling-file settings need a dir", ErrInvalidConfig)
+	}
+	s := &rollingSink{dir: cfg.Dir, maxBytes: cfg.MaxBytes, maxAge: defaultRollAge, files: make(map[string]*rollingFile)}
+	if s.maxBytes <= 0 {
+		s.maxBytes = defaultRollBytes
+	}
+	if cfg.MaxAge != "" {
+		d, err := time.ParseDuration(cfg.MaxAge)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: rolling-file settings: invalid max_age %q", ErrInvalidConfig, cfg.MaxAge)
+		}
+		s.maxAge = d
+	}
+	return s, nil
+}
+
+func (s *rollingSink) Write(ctx context.Context, topic string, partition int, recs []commitlog.Record) error {
+	var buf []byte
+	for _, rec := range recs {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	// Partitions are written concurrently; each has its own file.
+	name := fmt.Sprintf("%s-%d", topic, partition)
+	s.mu.Lock()
+	rf := s.files[name]
+	s.mu.Unlock()
+	if rf != nil && (rf.size >= s.maxBytes || time.Since(rf.created) >= s.maxAge) {
+		s.mu.Lock()
+		delete(s.files, name)
+		s.mu.Unlock()
+		if err := rf.f.Close(); err != nil {
+			return err
+		}
+		rf = nil
+	}
+	if rf == nil {
+		if err := os.MkdirAll(s.dir, 0o755); err != nil {
+			return err
+		}
+		path := filepath.Join(s.dir, fmt.Sprintf("%s-%020d.ndjson", name, recs[0].Offset))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		rf = &rollingFile{f: f, size: fi.Size(), created: time.Now()}
+		s.mu.Lock()
+		s.files[name] = rf
+		s.mu.Unlock()
+	}
+	if _, err := rf.f.Write(buf); err != nil {
+		return err
+	}
+	rf.size += int64(len(buf))
+	return rf.f.Sync()
+}
+
+func (s *rollingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var first error
+	for name, rf := range s.files {
+		if err := rf.f.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(s.files, name)
+	}
+	return first
+}
@@ -0,0 +1,526 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/client"
+)
+
+// stateFile holds connector configs and source positions in a Runtime's
+// directory.
+const stateFile = "connectors.json"
+
+const (
+	// pollWait is how long a sink long-polls for new records.
+	pollWait = 10 * time.Second
+
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+)
+
+// State is what a connector is doing.
+type State string
+
+const (
+	StateRunning  State = "running"
+	StatePaused   State = "paused"
+	StateFailed   State = "failed"   // restarting after an error
+	StateFinished State = "finished" // a source that ran out of records
+)
+
+// PartitionOffset is a sink's checkpoint in one partition: the next
+// offset it will consume.
+type PartitionOffset struct {
+	Partition int `json:"partition"`
+	Offset    int `json:"offset"`
+}
+
+// Status describes a connector.
+type Status struct {
+	Config
+	State State  `json:"state"`
+	Error string `json:"error,omitempty"`
+	// Records counts records moved since the runtime started.
+	Records int64 `json:"records"`
+	// Position is a source's checkpoint.
+	Position string `json:"position,omitempty"`
+	// Offsets are a sink's checkpoints.
+	Offsets []PartitionOffset `json:"offsets,omitempty"`
+}
+
+// connector is a configured connector and its running task.
+type connector struct {
+	cfg    Config
+	pos    string
+	paused bool
+
+	state   State
+	err     string
+	records int64
+	offsets map[int]int
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Runtime runs connectors against one commit log server. It saves their
+// configs and source positions in a directory so they carry on where
+// they left off after a restart.
+type Runtime struct {
+	client *client.Client
+	path   string
+
+	// ops serializes changes that stop and start connectors.
+	ops   sync.Mutex
+	mu    sync.Mutex
+	conns map[string]*connector
+}
+
+// savedConnector is a connector as written to stateFile.
+type savedConnector struct {
+	Config   Config `json:"config"`
+	Position string `json:"position,omitempty"`
+	Paused   bool   `json:"paused,omitempty"`
+}
+
+// NewRuntime starts the connectors saved in dir, which is created if
+// needed. With an empty dir nothing is saved.
+func NewRuntime(cl *client.Client, dir string) (*Runtime, error) {
+	r := &Runtime{client: cl, conns: make(map[string]*connector)}
+	if dir == "" {
+		return r, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	r.path = filepath.Join(dir, stateFile)
+	data, err := os.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved []savedConnector
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("connect: %s: %w", stateFile, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range saved {
+		c := &connector{cfg: s.Config, pos: s.Position, paused: s.Paused}
+		r.conns[c.cfg.Name] = c
+		r.startLocked(c)
+	}
+	return r, nil
+}
+
+// saveLocked writes every connector to stateFile. r.mu must be held.
+func (r *Runtime) saveLocked() error {
+	if r.path == "" {
+		return nil
+	}
+	saved := make([]savedConnector, 0, len(r.conns))
+	for _, c := range r.sortedLocked() {
+		saved = append(saved, savedConnector{Config: c.cfg, Position: c.pos, Paused: c.paused})
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return commitlog.WriteFileAtomic(r.path, data)
+}
+
+func (r *Runtime) sortedLocked() []*connector {
+	conns := make([]*connector, 0, len(r.conns))
+	for _, c := range r.conns {
+		conns = append(conns, c)
+	}
+	sort.Slice(conns, func(i, j int) bool { return conns[i].cfg.Name < conns[j].cfg.Name })
+	return conns
+}
+
+// Create validates cfg and starts the connector.
+func (r *Runtime) Create(cfg Config) (Status, error) {
+	if err := cfg.Validate(); err != nil {
+		return Status{}, err
+	}
+	r.ops.Lock()
+	defer r.ops.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.conns[cfg.Name]; ok {
+		return Status{}, fmt.Errorf("%w: %s", ErrExists, cfg.Name)
+	}
+	c := &connector{cfg: cfg}
+	r.conns[cfg.Name] = c
+	r.startLocked(c)
+	return c.status(), r.saveLocked()
+}
+
+// Update replaces a connector's config and restarts it. A source keeps
+// its position unless its type changes; a sink keeps its committed
+// offsets.
+func (r *Runtime) Update(cfg Config) (Status, error) {
+	if err := cfg.Validate(); err != nil {
+		return Status{}, err
+	}
+	r.ops.Lock()
+	defer r.ops.Unlock()
+	c, err := r.stop(cfg.Name)
+	if err != nil {
+		return Status{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c.cfg.Kind != cfg.Kind || c.cfg.Type != cfg.Type {
+		c.pos = ""
+	}
+	c.cfg = cfg
+	r.startLocked(c)
+	return c.status(), r.saveLocked()
+}
+
+// Apply creates the connectors in cfgs that don't exist and updates
+// those whose config differs, for declarative configuration.
+func (r *Runtime) Apply(cfgs []Config) error {
+	for _, cfg := range cfgs {
+		cur, err := r.Status(cfg.Name)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			_, err = r.Create(cfg)
+		case err == nil && !sameConfig(cur.Config, cfg):
+			_, err = r.Update(cfg)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", cfg.Name, err)
+		}
+	}
+	return nil
+}
+
+func sameConfig(a, b Config) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+// Delete stops a connector and forgets it, including a source's
+// position. A sink's committed offsets stay on the server.
+func (r *Runtime) Delete(name string) error {
+	r.ops.Lock()
+	defer r.ops.Unlock()
+	if _, err := r.stop(name); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, name)
+	return r.saveLocked()
+}
+
+// Pause stops a connector until Resume.
+func (r *Runtime) Pause(name string) (Status, error) {
+	r.ops.Lock()
+	defer r.ops.Unlock()
+	c, err := r.stop(name)
+	if err != nil {
+		return Status{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c.paused = true
+	r.startLocked(c)
+	return c.status(), r.saveLocked()
+}
+
+// Resume restarts a paused connector.
+func (r *Runtime) Resume(name string) (Status, error) {
+	return r.restart(name, func(c *connector) { c.paused = false })
+}
+
+// Restart stops and starts a connector, clearing a failure or a
+// finished source's state.
+func (r *Runtime) Restart(name string) (Status, error) {
+	return r.restart(name, func(*connector) {})
+}
+
+func (r *Runtime) restart(name string, fn func(*connector)) (Status, error) {
+	r.ops.Lock()
+	defer r.ops.Unlock()
+	c, err := r.stop(name)
+	if err != nil {
+		return Status{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(c)
+	r.startLocked(c)
+	return c.status(), r.saveLocked()
+}
+
+// Status describes one connector.
+func (r *Runtime) Status(name string) (Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.conns[name]
+	if !ok {
+		return Status{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return c.status(), nil
+}
+
+// List describes every connector, ordered by name.
+func (r *Runtime) List() []Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	statuses := []Status{}
+	for _, c := range r.sortedLocked() {
+		statuses = append(statuses, c.status())
+	}
+	return statuses
+}
+
+// Close stops every connector.
+func (r *Runtime) Close() error {
+	r.ops.Lock()
+	defer r.ops.Unlock()
+	r.mu.Lock()
+	var names []string
+	for name := range r.conns {
+		names = append(names, name)
+	}
+	r.mu.Unlock()
+	for _, name := range names {
+		r.stop(name)
+	}
+	return nil
+}
+
+// status describes c. The runtime's lock must be held.
+func (c *connector) status() Status {
+	st := Status{Config: c.cfg, State: c.state, Error: c.err, Records: c.records, Position: c.pos}
+	for p, off := range c.offsets {
+		st.Offsets = append(st.Offsets, PartitionOffset{Partition: p, Offset: off})
+	}
+	sort.Slice(st.Offsets, func(i, j int) bool { return st.Offsets[i].Partition < st.Offsets[j].Partition })
+	return st
+}
+
+// stop stops a connector's task and waits for it to exit.
+func (r *Runtime) stop(name string) (*connector, error) {
+	r.mu.Lock()
+	c, ok := r.conns[name]
+	if !ok {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	cancel, done := c.cancel, c.done
+	r.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	return c, nil
+}
+
+// startLocked starts c's task, unless it is paused. r.mu must be held.
+func (r *Runtime) startLocked(c *connector) {
+	c.err = ""
+	c.offsets = nil
+	if c.paused {
+		c.state, c.cancel, c.done = StatePaused, nil, nil
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.state, c.cancel, c.done = StateRunning, cancel, make(chan struct{})
+	go func() {
+		defer close(c.done)
+		r.run(ctx, c)
+	}()
+}
+
+// run runs c until ctx is done, restarting it with backoff after errors.
+func (r *Runtime) run(ctx context.Context, c *connector) {
+	backoff := minRestartBackoff
+	for {
+		started := time.Now()
+		var err error
+		if c.cfg.Kind == KindSource {
+			err = r.runSource(ctx, c)
+		} else {
+			err = r.runSink(ctx, c)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, io.EOF) {
+			r.setState(c, StateFinished, "")
+			return
+		}
+		log.Printf("connect: %s: %v", c.cfg.Name, err)
+		r.setState(c, StateFailed, err.Error())
+		if time.Since(started) > maxRestartBackoff {
+			backoff = minRestartBackoff // it had been healthy
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, maxRestartBackoff)
+		r.setState(c, StateRunning, "")
+	}
+}
+
+func (r *Runtime) setState(c *connector, s State, err string) {
+	r.mu.Lock()
+	c.state, c.err = s, err
+	r.mu.Unlock()
+}
+
+// runSource produces a source's records until ctx is done or it fails,
+// saving its position after each batch is produced.
+func (r *Runtime) runSource(ctx context.Context, c *connector) error {
+	src, err := NewSource(c.cfg.Type, c.cfg.Settings)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	r.mu.Lock()
+	pos := c.pos
+	r.mu.Unlock()
+	if err := src.Start(pos); err != nil {
+		return err
+	}
+	cl := r.client.Topic(c.cfg.Topic, client.AnyPartition)
+	for {
+		recs, pos, err := src.Poll(ctx)
+		if err != nil {
+			return err
+		}
+		if len(recs) > 0 {
+			if _, err := cl.ProduceBatch(ctx, recs); err != nil {
+				return err
+			}
+		}
+		r.mu.Lock()
+		c.pos = pos
+		c.records += int64(len(recs))
+		err = r.saveLocked()
+		r.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// runSink consumes every partition of the sink's topic until ctx is done
+// or one fails, committing offsets as group "connect-" + name after each
+// batch is written.
+func (r *Runtime) runSink(ctx context.Context, c *connector) error {
+	sink, err := NewSink(c.cfg.Type, c.cfg.Settings)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	topic, err := r.client.DescribeTopic(ctx, c.cfg.Topic)
+	if err != nil {
+		return err
+	}
+	group := "connect-" + c.cfg.Name
+	committed := map[int]int{}
+	offsets, err := r.client.DescribeGroup(ctx, group)
+	var ce *client.Error
+	if errors.As(err, &ce) && ce.Code == "group_not_found" {
+		err = nil // nothing committed yet
+	}
+	if err != nil {
+		return err
+	}
+	for _, o := range offsets {
+		if o.Topic == topic.Name {
+			committed[o.Partition] = o.Offset
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(topic.Partitions))
+	for _, p := range topic.Partitions {
+		from, ok := committed[p.Partition]
+		if !ok {
+			from = p.StartOffset
+			if c.cfg.Start == "end" {
+				from = p.EndOffset
+			}
+		}
+		go func() {
+			errs <- r.runSinkPartition(ctx, c, sink, group, p.Partition, from)
+		}()
+	}
+	err = <-errs
+	cancel()
+	for range len(topic.Partitions) - 1 {
+		<-errs
+	}
+	return err
+}
+
+func (r *Runtime) runSinkPartition(ctx context.Context, c *connector, sink Sink, group string, p, from int) error {
+	cl := r.client.Topic(c.cfg.Topic, p)
+	batch := c.cfg.BatchSize
+	if batch == 0 {
+		batch = DefaultBatchSize
+	}
+	r.setOffset(c, p, from, 0)
+	for {
+		recs, err := cl.Records(ctx, from, batch, pollWait)
+		var oor *commitlog.ErrOffsetOutOfRange
+		if errors.As(err, &oor) && from < oor.Start {
+			// Retention removed records before the sink got to them.
+			log.Printf("connect: %s: partition %d: skipping offsets %d to %d, no longer held", c.cfg.Name, p, from, oor.Start)
+			from = oor.Start
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if len(recs) == 0 {
+			continue
+		}
+		if err := sink.Write(ctx, c.cfg.Topic, p, recs); err != nil {
+			return err
+		}
+		from = recs[len(recs)-1].Offset + 1
+		if _, err := cl.CommitOffset(ctx, group, from, ""); err != nil {
+			return err
+		}
+		r.setOffset(c, p, from, len(recs))
+	}
+}
+
+func (r *Runtime) setOffset(c *connector, p, off, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c.offsets == nil {
+		c.offsets = make(map[int]int)
+	}
+	c.offsets[p] = off
+	c.records += int64(n)
+	if n > 0 && c.state == StateFailed {
+		c.state, c.err = StateRunning, ""
+	}
+}
+
@@ -0,0 +1,153 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	pb "distributed-systems/16-assignment2/proto"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func init() {
+	RegisterSink("commitlog", newLogSink)
+	RegisterSink("kvstore", newKVSink)
+}
+
+// logSink produces records to a topic on another commit log server,
+// keeping their keys and timestamps. Records go to the partition of the
+// same number if "preserve_partitions" is set, and are placed by key
+// otherwise.
+//
+// Settings:
+//
+//	{"server": "http://replica:8080", "topic": "orders", "preserve_partitions": true}
+type logSink struct {
+	client   *client.Client
+	topic    string
+	preserve bool
+}
+
+func newLogSink(settings json.RawMessage) (Sink, error) {
+	var cfg struct {
+		Server             string `json:"server"`
+		Topic              string `json:"topic"`
+		PreservePartitions bool   `json:"preserve_partitions"`
+	}
+	if err := decodeSettings("commitlog", settings, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Server == "" {
+		return nil, fmt.Errorf("%w: commitlog settings need a server", ErrInvalidConfig)
+	}
+	return &logSink{client: client.New(cfg.Server), topic: cfg.Topic, preserve: cfg.PreservePartitions}, nil
+}
+
+func (s *logSink) Write(ctx context.Context, topic string, partition int, recs []commitlog.Record) error {
+	p := client.AnyPartition
+	if s.preserve {
+		p = partition
+	}
+	out := make([]commitlog.Record, len(recs))
+	for i, rec := range recs {
+		out[i] = commitlog.Record{Key: rec.Key, Value: rec.Value, Timestamp: rec.Timestamp}
+	}
+	_, err := s.client.Topic(s.topic, p).ProduceBatch(ctx, out)
+	return err
+}
+
+func (s *logSink) Close() error { return nil }
+
+// kvSink puts each keyed record into the 16-assignment2 key-value store,
+// so the store holds the latest value of every key. Records without a
+// key are skipped.
+//
+// Settings:
+//
+//	{"address": "localhost:50051", "timeout": "5s"}
+type kvSink struct {
+	address string
+	timeout time.Duration
+
+	mu   sync.Mutex // guards dialing; partitions write concurrently
+	conn *grpc.ClientConn
+	kv   pb.KeyValueStoreClient
+}
+
+func newKVSink(settings json.RawMessage) (Sink, error) {
+	var cfg struct {
+		Address string `json:"address"`
+		Timeout string `json:"timeout"`
+	}
+	if err := decodeSettings("kvstore", settings, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("%w: kvstore settings need an address", ErrInvalidConfig)
+	}
+	s := &kvSink{address: cfg.Address, timeout: 5 * time.Second}
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: kvstore settings: invalid timeout %q", ErrInvalidConfig, cfg.Timeout)
+		}
+		s.timeout = d
+	}
+	return s, nil
+}
+
+// store returns a client for the store, connecting the first time.
+func (s *kvSink) store() (pb.KeyValueStoreClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		conn, err := grpc.NewClient(s.address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, err
+		}
+		s.conn, s.kv = conn, pb.NewKeyValueStoreClient(conn)
+	}
+	return s.kv, nil
+}
+
+func (s *kvSink) Write(ctx context.Context, topic string, partition int, recs []commitlog.Record) error {
+	kv, err := s.store()
+	if err != nil {
+		return err
+	}
+	skipped := 0
+	for _, rec := range recs {
+		if rec.Key == "" {
+			skipped++
+			continue
+		}
+		callCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		ack, err := kv.Put(callCtx, &pb.KeyValue{Key: rec.Key, Value: rec.Value})
+		cancel()
+		if err != nil {
+			return fmt.Errorf("kvstore put %q (offset %d): %w", rec.Key, rec.Offset, err)
+		}
+		if !ack.GetSuccess() {
+			return fmt.Errorf("kvstore put %q (offset %d): not acknowledged", rec.Key, rec.Offset)
+		}
+	}
+	if skipped > 0 {
+		log.Printf("connect: kvstore: skipped %d records without a key in %s-%d", skipped, topic, partition)
+	}
+	return nil
+}
+
+func (s *kvSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
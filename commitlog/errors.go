@@ -0,0 +1,62 @@
+package commitlog
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTruncated is returned for offsets that were deleted from the
+	// start of the log. It is wrapped by ErrOffsetOutOfRange.
+	ErrTruncated = errors.New("offset has been deleted from the log")
+	// ErrCorrupt is returned when stored data fails its checksum.
+	ErrCorrupt = errors.New("log data is corrupt")
+	// ErrClosed is returned by operations on a closed log.
+	ErrClosed = errors.New("log is closed")
+)
+
+// ErrOffsetOutOfRange reports an offset outside the log, along with the
+// range [Start, End) that is valid.
+type ErrOffsetOutOfRange struct {
+	Offset int
+	Start  int
+	End    int
+}
+
+func (e *ErrOffsetOutOfRange) Error() string {
+	return fmt.Sprintf("offset %d out of range [%d, %d)", e.Offset, e.Start, e.End)
+}
+
+// Unwrap returns ErrTruncated when the offset was deleted from the log.
+func (e *ErrOffsetOutOfRange) Unwrap() error {
+	if e.Offset >= 0 && e.Offset < e.Start {
+		return ErrTruncated
+	}
+	return nil
+}
+
+// Machine-readable codes for log errors, shared by the HTTP and gRPC
+// front ends.
+const (
+	CodeOffsetOutOfRange = "offset_out_of_range"
+	CodeTruncated        = "offset_truncated"
+	CodeCorrupt          = "corrupt"
+	CodeClosed           = "closed"
+	CodeInternal         = "internal"
+)
+
+// ErrorCode returns the machine-readable code for err.
+func ErrorCode(err error) string {
+	var oor *ErrOffsetOutOfRange
+	switch {
+	case errors.Is(err, ErrTruncated):
+		return CodeTruncated
+	case errors.As(err, &oor):
+		return CodeOffsetOutOfRange
+	case errors.Is(err, ErrCorrupt):
+		return CodeCorrupt
+	case errors.Is(err, ErrClosed):
+		return CodeClosed
+	}
+	return CodeInternal
+}
@@ -0,0 +1,132 @@
+package eventsource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DefaultUpdateAttempts is how many times Update tries to append before
+// giving up on version conflicts, unless the Aggregate says otherwise.
+const DefaultUpdateAttempts = 5
+
+// Aggregate defines a kind of aggregate by how its state S follows from
+// its events. S is stored in snapshots as JSON.
+type Aggregate[S any] struct {
+	// New returns the state of an aggregate with no events. If it is nil
+	// the zero S is used.
+	New func() S
+	// Apply returns the state after e. It must depend only on state and
+	// e, since it is run again whenever the aggregate is loaded.
+	Apply func(state S, e Event) (S, error)
+	// SnapshotEvery saves a snapshot each time a stream's version
+	// passes a multiple of it. Zero disables snapshots.
+	SnapshotEvery int
+	// UpdateAttempts bounds Update's retries; zero means
+	// DefaultUpdateAttempts.
+	UpdateAttempts int
+}
+
+// Repository loads and updates the aggregates of one kind in a Store.
+type Repository[S any] struct {
+	store *Store
+	agg   Aggregate[S]
+}
+
+// NewRepository returns a Repository for agg's aggregates in store.
+func NewRepository[S any](store *Store, agg Aggregate[S]) *Repository[S] {
+	if agg.Apply == nil {
+		panic("eventsource: Aggregate needs an Apply function")
+	}
+	if agg.UpdateAttempts <= 0 {
+		agg.UpdateAttempts = DefaultUpdateAttempts
+	}
+	return &Repository[S]{store: store, agg: agg}
+}
+
+func (r *Repository[S]) initial() S {
+	if r.agg.New != nil {
+		return r.agg.New()
+	}
+	var s S
+	return s
+}
+
+// Load returns the current state and version of aggregate id: its latest
+// snapshot with the events since replayed. An aggregate with no events
+// is at version 0 with its initial state.
+func (r *Repository[S]) Load(id string) (S, int, error) {
+	state, version := r.initial(), 0
+	snap, ok, err := r.store.snapshot(id)
+	if err != nil {
+		return state, 0, err
+	}
+	if ok {
+		if err := json.Unmarshal(snap.State, &state); err != nil {
+			return r.initial(), 0, fmt.Errorf("eventsource: snapshot of %s: %w", id, err)
+		}
+		version = snap.Version
+	}
+	events, err := r.store.Read(id, version+1)
+	if err != nil {
+		return state, 0, err
+	}
+	return r.apply(state, version, events)
+}
+
+// apply applies events to state at version.
+func (r *Repository[S]) apply(state S, version int, events []Event) (S, int, error) {
+	for _, e := range events {
+		next, err := r.agg.Apply(state, e)
+		if err != nil {
+			return state, version, fmt.Errorf("eventsource: applying %s event %d of %s: %w", e.Type, e.Version, e.StreamID, err)
+		}
+		state, version = next, e.Version
+	}
+	return state, version, nil
+}
+
+// Update loads aggregate id, passes its state to decide and appends the
+// events decide returns, expecting the version it loaded. If another
+// writer appended in between it loads and decides again, up to the
+// Aggregate's UpdateAttempts. It returns the new state and version; an
+// error from decide is returned as is, with nothing appended.
+func (r *Repository[S]) Update(id string, decide func(state S) ([]Event, error)) (S, int, error) {
+	var err error
+	for range r.agg.UpdateAttempts {
+		var state S
+		var version int
+		state, version, err = r.Load(id)
+		if err != nil {
+			return state, version, err
+		}
+		var events []Event
+		if events, err = decide(state); err != nil {
+			return state, version, err
+		}
+		var stored []Event
+		stored, err = r.store.Append(id, version, events...)
+		if errors.Is(err, ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return state, version, err
+		}
+		return r.saved(id, state, version, stored)
+	}
+	return r.initial(), 0, err
+}
+
+// saved applies newly appended events to the state they were decided on
+// and saves a snapshot if one is due. A failed snapshot is not an error
+// for the update: the events are stored, and the next snapshot will do.
+func (r *Repository[S]) saved(id string, state S, version int, stored []Event) (S, int, error) {
+	state, next, err := r.apply(state, version, stored)
+	if err != nil {
+		return state, next, err
+	}
+	if n := r.agg.SnapshotEvery; n > 0 && next/n > version/n {
+		r.store.saveSnapshot(id, next, state)
+	}
+	return state, next, nil
+}
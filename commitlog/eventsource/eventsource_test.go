@@ -0,0 +1,220 @@
+package eventsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// order is the aggregate used by the tests.
+type order struct {
+	Items   []string `json:"items"`
+	Shipped bool     `json:"shipped"`
+}
+
+type item struct {
+	Name string `json:"name"`
+}
+
+func event(t *testing.T, typ string, data any) Event {
+	t.Helper()
+	e, err := NewEvent(typ, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// orders returns an order Aggregate counting the events it applies.
+func orders(applied *int, snapshotEvery int) Aggregate[order] {
+	return Aggregate[order]{
+		Apply: func(o order, e Event) (order, error) {
+			*applied++
+			switch e.Type {
+			case "ItemAdded":
+				var it item
+				if err := e.Decode(&it); err != nil {
+					return o, err
+				}
+				o.Items = append(o.Items, it.Name)
+			case "Shipped":
+				o.Shipped = true
+			default:
+				return o, fmt.Errorf("unknown event %s", e.Type)
+			}
+			return o, nil
+		},
+		SnapshotEvery: snapshotEvery,
+	}
+}
+
+func TestAppendExpectedVersion(t *testing.T) {
+	s, err := Open(commitlog.NewMemoryLog(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := event(t, "ItemAdded", item{"book"})
+	if stored, err := s.Append("order-1", NoStream, add, add); err != nil || len(stored) != 2 || stored[1].Version != 2 {
+		t.Fatalf("Append to a new stream = %+v, %v", stored, err)
+	}
+	if _, err := s.Append("order-1", NoStream, add); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Append expecting no stream = %v, want ErrVersionConflict", err)
+	}
+	if _, err := s.Append("order-1", 1, add); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Append expecting a stale version = %v, want ErrVersionConflict", err)
+	}
+	if stored, err := s.Append("order-1", 2, add); err != nil || stored[0].Version != 3 {
+		t.Errorf("Append expecting the current version = %+v, %v", stored, err)
+	}
+	if stored, err := s.Append("order-1", AnyVersion, add); err != nil || stored[0].Version != 4 {
+		t.Errorf("Append with AnyVersion = %+v, %v", stored, err)
+	}
+	s.Append("order-2", NoStream, add)
+
+	events, err := s.Read("order-1", 3)
+	if err != nil || len(events) != 2 || events[0].Version != 3 || events[0].StreamID != "order-1" {
+		t.Fatalf("Read(order-1, 3) = %+v, %v", events, err)
+	}
+	if v := s.Version("order-2"); v != 1 {
+		t.Errorf("Version(order-2) = %d, want 1", v)
+	}
+	if v := s.Version("order-3"); v != 0 {
+		t.Errorf("Version of a missing stream = %d, want 0", v)
+	}
+}
+
+func TestRepository(t *testing.T) {
+	events, snapshots := commitlog.NewMemoryLog(), commitlog.NewMemoryLog()
+	s, err := Open(events, snapshots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied int
+	repo := NewRepository(s, orders(&applied, 3))
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if _, _, err := repo.Update("order-1", func(o order) ([]Event, error) {
+			return []Event{event(t, "ItemAdded", item{name})}, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	o, v, err := repo.Update("order-1", func(o order) ([]Event, error) {
+		if o.Shipped {
+			return nil, errors.New("already shipped")
+		}
+		return []Event{event(t, "Shipped", nil)}, nil
+	})
+	if err != nil || v != 5 || !o.Shipped || len(o.Items) != 4 {
+		t.Fatalf("Update = %+v at %d, %v", o, v, err)
+	}
+	if _, _, err := repo.Update("order-1", func(o order) ([]Event, error) {
+		if o.Shipped {
+			return nil, errors.New("already shipped")
+		}
+		return nil, nil
+	}); err == nil || err.Error() != "already shipped" {
+		t.Errorf("Update rejected by decide = %v", err)
+	}
+
+	// Reopening finds the streams, and loading starts from the snapshot
+	// at version 3.
+	s, err = Open(events, snapshots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied = 0
+	repo = NewRepository(s, orders(&applied, 3))
+	o, v, err = repo.Load("order-1")
+	if err != nil || v != 5 || !o.Shipped || fmt.Sprint(o.Items) != "[a b c d]" {
+		t.Fatalf("Load after reopening = %+v at %d, %v", o, v, err)
+	}
+	if applied != 2 {
+		t.Errorf("Load applied %d events, want the 2 after the snapshot", applied)
+	}
+	if _, err := s.Append("order-1", 4, event(t, "Shipped", nil)); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Append at a stale version after reopening = %v", err)
+	}
+}
+
+func TestUpdateRetriesConflicts(t *testing.T) {
+	s, err := Open(commitlog.NewMemoryLog(), commitlog.NewMemoryLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var applied int
+	agg := orders(&applied, 2)
+	apply := agg.Apply
+	agg.Apply = func(o order, e Event) (order, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return apply(o, e)
+	}
+	agg.UpdateAttempts = 100
+	repo := NewRepository(s, agg)
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := repo.Update("order-1", func(order) ([]Event, error) {
+				time.Sleep(time.Millisecond) // widen the window for conflicts
+				return []Event{event(t, "ItemAdded", item{fmt.Sprint(i)})}, nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	o, v, err := repo.Load("order-1")
+	if err != nil || v != 10 || len(o.Items) != 10 {
+		t.Errorf("after 10 concurrent updates: %d items at version %d, %v", len(o.Items), v, err)
+	}
+}
+
+func TestProjection(t *testing.T) {
+	s, err := Open(commitlog.NewMemoryLog(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Items ordered per name, across orders.
+	p := NewProjection(map[string]int{}, 0, func(m map[string]int, e Event) (map[string]int, error) {
+		if e.Type == "ItemAdded" {
+			var it item
+			if err := e.Decode(&it); err != nil {
+				return m, err
+			}
+			m[it.Name]++
+		}
+		return m, nil
+	})
+	s.Append("order-1", NoStream, event(t, "ItemAdded", item{"book"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx, s) }()
+
+	s.Append("order-2", NoStream, event(t, "ItemAdded", item{"pen"}), event(t, "Shipped", nil))
+	stored, _ := s.Append("order-3", NoStream, event(t, "ItemAdded", item{"book"}))
+	wctx, wcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer wcancel()
+	if err := p.WaitFor(wctx, stored[0].Offset+1); err != nil {
+		t.Fatal(err)
+	}
+	p.View(func(m map[string]int, next int) {
+		if m["book"] != 2 || m["pen"] != 1 || next != 4 {
+			t.Errorf("model = %v before %d, want 2 books and 1 pen before 4", m, next)
+		}
+	})
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run = %v, want context.Canceled", err)
+	}
+}
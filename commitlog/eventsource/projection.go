@@ -0,0 +1,73 @@
+package eventsource
+
+import (
+	"context"
+	"sync"
+)
+
+// Projection builds a read model M from the events of every stream, in
+// the order they were appended. It is kept in memory: a process starting
+// up rebuilds it by replaying the store from the start, or from the
+// offset View reported for a model it saved itself.
+type Projection[M any] struct {
+	apply func(model M, e Event) (M, error)
+
+	mu      sync.RWMutex
+	model   M
+	next    int
+	changed chan struct{} // closed when next advances
+}
+
+// NewProjection returns a Projection starting from model, before the
+// event at offset from of the events log, that folds events into it with
+// apply.
+func NewProjection[M any](model M, from int, apply func(model M, e Event) (M, error)) *Projection[M] {
+	return &Projection[M]{apply: apply, model: model, next: from, changed: make(chan struct{})}
+}
+
+// Run follows the store, applying each event to the model, until ctx is
+// done or apply fails.
+func (p *Projection[M]) Run(ctx context.Context, s *Store) error {
+	p.mu.RLock()
+	from := p.next
+	p.mu.RUnlock()
+	_, err := s.Subscribe(ctx, from, func(e Event) error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		model, err := p.apply(p.model, e)
+		if err != nil {
+			return err
+		}
+		p.model, p.next = model, e.Offset+1
+		close(p.changed)
+		p.changed = make(chan struct{})
+		return nil
+	})
+	return err
+}
+
+// View calls f with the model and the offset of the next event to be
+// applied. The model must not be changed or kept after f returns.
+func (p *Projection[M]) View(f func(model M, next int)) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	f(p.model, p.next)
+}
+
+// WaitFor blocks until the model reflects every event before offset, so
+// a writer can read its own appends, or until ctx is done.
+func (p *Projection[M]) WaitFor(ctx context.Context, offset int) error {
+	for {
+		p.mu.RLock()
+		next, changed := p.next, p.changed
+		p.mu.RUnlock()
+		if next >= offset {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,344 @@
+// Package eventsource keeps event-sourced aggregates in a commit log.
+//
+// A Store appends events to streams, one per aggregate, keyed by stream
+// ID. Each event in a stream has a version, counting from 1, and appends
+// name the version they expect the stream to be at, so two writers that
+// both read version 3 can't both append version 4:
+//
+//	store, err := eventsource.Open(events, snapshots)
+//	created, _ := eventsource.NewEvent("OrderCreated", order)
+//	_, err = store.Append("order-42", eventsource.NoStream, created)
+//
+// A Repository loads an aggregate's state by replaying its events
+// through an Aggregate's Apply function, starting from its latest
+// snapshot, and writes a new snapshot every so many events. Update runs
+// the load, decide and append cycle, retrying when another writer got
+// there first.
+//
+// Projections follow every stream in the store, in the order events were
+// appended, to build read models.
+//
+// Events are records of the events log: the key is the stream ID and the
+// value a JSON envelope with the event's version, type and data. A Store
+// must be the only writer of its logs, and the events log must not lose
+// records to retention, since a stream's history is its state.
+package eventsource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// Expected versions with special meanings in Append.
+const (
+	// AnyVersion appends whatever version the stream is at.
+	AnyVersion = -1
+	// NoStream appends only if the stream has no events yet.
+	NoStream = 0
+)
+
+// ErrVersionConflict is returned by Append when the stream is not at the
+// expected version.
+var ErrVersionConflict = errors.New("eventsource: version conflict")
+
+// subscribeBatch is how many events Subscribe reads at a time.
+const subscribeBatch = 500
+
+// Event is one event in a stream. Type and Data are set by the writer;
+// the rest is set when the event is appended.
+type Event struct {
+	StreamID string          `json:"-"`
+	Version  int             `json:"version"`
+	Type     string          `json:"type"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	// Offset is the event's offset in the events log; Time is when it
+	// was appended.
+	Offset int       `json:"-"`
+	Time   time.Time `json:"-"`
+}
+
+// NewEvent returns an event of type typ with data encoded as JSON.
+func NewEvent(typ string, data any) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("eventsource: encoding %s: %w", typ, err)
+	}
+	return Event{Type: typ, Data: raw}, nil
+}
+
+// Decode decodes the event's data into v.
+func (e Event) Decode(v any) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("eventsource: decoding %s event %d of %s: %w", e.Type, e.Version, e.StreamID, err)
+	}
+	return nil
+}
+
+// decodeEvent returns the event stored in rec.
+func decodeEvent(rec commitlog.Record) (Event, error) {
+	var e Event
+	if err := json.Unmarshal([]byte(rec.Value), &e); err != nil || e.Version < 1 {
+		return Event{}, fmt.Errorf("eventsource: record %d is not an event", rec.Offset)
+	}
+	e.StreamID, e.Offset, e.Time = rec.Key, rec.Offset, rec.Timestamp
+	return e, nil
+}
+
+// stream is what a Store knows about one stream: where its events are.
+type stream struct {
+	// first is the version of the event at offsets[0].
+	first   int
+	offsets []int
+}
+
+func (s *stream) version() int {
+	return s.first + len(s.offsets) - 1
+}
+
+// snapshot is a stored aggregate state.
+type snapshot struct {
+	Version int             `json:"version"`
+	State   json.RawMessage `json:"state"`
+}
+
+// Store holds event streams in a commit log, with snapshots of their
+// aggregates' state in another. It keeps the offsets of every stream's
+// events in memory.
+type Store struct {
+	events  *commitlog.Tailable
+	snapLog commitlog.Log
+
+	mu        sync.RWMutex
+	streams   map[string]*stream
+	snapshots map[string]snapshotRef // each stream's latest snapshot
+}
+
+// snapshotRef locates a snapshot in the snapshots log.
+type snapshotRef struct {
+	offset, version int
+}
+
+// Open returns a Store over the events log, reading it to find every
+// stream. Snapshots are kept in the snapshots log; it may be nil, in
+// which case none are written. The Store does not close the logs.
+func Open(events, snapshots commitlog.Log) (*Store, error) {
+	t, ok := events.(*commitlog.Tailable)
+	if !ok {
+		t = commitlog.NewTailable(events)
+	}
+	s := &Store{
+		events:    t,
+		snapLog:   snapshots,
+		streams:   make(map[string]*stream),
+		snapshots: make(map[string]snapshotRef),
+	}
+	recs, err := commitlog.List(events)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range recs {
+		e, err := decodeEvent(rec)
+		if err != nil {
+			return nil, err
+		}
+		st := s.streams[e.StreamID]
+		if st == nil {
+			st = &stream{first: e.Version}
+			s.streams[e.StreamID] = st
+		} else if e.Version != st.version()+1 {
+			return nil, fmt.Errorf("eventsource: record %d is version %d of %s, want %d", rec.Offset, e.Version, e.StreamID, st.version()+1)
+		}
+		st.offsets = append(st.offsets, rec.Offset)
+	}
+	if snapshots != nil {
+		recs, err := commitlog.List(snapshots)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range recs {
+			var snap snapshot
+			if err := json.Unmarshal([]byte(rec.Value), &snap); err != nil {
+				return nil, fmt.Errorf("eventsource: snapshot record %d: %w", rec.Offset, err)
+			}
+			s.keepSnapshot(rec.Key, snapshotRef{rec.Offset, snap.Version})
+		}
+	}
+	return s, nil
+}
+
+// Version returns the version of a stream, 0 if it has no events.
+func (s *Store) Version(id string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if st := s.streams[id]; st != nil {
+		return st.version()
+	}
+	return 0
+}
+
+// Append appends events to a stream if it is at version expected, or at
+// any version for AnyVersion, and returns them as stored. If the stream
+// is at another version nothing is appended and the error wraps
+// ErrVersionConflict.
+func (s *Store) Append(id string, expected int, events ...Event) ([]Event, error) {
+	if id == "" {
+		return nil, errors.New("eventsource: empty stream ID")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.streams[id]
+	version := 0
+	if st != nil {
+		version = st.version()
+	}
+	if expected != AnyVersion && expected != version {
+		return nil, fmt.Errorf("%w: %s is at version %d, not %d", ErrVersionConflict, id, version, expected)
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	stored := make([]Event, len(events))
+	recs := make([]commitlog.Record, len(events))
+	now := time.Now()
+	for i, e := range events {
+		if e.Type == "" {
+			return nil, fmt.Errorf("eventsource: event %d for %s has no type", i, id)
+		}
+		e.StreamID, e.Version, e.Time = id, version+1+i, now
+		value, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		stored[i] = e
+		recs[i] = commitlog.Record{Key: id, Value: string(value), Timestamp: now}
+	}
+	offsets, err := s.events.AppendBatch(recs)
+	if len(offsets) > 0 {
+		if st == nil {
+			st = &stream{first: 1}
+			s.streams[id] = st
+		}
+		st.offsets = append(st.offsets, offsets...)
+	}
+	for i, off := range offsets {
+		stored[i].Offset = off
+	}
+	if err != nil {
+		return stored[:len(offsets)], err
+	}
+	return stored, nil
+}
+
+// Read returns a stream's events from version from onwards.
+func (s *Store) Read(id string, from int) ([]Event, error) {
+	s.mu.RLock()
+	var offsets []int
+	if st := s.streams[id]; st != nil {
+		if from < st.first {
+			s.mu.RUnlock()
+			return nil, fmt.Errorf("eventsource: %s holds versions from %d, not %d", id, st.first, from)
+		}
+		if i := from - st.first; i < len(st.offsets) {
+			offsets = append(offsets, st.offsets[i:]...)
+		}
+	}
+	s.mu.RUnlock()
+
+	events := make([]Event, 0, len(offsets))
+	for _, off := range offsets {
+		rec, err := s.events.Read(off)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeEvent(rec)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// Subscribe passes every event from offset from of the events log to
+// handle, in the order they were appended, following new events until
+// ctx is done or handle fails. It returns the offset after the last
+// event handled with the error that stopped it.
+func (s *Store) Subscribe(ctx context.Context, from int, handle func(Event) error) (int, error) {
+	for {
+		if err := s.events.Wait(ctx, from); err != nil {
+			return from, err
+		}
+		recs, err := commitlog.ReadRange(s.events, from, subscribeBatch)
+		if err != nil {
+			return from, err
+		}
+		for _, rec := range recs {
+			e, err := decodeEvent(rec)
+			if err != nil {
+				return from, err
+			}
+			if err := handle(e); err != nil {
+				return from, err
+			}
+			from = rec.Offset + 1
+		}
+	}
+}
+
+// snapshot returns a stream's latest snapshot, if it has one.
+func (s *Store) snapshot(id string) (snapshot, bool, error) {
+	s.mu.RLock()
+	ref, ok := s.snapshots[id]
+	s.mu.RUnlock()
+	if !ok {
+		return snapshot{}, false, nil
+	}
+	off := ref.offset
+	rec, err := s.snapLog.Read(off)
+	if err != nil {
+		return snapshot{}, false, err
+	}
+	var snap snapshot
+	if err := json.Unmarshal([]byte(rec.Value), &snap); err != nil {
+		return snapshot{}, false, fmt.Errorf("eventsource: snapshot %d of %s: %w", off, id, err)
+	}
+	return snap, true, nil
+}
+
+// saveSnapshot stores state as a stream's state at version.
+func (s *Store) saveSnapshot(id string, version int, state any) error {
+	if s.snapLog == nil {
+		return nil
+	}
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("eventsource: encoding snapshot of %s: %w", id, err)
+	}
+	value, err := json.Marshal(snapshot{Version: version, State: raw})
+	if err != nil {
+		return err
+	}
+	off, err := s.snapLog.Append(commitlog.Record{Key: id, Value: string(value)})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keepSnapshot(id, snapshotRef{off, version})
+	return nil
+}
+
+// keepSnapshot records ref as a stream's latest snapshot unless it has a
+// later one: concurrent updates may save their snapshots out of order.
+func (s *Store) keepSnapshot(id string, ref snapshotRef) {
+	if prev, ok := s.snapshots[id]; !ok || prev.version < ref.version {
+		s.snapshots[id] = ref
+	}
+}
@@ -0,0 +1,491 @@
+package commitlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSegmentBytes is the store size at which a FileLog starts a
+// new segment when Config.MaxSegmentBytes is zero.
+const DefaultMaxSegmentBytes = 16 << 20
+
+// startFile persists the start offset set by DeleteBefore when it falls
+// inside a segment.
+const startFile = "start-offset"
+
+// Config configures a FileLog.
+type Config struct {
+	// MaxSegmentBytes is the store size at which a new segment is
+	// started.
+	MaxSegmentBytes int64
+	// Sync is the durability policy for appends.
+	Sync SyncPolicy
+	// Tier offloads closed segments to an object store when its Store
+	// is set.
+	Tier TierConfig
+}
+
+// FileLog is a Log stored in a directory of segment files.
+type FileLog struct {
+	dir string
+	cfg Config
+
+	mu       sync.RWMutex
+	segments []*segment      // ascending by base; the last one takes appends
+	remote   []remoteSegment // offloaded, ascending, all before segments
+	start    int
+	seq      int64
+	dirty    map[*segment]bool
+	closed   bool
+
+	// fsyncMu is held across fsyncs and across operations that remove
+	// or shrink segments, so the two never overlap.
+	fsyncMu sync.Mutex
+	syncer  *syncer
+
+	tier       *tier // nil without tiered storage
+	offloadErr error
+}
+
+var _ Log = (*FileLog)(nil)
+
+// OpenFileLog opens the log in dir, creating the directory if needed.
+func OpenFileLog(dir string, cfg Config) (*FileLog, error) {
+	if cfg.MaxSegmentBytes <= 0 {
+		cfg.MaxSegmentBytes = DefaultMaxSegmentBytes
+	}
+	if cfg.Sync.Mode == SyncPeriodic && cfg.Sync.Interval <= 0 {
+		return nil, errors.New("commitlog: periodic sync needs a positive interval")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	l := &FileLog{dir: dir, cfg: cfg, dirty: make(map[*segment]bool)}
+	if err := l.load(); err != nil {
+		for _, s := range l.segments {
+			s.close()
+		}
+		return nil, err
+	}
+	l.syncer = newSyncer(cfg.Sync, l.flush)
+	if l.tier != nil {
+		l.tier.wg.Add(1)
+		go l.offloadLoop()
+		l.kickOffload()
+	}
+	return l, nil
+}
+
+func (l *FileLog) load() error {
+	bases, err := segmentBases(l.dir)
+	if err != nil {
+		return err
+	}
+	var remote []remoteSegment
+	if l.cfg.Tier.Store != nil {
+		if remote, err = l.openTier(); err != nil {
+			return err
+		}
+	}
+	if len(bases) == 0 {
+		// A new log, or one whose local segments have all been
+		// offloaded: appends continue after the offloaded ones.
+		next := 0
+		if n := len(remote); n > 0 {
+			next = remote[n-1].nextOffset()
+		}
+		bases = []int{next}
+	}
+	// A segment uploaded just before a crash may still be on disk too;
+	// the local copy wins.
+	for _, r := range remote {
+		if r.base < bases[0] {
+			l.remote = append(l.remote, r)
+		}
+	}
+	for i, base := range bases {
+		s, err := openSegment(l.dir, base, i == len(bases)-1)
+		if err != nil {
+			return err
+		}
+		if n := len(l.segments); n > 0 && l.segments[n-1].nextOffset() != base {
+			s.close()
+			return fmt.Errorf("%w: segment %d follows segment %d, which ends at %d",
+				ErrCorrupt, base, l.segments[n-1].base, l.segments[n-1].nextOffset())
+		}
+		l.segments = append(l.segments, s)
+	}
+
+	l.start = l.segments[0].base
+	if len(l.remote) > 0 {
+		l.start = l.remote[0].base
+	}
+	data, err := os.ReadFile(filepath.Join(l.dir, startFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		start, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrCorrupt, startFile, err)
+		}
+		if start > l.start {
+			l.start = min(start, l.active().nextOffset())
+		}
+	}
+	return nil
+}
+
+// segmentBases returns the base offsets of the segments in dir, sorted.
+func segmentBases(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var bases []int
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), storeExt)
+		if !ok {
+			continue
+		}
+		base, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		bases = append(bases, base)
+	}
+	sort.Ints(bases)
+	return bases, nil
+}
+
+func (l *FileLog) active() *segment {
+	return l.segments[len(l.segments)-1]
+}
+
+// segmentFor returns the segment holding offset, which must be within
+// the log.
+func (l *FileLog) segmentFor(offset int) *segment {
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].base > offset
+	})
+	return l.segments[i-1]
+}
+
+// Append adds rec to the log and returns once it is durable under the
+// log's sync policy.
+func (l *FileLog) Append(rec Record) (int, error) {
+	offsets, err := l.AppendBatch([]Record{rec})
+	if err != nil {
+		return 0, err
+	}
+	return offsets[0], nil
+}
+
+// AppendBatch appends recs and waits once for all of them to become
+// durable.
+func (l *FileLog) AppendBatch(recs []Record) ([]int, error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, ErrClosed
+	}
+	offsets := make([]int, 0, len(recs))
+	var err error
+	for _, rec := range recs {
+		var off int
+		if off, err = l.appendLocked(rec); err != nil {
+			break
+		}
+		offsets = append(offsets, off)
+	}
+	seq := l.seq
+	l.mu.Unlock()
+
+	if len(offsets) > 0 {
+		l.syncer.appended()
+		if werr := l.syncer.wait(seq); werr != nil {
+			return nil, werr
+		}
+	}
+	return offsets, err
+}
+
+func (l *FileLog) appendLocked(rec Record) (int, error) {
+	s := l.active()
+	if s.size >= l.cfg.MaxSegmentBytes {
+		next, err := openSegment(l.dir, s.nextOffset(), true)
+		if err != nil {
+			return 0, err
+		}
+		l.segments = append(l.segments, next)
+		s = next
+		l.kickOffload()
+	}
+	rec.Offset = s.nextOffset()
+	if rec.Timestamp.IsZero() {
+		rec.Timestamp = time.Now()
+	}
+	if err := s.append(rec); err != nil {
+		return 0, err
+	}
+	l.seq++
+	if l.cfg.Sync.Mode != SyncOS {
+		l.dirty[s] = true
+	}
+	return rec.Offset, nil
+}
+
+// flush fsyncs every segment written since the last flush.
+func (l *FileLog) flush() (int64, error) {
+	l.fsyncMu.Lock()
+	defer l.fsyncMu.Unlock()
+	l.mu.Lock()
+	seq, dirty := l.seq, l.dirty
+	l.dirty = make(map[*segment]bool)
+	l.mu.Unlock()
+	for s := range dirty {
+		if err := s.sync(); err != nil {
+			return seq, err
+		}
+	}
+	return seq, nil
+}
+
+// flushLocked is flush for callers already holding fsyncMu and mu.
+func (l *FileLog) flushLocked() error {
+	for s := range l.dirty {
+		if err := s.sync(); err != nil {
+			return err
+		}
+	}
+	l.dirty = make(map[*segment]bool)
+	return nil
+}
+
+func (l *FileLog) Read(offset int) (Record, error) {
+	l.mu.RLock()
+	if l.closed {
+		l.mu.RUnlock()
+		return Record{}, ErrClosed
+	}
+	if end := l.active().nextOffset(); offset < l.start || offset >= end {
+		l.mu.RUnlock()
+		return Record{}, &ErrOffsetOutOfRange{Offset: offset, Start: l.start, End: end}
+	}
+	if offset >= l.segments[0].base {
+		defer l.mu.RUnlock()
+		return l.segmentFor(offset).read(offset)
+	}
+	// Fetching an offloaded segment can be slow, so it is done
+	// without holding up appends.
+	r, ok := l.remoteFor(offset)
+	l.mu.RUnlock()
+	if !ok {
+		return Record{}, fmt.Errorf("%w: offset %d is in no segment", ErrCorrupt, offset)
+	}
+	return l.tier.read(r, offset)
+}
+
+func (l *FileLog) StartOffset() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.start
+}
+
+func (l *FileLog) EndOffset() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.active().nextOffset()
+}
+
+// DeleteBefore drops every record below offset. Whole segments below it
+// are removed from disk; the new start offset is persisted.
+func (l *FileLog) DeleteBefore(offset int) error {
+	l.fsyncMu.Lock()
+	defer l.fsyncMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	end := l.active().nextOffset()
+	if offset > end {
+		return &ErrOffsetOutOfRange{Offset: offset, Start: l.start, End: end}
+	}
+	if offset <= l.start {
+		return nil
+	}
+	if err := l.flushLocked(); err != nil {
+		return err
+	}
+	if offset == end && len(l.active().pos) > 0 {
+		// Everything goes; start an empty segment so the next
+		// append keeps its offset.
+		s, err := openSegment(l.dir, end, true)
+		if err != nil {
+			return err
+		}
+		l.segments = append(l.segments, s)
+	}
+	if err := WriteFileAtomic(filepath.Join(l.dir, startFile), []byte(strconv.Itoa(offset)+"\n")); err != nil {
+		return err
+	}
+	l.start = offset
+
+	keep := 0
+	for keep < len(l.segments)-1 && l.segments[keep+1].base <= offset {
+		keep++
+	}
+	for _, s := range l.segments[:keep] {
+		if err := s.remove(); err != nil {
+			return err
+		}
+	}
+	l.segments = append([]*segment(nil), l.segments[keep:]...)
+
+	var gone []int
+	for len(l.remote) > 0 && l.remote[0].nextOffset() <= offset {
+		gone = append(gone, l.remote[0].base)
+		l.remote = l.remote[1:]
+	}
+	if len(gone) > 0 {
+		return l.tier.deleteRemote(context.Background(), gone)
+	}
+	return nil
+}
+
+// TruncateAfter drops every record above offset, removing whole segments
+// past it.
+func (l *FileLog) TruncateAfter(offset int) error {
+	l.fsyncMu.Lock()
+	defer l.fsyncMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	end := l.active().nextOffset()
+	if offset < l.start-1 {
+		return &ErrOffsetOutOfRange{Offset: offset, Start: l.start, End: end}
+	}
+	if offset >= end-1 {
+		return nil
+	}
+	if err := l.flushLocked(); err != nil {
+		return err
+	}
+	if offset+1 < l.segments[0].base {
+		return l.truncateOffloaded(offset)
+	}
+	k := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].base > offset+1
+	}) - 1
+	for _, s := range l.segments[k+1:] {
+		if err := s.remove(); err != nil {
+			return err
+		}
+	}
+	l.segments = l.segments[:k+1]
+	s := l.segments[k]
+	if err := s.truncate(offset + 1 - s.base); err != nil {
+		return err
+	}
+	if err := s.sync(); err != nil {
+		return err
+	}
+	l.syncer.advance(l.seq, nil)
+	return nil
+}
+
+// Stats describes a FileLog's footprint on disk and, with tiered
+// storage, in the object store.
+type Stats struct {
+	Segments int
+	Bytes    int64
+
+	OffloadedSegments int
+	OffloadedBytes    int64
+	// OffloadErr is the error from the last offload attempt, if it
+	// failed.
+	OffloadErr error
+}
+
+// Stats returns the number of segments and their total size.
+func (l *FileLog) Stats() Stats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	st := Stats{Segments: len(l.segments), OffloadedSegments: len(l.remote), OffloadErr: l.offloadErr}
+	for _, s := range l.segments {
+		st.Bytes += s.bytes()
+	}
+	for _, r := range l.remote {
+		st.OffloadedBytes += r.bytes
+	}
+	return st
+}
+
+// Close syncs pending appends and closes the segment files.
+func (l *FileLog) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.mu.Unlock()
+	l.syncer.close()
+	if l.tier != nil {
+		l.tier.close()
+	}
+
+	l.fsyncMu.Lock()
+	defer l.fsyncMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	var err error
+	for _, s := range l.segments {
+		if serr := s.sync(); err == nil {
+			err = serr
+		}
+		if cerr := s.close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// WriteFileAtomic replaces path with data so a crash leaves either the
+// old or the new contents. The directory is synced after the rename, so
+// the new contents survive a crash once it returns.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	f, err := os.Open(tmp)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	d, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
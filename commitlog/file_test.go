@@ -0,0 +1,168 @@
+package commitlog_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/logtest"
+)
+
+func TestFileLog(t *testing.T) {
+	policies := map[string]commitlog.SyncPolicy{
+		"os":       {Mode: commitlog.SyncOS},
+		"always":   {Mode: commitlog.SyncAlways},
+		"periodic": {Mode: commitlog.SyncPeriodic, Interval: time.Millisecond, Records: 10},
+	}
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			logtest.Run(t, func(t *testing.T) commitlog.Log {
+				// Small segments so the suite crosses segment
+				// boundaries.
+				l, err := commitlog.OpenFileLog(t.TempDir(), commitlog.Config{MaxSegmentBytes: 128, Sync: policy})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return l
+			})
+		})
+	}
+}
+
+func TestFileLogReopen(t *testing.T) {
+	dir := t.TempDir()
+	cfg := commitlog.Config{MaxSegmentBytes: 128}
+	l, err := commitlog.OpenFileLog(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		if _, err := l.Append(commitlog.Record{Value: "value"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.DeleteBefore(13); err != nil {
+		t.Fatal(err)
+	}
+	if st := l.Stats(); st.Segments < 2 {
+		t.Fatalf("got %d segments, want several", st.Segments)
+	}
+	l.Close()
+
+	// Tear the last frame, as a crash mid-write would.
+	bases, _ := filepath.Glob(filepath.Join(dir, "*.store"))
+	last := bases[len(bases)-1]
+	fi, _ := os.Stat(last)
+	if err := os.Truncate(last, fi.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = commitlog.OpenFileLog(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if start, end := l.StartOffset(), l.EndOffset(); start != 13 || end != 29 {
+		t.Fatalf("reopened range [%d, %d), want [13, 29)", start, end)
+	}
+	if _, err := l.Read(12); !errors.Is(err, commitlog.ErrTruncated) {
+		t.Fatalf("Read(12) = %v, want ErrTruncated", err)
+	}
+	if off, err := l.Append(commitlog.Record{Value: "after"}); err != nil || off != 29 {
+		t.Fatalf("Append = %d, %v, want 29", off, err)
+	}
+}
+
+func TestFileLogCorruptSegment(t *testing.T) {
+	dir := t.TempDir()
+	cfg := commitlog.Config{MaxSegmentBytes: 128}
+	l, err := commitlog.OpenFileLog(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		if _, err := l.Append(commitlog.Record{Value: "value"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	// Flip a byte in the middle of a closed segment.
+	first := filepath.Join(dir, "00000000000000000000.store")
+	f, err := os.OpenFile(first, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte{0xff}, 20)
+	f.Close()
+
+	l, err = commitlog.OpenFileLog(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.Read(0); !errors.Is(err, commitlog.ErrCorrupt) {
+		t.Fatalf("Read(0) = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestFileLogBadFrameLength(t *testing.T) {
+	dir := t.TempDir()
+	cfg := commitlog.Config{MaxSegmentBytes: 128}
+	l, err := commitlog.OpenFileLog(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		if _, err := l.Append(commitlog.Record{Value: "value"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	end := l.EndOffset()
+	l.Close()
+
+	// A length of almost 4 GiB in a frame header, in a closed segment and
+	// in the last frame of the log.
+	setLength := func(path string, pos int64) {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0xf0}, pos); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stores, _ := filepath.Glob(filepath.Join(dir, "*.store"))
+	setLength(stores[0], 0)
+	// The records are all the same size, so the last segment's frames
+	// are its store's size over its index entries.
+	last := stores[len(stores)-1]
+	store, err := os.Stat(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := os.Stat(strings.TrimSuffix(last, ".store") + ".index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setLength(last, store.Size()-store.Size()/(index.Size()/8))
+
+	l, err = commitlog.OpenFileLog(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.Read(0); !errors.Is(err, commitlog.ErrCorrupt) {
+		t.Fatalf("Read(0) = %v, want ErrCorrupt", err)
+	}
+	// The last frame is taken for one torn by a crash, and dropped.
+	if got := l.EndOffset(); got != end-1 {
+		t.Fatalf("EndOffset = %d, want %d", got, end-1)
+	}
+}
@@ -0,0 +1,228 @@
+package commitlog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// FramesContentType is the media type of a response body holding records
+// as frames, in the layout of a segment's store file:
+//
+//	length uint32 | crc32c uint32 | payload
+//
+// Servers send frames copied straight from segment files, so a large
+// read costs no decoding or encoding. FrameDecoder reads them back.
+const FramesContentType = "application/x-commitlog-frames"
+
+// Frames is a range of records ready to be written as frames. It holds
+// open the segment files it copies from, so it must be closed.
+type Frames struct {
+	spans []frameSpan
+	size  int64
+	count int
+	next  int
+}
+
+// frameSpan is a run of frames in a store file, or encoded in data.
+type frameSpan struct {
+	f    *os.File
+	pos  int64
+	n    int64
+	data []byte
+}
+
+// Size returns how many bytes WriteTo will write.
+func (f *Frames) Size() int64 { return f.size }
+
+// Len returns the number of records.
+func (f *Frames) Len() int { return f.count }
+
+// Next returns the offset after the last record, or the offset the
+// range was asked from if it is empty.
+func (f *Frames) Next() int { return f.next }
+
+// WriteTo writes the frames to w. Spans of a segment file are copied
+// with io.Copy from the file itself, which the net package turns into
+// sendfile when w is a TCP connection or an HTTP response with a known
+// length. If the log was truncated after the range was read, WriteTo
+// stops short with io.ErrUnexpectedEOF.
+func (f *Frames) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, s := range f.spans {
+		if s.f == nil {
+			n, err := w.Write(s.data)
+			total += int64(n)
+			if err != nil {
+				return total, err
+			}
+			continue
+		}
+		if _, err := s.f.Seek(s.pos, io.SeekStart); err != nil {
+			return total, err
+		}
+		n, err := io.Copy(w, io.LimitReader(s.f, s.n))
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < s.n {
+			return total, io.ErrUnexpectedEOF
+		}
+	}
+	return total, nil
+}
+
+// Close releases the segment files.
+func (f *Frames) Close() error {
+	var err error
+	for _, s := range f.spans {
+		if s.f != nil {
+			if cerr := s.f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	f.spans = nil
+	return err
+}
+
+// FrameSource is implemented by logs that can return a range of frames
+// without decoding their records.
+type FrameSource interface {
+	ReadFrames(from, max int, maxBytes int64) (*Frames, error)
+}
+
+// ReadFrames returns up to max records starting at from as frames,
+// stopping at the end of the log or once they take maxBytes; the first
+// record is returned whatever its size. A max or maxBytes of zero or
+// less means no limit. It may return fewer records than are available,
+// so callers reading a long range continue from Next. It uses l's
+// ReadFrames method if it has one, and otherwise reads and encodes each
+// record.
+func ReadFrames(l Log, from, max int, maxBytes int64) (*Frames, error) {
+	if t, ok := l.(*Tailable); ok {
+		l = t.Log
+	}
+	if src, ok := l.(FrameSource); ok {
+		return src.ReadFrames(from, max, maxBytes)
+	}
+	return encodeFrames(l, from, max, maxBytes)
+}
+
+// encodeFrames is ReadFrames for logs that keep no frames to copy.
+func encodeFrames(l Log, from, max int, maxBytes int64) (*Frames, error) {
+	if start, end := l.StartOffset(), l.EndOffset(); from < start || from > end {
+		return nil, &ErrOffsetOutOfRange{Offset: from, Start: start, End: end}
+	}
+	end := l.EndOffset()
+	if max > 0 && from+max < end {
+		end = from + max
+	}
+	f := &Frames{next: from}
+	var buf []byte
+	for off := from; off < end; off++ {
+		rec, err := l.Read(off)
+		if err != nil {
+			var oor *ErrOffsetOutOfRange
+			if f.count > 0 && errors.As(err, &oor) {
+				break // truncated while we were reading
+			}
+			return nil, err
+		}
+		frame := encodeRecord(rec)
+		if maxBytes > 0 && f.count > 0 && int64(len(buf)+len(frame)) > maxBytes {
+			break
+		}
+		buf = append(buf, frame...)
+		f.count++
+		f.next = off + 1
+	}
+	f.spans = []frameSpan{{data: buf, n: int64(len(buf))}}
+	f.size = int64(len(buf))
+	return f, nil
+}
+
+// ReadFrames returns frames copied from the segment files. A range
+// starting in an offloaded segment is read and encoded record by record
+// up to the first local segment.
+func (l *FileLog) ReadFrames(from, max int, maxBytes int64) (*Frames, error) {
+	l.mu.RLock()
+	if l.closed {
+		l.mu.RUnlock()
+		return nil, ErrClosed
+	}
+	end := l.active().nextOffset()
+	if from < l.start || from > end {
+		l.mu.RUnlock()
+		return nil, &ErrOffsetOutOfRange{Offset: from, Start: l.start, End: end}
+	}
+	if max > 0 && from+max < end {
+		end = from + max
+	}
+	if first := l.segments[0].base; from < first {
+		l.mu.RUnlock()
+		return encodeFrames(l, from, min(end, first)-from, maxBytes)
+	}
+	defer l.mu.RUnlock()
+
+	f := &Frames{next: from}
+	for off := from; off < end; {
+		s := l.segmentFor(off)
+		i, j := off-s.base, min(end, s.nextOffset())-s.base
+		endPos := func(k int) int64 { // where record k's frame ends
+			if k+1 < len(s.pos) {
+				return s.pos[k+1]
+			}
+			return s.size
+		}
+		if maxBytes > 0 {
+			left := maxBytes - f.size
+			j = i + sort.Search(j-i, func(k int) bool { return endPos(i+k)-s.pos[i] > left })
+			if f.count == 0 && j == i {
+				j = i + 1
+			}
+		}
+		if j == i {
+			break
+		}
+		file, err := os.Open(s.store.Name())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		n := endPos(j-1) - s.pos[i]
+		f.spans = append(f.spans, frameSpan{f: file, pos: s.pos[i], n: n})
+		f.size += n
+		f.count += j - i
+		f.next = s.base + j
+		off = f.next
+		if maxBytes > 0 && f.size >= maxBytes {
+			break
+		}
+	}
+	return f, nil
+}
+
+// FrameDecoder reads records from frames, as written by Frames.WriteTo.
+type FrameDecoder struct {
+	r *bufio.Reader
+}
+
+// NewFrameDecoder returns a FrameDecoder reading from r.
+func NewFrameDecoder(r io.Reader) *FrameDecoder {
+	return &FrameDecoder{r: bufio.NewReaderSize(r, 64<<10)}
+}
+
+// Next returns the next record. It returns io.EOF at the end of the
+// input, io.ErrUnexpectedEOF if it ends inside a frame and ErrCorrupt
+// for a frame that fails its checksum.
+func (d *FrameDecoder) Next() (Record, error) {
+	payload, _, err := readFrame(d.r, -1)
+	if err != nil {
+		return Record{}, err
+	}
+	return decodeRecord(payload)
+}
@@ -0,0 +1,120 @@
+package commitlog_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// decodeFrames writes f to a buffer and decodes it back.
+func decodeFrames(t *testing.T, f *commitlog.Frames) []commitlog.Record {
+	t.Helper()
+	defer f.Close()
+	var buf bytes.Buffer
+	if n, err := f.WriteTo(&buf); err != nil || n != f.Size() {
+		t.Fatalf("WriteTo = %d, %v, want %d bytes", n, err, f.Size())
+	}
+	var recs []commitlog.Record
+	d := commitlog.NewFrameDecoder(&buf)
+	for {
+		rec, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != f.Len() {
+		t.Fatalf("decoded %d records, Len = %d", len(recs), f.Len())
+	}
+	return recs
+}
+
+func TestReadFrames(t *testing.T) {
+	file, err := commitlog.OpenFileLog(t.TempDir(), commitlog.Config{MaxSegmentBytes: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	logs := map[string]commitlog.Log{
+		"file":   commitlog.NewTailable(file),
+		"memory": commitlog.NewMemoryLog(),
+	}
+	for name, l := range logs {
+		t.Run(name, func(t *testing.T) {
+			for i := range 40 {
+				if _, err := l.Append(commitlog.Record{Key: fmt.Sprint(i % 4), Value: fmt.Sprintf("value-%d", i)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := l.DeleteBefore(3); err != nil {
+				t.Fatal(err)
+			}
+
+			// Reading in small pages from the start crosses segments
+			// and returns every record as Read does.
+			for from := 3; from < 40; {
+				f, err := commitlog.ReadFrames(l, from, 0, 100)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if f.Len() == 0 || f.Size() > 100 {
+					t.Fatalf("ReadFrames(%d) = %d records in %d bytes", from, f.Len(), f.Size())
+				}
+				for i, rec := range decodeFrames(t, f) {
+					want, _ := l.Read(from + i)
+					if rec.Offset != want.Offset || rec.Key != want.Key || rec.Value != want.Value || !rec.Timestamp.Equal(want.Timestamp) {
+						t.Fatalf("record %d = %+v, want %+v", from+i, rec, want)
+					}
+				}
+				from = f.Next()
+			}
+
+			if f, err := commitlog.ReadFrames(l, 10, 5, 0); err != nil || f.Len() != 5 || f.Next() != 15 {
+				t.Errorf("ReadFrames(10, max 5) = %d records to %d, %v", f.Len(), f.Next(), err)
+			} else {
+				f.Close()
+			}
+			// The first record comes back even when it exceeds the byte
+			// limit.
+			if f, err := commitlog.ReadFrames(l, 20, 0, 1); err != nil || f.Len() != 1 {
+				t.Errorf("ReadFrames(20, 1 byte) = %d records, %v", f.Len(), err)
+			} else {
+				f.Close()
+			}
+			if f, err := commitlog.ReadFrames(l, 40, 0, 0); err != nil || f.Len() != 0 || f.Size() != 0 || f.Next() != 40 {
+				t.Errorf("ReadFrames at the end = %d records, %v", f.Len(), err)
+			}
+			var oor *commitlog.ErrOffsetOutOfRange
+			if _, err := commitlog.ReadFrames(l, 2, 0, 0); !errors.As(err, &oor) {
+				t.Errorf("ReadFrames below the start = %v, want ErrOffsetOutOfRange", err)
+			}
+		})
+	}
+}
+
+func TestFrameDecoderErrors(t *testing.T) {
+	l := commitlog.NewMemoryLog()
+	l.Append(commitlog.Record{Value: "value"})
+	f, err := commitlog.ReadFrames(l, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	f.WriteTo(&buf)
+	data := buf.Bytes()
+
+	if _, err := commitlog.NewFrameDecoder(bytes.NewReader(data[:len(data)-1])).Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("torn frame: %v, want io.ErrUnexpectedEOF", err)
+	}
+	data[len(data)-1] ^= 0xff
+	if _, err := commitlog.NewFrameDecoder(bytes.NewReader(data)).Next(); !errors.Is(err, commitlog.ErrCorrupt) {
+		t.Errorf("corrupt frame: %v, want ErrCorrupt", err)
+	}
+}
@@ -0,0 +1,159 @@
+package frametcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// Error is an error answer from the server.
+type Error struct {
+	// Code is the machine-readable error code, such as
+	// commitlog.CodeOffsetOutOfRange or CodePartitionNotFound.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Offset, StartOffset and EndOffset are set for offset errors.
+	Offset      *int `json:"offset,omitempty"`
+	StartOffset *int `json:"start_offset,omitempty"`
+	EndOffset   *int `json:"end_offset,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("frametcp server: %s (%s)", e.Message, e.Code)
+}
+
+// Unwrap returns the commitlog error matching the code, so callers can
+// use errors.Is and errors.As as they would against a local log.
+func (e *Error) Unwrap() error {
+	switch e.Code {
+	case commitlog.CodeOffsetOutOfRange, commitlog.CodeTruncated:
+		if e.Offset != nil && e.StartOffset != nil && e.EndOffset != nil {
+			return &commitlog.ErrOffsetOutOfRange{Offset: *e.Offset, Start: *e.StartOffset, End: *e.EndOffset}
+		}
+		if e.Code == commitlog.CodeTruncated {
+			return commitlog.ErrTruncated
+		}
+	case commitlog.CodeCorrupt:
+		return commitlog.ErrCorrupt
+	case commitlog.CodeClosed:
+		return commitlog.ErrClosed
+	}
+	return nil
+}
+
+// logError builds the answer to a log error.
+func logError(err error) *Error {
+	e := &Error{Code: commitlog.ErrorCode(err), Message: err.Error()}
+	var oor *commitlog.ErrOffsetOutOfRange
+	if errors.As(err, &oor) {
+		e.Offset, e.StartOffset, e.EndOffset = &oor.Offset, &oor.Start, &oor.End
+	}
+	return e
+}
+
+// Client reads records from a frametcp server over one connection. Its
+// methods may be called concurrently; requests are sent one at a time.
+type Client struct {
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+	err  error // set once the connection is unusable
+}
+
+// Dial connects to the server at addr.
+func Dial(ctx context.Context, addr string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, r: bufio.NewReaderSize(conn, 64<<10)}, nil
+}
+
+// Read returns the records req asks for and the offset to read from
+// next. An error answer is returned as an *Error; any other error means
+// the connection broke, and every later call returns it too.
+func (c *Client) Read(ctx context.Context, req Request) ([]commitlog.Record, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, 0, c.err
+	}
+	recs, next, err := c.read(ctx, req)
+	var e *Error
+	if err != nil && !errors.As(err, &e) {
+		c.err = err
+		c.conn.Close()
+	}
+	return recs, next, err
+}
+
+func (c *Client) read(ctx context.Context, req Request) ([]commitlog.Record, int, error) {
+	// The connection's deadline is only ever set when ctx is done, so
+	// the failure it causes is always reported as ctx's error.
+	c.conn.SetDeadline(time.Time{})
+	stopped := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetDeadline(time.Unix(1, 0))
+		close(stopped)
+	})
+	defer func() {
+		if !stop() {
+			<-stopped // so it can't undo the next call's deadline
+		}
+	}()
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := c.conn.Write(append(data, '\n')); err != nil {
+		return nil, 0, ctxErr(ctx, err)
+	}
+	line, err := c.r.ReadSlice('\n')
+	if err != nil {
+		return nil, 0, ctxErr(ctx, err)
+	}
+	var h header
+	if err := json.Unmarshal(line, &h); err != nil {
+		return nil, 0, fmt.Errorf("frametcp: bad answer: %w", err)
+	}
+	if h.Error != nil {
+		return nil, 0, h.Error
+	}
+	dec := commitlog.NewFrameDecoder(io.LimitReader(c.r, h.Size))
+	recs := make([]commitlog.Record, 0, h.Count)
+	for range h.Count {
+		rec, err := dec.Next()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, 0, ctxErr(ctx, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, h.Next, nil
+}
+
+// ctxErr returns ctx's error if it is done, since the connection failed
+// because Read stopped it, and err otherwise.
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Close closes the connection, stopping a Read in progress.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
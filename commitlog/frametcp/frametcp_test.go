@@ -0,0 +1,162 @@
+package frametcp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/frametcp"
+)
+
+// source serves one partition, 0 of topic "t".
+type source struct{ l *commitlog.Tailable }
+
+func (s source) Partition(topic string, partition int) (*commitlog.Tailable, bool) {
+	return s.l, topic == "t" && partition == 0
+}
+
+// serve starts a Server for l and returns a connected Client.
+func serve(t *testing.T, l *commitlog.Tailable) (*frametcp.Client, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := frametcp.NewServer(source{l})
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	c, err := frametcp.Dial(context.Background(), ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, ln.Addr().String()
+}
+
+// fileLog returns a file log of n records over several segments, so
+// reads are sent from segment files.
+func fileLog(t *testing.T, n int) *commitlog.Tailable {
+	t.Helper()
+	file, err := commitlog.OpenFileLog(t.TempDir(), commitlog.Config{MaxSegmentBytes: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := commitlog.NewTailable(file)
+	t.Cleanup(func() { l.Close() })
+	for i := range n {
+		if _, err := l.Append(commitlog.Record{Value: fmt.Sprintf("record %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l
+}
+
+func TestRead(t *testing.T) {
+	c, _ := serve(t, fileLog(t, 20))
+	tests := []struct {
+		req      frametcp.Request
+		from     int
+		wantNext int
+	}{
+		{frametcp.Request{Topic: "t", From: 0}, 0, 20},
+		{frametcp.Request{Topic: "t", From: 5, Max: 3}, 5, 8},
+		{frametcp.Request{Topic: "t", From: 18, Max: 10}, 18, 20},
+		{frametcp.Request{Topic: "t", From: 20}, 20, 20},
+		// The first record is sent whatever max_bytes says.
+		{frametcp.Request{Topic: "t", From: 3, MaxBytes: 1}, 3, 4},
+	}
+	// Every request goes over the same connection.
+	for _, tt := range tests {
+		recs, next, err := c.Read(context.Background(), tt.req)
+		if err != nil {
+			t.Fatalf("Read(%+v) = %v", tt.req, err)
+		}
+		if next != tt.wantNext || len(recs) != tt.wantNext-tt.from {
+			t.Fatalf("Read(%+v) = %d records, next %d, want next %d", tt.req, len(recs), next, tt.wantNext)
+		}
+		for i, rec := range recs {
+			if want := fmt.Sprintf("record %d", tt.from+i); rec.Value != want {
+				t.Fatalf("Read(%+v) record %d = %q, want %q", tt.req, i, rec.Value, want)
+			}
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	c, _ := serve(t, fileLog(t, 3))
+
+	_, _, err := c.Read(context.Background(), frametcp.Request{Topic: "other", From: 0})
+	var e *frametcp.Error
+	if !errors.As(err, &e) || e.Code != frametcp.CodePartitionNotFound {
+		t.Fatalf("Read of a missing topic = %v, want %s", err, frametcp.CodePartitionNotFound)
+	}
+
+	_, _, err = c.Read(context.Background(), frametcp.Request{Topic: "t", From: 7})
+	var oor *commitlog.ErrOffsetOutOfRange
+	if !errors.As(err, &oor) || oor.Offset != 7 || oor.Start != 0 || oor.End != 3 {
+		t.Fatalf("Read past the end = %v, want offset 7 out of range [0, 3)", err)
+	}
+
+	_, _, err = c.Read(context.Background(), frametcp.Request{Topic: "t", From: -1})
+	if !errors.As(err, &e) || e.Code != frametcp.CodeBadRequest {
+		t.Fatalf("Read from -1 = %v, want %s", err, frametcp.CodeBadRequest)
+	}
+
+	// Error answers leave the connection usable.
+	if recs, _, err := c.Read(context.Background(), frametcp.Request{Topic: "t", From: 0}); err != nil || len(recs) != 3 {
+		t.Fatalf("Read after errors = %d records, %v", len(recs), err)
+	}
+}
+
+func TestReadWait(t *testing.T) {
+	l := commitlog.NewTailable(commitlog.NewMemoryLog())
+	c, _ := serve(t, l)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		l.Append(commitlog.Record{Value: "late"})
+	}()
+	recs, next, err := c.Read(context.Background(), frametcp.Request{Topic: "t", From: 0, WaitMillis: 5000})
+	if err != nil || len(recs) != 1 || recs[0].Value != "late" || next != 1 {
+		t.Fatalf("Read with wait = %v, next %d, %v", recs, next, err)
+	}
+
+	// Without a record in time, the answer is empty.
+	recs, next, err = c.Read(context.Background(), frametcp.Request{Topic: "t", From: 1, WaitMillis: 20})
+	if err != nil || len(recs) != 0 || next != 1 {
+		t.Fatalf("Read with an expired wait = %v, next %d, %v", recs, next, err)
+	}
+}
+
+func TestReadCancel(t *testing.T) {
+	c, _ := serve(t, commitlog.NewTailable(commitlog.NewMemoryLog()))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err := c.Read(ctx, frametcp.Request{Topic: "t", From: 0, WaitMillis: 5000})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Read cancelled while waiting = %v, want %v", err, context.DeadlineExceeded)
+	}
+	// The answer may still arrive, so the connection is not reused.
+	if _, _, err := c.Read(context.Background(), frametcp.Request{Topic: "t", From: 0}); err == nil {
+		t.Fatal("Read after a cancelled Read succeeded")
+	}
+}
+
+func TestBadRequestClosesConnection(t *testing.T) {
+	_, addr := serve(t, fileLog(t, 1))
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("not json\n")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("read %d bytes after a bad request, want the connection closed", n)
+	}
+}
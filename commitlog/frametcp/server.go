@@ -0,0 +1,266 @@
+// Package frametcp serves ranges of records as frames over raw TCP, for
+// consumers that read a lot and want less overhead than HTTP. The frames
+// are copied from segment files to the connection with sendfile, as the
+// HTTP server does for a response of commitlog.FramesContentType.
+//
+// A client sends requests as lines of JSON:
+//
+//	{"topic": "orders", "partition": 0, "from": 10, "max": 100, "max_bytes": 1048576, "wait_ms": 1000}
+//
+// The server answers each in order with a line of JSON and, unless it
+// holds an error, size bytes of frames in the layout of a segment's store
+// file, which commitlog.FrameDecoder reads:
+//
+//	{"count": 3, "next": 13, "size": 120}
+//	{"error": {"code": "offset_out_of_range", "message": "...", "offset": 99, "start_offset": 0, "end_offset": 13}}
+//
+// A request the server can't parse closes the connection, and so does
+// a range truncated while its frames are being sent, since the size
+// the server promised can't be met.
+package frametcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// Source is the commit log a Server serves. Its methods must be safe
+// for concurrent use.
+type Source interface {
+	// Partition returns one partition's log, or false if there is no
+	// such topic or partition.
+	Partition(topic string, partition int) (*commitlog.Tailable, bool)
+}
+
+// Limits on a request, like the HTTP server's.
+const (
+	// DefaultMaxBytes limits the frames of a request that sets no limit.
+	DefaultMaxBytes = 16 << 20
+	// MaxBytes caps the frames of any request.
+	MaxBytes = 64 << 20
+	// MaxWait caps how long a request may wait for records.
+	MaxWait = 30 * time.Second
+	// maxRequestBytes caps a request line.
+	maxRequestBytes = 64 << 10
+)
+
+// Machine-readable codes for request problems; log errors use the codes
+// from commitlog.ErrorCode.
+const (
+	CodeBadRequest        = "bad_request"
+	CodePartitionNotFound = "partition_not_found"
+)
+
+// Request asks for records of a partition as frames.
+type Request struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	// From is the offset of the first record.
+	From int `json:"from"`
+	// Max and MaxBytes limit the records and their bytes, as for
+	// commitlog.ReadFrames; the first record is sent whatever its size.
+	// Zero means no limit on records and DefaultMaxBytes on bytes.
+	Max      int   `json:"max,omitempty"`
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+	// WaitMillis is how long to wait for a record at From if there is
+	// none yet, up to MaxWait.
+	WaitMillis int64 `json:"wait_ms,omitempty"`
+}
+
+// header is the line that answers a Request.
+type header struct {
+	Count int    `json:"count"`
+	Next  int    `json:"next"`
+	Size  int64  `json:"size"`
+	Error *Error `json:"error,omitempty"`
+}
+
+// Server serves a Source's partitions to frametcp clients.
+type Server struct {
+	source Source
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewServer returns a Server for src.
+func NewServer(src Source) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		source:    src,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves it.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Close is called, when it returns
+// net.ErrClosed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return net.ErrClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return net.ErrClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return net.ErrClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the listeners and closes every connection.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+// serveConn answers a connection's requests in order.
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+	r := bufio.NewReaderSize(conn, maxRequestBytes)
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("frametcp: %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		var req Request
+		if err := json.Unmarshal(line, &req); err != nil {
+			log.Printf("frametcp: %s: bad request: %v", conn.RemoteAddr(), err)
+			return
+		}
+		if err := s.serve(conn, &req); err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("frametcp: %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+// serve answers one request. It returns an error only if the connection
+// can't be used for the next one.
+func (s *Server) serve(conn net.Conn, req *Request) error {
+	f, e := s.read(req)
+	if e != nil {
+		return writeHeader(conn, struct {
+			Error *Error `json:"error"`
+		}{e})
+	}
+	defer f.Close()
+	if err := writeHeader(conn, header{Count: f.Len(), Next: f.Next(), Size: f.Size()}); err != nil {
+		return err
+	}
+	// On a TCP connection this is sendfile from each segment file.
+	if _, err := f.WriteTo(conn); err != nil {
+		return fmt.Errorf("sending frames: %w", err)
+	}
+	return nil
+}
+
+// read returns the frames a request asks for, waiting for them if it
+// asks to.
+func (s *Server) read(req *Request) (*commitlog.Frames, *Error) {
+	if req.From < 0 || req.Max < 0 || req.MaxBytes < 0 || req.WaitMillis < 0 {
+		return nil, &Error{Code: CodeBadRequest, Message: "negative from, max, max_bytes or wait_ms"}
+	}
+	l, ok := s.source.Partition(req.Topic, req.Partition)
+	if !ok {
+		return nil, &Error{Code: CodePartitionNotFound, Message: fmt.Sprintf("no partition %d of topic %q", req.Partition, req.Topic)}
+	}
+	maxBytes := int64(DefaultMaxBytes)
+	if req.MaxBytes > 0 {
+		maxBytes = min(req.MaxBytes, MaxBytes)
+	}
+	if wait := min(time.Duration(req.WaitMillis)*time.Millisecond, MaxWait); wait > 0 && req.From >= l.EndOffset() {
+		ctx, cancel := context.WithTimeout(s.ctx, wait)
+		l.Wait(ctx, req.From)
+		cancel()
+	}
+	f, err := commitlog.ReadFrames(l, req.From, req.Max, maxBytes)
+	if err != nil {
+		return nil, logError(err)
+	}
+	return f, nil
+}
+
+// writeHeader writes the line answering a request, a header or an
+// error.
+func writeHeader(w io.Writer, h any) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,201 @@
+package commitlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// CheckOptions chooses the repairs Check makes. With neither set it only
+// reads.
+type CheckOptions struct {
+	// RebuildIndex rewrites index files that disagree with an intact
+	// store file.
+	RebuildIndex bool
+	// Truncate cuts the log at its first bad record: that segment's
+	// store is truncated just before it, its index rewritten, and every
+	// later segment removed. Records from the bad one onwards are lost.
+	Truncate bool
+}
+
+// SegmentCheck is what Check found in one segment.
+type SegmentCheck struct {
+	Base int
+	// Records is the number of intact records before the first bad one.
+	Records int
+	// BadOffset is the first offset in the segment that can't be read
+	// back intact, or -1 if there is none. It is set with StoreErr, or
+	// with GapErr to the segment's base.
+	BadOffset int
+	// StoreErr is a *StoreError for the first bad frame: a checksum
+	// mismatch or misplaced record (ErrCorrupt) or a torn write
+	// (io.ErrUnexpectedEOF).
+	StoreErr error
+	// IndexErr describes how the index disagrees with the store.
+	IndexErr error
+	// GapErr reports that the segment doesn't start where the previous
+	// one ends.
+	GapErr error
+	// Repair describes what was done to the segment, if anything.
+	Repair string
+}
+
+// OK reports whether the segment had no problems.
+func (c *SegmentCheck) OK() bool {
+	return c.StoreErr == nil && c.IndexErr == nil && c.GapErr == nil
+}
+
+// CheckReport is the result of checking a log directory.
+type CheckReport struct {
+	Dir      string
+	Segments []SegmentCheck
+	// FirstBadOffset is the lowest offset that can't be read back
+	// intact, or -1 if every record can.
+	FirstBadOffset int
+}
+
+// OK reports whether every segment was healthy when checked. A repaired
+// log is not OK, but a second Check of it will be.
+func (r *CheckReport) OK() bool {
+	for i := range r.Segments {
+		if !r.Segments[i].OK() {
+			return false
+		}
+	}
+	return true
+}
+
+// Check verifies every segment in the log directory dir: each frame's
+// checksum, that records hold consecutive offsets, that the index points
+// at each record, and that segments follow on from one another. It makes
+// the repairs chosen by opts. The log must not be open while Check runs.
+//
+// Problems are reported in the CheckReport; the error is only for
+// failures to read or repair the files themselves.
+func Check(dir string, opts CheckOptions) (*CheckReport, error) {
+	files, err := SegmentFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	report := &CheckReport{Dir: dir, FirstBadOffset: -1}
+	next := -1 // offset the next segment should start at
+	for _, f := range files {
+		c, positions, err := checkSegment(f)
+		if err != nil {
+			return report, err
+		}
+		if next >= 0 && f.Base != next {
+			c.GapErr = fmt.Errorf("%w: segment starts at %d but the previous one ends at %d", ErrCorrupt, f.Base, next)
+			c.BadOffset = f.Base
+		}
+		next = f.Base + c.Records
+		if c.StoreErr != nil {
+			// Where this segment really ends is unknown, so
+			// don't judge the next one by it.
+			next = -1
+		}
+
+		switch {
+		case report.FirstBadOffset >= 0:
+			// Past the first bad record: with Truncate this
+			// segment goes too.
+			if opts.Truncate {
+				if err := removeSegmentFiles(f); err != nil {
+					return report, err
+				}
+				c.Repair = "removed"
+			}
+		case c.GapErr != nil:
+			report.FirstBadOffset = c.BadOffset
+			if opts.Truncate {
+				if err := removeSegmentFiles(f); err != nil {
+					return report, err
+				}
+				c.Repair = "removed"
+			}
+		case c.StoreErr != nil:
+			report.FirstBadOffset = c.BadOffset
+			if opts.Truncate {
+				var se *StoreError
+				errors.As(c.StoreErr, &se)
+				if err := os.Truncate(f.StorePath, se.Pos); err != nil {
+					return report, err
+				}
+				if err := writeIndexFile(f.IndexPath, positions); err != nil {
+					return report, err
+				}
+				c.Repair = fmt.Sprintf("truncated to %d records", c.Records)
+			}
+		case c.IndexErr != nil && opts.RebuildIndex:
+			if err := writeIndexFile(f.IndexPath, positions); err != nil {
+				return report, err
+			}
+			c.Repair = "index rebuilt"
+		}
+		report.Segments = append(report.Segments, c)
+	}
+	return report, nil
+}
+
+// checkSegment reads one segment and returns its check along with the
+// store positions of its intact records.
+func checkSegment(f SegmentFile) (SegmentCheck, []int64, error) {
+	c := SegmentCheck{Base: f.Base, BadOffset: -1}
+	var positions []int64
+	err := ScanStore(f.StorePath, func(pos int64, rec Record) error {
+		if want := f.Base + len(positions); rec.Offset != want {
+			return &StoreError{Pos: pos, Err: fmt.Errorf("%w: record has offset %d, want %d", ErrCorrupt, rec.Offset, want)}
+		}
+		positions = append(positions, pos)
+		return nil
+	})
+	var se *StoreError
+	if errors.As(err, &se) {
+		c.StoreErr = err
+		c.BadOffset = f.Base + len(positions)
+	} else if err != nil {
+		return c, nil, err
+	}
+	c.Records = len(positions)
+
+	index, err := ReadIndexFile(f.IndexPath)
+	if err != nil && !os.IsNotExist(err) {
+		return c, nil, err
+	}
+	switch {
+	case os.IsNotExist(err):
+		c.IndexErr = errors.New("index file is missing")
+	case f.IndexBytes%entrySize != 0:
+		c.IndexErr = fmt.Errorf("index file has a partial entry (%d bytes)", f.IndexBytes)
+	case c.StoreErr == nil && len(index) != len(positions):
+		c.IndexErr = fmt.Errorf("index has %d entries for %d records", len(index), len(positions))
+	default:
+		for i := 0; i < min(len(index), len(positions)); i++ {
+			if index[i] != positions[i] {
+				c.IndexErr = fmt.Errorf("index entry for offset %d points at position %d, want %d",
+					f.Base+i, index[i], positions[i])
+				break
+			}
+		}
+	}
+	return c, positions, nil
+}
+
+// writeIndexFile replaces the index file at path with positions.
+func writeIndexFile(path string, positions []int64) error {
+	buf := make([]byte, 0, len(positions)*entrySize)
+	for _, p := range positions {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(p))
+	}
+	return WriteFileAtomic(path, buf)
+}
+
+func removeSegmentFiles(f SegmentFile) error {
+	for _, path := range []string{f.StorePath, f.IndexPath} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
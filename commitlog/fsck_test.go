@@ -0,0 +1,123 @@
+package commitlog_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// writeLog fills a FileLog in a new directory with n records across
+// several small segments.
+func writeLog(t *testing.T, n int) string {
+	t.Helper()
+	dir := t.TempDir()
+	l, err := commitlog.OpenFileLog(dir, commitlog.Config{MaxSegmentBytes: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if _, err := l.Append(commitlog.Record{Value: "value"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCheckHealthy(t *testing.T) {
+	dir := writeLog(t, 30)
+	report, err := commitlog.Check(dir, commitlog.CheckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.FirstBadOffset != -1 || len(report.Segments) < 2 {
+		t.Fatalf("report = %+v, want several healthy segments", report)
+	}
+}
+
+func TestCheckTruncate(t *testing.T) {
+	dir := writeLog(t, 30)
+	files, _ := commitlog.SegmentFiles(dir)
+	if len(files) < 3 {
+		t.Fatalf("got %d segments, want at least 3", len(files))
+	}
+
+	// Corrupt the second record of the second segment.
+	bad := files[1]
+	positions, err := commitlog.ReadIndexFile(bad.IndexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(bad.StorePath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte{0xff}, positions[1]+12)
+	f.Close()
+
+	report, err := commitlog.Check(dir, commitlog.CheckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bad.Base + 1
+	if report.FirstBadOffset != want {
+		t.Fatalf("FirstBadOffset = %d, want %d", report.FirstBadOffset, want)
+	}
+	if err := report.Segments[1].StoreErr; !errors.Is(err, commitlog.ErrCorrupt) {
+		t.Fatalf("StoreErr = %v, want ErrCorrupt", err)
+	}
+
+	if _, err := commitlog.Check(dir, commitlog.CheckOptions{Truncate: true}); err != nil {
+		t.Fatal(err)
+	}
+	report, err = commitlog.Check(dir, commitlog.CheckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || len(report.Segments) != 2 {
+		t.Fatalf("after repair report = %+v, want 2 healthy segments", report)
+	}
+	l, err := commitlog.OpenFileLog(dir, commitlog.Config{MaxSegmentBytes: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if end := l.EndOffset(); end != want {
+		t.Fatalf("EndOffset = %d, want %d", end, want)
+	}
+}
+
+func TestCheckRebuildIndex(t *testing.T) {
+	dir := writeLog(t, 30)
+	files, _ := commitlog.SegmentFiles(dir)
+	if err := os.WriteFile(files[0].IndexPath, []byte{0, 0, 0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(files[1].IndexPath); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := commitlog.Check(dir, commitlog.CheckOptions{RebuildIndex: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range report.Segments[:2] {
+		if c.IndexErr == nil || c.Repair != "index rebuilt" {
+			t.Fatalf("segment %d: %+v, want a rebuilt index", c.Base, c)
+		}
+	}
+	if report.FirstBadOffset != -1 {
+		t.Fatalf("FirstBadOffset = %d, want -1 for index damage", report.FirstBadOffset)
+	}
+	report, err = commitlog.Check(dir, commitlog.CheckOptions{})
+	if err != nil || !report.OK() {
+		t.Fatalf("after rebuild report = %+v, %v", report, err)
+	}
+	if _, err := os.Stat(files[1].IndexPath); err != nil {
+		t.Fatal(err)
+	}
+}
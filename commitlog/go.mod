@@ -0,0 +1,13 @@
+module github.com/Ramykaz/Distributed-Systems-/commitlog
+
+go 1.25.2
+
+require (
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250804133106-a7a43d27e69b
+	google.golang.org/grpc v1.76.0
+)
+
+require (
+	golang.org/x/sys v0.34.0 // indirect
+	google.golang.org/protobuf v1.36.6 // indirect
+)
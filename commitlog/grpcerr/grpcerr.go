@@ -0,0 +1,53 @@
+// Package grpcerr maps commit log errors to gRPC status errors, for gRPC
+// front ends to the log.
+package grpcerr
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error converts err into a gRPC status error. The status carries an
+// ErrorInfo detail whose reason is commitlog.ErrorCode(err), and for out
+// of range offsets the valid range as metadata.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	reason := commitlog.ErrorCode(err)
+	meta := map[string]string{}
+	var oor *commitlog.ErrOffsetOutOfRange
+	if errors.As(err, &oor) {
+		meta["start_offset"] = strconv.Itoa(oor.Start)
+		meta["end_offset"] = strconv.Itoa(oor.End)
+	}
+	st := status.New(Code(err), err.Error())
+	if withInfo, derr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   "commitlog",
+		Metadata: meta,
+	}); derr == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
+
+// Code returns the gRPC code for err.
+func Code(err error) codes.Code {
+	switch commitlog.ErrorCode(err) {
+	case commitlog.CodeOffsetOutOfRange:
+		return codes.OutOfRange
+	case commitlog.CodeTruncated:
+		return codes.FailedPrecondition
+	case commitlog.CodeCorrupt:
+		return codes.DataLoss
+	case commitlog.CodeClosed:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
@@ -0,0 +1,73 @@
+package grpcerr_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/grpcerr"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestError(t *testing.T) {
+	truncated := &commitlog.ErrOffsetOutOfRange{Offset: 1, Start: 3, End: 9}
+	beyond := &commitlog.ErrOffsetOutOfRange{Offset: 12, Start: 3, End: 9}
+	tests := []struct {
+		name   string
+		err    error
+		code   codes.Code
+		reason string
+		// meta is the valid range, for offset errors.
+		meta map[string]string
+	}{
+		{"truncated", commitlog.ErrTruncated, codes.FailedPrecondition, commitlog.CodeTruncated, nil},
+		{"offset deleted", truncated, codes.FailedPrecondition, commitlog.CodeTruncated, map[string]string{"start_offset": "3", "end_offset": "9"}},
+		{"offset past the end", beyond, codes.OutOfRange, commitlog.CodeOffsetOutOfRange, map[string]string{"start_offset": "3", "end_offset": "9"}},
+		{"corrupt", commitlog.ErrCorrupt, codes.DataLoss, commitlog.CodeCorrupt, nil},
+		{"closed", commitlog.ErrClosed, codes.Unavailable, commitlog.CodeClosed, nil},
+		{"object not found", commitlog.ErrObjectNotFound, codes.Internal, commitlog.CodeInternal, nil},
+		{"other", errors.New("disk on fire"), codes.Internal, commitlog.CodeInternal, nil},
+
+		// Wrapped errors map as what they wrap.
+		{"wrapped truncated", fmt.Errorf("reading: %w", commitlog.ErrTruncated), codes.FailedPrecondition, commitlog.CodeTruncated, nil},
+		{"wrapped offset deleted", fmt.Errorf("reading: %w", truncated), codes.FailedPrecondition, commitlog.CodeTruncated, map[string]string{"start_offset": "3", "end_offset": "9"}},
+		{"wrapped offset past the end", fmt.Errorf("reading: %w", beyond), codes.OutOfRange, commitlog.CodeOffsetOutOfRange, map[string]string{"start_offset": "3", "end_offset": "9"}},
+		{"wrapped corrupt", fmt.Errorf("segment 4: %w", commitlog.ErrCorrupt), codes.DataLoss, commitlog.CodeCorrupt, nil},
+		{"wrapped closed", fmt.Errorf("append: %w", commitlog.ErrClosed), codes.Unavailable, commitlog.CodeClosed, nil},
+		{"joined", errors.Join(errors.New("retrying"), commitlog.ErrCorrupt), codes.DataLoss, commitlog.CodeCorrupt, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := grpcerr.Code(tt.err); got != tt.code {
+				t.Fatalf("Code = %v, want %v", got, tt.code)
+			}
+			st, ok := status.FromError(grpcerr.Error(tt.err))
+			if !ok || st.Code() != tt.code || st.Message() != tt.err.Error() {
+				t.Fatalf("Error = %v, want code %v and message %q", st, tt.code, tt.err.Error())
+			}
+			details := st.Details()
+			if len(details) != 1 {
+				t.Fatalf("details = %v, want an ErrorInfo", details)
+			}
+			info, ok := details[0].(*errdetails.ErrorInfo)
+			if !ok || info.Reason != tt.reason || info.Domain != "commitlog" {
+				t.Fatalf("detail = %v, want reason %q in domain commitlog", details[0], tt.reason)
+			}
+			if len(info.Metadata) != len(tt.meta) {
+				t.Fatalf("metadata = %v, want %v", info.Metadata, tt.meta)
+			}
+			for k, v := range tt.meta {
+				if info.Metadata[k] != v {
+					t.Fatalf("metadata = %v, want %v", info.Metadata, tt.meta)
+				}
+			}
+		})
+	}
+
+	if err := grpcerr.Error(nil); err != nil {
+		t.Fatalf("Error(nil) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,107 @@
+package commitlog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SegmentFile describes the files of one segment in a log directory.
+type SegmentFile struct {
+	Base       int
+	StorePath  string
+	IndexPath  string
+	StoreBytes int64
+	IndexBytes int64
+}
+
+// SegmentFiles lists the segments in the log directory dir, in offset
+// order, without opening the log. It is meant for offline tools.
+func SegmentFiles(dir string) ([]SegmentFile, error) {
+	bases, err := segmentBases(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]SegmentFile, 0, len(bases))
+	for _, base := range bases {
+		f := SegmentFile{
+			Base:      base,
+			StorePath: segmentPath(dir, base, storeExt),
+			IndexPath: segmentPath(dir, base, indexExt),
+		}
+		if fi, err := os.Stat(f.StorePath); err == nil {
+			f.StoreBytes = fi.Size()
+		}
+		if fi, err := os.Stat(f.IndexPath); err == nil {
+			f.IndexBytes = fi.Size()
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// ReadIndexFile returns the store positions recorded in an index file.
+// A trailing partial entry is ignored.
+func ReadIndexFile(path string) ([]int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readIndex(f)
+}
+
+// StoreError reports where a store file stopped being readable.
+type StoreError struct {
+	Pos int64
+	Err error
+}
+
+func (e *StoreError) Error() string {
+	return fmt.Sprintf("at position %d: %v", e.Pos, e.Err)
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+// ScanStore calls fn with each record in the store file at path and the
+// position of its frame, in order. It stops at the end of the file, when
+// fn returns an error, or at the first unreadable frame, which it
+// reports as a *StoreError wrapping ErrCorrupt or io.ErrUnexpectedEOF.
+func ScanStore(path string, fn func(pos int64, rec Record) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(f)
+	var pos int64
+	for {
+		payload, n, err := readFrame(r, fi.Size()-pos)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if !errors.Is(err, ErrCorrupt) {
+				err = io.ErrUnexpectedEOF
+			}
+			return &StoreError{Pos: pos, Err: err}
+		}
+		rec, err := decodeRecord(payload)
+		if err != nil {
+			return &StoreError{Pos: pos, Err: err}
+		}
+		if err := fn(pos, rec); err != nil {
+			return err
+		}
+		pos += n
+	}
+}
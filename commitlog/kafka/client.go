@@ -0,0 +1,320 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// Node is a broker as Metadata and FindCoordinator describe it.
+type Node struct {
+	ID   int32
+	Host string
+	Port int32
+}
+
+// FetchResult is what a fetch returned for a partition.
+type FetchResult struct {
+	Records        []commitlog.Record
+	HighWatermark  int
+	LogStartOffset int
+}
+
+// Client sends requests to one broker over one connection, one at a
+// time. It uses the highest version of each API that both it and the
+// broker support.
+type Client struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	clientID string
+
+	mu          sync.Mutex
+	correlation int32
+	versions    map[int16]int16
+	err         error // set once the connection is unusable
+}
+
+// Dial connects to the broker at addr and agrees API versions with it.
+func Dial(ctx context.Context, addr string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{conn: conn, r: bufio.NewReader(conn), clientID: "commitlog-kafka", versions: map[int16]int16{apiApiVersions: 2}}
+	var resp apiVersionsResponse
+	if err := c.roundTrip(ctx, apiApiVersions, &apiVersionsRequest{}, &resp); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := codeError(resp.ErrorCode); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.versions = map[int16]int16{}
+	for _, theirs := range resp.APIKeys {
+		ours, ok := supportedRange(theirs.Key)
+		if !ok || theirs.Max < ours.Min || theirs.Min > ours.Max {
+			continue
+		}
+		c.versions[theirs.Key] = min(ours.Max, theirs.Max)
+	}
+	return c, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// roundTrip sends req and reads its response into resp, or just sends
+// it if resp is nil.
+func (c *Client) roundTrip(ctx context.Context, key int16, req, resp message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	v, ok := c.versions[key]
+	if !ok {
+		return fmt.Errorf("kafka: broker supports no common version of API key %d", key)
+	}
+	c.correlation++
+	h := requestHeader{Key: key, Version: v, CorrelationID: c.correlation, ClientID: c.clientID}
+	w := newWriter()
+	h.fields(w)
+	req.fields(w, v)
+	if w.err != nil {
+		return w.err
+	}
+
+	// Interrupt blocked I/O when ctx is done. The connection is then
+	// mid-message, so it can't be used again.
+	deadline, _ := ctx.Deadline()
+	c.conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { c.conn.SetDeadline(time.Now()) })
+	defer stop()
+	fail := func(err error) error {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		c.err = fmt.Errorf("kafka: connection unusable after: %w", err)
+		c.conn.Close()
+		return err
+	}
+
+	if err := writeFrame(c.conn, w.buf); err != nil {
+		return fail(err)
+	}
+	if resp == nil {
+		return nil
+	}
+	frame, err := readFrame(c.r)
+	if err != nil {
+		return fail(err)
+	}
+	r := newReader(frame)
+	var correlation int32
+	r.i32(&correlation)
+	if r.err == nil && correlation != c.correlation {
+		return fail(fmt.Errorf("kafka: response for request %d, want %d", correlation, c.correlation))
+	}
+	if err := decode(r, resp, v); err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+// Metadata returns the brokers and the named topics, or every topic if
+// none are named. It fails with ErrUnknownTopicOrPartition if a named
+// topic doesn't exist.
+func (c *Client) Metadata(ctx context.Context, topics ...string) ([]Node, []Topic, error) {
+	req := metadataRequest{Topics: topics}
+	var resp metadataResponse
+	if err := c.roundTrip(ctx, apiMetadata, &req, &resp); err != nil {
+		return nil, nil, err
+	}
+	var nodes []Node
+	for _, b := range resp.Brokers {
+		nodes = append(nodes, Node{ID: b.NodeID, Host: b.Host, Port: b.Port})
+	}
+	var ts []Topic
+	for _, t := range resp.Topics {
+		if err := codeError(t.ErrorCode); err != nil {
+			return nil, nil, fmt.Errorf("topic %s: %w", t.Name, err)
+		}
+		ts = append(ts, Topic{Name: t.Name, Partitions: len(t.Partitions)})
+	}
+	return nodes, ts, nil
+}
+
+// Produce appends recs to a partition, waiting for them to be written,
+// and returns the first one's offset. Records are sent in one batch,
+// gzip-compressed if compress is set.
+func (c *Client) Produce(ctx context.Context, topic string, partition int, recs []commitlog.Record, compress bool) (int, error) {
+	if len(recs) == 0 {
+		return 0, errors.New("kafka: no records to produce")
+	}
+	batch := make([]commitlog.Record, len(recs))
+	for i, rec := range recs {
+		batch[i] = rec
+		batch[i].Offset = i
+		if rec.Timestamp.IsZero() {
+			batch[i].Timestamp = time.Now()
+		}
+	}
+	data, err := encodeBatch(batch, compress)
+	if err != nil {
+		return 0, err
+	}
+	req := produceRequest{Acks: -1, TimeoutMs: 30000, Topics: []produceTopic{{
+		Name:       topic,
+		Partitions: []producePartition{{Index: int32(partition), Records: data}},
+	}}}
+	var resp produceResponse
+	if err := c.roundTrip(ctx, apiProduce, &req, &resp); err != nil {
+		return 0, err
+	}
+	p, err := onlyPartition(resp.Topics, func(t produceTopicResponse) []producePartitionResponse { return t.Partitions })
+	if err != nil {
+		return 0, err
+	}
+	if err := codeError(p.ErrorCode); err != nil {
+		return 0, err
+	}
+	return int(p.BaseOffset), nil
+}
+
+// Fetch returns records of a partition from offset, waiting up to
+// maxWait for some if there are none yet. It returns at most about
+// maxBytes of records, but always at least one if there are any.
+func (c *Client) Fetch(ctx context.Context, topic string, partition, offset int, maxWait time.Duration, maxBytes int) (FetchResult, error) {
+	req := fetchRequest{
+		ReplicaID:    -1,
+		MaxWaitMs:    int32(maxWait / time.Millisecond),
+		MinBytes:     1,
+		MaxBytes:     int32(maxBytes),
+		SessionEpoch: -1,
+		Topics: []fetchTopic{{Name: topic, Partitions: []fetchPartition{{
+			Index:              int32(partition),
+			CurrentLeaderEpoch: -1,
+			FetchOffset:        int64(offset),
+			LogStartOffset:     -1,
+			MaxBytes:           int32(maxBytes),
+		}}}},
+	}
+	var resp fetchResponse
+	if err := c.roundTrip(ctx, apiFetch, &req, &resp); err != nil {
+		return FetchResult{}, err
+	}
+	if err := codeError(resp.ErrorCode); err != nil {
+		return FetchResult{}, err
+	}
+	p, err := onlyPartition(resp.Topics, func(t fetchTopicResponse) []fetchPartitionResponse { return t.Partitions })
+	if err != nil {
+		return FetchResult{}, err
+	}
+	if err := codeError(p.ErrorCode); err != nil {
+		return FetchResult{}, err
+	}
+	recs, err := decodeBatches(p.Records, true)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	// A batch may start before the offset asked for.
+	for len(recs) > 0 && recs[0].Offset < offset {
+		recs = recs[1:]
+	}
+	return FetchResult{Records: recs, HighWatermark: int(p.HighWatermark), LogStartOffset: int(p.LogStartOffset)}, nil
+}
+
+// ListOffsets returns the first offset of a partition whose record's
+// timestamp, in Unix milliseconds, is at least timestamp, or -1 if there
+// is none. Latest and Earliest give the partition's end and start.
+func (c *Client) ListOffsets(ctx context.Context, topic string, partition int, timestamp int64) (int, error) {
+	req := listOffsetsRequest{ReplicaID: -1, Topics: []listOffsetsTopic{{Name: topic, Partitions: []listOffsetsPartition{{
+		Index:              int32(partition),
+		CurrentLeaderEpoch: -1,
+		Timestamp:          timestamp,
+	}}}}}
+	var resp listOffsetsResponse
+	if err := c.roundTrip(ctx, apiListOffsets, &req, &resp); err != nil {
+		return 0, err
+	}
+	p, err := onlyPartition(resp.Topics, func(t listOffsetsTopicResponse) []listOffsetsPartitionResponse { return t.Partitions })
+	if err != nil {
+		return 0, err
+	}
+	if err := codeError(p.ErrorCode); err != nil {
+		return 0, err
+	}
+	return int(p.Offset), nil
+}
+
+// CommitOffset commits a group's offset for a partition, outside any
+// group generation.
+func (c *Client) CommitOffset(ctx context.Context, group, topic string, partition, offset int, metadata string) error {
+	req := offsetCommitRequest{GroupID: group, GenerationID: -1, RetentionMs: -1, Topics: []offsetCommitTopic{{
+		Name:       topic,
+		Partitions: []offsetCommitPartition{{Index: int32(partition), Offset: int64(offset), LeaderEpoch: -1, Metadata: metadata}},
+	}}}
+	var resp offsetCommitResponse
+	if err := c.roundTrip(ctx, apiOffsetCommit, &req, &resp); err != nil {
+		return err
+	}
+	p, err := onlyPartition(resp.Topics, func(t offsetCommitTopicResponse) []partitionError { return t.Partitions })
+	if err != nil {
+		return err
+	}
+	return codeError(p.ErrorCode)
+}
+
+// FetchOffset returns a group's committed offset for a partition and its
+// metadata, with an offset of -1 if it has committed none.
+func (c *Client) FetchOffset(ctx context.Context, group, topic string, partition int) (int, string, error) {
+	req := offsetFetchRequest{GroupID: group, Topics: []offsetFetchTopic{{Name: topic, Partitions: []int32{int32(partition)}}}}
+	var resp offsetFetchResponse
+	if err := c.roundTrip(ctx, apiOffsetFetch, &req, &resp); err != nil {
+		return 0, "", err
+	}
+	if err := codeError(resp.ErrorCode); err != nil {
+		return 0, "", err
+	}
+	p, err := onlyPartition(resp.Topics, func(t offsetFetchTopicResponse) []offsetFetchPartitionResponse { return t.Partitions })
+	if err != nil {
+		return 0, "", err
+	}
+	if err := codeError(p.ErrorCode); err != nil {
+		return 0, "", err
+	}
+	return int(p.Offset), p.Metadata, nil
+}
+
+// FindCoordinator returns the broker coordinating a consumer group.
+func (c *Client) FindCoordinator(ctx context.Context, group string) (Node, error) {
+	req := findCoordinatorRequest{Key: group}
+	var resp findCoordinatorResponse
+	if err := c.roundTrip(ctx, apiFindCoordinator, &req, &resp); err != nil {
+		return Node{}, err
+	}
+	if err := codeError(resp.ErrorCode); err != nil {
+		return Node{}, err
+	}
+	return Node{ID: resp.NodeID, Host: resp.Host, Port: resp.Port}, nil
+}
+
+// onlyPartition returns the single partition of a response to a request
+// for one partition.
+func onlyPartition[T, P any](topics []T, partitions func(T) []P) (P, error) {
+	var zero P
+	if len(topics) != 1 || len(partitions(topics[0])) != 1 {
+		return zero, errors.New("kafka: response does not hold the one partition asked for")
+	}
+	return partitions(topics[0])[0], nil
+}
@@ -0,0 +1,339 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// memBroker is a Broker over in-memory logs.
+type memBroker struct {
+	mu      sync.Mutex
+	topics  map[string][]*commitlog.Tailable
+	offsets map[string][]GroupOffset
+}
+
+func newMemBroker(topics map[string]int) *memBroker {
+	b := &memBroker{topics: map[string][]*commitlog.Tailable{}, offsets: map[string][]GroupOffset{}}
+	for name, n := range topics {
+		for range n {
+			b.topics[name] = append(b.topics[name], commitlog.NewTailable(commitlog.NewMemoryLog()))
+		}
+	}
+	return b
+}
+
+func (b *memBroker) Topics() []Topic {
+	var ts []Topic
+	for name, ps := range b.topics {
+		ts = append(ts, Topic{Name: name, Partitions: len(ps)})
+	}
+	return ts
+}
+
+func (b *memBroker) Partition(topic string, p int) (*commitlog.Tailable, bool) {
+	ps := b.topics[topic]
+	if p < 0 || p >= len(ps) {
+		return nil, false
+	}
+	return ps[p], true
+}
+
+func (b *memBroker) Append(topic string, p int, recs []commitlog.Record) ([]int, error) {
+	l, ok := b.Partition(topic, p)
+	if !ok {
+		return nil, ErrUnknownTopicOrPartition
+	}
+	return commitlog.AppendBatch(l, recs)
+}
+
+func (b *memBroker) CommitOffset(group string, o GroupOffset) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, old := range b.offsets[group] {
+		if old.Topic == o.Topic && old.Partition == o.Partition {
+			b.offsets[group][i] = o
+			return nil
+		}
+	}
+	b.offsets[group] = append(b.offsets[group], o)
+	return nil
+}
+
+func (b *memBroker) GroupOffsets(group string) []GroupOffset {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]GroupOffset(nil), b.offsets[group]...)
+}
+
+// serve starts a Server for b on a loopback port and returns its address.
+func serve(t *testing.T, b Broker) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(b, "")
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return l.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *Client {
+	t.Helper()
+	c, err := Dial(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestNegotiatesVersions(t *testing.T) {
+	c := dial(t, serve(t, newMemBroker(nil)))
+	for _, r := range supported {
+		if got := c.versions[r.Key]; got != r.Max {
+			t.Errorf("API %d: negotiated v%d, want v%d", r.Key, got, r.Max)
+		}
+	}
+}
+
+// TestEveryVersion runs a produce, fetch, offset lookup and commit round
+// trip at every supported version of each API.
+func TestEveryVersion(t *testing.T) {
+	ctx := context.Background()
+	b := newMemBroker(map[string]int{"events": 2})
+	c := dial(t, serve(t, b))
+	ts := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, r := range supported {
+		for v := r.Min; v <= r.Max; v++ {
+			t.Run(fmt.Sprintf("api%d/v%d", r.Key, v), func(t *testing.T) {
+				negotiated := c.versions[r.Key]
+				c.versions[r.Key] = v
+				defer func() { c.versions[r.Key] = negotiated }()
+
+				switch r.Key {
+				case apiApiVersions:
+					var resp apiVersionsResponse
+					if err := c.roundTrip(ctx, apiApiVersions, &apiVersionsRequest{}, &resp); err != nil || len(resp.APIKeys) != len(supported) {
+						t.Fatalf("ApiVersions = %d keys, %v", len(resp.APIKeys), err)
+					}
+				case apiMetadata:
+					nodes, topics, err := c.Metadata(ctx, "events")
+					if err != nil || len(nodes) != 1 || nodes[0].Host != "127.0.0.1" || len(topics) != 1 || topics[0].Partitions != 2 {
+						t.Fatalf("Metadata = %v, %v, %v", nodes, topics, err)
+					}
+				case apiProduce:
+					key := fmt.Sprintf("produce-v%d", v)
+					off, err := c.Produce(ctx, "events", 1, []commitlog.Record{{Key: key, Value: "x", Timestamp: ts}}, false)
+					if err != nil {
+						t.Fatal(err)
+					}
+					rec, err := b.topics["events"][1].Read(off)
+					if err != nil || rec.Key != key || !rec.Timestamp.Equal(ts) {
+						t.Fatalf("record %d = %+v, %v", off, rec, err)
+					}
+				case apiFetch:
+					l := b.topics["events"][0]
+					off, _ := l.Append(commitlog.Record{Key: "k", Value: fmt.Sprintf("fetch-v%d", v), Timestamp: ts})
+					res, err := c.Fetch(ctx, "events", 0, off, 0, 1<<20)
+					if err != nil || len(res.Records) != 1 || res.Records[0].Value != fmt.Sprintf("fetch-v%d", v) || res.HighWatermark != off+1 {
+						t.Fatalf("Fetch = %+v, %v", res, err)
+					}
+				case apiListOffsets:
+					got, err := c.ListOffsets(ctx, "events", 0, Latest)
+					if want := b.topics["events"][0].EndOffset(); err != nil || got != want {
+						t.Fatalf("ListOffsets(Latest) = %d, %v, want %d", got, err, want)
+					}
+				case apiOffsetCommit, apiOffsetFetch:
+					group := fmt.Sprintf("g-%d-%d", r.Key, v)
+					if err := c.CommitOffset(ctx, group, "events", 1, int(v)+10, "meta"); err != nil {
+						t.Fatal(err)
+					}
+					off, meta, err := c.FetchOffset(ctx, group, "events", 1)
+					if err != nil || off != int(v)+10 || meta != "meta" {
+						t.Fatalf("FetchOffset = %d, %q, %v", off, meta, err)
+					}
+				case apiFindCoordinator:
+					n, err := c.FindCoordinator(ctx, "g")
+					if err != nil || n.ID != nodeID || n.Host != "127.0.0.1" {
+						t.Fatalf("FindCoordinator = %+v, %v", n, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestProduceAndFetch(t *testing.T) {
+	ctx := context.Background()
+	b := newMemBroker(map[string]int{"t": 1})
+	c := dial(t, serve(t, b))
+
+	var recs []commitlog.Record
+	for i := range 250 {
+		recs = append(recs, commitlog.Record{Key: fmt.Sprint(i % 3), Value: fmt.Sprintf("value-%d", i)})
+	}
+	if off, err := c.Produce(ctx, "t", 0, recs[:200], true); err != nil || off != 0 {
+		t.Fatalf("gzip Produce = %d, %v", off, err)
+	}
+	if off, err := c.Produce(ctx, "t", 0, recs[200:], false); err != nil || off != 200 {
+		t.Fatalf("Produce = %d, %v", off, err)
+	}
+
+	// A small fetch limit still returns the first record.
+	res, err := c.Fetch(ctx, "t", 0, 5, 0, 1)
+	if err != nil || len(res.Records) != 1 || res.Records[0].Offset != 5 || res.Records[0].Value != "value-5" {
+		t.Fatalf("Fetch(limit 1) = %+v, %v", res.Records, err)
+	}
+	var got []commitlog.Record
+	for off := 0; off < 250; off += len(res.Records) {
+		if res, err = c.Fetch(ctx, "t", 0, off, 0, 1000); err != nil || len(res.Records) == 0 {
+			t.Fatalf("Fetch(%d) = %d records, %v", off, len(res.Records), err)
+		}
+		got = append(got, res.Records...)
+	}
+	for i, rec := range got {
+		if rec.Offset != i || rec.Key != recs[i].Key || rec.Value != recs[i].Value {
+			t.Fatalf("record %d = %+v, want %+v", i, rec, recs[i])
+		}
+	}
+}
+
+func TestFetchWaitsForRecords(t *testing.T) {
+	ctx := context.Background()
+	b := newMemBroker(map[string]int{"t": 1})
+	addr := serve(t, b)
+	c := dial(t, addr)
+
+	start := time.Now()
+	res, err := c.Fetch(ctx, "t", 0, 0, 100*time.Millisecond, 1<<20)
+	if err != nil || len(res.Records) != 0 || time.Since(start) < 100*time.Millisecond {
+		t.Fatalf("Fetch of empty partition = %+v, %v after %v", res, err, time.Since(start))
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		producer, err := Dial(ctx, addr)
+		if err != nil {
+			return
+		}
+		defer producer.Close()
+		producer.Produce(ctx, "t", 0, []commitlog.Record{{Value: "late"}}, false)
+	}()
+	res, err = c.Fetch(ctx, "t", 0, 0, 10*time.Second, 1<<20)
+	if err != nil || len(res.Records) != 1 || res.Records[0].Value != "late" {
+		t.Fatalf("waiting Fetch = %+v, %v", res, err)
+	}
+}
+
+func TestListOffsetsByTime(t *testing.T) {
+	ctx := context.Background()
+	b := newMemBroker(map[string]int{"t": 1})
+	c := dial(t, serve(t, b))
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 10 {
+		b.topics["t"][0].Append(commitlog.Record{Value: "v", Timestamp: base.Add(time.Duration(i) * time.Second)})
+	}
+	b.topics["t"][0].DeleteBefore(2)
+
+	for _, tc := range []struct {
+		ts   int64
+		want int
+	}{
+		{Earliest, 2},
+		{Latest, 10},
+		{base.UnixMilli(), 2},
+		{base.Add(4500 * time.Millisecond).UnixMilli(), 5},
+		{base.Add(9 * time.Second).UnixMilli(), 9},
+		{base.Add(time.Minute).UnixMilli(), -1},
+	} {
+		if got, err := c.ListOffsets(ctx, "t", 0, tc.ts); err != nil || got != tc.want {
+			t.Errorf("ListOffsets(%d) = %d, %v, want %d", tc.ts, got, err, tc.want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	b := newMemBroker(map[string]int{"t": 1})
+	c := dial(t, serve(t, b))
+	b.topics["t"][0].Append(commitlog.Record{Value: "v"})
+
+	if _, _, err := c.Metadata(ctx, "missing"); !errors.Is(err, ErrUnknownTopicOrPartition) {
+		t.Errorf("Metadata(missing) = %v", err)
+	}
+	if _, err := c.Produce(ctx, "t", 3, []commitlog.Record{{Value: "v"}}, false); !errors.Is(err, ErrUnknownTopicOrPartition) {
+		t.Errorf("Produce to partition 3 = %v", err)
+	}
+	if _, err := c.Fetch(ctx, "t", 0, 5, 0, 1<<20); !errors.Is(err, ErrOffsetOutOfRange) {
+		t.Errorf("Fetch past the end = %v", err)
+	}
+	if err := c.CommitOffset(ctx, "", "t", 0, 1, ""); !errors.Is(err, ErrInvalidGroupID) {
+		t.Errorf("CommitOffset with no group = %v", err)
+	}
+	if off, _, err := c.FetchOffset(ctx, "nobody", "t", 0); err != nil || off != -1 {
+		t.Errorf("FetchOffset with no commit = %d, %v, want -1", off, err)
+	}
+	// The connection is still usable after error responses.
+	if res, err := c.Fetch(ctx, "t", 0, 0, 0, 1<<20); err != nil || len(res.Records) != 1 {
+		t.Errorf("Fetch after errors = %+v, %v", res, err)
+	}
+}
+
+func TestNewerApiVersionsRequest(t *testing.T) {
+	conn, err := net.Dial("tcp", serve(t, newMemBroker(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	w := newWriter()
+	h := requestHeader{Key: apiApiVersions, Version: 3, CorrelationID: 7, ClientID: "new"}
+	h.fields(w)
+	if err := writeFrame(conn, w.buf); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := readFrame(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newReader(frame)
+	var correlation int32
+	r.i32(&correlation)
+	var resp apiVersionsResponse
+	if err := decode(r, &resp, 0); err != nil || correlation != 7 || Error(resp.ErrorCode) != ErrUnsupportedVersion || len(resp.APIKeys) != len(supported) {
+		t.Fatalf("ApiVersions v3 = %d, %+v, %v", correlation, resp, err)
+	}
+}
+
+func TestBatchCorruption(t *testing.T) {
+	recs := []commitlog.Record{{Offset: 4, Key: "k", Value: "v", Timestamp: time.UnixMilli(1000)}, {Offset: 5, Value: "w", Timestamp: time.UnixMilli(900)}}
+	for _, compress := range []bool{false, true} {
+		data, err := encodeBatch(recs, compress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decodeBatches(data, false)
+		if err != nil || len(got) != 2 || got[0].Offset != 4 || got[1].Key != "" || got[1].Timestamp.UnixMilli() != 900 {
+			t.Fatalf("round trip (gzip %v) = %+v, %v", compress, got, err)
+		}
+		if got, err := decodeBatches(data[:len(data)-1], true); err != nil || len(got) != 0 {
+			t.Errorf("partial batch = %+v, %v, want it skipped", got, err)
+		}
+		if _, err := decodeBatches(data[:len(data)-1], false); !errors.Is(err, ErrCorruptMessage) {
+			t.Errorf("truncated batch = %v, want ErrCorruptMessage", err)
+		}
+		data[len(data)-1] ^= 0xff
+		if _, err := decodeBatches(data, false); !errors.Is(err, ErrCorruptMessage) {
+			t.Errorf("corrupted batch = %v, want ErrCorruptMessage", err)
+		}
+	}
+}
@@ -0,0 +1,610 @@
+package kafka
+
+// The requests and responses of the supported APIs. Each fields method
+// describes a message at one version, as listed in the Kafka protocol
+// guide; fields a version doesn't have keep their zero value.
+
+// message is a request or response body.
+type message interface {
+	fields(w *wire, v int16)
+}
+
+// requestHeader is request header v1, used by every non-flexible
+// request version.
+type requestHeader struct {
+	Key           int16
+	Version       int16
+	CorrelationID int32
+	ClientID      string
+}
+
+func (h *requestHeader) fields(w *wire) {
+	w.i16(&h.Key)
+	w.i16(&h.Version)
+	w.i32(&h.CorrelationID)
+	w.nstr(&h.ClientID)
+}
+
+// ApiVersions (key 18), v0-2.
+
+type apiVersionsRequest struct{}
+
+func (*apiVersionsRequest) fields(*wire, int16) {}
+
+type apiVersionsResponse struct {
+	ErrorCode  int16
+	APIKeys    []apiRange
+	ThrottleMs int32
+}
+
+func (r *apiVersionsResponse) fields(w *wire, v int16) {
+	w.i16(&r.ErrorCode)
+	array(w, &r.APIKeys, false, func(a *apiRange) {
+		w.i16(&a.Key)
+		w.i16(&a.Min)
+		w.i16(&a.Max)
+	})
+	if v >= 1 {
+		w.i32(&r.ThrottleMs)
+	}
+}
+
+// Metadata (key 3), v0-8.
+
+type metadataRequest struct {
+	// Topics are the topics to describe; nil means every topic.
+	Topics            []string
+	AllowAutoCreate   bool
+	IncludeClusterOps bool
+	IncludeTopicOps   bool
+}
+
+func (r *metadataRequest) fields(w *wire, v int16) {
+	if v == 0 {
+		// Version 0 has no null array; an empty one means every topic.
+		if !w.read && r.Topics == nil {
+			r.Topics = []string{}
+		}
+		array(w, &r.Topics, false, func(s *string) { w.str(s) })
+		if w.read && len(r.Topics) == 0 {
+			r.Topics = nil
+		}
+	} else {
+		array(w, &r.Topics, true, func(s *string) { w.str(s) })
+	}
+	if v >= 4 {
+		w.boolean(&r.AllowAutoCreate)
+	}
+	if v >= 8 {
+		w.boolean(&r.IncludeClusterOps)
+		w.boolean(&r.IncludeTopicOps)
+	}
+}
+
+type metadataResponse struct {
+	ThrottleMs   int32
+	Brokers      []metadataBroker
+	ClusterID    string
+	ControllerID int32
+	Topics       []metadataTopic
+	ClusterOps   int32
+}
+
+type metadataBroker struct {
+	NodeID int32
+	Host   string
+	Port   int32
+	Rack   string
+}
+
+type metadataTopic struct {
+	ErrorCode  int16
+	Name       string
+	Internal   bool
+	Partitions []metadataPartition
+	TopicOps   int32
+}
+
+type metadataPartition struct {
+	ErrorCode   int16
+	Index       int32
+	Leader      int32
+	LeaderEpoch int32
+	Replicas    []int32
+	ISR         []int32
+	Offline     []int32
+}
+
+func (r *metadataResponse) fields(w *wire, v int16) {
+	if v >= 3 {
+		w.i32(&r.ThrottleMs)
+	}
+	array(w, &r.Brokers, false, func(b *metadataBroker) {
+		w.i32(&b.NodeID)
+		w.str(&b.Host)
+		w.i32(&b.Port)
+		if v >= 1 {
+			w.nstr(&b.Rack)
+		}
+	})
+	if v >= 2 {
+		w.nstr(&r.ClusterID)
+	}
+	if v >= 1 {
+		w.i32(&r.ControllerID)
+	}
+	array(w, &r.Topics, false, func(t *metadataTopic) {
+		w.i16(&t.ErrorCode)
+		w.str(&t.Name)
+		if v >= 1 {
+			w.boolean(&t.Internal)
+		}
+		array(w, &t.Partitions, false, func(p *metadataPartition) {
+			w.i16(&p.ErrorCode)
+			w.i32(&p.Index)
+			w.i32(&p.Leader)
+			if v >= 7 {
+				w.i32(&p.LeaderEpoch)
+			}
+			w.int32s(&p.Replicas)
+			w.int32s(&p.ISR)
+			if v >= 5 {
+				w.int32s(&p.Offline)
+			}
+		})
+		if v >= 8 {
+			w.i32(&t.TopicOps)
+		}
+	})
+	if v >= 8 {
+		w.i32(&r.ClusterOps)
+	}
+}
+
+// Produce (key 0), v3-8: the versions carrying record batches.
+
+type produceRequest struct {
+	TransactionalID string
+	Acks            int16
+	TimeoutMs       int32
+	Topics          []produceTopic
+}
+
+type produceTopic struct {
+	Name       string
+	Partitions []producePartition
+}
+
+type producePartition struct {
+	Index   int32
+	Records []byte
+}
+
+func (r *produceRequest) fields(w *wire, v int16) {
+	w.nstr(&r.TransactionalID)
+	w.i16(&r.Acks)
+	w.i32(&r.TimeoutMs)
+	array(w, &r.Topics, false, func(t *produceTopic) {
+		w.str(&t.Name)
+		array(w, &t.Partitions, false, func(p *producePartition) {
+			w.i32(&p.Index)
+			w.bytes(&p.Records)
+		})
+	})
+}
+
+type produceResponse struct {
+	Topics     []produceTopicResponse
+	ThrottleMs int32
+}
+
+type produceTopicResponse struct {
+	Name       string
+	Partitions []producePartitionResponse
+}
+
+type producePartitionResponse struct {
+	Index           int32
+	ErrorCode       int16
+	BaseOffset      int64
+	LogAppendTimeMs int64
+	LogStartOffset  int64
+	RecordErrors    []recordError
+	ErrorMessage    string
+}
+
+type recordError struct {
+	BatchIndex int32
+	Message    string
+}
+
+func (r *produceResponse) fields(w *wire, v int16) {
+	array(w, &r.Topics, false, func(t *produceTopicResponse) {
+		w.str(&t.Name)
+		array(w, &t.Partitions, false, func(p *producePartitionResponse) {
+			w.i32(&p.Index)
+			w.i16(&p.ErrorCode)
+			w.i64(&p.BaseOffset)
+			w.i64(&p.LogAppendTimeMs)
+			if v >= 5 {
+				w.i64(&p.LogStartOffset)
+			}
+			if v >= 8 {
+				array(w, &p.RecordErrors, false, func(e *recordError) {
+					w.i32(&e.BatchIndex)
+					w.nstr(&e.Message)
+				})
+				w.nstr(&p.ErrorMessage)
+			}
+		})
+	})
+	w.i32(&r.ThrottleMs)
+}
+
+// Fetch (key 1), v4-11.
+
+type fetchRequest struct {
+	ReplicaID      int32
+	MaxWaitMs      int32
+	MinBytes       int32
+	MaxBytes       int32
+	IsolationLevel int8
+	SessionID      int32
+	SessionEpoch   int32
+	Topics         []fetchTopic
+	Forgotten      []fetchForgotten
+	RackID         string
+}
+
+type fetchTopic struct {
+	Name       string
+	Partitions []fetchPartition
+}
+
+type fetchPartition struct {
+	Index              int32
+	CurrentLeaderEpoch int32
+	FetchOffset        int64
+	LogStartOffset     int64
+	MaxBytes           int32
+}
+
+type fetchForgotten struct {
+	Name       string
+	Partitions []int32
+}
+
+func (r *fetchRequest) fields(w *wire, v int16) {
+	w.i32(&r.ReplicaID)
+	w.i32(&r.MaxWaitMs)
+	w.i32(&r.MinBytes)
+	w.i32(&r.MaxBytes)
+	w.i8(&r.IsolationLevel)
+	if v >= 7 {
+		w.i32(&r.SessionID)
+		w.i32(&r.SessionEpoch)
+	}
+	array(w, &r.Topics, false, func(t *fetchTopic) {
+		w.str(&t.Name)
+		array(w, &t.Partitions, false, func(p *fetchPartition) {
+			w.i32(&p.Index)
+			if v >= 9 {
+				w.i32(&p.CurrentLeaderEpoch)
+			}
+			w.i64(&p.FetchOffset)
+			if v >= 5 {
+				w.i64(&p.LogStartOffset)
+			}
+			w.i32(&p.MaxBytes)
+		})
+	})
+	if v >= 7 {
+		array(w, &r.Forgotten, false, func(f *fetchForgotten) {
+			w.str(&f.Name)
+			w.int32s(&f.Partitions)
+		})
+	}
+	if v >= 11 {
+		w.str(&r.RackID)
+	}
+}
+
+type fetchResponse struct {
+	ThrottleMs int32
+	ErrorCode  int16
+	SessionID  int32
+	Topics     []fetchTopicResponse
+}
+
+type fetchTopicResponse struct {
+	Name       string
+	Partitions []fetchPartitionResponse
+}
+
+type fetchPartitionResponse struct {
+	Index                int32
+	ErrorCode            int16
+	HighWatermark        int64
+	LastStableOffset     int64
+	LogStartOffset       int64
+	Aborted              []abortedTransaction
+	PreferredReadReplica int32
+	Records              []byte
+}
+
+type abortedTransaction struct {
+	ProducerID  int64
+	FirstOffset int64
+}
+
+func (r *fetchResponse) fields(w *wire, v int16) {
+	w.i32(&r.ThrottleMs)
+	if v >= 7 {
+		w.i16(&r.ErrorCode)
+		w.i32(&r.SessionID)
+	}
+	array(w, &r.Topics, false, func(t *fetchTopicResponse) {
+		w.str(&t.Name)
+		array(w, &t.Partitions, false, func(p *fetchPartitionResponse) {
+			w.i32(&p.Index)
+			w.i16(&p.ErrorCode)
+			w.i64(&p.HighWatermark)
+			w.i64(&p.LastStableOffset)
+			if v >= 5 {
+				w.i64(&p.LogStartOffset)
+			}
+			array(w, &p.Aborted, true, func(a *abortedTransaction) {
+				w.i64(&a.ProducerID)
+				w.i64(&a.FirstOffset)
+			})
+			if v >= 11 {
+				w.i32(&p.PreferredReadReplica)
+			}
+			w.bytes(&p.Records)
+		})
+	})
+}
+
+// ListOffsets (key 2), v1-5.
+
+type listOffsetsRequest struct {
+	ReplicaID      int32
+	IsolationLevel int8
+	Topics         []listOffsetsTopic
+}
+
+type listOffsetsTopic struct {
+	Name       string
+	Partitions []listOffsetsPartition
+}
+
+type listOffsetsPartition struct {
+	Index              int32
+	CurrentLeaderEpoch int32
+	Timestamp          int64
+}
+
+func (r *listOffsetsRequest) fields(w *wire, v int16) {
+	w.i32(&r.ReplicaID)
+	if v >= 2 {
+		w.i8(&r.IsolationLevel)
+	}
+	array(w, &r.Topics, false, func(t *listOffsetsTopic) {
+		w.str(&t.Name)
+		array(w, &t.Partitions, false, func(p *listOffsetsPartition) {
+			w.i32(&p.Index)
+			if v >= 4 {
+				w.i32(&p.CurrentLeaderEpoch)
+			}
+			w.i64(&p.Timestamp)
+		})
+	})
+}
+
+type listOffsetsResponse struct {
+	ThrottleMs int32
+	Topics     []listOffsetsTopicResponse
+}
+
+type listOffsetsTopicResponse struct {
+	Name       string
+	Partitions []listOffsetsPartitionResponse
+}
+
+type listOffsetsPartitionResponse struct {
+	Index       int32
+	ErrorCode   int16
+	Timestamp   int64
+	Offset      int64
+	LeaderEpoch int32
+}
+
+func (r *listOffsetsResponse) fields(w *wire, v int16) {
+	if v >= 2 {
+		w.i32(&r.ThrottleMs)
+	}
+	array(w, &r.Topics, false, func(t *listOffsetsTopicResponse) {
+		w.str(&t.Name)
+		array(w, &t.Partitions, false, func(p *listOffsetsPartitionResponse) {
+			w.i32(&p.Index)
+			w.i16(&p.ErrorCode)
+			w.i64(&p.Timestamp)
+			w.i64(&p.Offset)
+			if v >= 4 {
+				w.i32(&p.LeaderEpoch)
+			}
+		})
+	})
+}
+
+// OffsetCommit (key 8), v2-7.
+
+type offsetCommitRequest struct {
+	GroupID         string
+	GenerationID    int32
+	MemberID        string
+	GroupInstanceID string
+	RetentionMs     int64
+	Topics          []offsetCommitTopic
+}
+
+type offsetCommitTopic struct {
+	Name       string
+	Partitions []offsetCommitPartition
+}
+
+type offsetCommitPartition struct {
+	Index       int32
+	Offset      int64
+	LeaderEpoch int32
+	Metadata    string
+}
+
+func (r *offsetCommitRequest) fields(w *wire, v int16) {
+	w.str(&r.GroupID)
+	w.i32(&r.GenerationID)
+	w.str(&r.MemberID)
+	if v >= 7 {
+		w.nstr(&r.GroupInstanceID)
+	}
+	if v <= 4 {
+		w.i64(&r.RetentionMs)
+	}
+	array(w, &r.Topics, false, func(t *offsetCommitTopic) {
+		w.str(&t.Name)
+		array(w, &t.Partitions, false, func(p *offsetCommitPartition) {
+			w.i32(&p.Index)
+			w.i64(&p.Offset)
+			if v >= 6 {
+				w.i32(&p.LeaderEpoch)
+			}
+			w.nstr(&p.Metadata)
+		})
+	})
+}
+
+type offsetCommitResponse struct {
+	ThrottleMs int32
+	Topics     []offsetCommitTopicResponse
+}
+
+type offsetCommitTopicResponse struct {
+	Name       string
+	Partitions []partitionError
+}
+
+type partitionError struct {
+	Index     int32
+	ErrorCode int16
+}
+
+func (r *offsetCommitResponse) fields(w *wire, v int16) {
+	if v >= 3 {
+		w.i32(&r.ThrottleMs)
+	}
+	array(w, &r.Topics, false, func(t *offsetCommitTopicResponse) {
+		w.str(&t.Name)
+		array(w, &t.Partitions, false, func(p *partitionError) {
+			w.i32(&p.Index)
+			w.i16(&p.ErrorCode)
+		})
+	})
+}
+
+// OffsetFetch (key 9), v1-5.
+
+type offsetFetchRequest struct {
+	GroupID string
+	// Topics are the partitions to fetch; nil means all of the group's,
+	// from version 2.
+	Topics []offsetFetchTopic
+}
+
+type offsetFetchTopic struct {
+	Name       string
+	Partitions []int32
+}
+
+func (r *offsetFetchRequest) fields(w *wire, v int16) {
+	w.str(&r.GroupID)
+	array(w, &r.Topics, v >= 2, func(t *offsetFetchTopic) {
+		w.str(&t.Name)
+		w.int32s(&t.Partitions)
+	})
+}
+
+type offsetFetchResponse struct {
+	ThrottleMs int32
+	Topics     []offsetFetchTopicResponse
+	ErrorCode  int16
+}
+
+type offsetFetchTopicResponse struct {
+	Name       string
+	Partitions []offsetFetchPartitionResponse
+}
+
+type offsetFetchPartitionResponse struct {
+	Index       int32
+	Offset      int64
+	LeaderEpoch int32
+	Metadata    string
+	ErrorCode   int16
+}
+
+func (r *offsetFetchResponse) fields(w *wire, v int16) {
+	if v >= 3 {
+		w.i32(&r.ThrottleMs)
+	}
+	array(w, &r.Topics, false, func(t *offsetFetchTopicResponse) {
+		w.str(&t.Name)
+		array(w, &t.Partitions, false, func(p *offsetFetchPartitionResponse) {
+			w.i32(&p.Index)
+			w.i64(&p.Offset)
+			if v >= 5 {
+				w.i32(&p.LeaderEpoch)
+			}
+			w.nstr(&p.Metadata)
+			w.i16(&p.ErrorCode)
+		})
+	})
+	if v >= 2 {
+		w.i16(&r.ErrorCode)
+	}
+}
+
+// FindCoordinator (key 10), v0-2.
+
+type findCoordinatorRequest struct {
+	Key     string
+	KeyType int8
+}
+
+func (r *findCoordinatorRequest) fields(w *wire, v int16) {
+	w.str(&r.Key)
+	if v >= 1 {
+		w.i8(&r.KeyType)
+	}
+}
+
+type findCoordinatorResponse struct {
+	ThrottleMs   int32
+	ErrorCode    int16
+	ErrorMessage string
+	NodeID       int32
+	Host         string
+	Port         int32
+}
+
+func (r *findCoordinatorResponse) fields(w *wire, v int16) {
+	if v >= 1 {
+		w.i32(&r.ThrottleMs)
+	}
+	w.i16(&r.ErrorCode)
+	if v >= 1 {
+		w.nstr(&r.ErrorMessage)
+	}
+	w.i32(&r.NodeID)
+	w.str(&r.Host)
+	w.i32(&r.Port)
+}
@@ -0,0 +1,160 @@
+// Package kafka speaks a subset of the Kafka binary protocol, so Kafka
+// clients and tools can produce to and consume from commit log topics.
+//
+// A Server serves the topics and consumer group offsets of a Broker
+// over TCP, as a single-node Kafka cluster whose node 0 leads every
+// partition. It handles these requests, in their non-flexible versions:
+//
+//	ApiVersions      v0-2
+//	Metadata         v0-8
+//	Produce          v3-8  (record batches, uncompressed or gzip)
+//	Fetch            v4-11
+//	ListOffsets      v1-5
+//	OffsetCommit     v2-7
+//	OffsetFetch      v1-5
+//	FindCoordinator  v0-2
+//
+// Consumer group membership (JoinGroup, SyncGroup, Heartbeat) is not
+// supported, so clients must assign partitions themselves; they can
+// still commit and fetch offsets under a group ID. Transactions,
+// idempotent producer sequence checks and record headers are not
+// supported either: headers are dropped on produce.
+//
+// Client is a minimal client for the same requests, used to test the
+// Server and usable against any broker supporting these versions.
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// API keys.
+const (
+	apiProduce         int16 = 0
+	apiFetch           int16 = 1
+	apiListOffsets     int16 = 2
+	apiMetadata        int16 = 3
+	apiOffsetCommit    int16 = 8
+	apiOffsetFetch     int16 = 9
+	apiFindCoordinator int16 = 10
+	apiApiVersions     int16 = 18
+)
+
+// apiRange is the versions of one API a peer supports.
+type apiRange struct {
+	Key, Min, Max int16
+}
+
+// supported lists the versions this package speaks, client and server.
+var supported = []apiRange{
+	{apiProduce, 3, 8},
+	{apiFetch, 4, 11},
+	{apiListOffsets, 1, 5},
+	{apiMetadata, 0, 8},
+	{apiOffsetCommit, 2, 7},
+	{apiOffsetFetch, 1, 5},
+	{apiFindCoordinator, 0, 2},
+	{apiApiVersions, 0, 2},
+}
+
+func supportedRange(key int16) (apiRange, bool) {
+	for _, r := range supported {
+		if r.Key == key {
+			return r, true
+		}
+	}
+	return apiRange{}, false
+}
+
+// Timestamps with special meanings in ListOffsets.
+const (
+	// Latest asks for the offset the next record will get.
+	Latest int64 = -1
+	// Earliest asks for the first offset the partition holds.
+	Earliest int64 = -2
+)
+
+// Error is a Kafka protocol error code.
+type Error int16
+
+// The error codes the Server returns.
+const (
+	ErrUnknownServerError         Error = -1
+	ErrOffsetOutOfRange           Error = 1
+	ErrCorruptMessage             Error = 2
+	ErrUnknownTopicOrPartition    Error = 3
+	ErrCoordinatorNotAvailable    Error = 15
+	ErrInvalidGroupID             Error = 24
+	ErrUnsupportedVersion         Error = 35
+	ErrUnsupportedCompressionType Error = 76
+)
+
+var errorNames = map[Error]string{
+	ErrUnknownServerError:         "UNKNOWN_SERVER_ERROR",
+	ErrOffsetOutOfRange:           "OFFSET_OUT_OF_RANGE",
+	ErrCorruptMessage:             "CORRUPT_MESSAGE",
+	ErrUnknownTopicOrPartition:    "UNKNOWN_TOPIC_OR_PARTITION",
+	ErrCoordinatorNotAvailable:    "COORDINATOR_NOT_AVAILABLE",
+	ErrInvalidGroupID:             "INVALID_GROUP_ID",
+	ErrUnsupportedVersion:         "UNSUPPORTED_VERSION",
+	ErrUnsupportedCompressionType: "UNSUPPORTED_COMPRESSION_TYPE",
+}
+
+func (e Error) Error() string {
+	if name, ok := errorNames[e]; ok {
+		return "kafka: " + name
+	}
+	return fmt.Sprintf("kafka: error code %d", int16(e))
+}
+
+// codeError returns the error for a response code, nil for 0.
+func codeError(code int16) error {
+	if code == 0 {
+		return nil
+	}
+	return Error(code)
+}
+
+// errorCode returns the response code for err: its own if it is an
+// Error, UNKNOWN_SERVER_ERROR otherwise.
+func errorCode(err error) int16 {
+	if err == nil {
+		return 0
+	}
+	var e Error
+	if errors.As(err, &e) {
+		return int16(e)
+	}
+	return int16(ErrUnknownServerError)
+}
+
+// maxFrameBytes caps the size of a request or response, as Kafka's
+// socket.request.max.bytes does.
+const maxFrameBytes = 100 << 20
+
+// readFrame reads a size-prefixed request or response.
+func readFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := int32(binary.BigEndian.Uint32(size[:]))
+	if n < 0 || n > maxFrameBytes {
+		return nil, fmt.Errorf("kafka: frame of %d bytes", n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// writeFrame writes buf with its size prefix.
+func writeFrame(w io.Writer, buf []byte) error {
+	frame := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(buf)), uint32(len(buf)))
+	_, err := w.Write(append(frame, buf...))
+	return err
+}
@@ -0,0 +1,219 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// Record batch (magic 2) layout. The batch length counts the bytes after
+// it; the CRC covers everything from the attributes on.
+const (
+	batchMagic        = 2
+	batchHeaderBytes  = 61 // from base offset to the record count
+	batchLengthOffset = 8
+	batchMagicOffset  = 16
+	batchCRCOffset    = 17
+	batchAttrsOffset  = 21
+
+	compressionMask = 0x07
+	compressionNone = 0
+	compressionGzip = 1
+	attrControl     = 0x20
+
+	// maxDecompressedBytes bounds what a compressed batch may expand to.
+	maxDecompressedBytes = maxFrameBytes
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// encodeBatch returns recs, which must have consecutive offsets, as one
+// record batch, gzip-compressed if compress is set. Empty keys are
+// encoded as null.
+func encodeBatch(recs []commitlog.Record, compress bool) ([]byte, error) {
+	base := recs[0]
+	baseTs := millis(base.Timestamp)
+	maxTs := baseTs
+	var body []byte
+	for _, rec := range recs {
+		ts := millis(rec.Timestamp)
+		maxTs = max(maxTs, ts)
+		r := newWriter()
+		var attrs int8
+		r.i8(&attrs)
+		tsDelta, offDelta := ts-baseTs, int64(rec.Offset-base.Offset)
+		r.varint(&tsDelta)
+		r.varint(&offDelta)
+		var key []byte
+		if rec.Key != "" {
+			key = []byte(rec.Key)
+		}
+		value := []byte(rec.Value)
+		r.varbytes(&key)
+		r.varbytes(&value)
+		var headers int64
+		r.varint(&headers)
+		body = binary.AppendVarint(body, int64(len(r.buf)))
+		body = append(body, r.buf...)
+	}
+
+	attrs := int16(compressionNone)
+	if compress {
+		attrs = compressionGzip
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+	}
+
+	w := newWriter()
+	baseOffset := int64(base.Offset)
+	var length, leaderEpoch int32
+	magic := int8(batchMagic)
+	var crc int32
+	lastDelta := int32(recs[len(recs)-1].Offset - base.Offset)
+	producerID, producerEpoch, baseSeq := int64(-1), int16(-1), int32(-1)
+	count := int32(len(recs))
+	w.i64(&baseOffset)
+	w.i32(&length)
+	w.i32(&leaderEpoch)
+	w.i8(&magic)
+	w.i32(&crc)
+	w.i16(&attrs)
+	w.i32(&lastDelta)
+	w.i64(&baseTs)
+	w.i64(&maxTs)
+	w.i64(&producerID)
+	w.i16(&producerEpoch)
+	w.i32(&baseSeq)
+	w.i32(&count)
+	buf := append(w.buf, body...)
+	binary.BigEndian.PutUint32(buf[batchLengthOffset:], uint32(len(buf)-batchLengthOffset-4))
+	binary.BigEndian.PutUint32(buf[batchCRCOffset:], crc32.Checksum(buf[batchAttrsOffset:], crcTable))
+	return buf, nil
+}
+
+// decodeBatches returns the records of the record batches in data, with
+// their offsets from the batches. Control batches are skipped. A batch
+// cut short at the end of data, as fetch responses may return, is
+// ignored if partial is set and an error otherwise.
+func decodeBatches(data []byte, partial bool) ([]commitlog.Record, error) {
+	var recs []commitlog.Record
+	for len(data) > 0 {
+		if len(data) < batchHeaderBytes {
+			if partial {
+				break
+			}
+			return nil, fmt.Errorf("%w: truncated record batch", ErrCorruptMessage)
+		}
+		n := int(int32(binary.BigEndian.Uint32(data[batchLengthOffset:]))) + batchLengthOffset + 4
+		if n < batchHeaderBytes || n > len(data) {
+			if partial && n >= batchHeaderBytes {
+				break
+			}
+			return nil, fmt.Errorf("%w: truncated record batch", ErrCorruptMessage)
+		}
+		batch := data[:n]
+		data = data[n:]
+		if batch[batchMagicOffset] != batchMagic {
+			return nil, fmt.Errorf("%w: record batch magic %d, only 2 is supported", ErrCorruptMessage, batch[batchMagicOffset])
+		}
+		if crc32.Checksum(batch[batchAttrsOffset:], crcTable) != binary.BigEndian.Uint32(batch[batchCRCOffset:]) {
+			return nil, fmt.Errorf("%w: record batch CRC mismatch", ErrCorruptMessage)
+		}
+		batchRecs, err := decodeBatch(batch)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, batchRecs...)
+	}
+	return recs, nil
+}
+
+// decodeBatch returns the records of one checked batch.
+func decodeBatch(batch []byte) ([]commitlog.Record, error) {
+	r := newReader(batch)
+	var baseOffset, baseTs, maxTs, producerID int64
+	var length, leaderEpoch, crc, lastDelta, baseSeq, count int32
+	var magic int8
+	var attrs, producerEpoch int16
+	r.i64(&baseOffset)
+	r.i32(&length)
+	r.i32(&leaderEpoch)
+	r.i8(&magic)
+	r.i32(&crc)
+	r.i16(&attrs)
+	r.i32(&lastDelta)
+	r.i64(&baseTs)
+	r.i64(&maxTs)
+	r.i64(&producerID)
+	r.i16(&producerEpoch)
+	r.i32(&baseSeq)
+	r.i32(&count)
+	if attrs&attrControl != 0 {
+		return nil, nil
+	}
+
+	body := batch[batchHeaderBytes:]
+	switch attrs & compressionMask {
+	case compressionNone:
+	case compressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptMessage, err)
+		}
+		body, err = io.ReadAll(io.LimitReader(zr, maxDecompressedBytes))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptMessage, err)
+		}
+	default:
+		return nil, ErrUnsupportedCompressionType
+	}
+
+	r = newReader(body)
+	recs := make([]commitlog.Record, 0, min(int(count), len(body)))
+	for i := 0; i < int(count); i++ {
+		var size, tsDelta, offDelta, headers int64
+		var attr int8
+		var key, value []byte
+		r.varint(&size)
+		end := r.off + int(size)
+		r.i8(&attr)
+		r.varint(&tsDelta)
+		r.varint(&offDelta)
+		r.varbytes(&key)
+		r.varbytes(&value)
+		r.varint(&headers)
+		for h := int64(0); h < headers && r.err == nil; h++ {
+			var hk, hv []byte
+			r.varbytes(&hk)
+			r.varbytes(&hv)
+		}
+		if r.err != nil || r.off != end {
+			return nil, fmt.Errorf("%w: malformed record %d of batch at offset %d", ErrCorruptMessage, i, baseOffset)
+		}
+		rec := commitlog.Record{Offset: int(baseOffset + offDelta), Key: string(key), Value: string(value)}
+		if ts := baseTs + tsDelta; baseTs >= 0 {
+			rec.Timestamp = time.UnixMilli(ts).UTC()
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// millis is t in Unix milliseconds, or -1 for the zero time.
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return -1
+	}
+	return t.UnixMilli()
+}
@@ -0,0 +1,649 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// Topic is a topic held by a Broker.
+type Topic struct {
+	Name       string
+	Partitions int
+}
+
+// GroupOffset is the next offset a consumer group will read from a
+// partition, as it committed it.
+type GroupOffset struct {
+	Topic     string
+	Partition int
+	Offset    int
+	Metadata  string
+}
+
+// Broker is the commit log a Server serves. Its methods must be safe
+// for concurrent use.
+type Broker interface {
+	// Topics lists the topics.
+	Topics() []Topic
+	// Partition returns one partition's log, or false if there is no
+	// such topic or partition.
+	Partition(topic string, partition int) (*commitlog.Tailable, bool)
+	// Append appends recs to a partition for a produce request and
+	// returns their offsets.
+	Append(topic string, partition int, recs []commitlog.Record) ([]int, error)
+	// CommitOffset records a group's offset for a partition.
+	CommitOffset(group string, o GroupOffset) error
+	// GroupOffsets returns every offset a group has committed.
+	GroupOffsets(group string) []GroupOffset
+}
+
+const (
+	// nodeID is the Server's broker ID, the leader of every partition.
+	nodeID = 0
+	// clusterID is the cluster ID Metadata reports.
+	clusterID = "commitlog"
+	// maxFetchWait caps how long a fetch may wait for records, like the
+	// HTTP server's long polls.
+	maxFetchWait = 30 * time.Second
+	// defaultFetchBytes limits a fetch whose request sets no limit.
+	defaultFetchBytes = 50 << 20
+	// fetchChunk is how many records a fetch reads from a log at a time.
+	fetchChunk = 100
+	// recordOverhead estimates a record's encoded size beyond its key
+	// and value, for fetch size limits.
+	recordOverhead = 20
+)
+
+// Server serves a Broker's topics to Kafka clients.
+type Server struct {
+	broker    Broker
+	advertise string
+
+	mu        sync.Mutex
+	host      string
+	port      int32
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewServer returns a Server for b. Clients are told to connect to
+// advertise, a host:port; if it is empty, the address of the listener
+// is used, with localhost for an unspecified IP such as ":9092".
+func NewServer(b Broker, advertise string) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		broker:    b,
+		advertise: advertise,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves it.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Close is called, when it returns
+// net.ErrClosed.
+func (s *Server) Serve(l net.Listener) error {
+	if err := s.setAddress(l.Addr()); err != nil {
+		l.Close()
+		return err
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return net.ErrClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return net.ErrClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return net.ErrClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// setAddress sets the advertised host and port.
+func (s *Server) setAddress(addr net.Addr) error {
+	adv := s.advertise
+	if adv == "" {
+		adv = addr.String()
+	}
+	host, portStr, err := net.SplitHostPort(adv)
+	if err != nil {
+		return fmt.Errorf("kafka: advertised address %q: %w", adv, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("kafka: advertised address %q: bad port", adv)
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.host, s.port = host, int32(port)
+	return nil
+}
+
+func (s *Server) address() (string, int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.host, s.port
+}
+
+// Close stops the listeners and closes every connection.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+// serveConn answers a connection's requests in order, as Kafka clients
+// expect. A request the Server can't parse closes the connection.
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+	r := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("kafka: %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		resp, err := s.handle(frame)
+		if err != nil {
+			log.Printf("kafka: %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+		if resp == nil {
+			continue // a produce with acks=0
+		}
+		if err := writeFrame(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers one request frame, returning nil if no response is
+// due.
+func (s *Server) handle(frame []byte) ([]byte, error) {
+	r := newReader(frame)
+	var h requestHeader
+	h.fields(r)
+	if r.err != nil {
+		return nil, fmt.Errorf("reading request header: %w", r.err)
+	}
+	rng, ok := supportedRange(h.Key)
+	if !ok {
+		return nil, fmt.Errorf("unsupported API key %d", h.Key)
+	}
+	w := newWriter()
+	w.i32(&h.CorrelationID)
+	if h.Key == apiApiVersions && h.Version > rng.Max {
+		// Newer clients start with a version we don't speak; answer in
+		// version 0 so they can pick one we do.
+		resp := apiVersionsResponse{ErrorCode: int16(ErrUnsupportedVersion), APIKeys: supported}
+		resp.fields(w, 0)
+		return w.buf, nil
+	}
+	if h.Version < rng.Min || h.Version > rng.Max {
+		return nil, fmt.Errorf("unsupported version %d of API key %d", h.Version, h.Key)
+	}
+
+	var resp message
+	var err error
+	switch h.Key {
+	case apiApiVersions:
+		resp = &apiVersionsResponse{APIKeys: supported}
+	case apiMetadata:
+		var req metadataRequest
+		if err = decode(r, &req, h.Version); err == nil {
+			resp = s.metadata(&req)
+		}
+	case apiProduce:
+		var req produceRequest
+		if err = decode(r, &req, h.Version); err == nil {
+			resp = s.produce(&req)
+			if req.Acks == 0 {
+				return nil, nil
+			}
+		}
+	case apiFetch:
+		var req fetchRequest
+		if err = decode(r, &req, h.Version); err == nil {
+			resp = s.fetch(&req)
+		}
+	case apiListOffsets:
+		var req listOffsetsRequest
+		if err = decode(r, &req, h.Version); err == nil {
+			resp = s.listOffsets(&req)
+		}
+	case apiOffsetCommit:
+		var req offsetCommitRequest
+		if err = decode(r, &req, h.Version); err == nil {
+			resp = s.offsetCommit(&req)
+		}
+	case apiOffsetFetch:
+		var req offsetFetchRequest
+		if err = decode(r, &req, h.Version); err == nil {
+			resp = s.offsetFetch(&req)
+		}
+	case apiFindCoordinator:
+		var req findCoordinatorRequest
+		if err = decode(r, &req, h.Version); err == nil {
+			resp = s.findCoordinator(&req)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading request %d v%d: %w", h.Key, h.Version, err)
+	}
+	resp.fields(w, h.Version)
+	return w.buf, w.err
+}
+
+func decode(r *wire, m message, v int16) error {
+	m.fields(r, v)
+	return r.err
+}
+
+func (s *Server) metadata(req *metadataRequest) *metadataResponse {
+	host, port := s.address()
+	resp := &metadataResponse{
+		Brokers:      []metadataBroker{{NodeID: nodeID, Host: host, Port: port}},
+		ClusterID:    clusterID,
+		ControllerID: nodeID,
+	}
+	topics := s.broker.Topics()
+	counts := make(map[string]int, len(topics))
+	for _, t := range topics {
+		counts[t.Name] = t.Partitions
+	}
+	names := req.Topics
+	if names == nil {
+		for _, t := range topics {
+			names = append(names, t.Name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		n, ok := counts[name]
+		if !ok {
+			resp.Topics = append(resp.Topics, metadataTopic{ErrorCode: int16(ErrUnknownTopicOrPartition), Name: name})
+			continue
+		}
+		t := metadataTopic{Name: name, Partitions: make([]metadataPartition, n)}
+		for p := range t.Partitions {
+			t.Partitions[p] = metadataPartition{
+				Index:    int32(p),
+				Leader:   nodeID,
+				Replicas: []int32{nodeID},
+				ISR:      []int32{nodeID},
+				Offline:  []int32{},
+			}
+		}
+		resp.Topics = append(resp.Topics, t)
+	}
+	return resp
+}
+
+func (s *Server) produce(req *produceRequest) *produceResponse {
+	resp := &produceResponse{}
+	for _, t := range req.Topics {
+		tr := produceTopicResponse{Name: t.Name}
+		for _, p := range t.Partitions {
+			pr := producePartitionResponse{Index: p.Index, BaseOffset: -1, LogAppendTimeMs: -1, LogStartOffset: -1}
+			base, start, err := s.appendBatches(t.Name, int(p.Index), p.Records)
+			if err != nil {
+				pr.ErrorCode = errorCode(err)
+				pr.ErrorMessage = err.Error()
+			} else {
+				pr.BaseOffset, pr.LogStartOffset = int64(base), int64(start)
+			}
+			tr.Partitions = append(tr.Partitions, pr)
+		}
+		resp.Topics = append(resp.Topics, tr)
+	}
+	return resp
+}
+
+// appendBatches appends the records of a produce request's batches and
+// returns the first one's offset and the partition's start offset.
+func (s *Server) appendBatches(topic string, partition int, data []byte) (base, start int, err error) {
+	l, ok := s.broker.Partition(topic, partition)
+	if !ok {
+		return 0, 0, ErrUnknownTopicOrPartition
+	}
+	recs, err := decodeBatches(data, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(recs) == 0 {
+		return l.EndOffset(), l.StartOffset(), nil
+	}
+	for i := range recs {
+		recs[i].Offset = 0
+	}
+	offsets, err := s.broker.Append(topic, partition, recs)
+	if err != nil {
+		return 0, 0, err
+	}
+	return offsets[0], l.StartOffset(), nil
+}
+
+func (s *Server) fetch(req *fetchRequest) *fetchResponse {
+	resp, size, failed := s.readFetch(req)
+	wait := min(time.Duration(req.MaxWaitMs)*time.Millisecond, maxFetchWait)
+	if size >= int(req.MinBytes) || failed || wait <= 0 {
+		return resp
+	}
+
+	// Wait for any of the partitions to grow, then read again.
+	ctx, cancel := context.WithTimeout(s.ctx, wait)
+	defer cancel()
+	for _, t := range req.Topics {
+		for _, p := range t.Partitions {
+			if l, ok := s.broker.Partition(t.Name, int(p.Index)); ok {
+				go func() {
+					if l.Wait(ctx, int(p.FetchOffset)) == nil {
+						cancel()
+					}
+				}()
+			}
+		}
+	}
+	<-ctx.Done()
+	resp, _, _ = s.readFetch(req)
+	return resp
+}
+
+// readFetch reads what a fetch asks for, returning the response, the
+// bytes of records in it and whether any partition had an error.
+func (s *Server) readFetch(req *fetchRequest) (resp *fetchResponse, size int, failed bool) {
+	budget := int(req.MaxBytes)
+	if budget <= 0 {
+		budget = defaultFetchBytes
+	}
+	resp = &fetchResponse{}
+	for _, t := range req.Topics {
+		tr := fetchTopicResponse{Name: t.Name}
+		for _, p := range t.Partitions {
+			pr := fetchPartitionResponse{Index: p.Index, HighWatermark: -1, LastStableOffset: -1, LogStartOffset: -1, PreferredReadReplica: -1, Records: []byte{}}
+			l, ok := s.broker.Partition(t.Name, int(p.Index))
+			if !ok {
+				pr.ErrorCode = int16(ErrUnknownTopicOrPartition)
+				failed = true
+				tr.Partitions = append(tr.Partitions, pr)
+				continue
+			}
+			start, end := l.StartOffset(), l.EndOffset()
+			pr.HighWatermark, pr.LastStableOffset, pr.LogStartOffset = int64(end), int64(end), int64(start)
+			off := int(p.FetchOffset)
+			switch {
+			case off < start || off > end:
+				pr.ErrorCode = int16(ErrOffsetOutOfRange)
+				failed = true
+			case off < end:
+				// Kafka returns at least one record, even past the limits,
+				// so a large record can't stall a consumer.
+				limit := budget
+				if p.MaxBytes > 0 {
+					limit = min(int(p.MaxBytes), budget)
+				}
+				recs, err := readRecords(l, off, limit, size == 0)
+				if err != nil {
+					pr.ErrorCode = errorCode(err)
+					failed = true
+					break
+				}
+				if len(recs) > 0 {
+					batch, err := encodeBatch(recs, false)
+					if err != nil {
+						pr.ErrorCode = errorCode(err)
+						failed = true
+						break
+					}
+					pr.Records = batch
+					size += len(batch)
+					budget -= len(batch)
+				}
+			}
+			tr.Partitions = append(tr.Partitions, pr)
+		}
+		resp.Topics = append(resp.Topics, tr)
+	}
+	return resp, size, failed
+}
+
+// readRecords reads records from offset while they fit in limit bytes,
+// taking the first one regardless if first is set.
+func readRecords(l commitlog.Log, offset, limit int, first bool) ([]commitlog.Record, error) {
+	var recs []commitlog.Record
+	used := 0
+	for {
+		chunk, err := commitlog.ReadRange(l, offset, fetchChunk)
+		if err != nil {
+			var oor *commitlog.ErrOffsetOutOfRange
+			if errors.As(err, &oor) {
+				if len(recs) > 0 {
+					return recs, nil
+				}
+				return nil, ErrOffsetOutOfRange
+			}
+			return nil, err
+		}
+		for _, rec := range chunk {
+			n := len(rec.Key) + len(rec.Value) + recordOverhead
+			if used+n > limit && !(first && len(recs) == 0) {
+				return recs, nil
+			}
+			recs = append(recs, rec)
+			used += n
+		}
+		if len(chunk) < fetchChunk {
+			return recs, nil
+		}
+		offset += len(chunk)
+	}
+}
+
+func (s *Server) listOffsets(req *listOffsetsRequest) *listOffsetsResponse {
+	resp := &listOffsetsResponse{}
+	for _, t := range req.Topics {
+		tr := listOffsetsTopicResponse{Name: t.Name}
+		for _, p := range t.Partitions {
+			pr := listOffsetsPartitionResponse{Index: p.Index, Timestamp: -1, Offset: -1}
+			l, ok := s.broker.Partition(t.Name, int(p.Index))
+			switch {
+			case !ok:
+				pr.ErrorCode = int16(ErrUnknownTopicOrPartition)
+			case p.Timestamp == Latest:
+				pr.Offset = int64(l.EndOffset())
+			case p.Timestamp == Earliest:
+				pr.Offset = int64(l.StartOffset())
+			default:
+				off, ts, err := offsetForTime(l, p.Timestamp)
+				pr.ErrorCode = errorCode(err)
+				if err == nil && off >= 0 {
+					pr.Offset, pr.Timestamp = int64(off), ts
+				}
+			}
+			tr.Partitions = append(tr.Partitions, pr)
+		}
+		resp.Topics = append(resp.Topics, tr)
+	}
+	return resp
+}
+
+// offsetForTime returns the first record whose timestamp is at least ms
+// milliseconds since the epoch, and its timestamp, or -1 if there is
+// none. It binary searches, assuming timestamps grow with offsets, as
+// they do unless producers set them out of order.
+func offsetForTime(l commitlog.Log, ms int64) (int, int64, error) {
+	lo, hi := l.StartOffset(), l.EndOffset()
+	var readErr error
+	i := sort.Search(hi-lo, func(i int) bool {
+		rec, err := l.Read(lo + i)
+		if err != nil {
+			readErr = err
+			return true
+		}
+		return rec.Timestamp.UnixMilli() >= ms
+	})
+	if readErr != nil {
+		return 0, 0, readErr
+	}
+	if lo+i == hi {
+		return -1, -1, nil
+	}
+	rec, err := l.Read(lo + i)
+	if err != nil {
+		return 0, 0, err
+	}
+	return lo + i, rec.Timestamp.UnixMilli(), nil
+}
+
+// offsetCommit records offsets under any group ID. There is no group
+// membership, so the generation and member ID are not checked.
+func (s *Server) offsetCommit(req *offsetCommitRequest) *offsetCommitResponse {
+	resp := &offsetCommitResponse{}
+	for _, t := range req.Topics {
+		tr := offsetCommitTopicResponse{Name: t.Name}
+		for _, p := range t.Partitions {
+			var err error
+			if req.GroupID == "" {
+				err = ErrInvalidGroupID
+			} else if _, ok := s.broker.Partition(t.Name, int(p.Index)); !ok {
+				err = ErrUnknownTopicOrPartition
+			} else {
+				err = s.broker.CommitOffset(req.GroupID, GroupOffset{
+					Topic:     t.Name,
+					Partition: int(p.Index),
+					Offset:    int(p.Offset),
+					Metadata:  p.Metadata,
+				})
+			}
+			if err != nil && errorCode(err) == int16(ErrUnknownServerError) {
+				log.Printf("kafka: committing %s/%d for group %s: %v", t.Name, p.Index, req.GroupID, err)
+			}
+			tr.Partitions = append(tr.Partitions, partitionError{Index: p.Index, ErrorCode: errorCode(err)})
+		}
+		resp.Topics = append(resp.Topics, tr)
+	}
+	return resp
+}
+
+// offsetFetch returns committed offsets, -1 for partitions the group has
+// not committed.
+func (s *Server) offsetFetch(req *offsetFetchRequest) *offsetFetchResponse {
+	resp := &offsetFetchResponse{}
+	committed := map[string]map[int]GroupOffset{}
+	for _, o := range s.broker.GroupOffsets(req.GroupID) {
+		if committed[o.Topic] == nil {
+			committed[o.Topic] = map[int]GroupOffset{}
+		}
+		committed[o.Topic][o.Partition] = o
+	}
+	topics := req.Topics
+	if topics == nil {
+		for name, parts := range committed {
+			t := offsetFetchTopic{Name: name}
+			for p := range parts {
+				t.Partitions = append(t.Partitions, int32(p))
+			}
+			sort.Slice(t.Partitions, func(i, j int) bool { return t.Partitions[i] < t.Partitions[j] })
+			topics = append(topics, t)
+		}
+		sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+	}
+	for _, t := range topics {
+		tr := offsetFetchTopicResponse{Name: t.Name}
+		for _, p := range t.Partitions {
+			pr := offsetFetchPartitionResponse{Index: p, Offset: -1, LeaderEpoch: -1}
+			if o, ok := committed[t.Name][int(p)]; ok {
+				pr.Offset, pr.Metadata = int64(o.Offset), o.Metadata
+			}
+			tr.Partitions = append(tr.Partitions, pr)
+		}
+		resp.Topics = append(resp.Topics, tr)
+	}
+	return resp
+}
+
+// findCoordinator names the Server as every group's coordinator. It has
+// no transaction coordinator.
+func (s *Server) findCoordinator(req *findCoordinatorRequest) *findCoordinatorResponse {
+	if req.KeyType != 0 {
+		return &findCoordinatorResponse{
+			ErrorCode:    int16(ErrCoordinatorNotAvailable),
+			ErrorMessage: "transactions are not supported",
+			NodeID:       -1,
+			Port:         -1,
+		}
+	}
+	host, port := s.address()
+	return &findCoordinatorResponse{NodeID: nodeID, Host: host, Port: port}
+}
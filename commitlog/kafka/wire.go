@@ -0,0 +1,235 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var errShort = errors.New("kafka: message too short")
+
+// wire reads or writes the fields of a message in the protocol's
+// big-endian encoding. The same fields method describes a message in
+// both directions: when reading, each call fills in the value pointed
+// to; when writing, it appends it. The first error sticks and makes
+// later calls no-ops.
+type wire struct {
+	read bool
+	buf  []byte
+	off  int // next byte to read
+	err  error
+}
+
+func newReader(buf []byte) *wire { return &wire{read: true, buf: buf} }
+func newWriter() *wire           { return &wire{} }
+
+func (w *wire) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// take returns the next n bytes to read.
+func (w *wire) take(n int) []byte {
+	if w.err != nil {
+		return nil
+	}
+	if n < 0 || len(w.buf)-w.off < n {
+		w.fail(errShort)
+		return nil
+	}
+	b := w.buf[w.off : w.off+n]
+	w.off += n
+	return b
+}
+
+func (w *wire) i8(v *int8) {
+	if !w.read {
+		w.buf = append(w.buf, byte(*v))
+	} else if b := w.take(1); b != nil {
+		*v = int8(b[0])
+	}
+}
+
+func (w *wire) boolean(v *bool) {
+	b := int8(0)
+	if *v {
+		b = 1
+	}
+	w.i8(&b)
+	*v = b != 0
+}
+
+func (w *wire) i16(v *int16) {
+	if !w.read {
+		w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(*v))
+	} else if b := w.take(2); b != nil {
+		*v = int16(binary.BigEndian.Uint16(b))
+	}
+}
+
+func (w *wire) i32(v *int32) {
+	if !w.read {
+		w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(*v))
+	} else if b := w.take(4); b != nil {
+		*v = int32(binary.BigEndian.Uint32(b))
+	}
+}
+
+func (w *wire) i64(v *int64) {
+	if !w.read {
+		w.buf = binary.BigEndian.AppendUint64(w.buf, uint64(*v))
+	} else if b := w.take(8); b != nil {
+		*v = int64(binary.BigEndian.Uint64(b))
+	}
+}
+
+// str is a STRING: an int16 length and UTF-8 bytes.
+func (w *wire) str(v *string) {
+	if !w.read {
+		if len(*v) > math.MaxInt16 {
+			w.fail(fmt.Errorf("kafka: string of %d bytes is too long", len(*v)))
+			return
+		}
+		n := int16(len(*v))
+		w.i16(&n)
+		w.buf = append(w.buf, *v...)
+		return
+	}
+	var n int16
+	w.i16(&n)
+	if n < 0 {
+		w.fail(errors.New("kafka: null string where one is required"))
+		return
+	}
+	*v = string(w.take(int(n)))
+}
+
+// nstr is a NULLABLE_STRING, with null read as and "" written as null.
+func (w *wire) nstr(v *string) {
+	if !w.read {
+		if *v == "" {
+			n := int16(-1)
+			w.i16(&n)
+			return
+		}
+		w.str(v)
+		return
+	}
+	var n int16
+	w.i16(&n)
+	if n < 0 {
+		*v = ""
+		return
+	}
+	*v = string(w.take(int(n)))
+}
+
+// bytes is NULLABLE_BYTES: an int32 length, -1 for nil.
+func (w *wire) bytes(v *[]byte) {
+	if !w.read {
+		n := int32(len(*v))
+		if *v == nil {
+			n = -1
+		}
+		w.i32(&n)
+		w.buf = append(w.buf, *v...)
+		return
+	}
+	var n int32
+	w.i32(&n)
+	if n < 0 {
+		*v = nil
+		return
+	}
+	*v = w.take(int(n))
+}
+
+// arrayLen reads or writes an ARRAY's int32 length. Reading a null
+// array gives -1. Lengths claiming more elements than there are bytes
+// left are rejected, so a corrupt length can't allocate a huge slice.
+func (w *wire) arrayLen(n *int) {
+	v := int32(*n)
+	w.i32(&v)
+	if w.read {
+		if int(v) > len(w.buf)-w.off {
+			w.fail(errShort)
+			v = 0
+		}
+		*n = int(v)
+	}
+}
+
+// array reads or writes *s with f describing each element. A nil slice
+// is written, and a null array read, as nil when nullable; otherwise as
+// an empty array.
+func array[T any](w *wire, s *[]T, nullable bool, f func(*T)) {
+	n := len(*s)
+	if !w.read && *s == nil && nullable {
+		n = -1
+	}
+	w.arrayLen(&n)
+	if w.read {
+		switch {
+		case n < 0 && nullable:
+			*s = nil
+			return
+		case n < 0:
+			n = 0
+		}
+		*s = make([]T, n)
+	}
+	for i := range *s {
+		if w.err != nil {
+			return
+		}
+		f(&(*s)[i])
+	}
+}
+
+// int32s is an ARRAY of INT32.
+func (w *wire) int32s(s *[]int32) {
+	array(w, s, false, func(v *int32) { w.i32(v) })
+}
+
+// varint and varlong are the zigzag-encoded integers of record batches.
+func (w *wire) varint(v *int64) {
+	if !w.read {
+		w.buf = binary.AppendVarint(w.buf, *v)
+		return
+	}
+	if w.err != nil {
+		return
+	}
+	x, n := binary.Varint(w.buf[w.off:])
+	if n <= 0 {
+		w.fail(errShort)
+		return
+	}
+	*v = x
+	w.off += n
+}
+
+// varbytes is a varint length and bytes, -1 for nil, as record keys and
+// values are encoded.
+func (w *wire) varbytes(v *[]byte) {
+	n := int64(len(*v))
+	if !w.read && *v == nil {
+		n = -1
+	}
+	w.varint(&n)
+	if !w.read {
+		w.buf = append(w.buf, *v...)
+		return
+	}
+	if n < 0 {
+		*v = nil
+		return
+	}
+	if n > int64(len(w.buf)-w.off) {
+		w.fail(errShort)
+		return
+	}
+	*v = w.take(int(n))
+}
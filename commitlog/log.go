@@ -0,0 +1,97 @@
+// Package commitlog provides an append-only log of records addressed by
+// offset, with in-memory and file-backed implementations.
+package commitlog
+
+import (
+	"errors"
+	"time"
+)
+
+// Record is a single entry in a log.
+type Record struct {
+	Offset    int       `json:"offset"`
+	Key       string    `json:"key,omitempty"`
+	Value     string    `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Log is an append-only sequence of records. Offsets are assigned in
+// order by Append and are never reused, except after TruncateAfter.
+//
+// Implementations are safe for concurrent use.
+type Log interface {
+	// Append adds rec to the end of the log and returns its offset. The
+	// record's Offset is ignored; a zero Timestamp is set to now.
+	Append(rec Record) (int, error)
+	// Read returns the record at offset, or an *ErrOffsetOutOfRange.
+	Read(offset int) (Record, error)
+	// StartOffset returns the lowest offset still held by the log.
+	StartOffset() int
+	// EndOffset returns the offset the next appended record will get.
+	EndOffset() int
+	// DeleteBefore drops every record below offset. The next append
+	// still gets EndOffset.
+	DeleteBefore(offset int) error
+	// TruncateAfter drops every record above offset, so the next append
+	// gets offset+1. It is meant for discarding a replica's divergent
+	// tail.
+	TruncateAfter(offset int) error
+	// Close releases the log's resources.
+	Close() error
+}
+
+// BatchAppender is implemented by logs that can append several records
+// more cheaply than one at a time.
+type BatchAppender interface {
+	AppendBatch(recs []Record) ([]int, error)
+}
+
+// AppendBatch appends recs in order and returns their offsets. It uses
+// l's AppendBatch method if it has one. On error the offsets of the
+// records appended so far are returned.
+func AppendBatch(l Log, recs []Record) ([]int, error) {
+	if b, ok := l.(BatchAppender); ok {
+		return b.AppendBatch(recs)
+	}
+	offsets := make([]int, 0, len(recs))
+	for _, rec := range recs {
+		off, err := l.Append(rec)
+		if err != nil {
+			return offsets, err
+		}
+		offsets = append(offsets, off)
+	}
+	return offsets, nil
+}
+
+// ReadRange returns up to max records starting at from, stopping at the
+// end of the log. A max of zero or less means no limit.
+func ReadRange(l Log, from, max int) ([]Record, error) {
+	end := l.EndOffset()
+	if max > 0 && from+max < end {
+		end = from + max
+	}
+	var records []Record
+	for off := from; off < end; off++ {
+		rec, err := l.Read(off)
+		if err != nil {
+			var oor *ErrOffsetOutOfRange
+			if len(records) > 0 && errors.As(err, &oor) {
+				break // truncated while we were reading
+			}
+			return records, err
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// List returns every record in the log.
+func List(l Log) ([]Record, error) {
+	records, err := ReadRange(l, l.StartOffset(), 0)
+	if errors.Is(err, ErrTruncated) {
+		// Deleted between StartOffset and the first read; start over.
+		return List(l)
+	}
+	return records, err
+}
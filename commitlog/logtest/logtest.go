@@ -0,0 +1,210 @@
+// Package logtest is a conformance suite for commitlog.Log
+// implementations.
+package logtest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// Run tests the behaviour every commitlog.Log must have. newLog must
+// return a new, empty log; Run closes it.
+func Run(t *testing.T, newLog func(t *testing.T) commitlog.Log) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, l commitlog.Log)
+	}{
+		{"AppendRead", testAppendRead},
+		{"OutOfRange", testOutOfRange},
+		{"ConcurrentAppend", testConcurrentAppend},
+		{"DeleteBefore", testDeleteBefore},
+		{"DeleteBeforeAll", testDeleteBeforeAll},
+		{"TruncateAfter", testTruncateAfter},
+		{"TruncateAfterAll", testTruncateAfterAll},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLog(t)
+			defer l.Close()
+			tt.fn(t, l)
+		})
+	}
+}
+
+func appendN(t *testing.T, l commitlog.Log, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		want := l.EndOffset()
+		off, err := l.Append(commitlog.Record{Key: fmt.Sprintf("k%d", want), Value: fmt.Sprintf("v%d", want)})
+		if err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+		if off != want {
+			t.Fatalf("Append returned offset %d, want %d", off, want)
+		}
+	}
+}
+
+func checkRead(t *testing.T, l commitlog.Log, offset int) {
+	t.Helper()
+	rec, err := l.Read(offset)
+	if err != nil {
+		t.Fatalf("Read(%d): %v", offset, err)
+	}
+	if rec.Offset != offset || rec.Key != fmt.Sprintf("k%d", offset) || rec.Value != fmt.Sprintf("v%d", offset) {
+		t.Fatalf("Read(%d) = %+v", offset, rec)
+	}
+	if rec.Timestamp.IsZero() {
+		t.Fatalf("Read(%d) has no timestamp", offset)
+	}
+}
+
+func checkRange(t *testing.T, l commitlog.Log, start, end int) {
+	t.Helper()
+	if got := l.StartOffset(); got != start {
+		t.Fatalf("StartOffset = %d, want %d", got, start)
+	}
+	if got := l.EndOffset(); got != end {
+		t.Fatalf("EndOffset = %d, want %d", got, end)
+	}
+}
+
+func checkOutOfRange(t *testing.T, err error, offset, start, end int) {
+	t.Helper()
+	var oor *commitlog.ErrOffsetOutOfRange
+	if !errors.As(err, &oor) {
+		t.Fatalf("offset %d: got %v, want ErrOffsetOutOfRange", offset, err)
+	}
+	if oor.Offset != offset || oor.Start != start || oor.End != end {
+		t.Fatalf("got %+v, want offset %d in [%d, %d)", oor, offset, start, end)
+	}
+	if truncated := offset >= 0 && offset < start; errors.Is(err, commitlog.ErrTruncated) != truncated {
+		t.Fatalf("offset %d: errors.Is(ErrTruncated) = %v, want %v", offset, !truncated, truncated)
+	}
+}
+
+func testAppendRead(t *testing.T, l commitlog.Log) {
+	checkRange(t, l, 0, 0)
+	appendN(t, l, 50)
+	checkRange(t, l, 0, 50)
+	for off := 0; off < 50; off++ {
+		checkRead(t, l, off)
+	}
+	records, err := commitlog.ReadRange(l, 10, 5)
+	if err != nil || len(records) != 5 || records[0].Offset != 10 {
+		t.Fatalf("ReadRange(10, 5) = %d records, %v", len(records), err)
+	}
+}
+
+func testOutOfRange(t *testing.T, l commitlog.Log) {
+	_, err := l.Read(0)
+	checkOutOfRange(t, err, 0, 0, 0)
+	appendN(t, l, 3)
+	_, err = l.Read(3)
+	checkOutOfRange(t, err, 3, 0, 3)
+	_, err = l.Read(-1)
+	checkOutOfRange(t, err, -1, 0, 3)
+}
+
+func testConcurrentAppend(t *testing.T, l commitlog.Log) {
+	const writers, each = 8, 25
+	var wg sync.WaitGroup
+	offsets := make(chan int, writers*each)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				off, err := l.Append(commitlog.Record{Value: "x"})
+				if err != nil {
+					t.Errorf("Append: %v", err)
+					return
+				}
+				offsets <- off
+			}
+		}()
+	}
+	wg.Wait()
+	close(offsets)
+	seen := make(map[int]bool)
+	for off := range offsets {
+		if seen[off] {
+			t.Fatalf("offset %d assigned twice", off)
+		}
+		seen[off] = true
+	}
+	checkRange(t, l, 0, writers*each)
+}
+
+func testDeleteBefore(t *testing.T, l commitlog.Log) {
+	appendN(t, l, 20)
+	if err := l.DeleteBefore(12); err != nil {
+		t.Fatalf("DeleteBefore: %v", err)
+	}
+	checkRange(t, l, 12, 20)
+	_, err := l.Read(11)
+	checkOutOfRange(t, err, 11, 12, 20)
+	checkRead(t, l, 12)
+
+	// Moving the start backwards is a no-op; past the end is an error.
+	if err := l.DeleteBefore(5); err != nil {
+		t.Fatalf("DeleteBefore(5): %v", err)
+	}
+	checkRange(t, l, 12, 20)
+	checkOutOfRange(t, l.DeleteBefore(21), 21, 12, 20)
+
+	appendN(t, l, 1)
+	checkRange(t, l, 12, 21)
+	checkRead(t, l, 20)
+}
+
+func testDeleteBeforeAll(t *testing.T, l commitlog.Log) {
+	appendN(t, l, 10)
+	if err := l.DeleteBefore(10); err != nil {
+		t.Fatalf("DeleteBefore: %v", err)
+	}
+	checkRange(t, l, 10, 10)
+	appendN(t, l, 2)
+	checkRange(t, l, 10, 12)
+	checkRead(t, l, 11)
+}
+
+func testTruncateAfter(t *testing.T, l commitlog.Log) {
+	appendN(t, l, 20)
+	if err := l.TruncateAfter(7); err != nil {
+		t.Fatalf("TruncateAfter: %v", err)
+	}
+	checkRange(t, l, 0, 8)
+	_, err := l.Read(8)
+	checkOutOfRange(t, err, 8, 0, 8)
+	checkRead(t, l, 7)
+
+	// Truncating at or past the end is a no-op.
+	if err := l.TruncateAfter(30); err != nil {
+		t.Fatalf("TruncateAfter(30): %v", err)
+	}
+	checkRange(t, l, 0, 8)
+
+	appendN(t, l, 3)
+	checkRange(t, l, 0, 11)
+	checkRead(t, l, 10)
+}
+
+func testTruncateAfterAll(t *testing.T, l commitlog.Log) {
+	appendN(t, l, 10)
+	if err := l.DeleteBefore(4); err != nil {
+		t.Fatalf("DeleteBefore: %v", err)
+	}
+	checkOutOfRange(t, l.TruncateAfter(2), 2, 4, 10)
+	if err := l.TruncateAfter(3); err != nil {
+		t.Fatalf("TruncateAfter: %v", err)
+	}
+	checkRange(t, l, 4, 4)
+	appendN(t, l, 1)
+	checkRange(t, l, 4, 5)
+	checkRead(t, l, 4)
+}
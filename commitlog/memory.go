@@ -0,0 +1,84 @@
+package commitlog
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryLog is a Log held entirely in memory.
+type MemoryLog struct {
+	mu      sync.RWMutex
+	records []Record
+	base    int
+}
+
+var _ Log = (*MemoryLog)(nil)
+
+// NewMemoryLog returns an empty in-memory log.
+func NewMemoryLog() *MemoryLog {
+	return &MemoryLog{}
+}
+
+func (l *MemoryLog) Append(rec Record) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec.Offset = l.base + len(l.records)
+	if rec.Timestamp.IsZero() {
+		rec.Timestamp = time.Now()
+	}
+	l.records = append(l.records, rec)
+	return rec.Offset, nil
+}
+
+func (l *MemoryLog) Read(offset int) (Record, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if offset < l.base || offset >= l.base+len(l.records) {
+		return Record{}, &ErrOffsetOutOfRange{Offset: offset, Start: l.base, End: l.base + len(l.records)}
+	}
+	return l.records[offset-l.base], nil
+}
+
+func (l *MemoryLog) StartOffset() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.base
+}
+
+func (l *MemoryLog) EndOffset() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.base + len(l.records)
+}
+
+func (l *MemoryLog) DeleteBefore(offset int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	end := l.base + len(l.records)
+	if offset > end {
+		return &ErrOffsetOutOfRange{Offset: offset, Start: l.base, End: end}
+	}
+	if offset <= l.base {
+		return nil
+	}
+	l.records = append([]Record(nil), l.records[offset-l.base:]...)
+	l.base = offset
+	return nil
+}
+
+func (l *MemoryLog) TruncateAfter(offset int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if offset < l.base-1 {
+		return &ErrOffsetOutOfRange{Offset: offset, Start: l.base, End: l.base + len(l.records)}
+	}
+	n := offset + 1 - l.base
+	if n < len(l.records) {
+		l.records = l.records[:n:n]
+	}
+	return nil
+}
+
+func (l *MemoryLog) Close() error {
+	return nil
+}
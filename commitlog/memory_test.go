@@ -0,0 +1,14 @@
+package commitlog_test
+
+import (
+	"testing"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/logtest"
+)
+
+func TestMemoryLog(t *testing.T) {
+	logtest.Run(t, func(t *testing.T) commitlog.Log {
+		return commitlog.NewMemoryLog()
+	})
+}
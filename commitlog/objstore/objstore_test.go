@@ -0,0 +1,86 @@
+package objstore_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/objstore"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/objstore/s3test"
+)
+
+func testStore(t *testing.T, store commitlog.ObjectStore) {
+	ctx := context.Background()
+	put := func(key, data string) {
+		t.Helper()
+		if err := store.Put(ctx, key, strings.NewReader(data), int64(len(data))); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+	put("a/1", "one")
+	put("a/2", "")
+	put("a/3", "three")
+	put("b/1", "other")
+	put("a/1", "uno")
+
+	rc, err := store.Get(ctx, "a/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "uno" {
+		t.Fatalf("Get(a/1) = %q, want the replaced contents", data)
+	}
+
+	objs, err := store.List(ctx, "a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []commitlog.ObjectInfo{{Key: "a/1", Size: 3}, {Key: "a/2", Size: 0}, {Key: "a/3", Size: 5}}
+	if len(objs) != len(want) {
+		t.Fatalf("List(a/) = %v, want %v", objs, want)
+	}
+	for i := range want {
+		if objs[i] != want[i] {
+			t.Fatalf("List(a/) = %v, want %v", objs, want)
+		}
+	}
+
+	if err := store.Delete(ctx, "a/1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "a/1"); err != nil {
+		t.Fatalf("deleting a missing object: %v", err)
+	}
+	if _, err := store.Get(ctx, "a/1"); !errors.Is(err, commitlog.ErrObjectNotFound) {
+		t.Fatalf("Get after Delete = %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestDir(t *testing.T) {
+	store, err := objstore.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
+
+func TestS3(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.PageSize = 2 // exercise List pagination
+	store, err := objstore.NewS3(objstore.S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    "segments",
+		AccessKey: "test",
+		SecretKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
@@ -0,0 +1,157 @@
+// Package s3test provides an in-memory stand-in for an S3-compatible
+// service, for testing objstore.S3 and tiered storage without one.
+//
+// It serves path-style PutObject, GetObject, DeleteObject and
+// ListObjectsV2 for any bucket name, and rejects requests that lack
+// SigV4 headers. Signatures themselves are not checked.
+package s3test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server is a running stand-in. Its URL is the endpoint to configure.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+	// PageSize caps the keys per ListObjectsV2 page, to exercise
+	// pagination.
+	PageSize int
+}
+
+// NewServer starts a stand-in; Close it when done.
+func NewServer() *Server {
+	s := &Server{buckets: make(map[string]map[string][]byte), PageSize: 1000}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Objects returns the keys stored in bucket, sorted.
+func (s *Server) Objects(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k := range s.buckets[bucket] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type errorBody struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(errorBody{Code: code, Message: msg})
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Amz-Date") == "" || r.Header.Get("X-Amz-Content-Sha256") == "" {
+		writeError(w, http.StatusForbidden, "AccessDenied", "missing SigV4 headers")
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" {
+		writeError(w, http.StatusBadRequest, "InvalidBucketName", "no bucket in path")
+		return
+	}
+	if key == "" {
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			s.list(w, r, bucket)
+			return
+		}
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "bucket operation not supported")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			writeError(w, http.StatusLengthRequired, "MissingContentLength", "Content-Length required")
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		s.mu.Lock()
+		if s.buckets[bucket] == nil {
+			s.buckets[bucket] = make(map[string][]byte)
+		}
+		s.buckets[bucket][key] = data
+		s.mu.Unlock()
+	case http.MethodGet:
+		s.mu.Lock()
+		data, ok := s.buckets[bucket][key]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.buckets[bucket], key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+type listResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Prefix                string   `xml:"Prefix"`
+	KeyCount              int      `xml:"KeyCount"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken,omitempty"`
+	Contents              []object `xml:"Contents"`
+}
+
+type object struct {
+	Key  string `xml:"Key"`
+	Size int    `xml:"Size"`
+}
+
+// list serves ListObjectsV2. The continuation token is the last key of
+// the previous page.
+func (s *Server) list(w http.ResponseWriter, r *http.Request, bucket string) {
+	prefix := r.URL.Query().Get("prefix")
+	after := r.URL.Query().Get("continuation-token")
+	s.mu.Lock()
+	var all []object
+	for k, v := range s.buckets[bucket] {
+		if strings.HasPrefix(k, prefix) && k > after {
+			all = append(all, object{Key: k, Size: len(v)})
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].Key < all[j].Key })
+
+	res := listResult{Prefix: prefix, Contents: all}
+	if len(all) > s.PageSize {
+		res.Contents = all[:s.PageSize]
+		res.IsTruncated = true
+		res.NextContinuationToken = res.Contents[len(res.Contents)-1].Key
+	}
+	res.KeyCount = len(res.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(res)
+}
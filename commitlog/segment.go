@@ -0,0 +1,326 @@
+package commitlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// On disk a segment is a pair of files named after the segment's base
+// offset. The store file holds frames:
+//
+//	length uint32 | crc32c uint32 | payload
+//
+// where the payload is an encoded Record. The index file holds, for each
+// record in order, the uint64 position of its frame in the store file.
+const (
+	storeExt  = ".store"
+	indexExt  = ".index"
+	frameSize = 8
+	entrySize = 8
+
+	recordVersion = 1
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// encodeRecord returns the frame for rec.
+func encodeRecord(rec Record) []byte {
+	payload := make([]byte, 0, 1+8+8+binary.MaxVarintLen64+len(rec.Key)+len(rec.Value))
+	payload = append(payload, recordVersion)
+	payload = binary.BigEndian.AppendUint64(payload, uint64(rec.Offset))
+	payload = binary.BigEndian.AppendUint64(payload, uint64(rec.Timestamp.UnixNano()))
+	payload = binary.AppendUvarint(payload, uint64(len(rec.Key)))
+	payload = append(payload, rec.Key...)
+	payload = append(payload, rec.Value...)
+
+	frame := make([]byte, frameSize, frameSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	return append(frame, payload...)
+}
+
+// decodeRecord parses a frame payload.
+func decodeRecord(p []byte) (Record, error) {
+	if len(p) < 17 || p[0] != recordVersion {
+		return Record{}, ErrCorrupt
+	}
+	rec := Record{
+		Offset:    int(binary.BigEndian.Uint64(p[1:9])),
+		Timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(p[9:17]))),
+	}
+	p = p[17:]
+	n, w := binary.Uvarint(p)
+	if w <= 0 || uint64(len(p)-w) < n {
+		return Record{}, ErrCorrupt
+	}
+	rec.Key = string(p[w : w+int(n)])
+	rec.Value = string(p[w+int(n):])
+	return rec, nil
+}
+
+// readFrame reads one frame and returns its payload and encoded size.
+// left is how many bytes r holds from the frame on, or -1 if that isn't
+// known. A checksum mismatch, or a length running past left, returns
+// ErrCorrupt along with the frame's size.
+func readFrame(r io.Reader, left int64) ([]byte, int64, error) {
+	var hdr [frameSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, 0, err
+	}
+	n := int64(binary.BigEndian.Uint32(hdr[0:4]))
+	if left >= 0 && frameSize+n > left {
+		return nil, frameSize + n, ErrCorrupt
+	}
+	var payload []byte
+	var err error
+	if left >= 0 {
+		payload = make([]byte, n)
+		_, err = io.ReadFull(r, payload)
+	} else {
+		// Without a bound the length isn't trusted with an allocation
+		// before the bytes it claims arrive.
+		payload, err = io.ReadAll(io.LimitReader(r, n))
+		if err == nil && int64(len(payload)) < n {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(hdr[4:8]) {
+		return nil, frameSize + n, ErrCorrupt
+	}
+	return payload, frameSize + n, nil
+}
+
+func segmentPath(dir string, base int, ext string) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", base, ext))
+}
+
+// segment is one store/index file pair covering a contiguous run of
+// offsets starting at base.
+type segment struct {
+	base  int
+	store *os.File
+	index *os.File
+	// pos holds the store position of each record's frame.
+	pos  []int64
+	size int64
+}
+
+// openSegment opens or creates the segment at base in dir. The index is
+// checked against the store, and rebuilt from it if they disagree. When
+// last is set a torn tail left by a crash is truncated away; in any
+// other segment it is reported as ErrCorrupt.
+func openSegment(dir string, base int, last bool) (*segment, error) {
+	store, err := os.OpenFile(segmentPath(dir, base, storeExt), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	index, err := os.OpenFile(segmentPath(dir, base, indexExt), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	s := &segment{base: base, store: store, index: index}
+	if err := s.load(last); err != nil {
+		s.close()
+		return nil, fmt.Errorf("segment %d: %w", base, err)
+	}
+	return s, nil
+}
+
+func (s *segment) load(last bool) error {
+	fi, err := s.store.Stat()
+	if err != nil {
+		return err
+	}
+	storeSize := fi.Size()
+	entries, err := readIndex(s.index)
+	if err != nil {
+		return err
+	}
+
+	// The index is trusted when its entries ascend from zero and its
+	// last entry points at a frame ending exactly at the end of the
+	// store. Otherwise it is rebuilt by scanning the store.
+	if s.indexMatches(entries, storeSize) {
+		s.pos = entries
+		s.size = storeSize
+		return nil
+	}
+
+	var end int64
+	r := bufio.NewReader(io.NewSectionReader(s.store, 0, storeSize))
+	for end < storeSize {
+		_, n, err := readFrame(r, storeSize-end)
+		if err != nil {
+			if !last || (errors.Is(err, ErrCorrupt) && end+n < storeSize) {
+				// Only the last frame of the last segment can
+				// be torn by a crash.
+				return fmt.Errorf("%w: record %d at position %d", ErrCorrupt, s.base+len(s.pos), end)
+			}
+			break
+		}
+		s.pos = append(s.pos, end)
+		end += n
+	}
+	if end < storeSize {
+		if err := s.store.Truncate(end); err != nil {
+			return err
+		}
+	}
+	s.size = end
+
+	return s.writeIndex()
+}
+
+func (s *segment) indexMatches(entries []int64, storeSize int64) bool {
+	if len(entries) == 0 {
+		return storeSize == 0
+	}
+	if entries[0] != 0 {
+		return false
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i] <= entries[i-1] {
+			return false
+		}
+	}
+	last := entries[len(entries)-1]
+	var hdr [frameSize]byte
+	if _, err := s.store.ReadAt(hdr[:], last); err != nil {
+		return false
+	}
+	return last+frameSize+int64(binary.BigEndian.Uint32(hdr[0:4])) == storeSize
+}
+
+func readIndex(f *os.File) ([]int64, error) {
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, indexSize(f)))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]int64, 0, len(data)/entrySize)
+	for i := 0; i+entrySize <= len(data); i += entrySize {
+		entries = append(entries, int64(binary.BigEndian.Uint64(data[i:])))
+	}
+	return entries, nil
+}
+
+func indexSize(f *os.File) int64 {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// writeIndex rewrites the index file from s.pos.
+func (s *segment) writeIndex() error {
+	buf := make([]byte, 0, len(s.pos)*entrySize)
+	for _, p := range s.pos {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(p))
+	}
+	if err := s.index.Truncate(0); err != nil {
+		return err
+	}
+	_, err := s.index.WriteAt(buf, 0)
+	return err
+}
+
+// nextOffset returns the offset the segment's next record would get.
+func (s *segment) nextOffset() int {
+	return s.base + len(s.pos)
+}
+
+func (s *segment) append(rec Record) error {
+	frame := encodeRecord(rec)
+	if _, err := s.store.WriteAt(frame, s.size); err != nil {
+		return err
+	}
+	var entry [entrySize]byte
+	binary.BigEndian.PutUint64(entry[:], uint64(s.size))
+	if _, err := s.index.WriteAt(entry[:], int64(len(s.pos))*entrySize); err != nil {
+		return err
+	}
+	s.pos = append(s.pos, s.size)
+	s.size += int64(len(frame))
+	return nil
+}
+
+func (s *segment) read(offset int) (Record, error) {
+	p := s.pos[offset-s.base]
+	payload, _, err := readFrame(io.NewSectionReader(s.store, p, s.size-p), s.size-p)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = ErrCorrupt
+		}
+		return Record{}, fmt.Errorf("segment %d, offset %d: %w", s.base, offset, err)
+	}
+	rec, err := decodeRecord(payload)
+	if err == nil && rec.Offset != offset {
+		err = ErrCorrupt
+	}
+	if err != nil {
+		return Record{}, fmt.Errorf("segment %d, offset %d: %w", s.base, offset, err)
+	}
+	return rec, nil
+}
+
+// truncate keeps the first n records of the segment.
+func (s *segment) truncate(n int) error {
+	if n >= len(s.pos) {
+		return nil
+	}
+	if err := s.store.Truncate(s.pos[n]); err != nil {
+		return err
+	}
+	if err := s.index.Truncate(int64(n) * entrySize); err != nil {
+		return err
+	}
+	s.size = s.pos[n]
+	s.pos = s.pos[:n:n]
+	return nil
+}
+
+// bytes returns the segment's size on disk.
+func (s *segment) bytes() int64 {
+	return s.size + int64(len(s.pos))*entrySize
+}
+
+func (s *segment) sync() error {
+	if err := s.store.Sync(); err != nil {
+		return err
+	}
+	return s.index.Sync()
+}
+
+func (s *segment) close() error {
+	err := s.store.Close()
+	if ierr := s.index.Close(); err == nil {
+		err = ierr
+	}
+	return err
+}
+
+// remove closes the segment and deletes its files.
+func (s *segment) remove() error {
+	s.close()
+	if err := os.Remove(s.store.Name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(s.index.Name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/client"
+)
+
+const (
+	// DefaultCheckpointInterval is how often an App checkpoints unless
+	// configured otherwise.
+	DefaultCheckpointInterval = 5 * time.Second
+	// DefaultBatchSize is how many records an App reads from a partition
+	// at a time unless configured otherwise.
+	DefaultBatchSize = 500
+
+	// idleWait is how long a poll waits for records once every input
+	// partition has been read to its end.
+	idleWait = 250 * time.Millisecond
+	// stateMetadata prefixes the committed offset metadata naming the
+	// snapshot the offsets belong to.
+	stateMetadata = "state:"
+)
+
+// Config configures an App.
+type Config struct {
+	// ID names the App. It is the consumer group committing the App's
+	// input offsets, and must stay the same across restarts.
+	ID string
+	// Input is the topic consumed and Output the topic produced to. Both
+	// must exist; output records are placed by key.
+	Input, Output string
+	// StateTopic holds the App's checkpoints. It defaults to ID+"-state"
+	// and is created with one partition if missing.
+	StateTopic string
+	// Start is where an App without a checkpoint begins reading Input:
+	// "start" (the default) or "end".
+	Start string
+	// CheckpointInterval defaults to DefaultCheckpointInterval and
+	// BatchSize to DefaultBatchSize.
+	CheckpointInterval time.Duration
+	BatchSize          int
+}
+
+// Stats counts what an App has done since it was created. Late, the
+// records Aggregate steps dropped, is kept in checkpoints and so carries
+// over restarts.
+type Stats struct {
+	Consumed    int64 `json:"consumed"`
+	Produced    int64 `json:"produced"`
+	Late        int64 `json:"late"`
+	Checkpoints int64 `json:"checkpoints"`
+}
+
+// App runs a Stream over an input topic.
+//
+// A checkpoint produces the output records buffered so far, appends a
+// snapshot of the Stream's state and the input offsets it was taken at
+// to the state topic, and then commits the input offsets to the
+// consumer group with the snapshot's offset as metadata. On start the
+// App restores the newest snapshot any committed offset names, so a
+// crash between the steps loses nothing: the snapshot, not the
+// committed offsets, says where to resume.
+type App struct {
+	client *client.Client
+	cfg    Config
+	stream *Stream
+
+	consumed, produced, checkpoints atomic.Int64
+}
+
+// snapshot is a checkpoint as stored in the state topic.
+type snapshot struct {
+	Offsets map[int]int       `json:"offsets"` // next offset by input partition
+	States  []json.RawMessage `json:"states"`  // by stage
+}
+
+// NewApp returns an App running s with the given configuration.
+func NewApp(cl *client.Client, cfg Config, s *Stream) (*App, error) {
+	if cfg.ID == "" || cfg.Input == "" || cfg.Output == "" {
+		return nil, errors.New("stream: config needs an ID, an Input and an Output")
+	}
+	if cfg.Input == cfg.Output {
+		return nil, errors.New("stream: Input and Output must differ")
+	}
+	switch cfg.Start {
+	case "":
+		cfg.Start = "start"
+	case "start", "end":
+	default:
+		return nil, fmt.Errorf("stream: Start must be \"start\" or \"end\", not %q", cfg.Start)
+	}
+	if cfg.StateTopic == "" {
+		cfg.StateTopic = cfg.ID + "-state"
+	}
+	if cfg.CheckpointInterval <= 0 {
+		cfg.CheckpointInterval = DefaultCheckpointInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	return &App{client: cl, cfg: cfg, stream: s}, nil
+}
+
+// Stats returns the App's counters. It is safe to call while Run is
+// running.
+func (a *App) Stats() Stats {
+	st := Stats{Consumed: a.consumed.Load(), Produced: a.produced.Load(), Checkpoints: a.checkpoints.Load()}
+	for _, s := range a.stream.stages {
+		if lc, ok := s.(interface{ lateRecords() int64 }); ok {
+			st.Late += lc.lateRecords()
+		}
+	}
+	return st
+}
+
+// Run restores the last checkpoint and processes records until ctx is
+// canceled, when it writes a final checkpoint and returns nil. An App
+// must not be run twice at once, in this process or any other.
+func (a *App) Run(ctx context.Context) error {
+	input, err := a.client.DescribeTopic(ctx, a.cfg.Input)
+	if err != nil {
+		return fmt.Errorf("stream: input topic: %w", err)
+	}
+	if _, err := a.client.DescribeTopic(ctx, a.cfg.Output); err != nil {
+		return fmt.Errorf("stream: output topic: %w", err)
+	}
+	if err := a.ensureStateTopic(ctx); err != nil {
+		return err
+	}
+	next, err := a.restore(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	var pending []commitlog.Record
+	out := func(rec Record) {
+		pending = append(pending, commitlog.Record{Key: rec.Key, Value: rec.Value, Timestamp: rec.Timestamp})
+	}
+	last := time.Now()
+	found := false // whether this pass over the partitions read anything
+	for p := 0; ; p = (p + 1) % len(input.Partitions) {
+		if p == 0 {
+			found = false
+		}
+		if ctx.Err() != nil {
+			// Checkpoint what was processed before stopping.
+			cctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			return a.checkpoint(cctx, next, &pending)
+		}
+		// Wait for records only when the rest of the pass found none.
+		wait := time.Duration(0)
+		if p == len(input.Partitions)-1 && !found {
+			wait = idleWait
+		}
+		recs, err := a.read(ctx, p, next, wait)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			return err
+		}
+		found = found || len(recs) > 0
+		for _, rec := range recs {
+			a.stream.process(0, rec, out)
+			next[p] = rec.Offset + 1
+		}
+		a.consumed.Add(int64(len(recs)))
+
+		if time.Since(last) >= a.cfg.CheckpointInterval {
+			if err := a.checkpoint(ctx, next, &pending); err != nil {
+				return err
+			}
+			last = time.Now()
+		} else if len(pending) >= a.cfg.BatchSize {
+			// Outputs are at-least-once anyway; don't hold many in memory.
+			if err := a.flush(ctx, &pending); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// read returns the next records of partition p, skipping past records
+// that retention has removed.
+func (a *App) read(ctx context.Context, p int, next map[int]int, wait time.Duration) ([]commitlog.Record, error) {
+	cl := a.client.Topic(a.cfg.Input, p)
+	for {
+		recs, err := cl.Records(ctx, next[p], a.cfg.BatchSize, wait)
+		var oor *commitlog.ErrOffsetOutOfRange
+		if errors.As(err, &oor) && next[p] < oor.Start {
+			log.Printf("stream: %s: partition %d: skipping offsets %d to %d, no longer held", a.cfg.ID, p, next[p], oor.Start)
+			next[p] = oor.Start
+			continue
+		}
+		return recs, err
+	}
+}
+
+func (a *App) ensureStateTopic(ctx context.Context) error {
+	_, err := a.client.CreateTopic(ctx, a.cfg.StateTopic, 1)
+	var ce *client.Error
+	if errors.As(err, &ce) && ce.Code == "topic_exists" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stream: state topic: %w", err)
+	}
+	return nil
+}
+
+// restore loads the newest checkpoint into the Stream and returns the
+// offsets to resume from.
+func (a *App) restore(ctx context.Context, input client.TopicInfo) (map[int]int, error) {
+	next := make(map[int]int)
+	for _, p := range input.Partitions {
+		if a.cfg.Start == "end" {
+			next[p.Partition] = p.EndOffset
+		} else {
+			next[p.Partition] = p.StartOffset
+		}
+	}
+
+	committed, err := a.client.DescribeGroup(ctx, a.cfg.ID)
+	var ce *client.Error
+	if errors.As(err, &ce) && ce.Code == "group_not_found" {
+		return next, a.stream.restore(nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stream: reading checkpoint: %w", err)
+	}
+	snapOffset := -1
+	for _, o := range committed {
+		if o.Topic != a.cfg.Input {
+			continue
+		}
+		next[o.Partition] = o.Offset
+		if n, err := strconv.Atoi(strings.TrimPrefix(o.Metadata, stateMetadata)); err == nil && strings.HasPrefix(o.Metadata, stateMetadata) && n > snapOffset {
+			snapOffset = n
+		}
+	}
+	if snapOffset < 0 {
+		// Offsets committed without state; start with empty state.
+		return next, a.stream.restore(nil)
+	}
+
+	rec, err := a.client.Topic(a.cfg.StateTopic, 0).Consume(ctx, snapOffset)
+	if err != nil {
+		return nil, fmt.Errorf("stream: reading checkpoint %d: %w", snapOffset, err)
+	}
+	var snap snapshot
+	if err := json.Unmarshal([]byte(rec.Value), &snap); err != nil {
+		return nil, fmt.Errorf("stream: decoding checkpoint %d: %w", snapOffset, err)
+	}
+	if len(snap.States) != len(a.stream.stages) {
+		return nil, fmt.Errorf("stream: checkpoint %d has %d stages, stream has %d", snapOffset, len(snap.States), len(a.stream.stages))
+	}
+	if err := a.stream.restore(snap.States); err != nil {
+		return nil, err
+	}
+	for p, off := range snap.Offsets {
+		next[p] = off
+	}
+	return next, nil
+}
+
+// flush produces the pending output records.
+func (a *App) flush(ctx context.Context, pending *[]commitlog.Record) error {
+	if len(*pending) == 0 {
+		return nil
+	}
+	if _, err := a.client.Topic(a.cfg.Output, client.AnyPartition).ProduceBatch(ctx, *pending); err != nil {
+		return fmt.Errorf("stream: producing output: %w", err)
+	}
+	a.produced.Add(int64(len(*pending)))
+	*pending = (*pending)[:0]
+	return nil
+}
+
+// checkpoint flushes the output, saves a snapshot of the state and
+// commits next with it.
+func (a *App) checkpoint(ctx context.Context, next map[int]int, pending *[]commitlog.Record) error {
+	if err := a.flush(ctx, pending); err != nil {
+		return err
+	}
+	states, err := a.stream.snapshot()
+	if err != nil {
+		return fmt.Errorf("stream: snapshotting state: %w", err)
+	}
+	data, err := json.Marshal(snapshot{Offsets: next, States: states})
+	if err != nil {
+		return fmt.Errorf("stream: snapshotting state: %w", err)
+	}
+	state := a.client.Topic(a.cfg.StateTopic, 0)
+	snapOffset, err := state.Produce(ctx, commitlog.Record{Key: a.cfg.ID, Value: string(data)})
+	if err != nil {
+		return fmt.Errorf("stream: saving checkpoint: %w", err)
+	}
+	meta := stateMetadata + strconv.Itoa(snapOffset)
+	for p, off := range next {
+		if _, err := a.client.Topic(a.cfg.Input, p).CommitOffset(ctx, a.cfg.ID, off, meta); err != nil {
+			return fmt.Errorf("stream: committing partition %d: %w", p, err)
+		}
+	}
+	a.checkpoints.Add(1)
+	// Older snapshots are no longer needed.
+	if err := state.DeleteBefore(ctx, snapOffset); err != nil {
+		log.Printf("stream: %s: trimming state topic: %v", a.cfg.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Package stream processes a commit log topic into another topic.
+//
+// A Stream is a chain of steps applied to each record consumed: Filter,
+// Map and FlatMap transform records one at a time, and Aggregate
+// combines the records of each key in tumbling or hopping time windows,
+// emitting one record per key and window once the window closes. An App
+// runs a Stream over an input topic and produces what comes out of it to
+// an output topic:
+//
+//	s := stream.New().
+//		Filter(func(r stream.Record) bool { return r.Key != "" })
+//	stream.Aggregate(s, stream.Tumbling(time.Minute), stream.Count())
+//	app := stream.NewApp(cl, stream.Config{ID: "clicks-per-minute", Input: "clicks", Output: "click-counts"}, s)
+//	err := app.Run(ctx)
+//
+// An App checkpoints the state of its aggregations together with its
+// input offsets, so a restarted App resumes exactly where the last
+// checkpoint left off: no input record is counted twice or missed.
+// Output records produced after the last checkpoint are produced again,
+// so the output topic is at-least-once.
+//
+// Windows are in event time, the records' timestamps. A window closes
+// when a record at least its grace period past its end has been seen;
+// records arriving for a closed window are dropped.
+package stream
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+)
+
+// Record is a commit log record. Records passed to steps carry their
+// input offset; it is ignored on output.
+type Record = commitlog.Record
+
+// stage is one step of a Stream. Stateless steps ignore snapshots.
+type stage interface {
+	// process handles rec, passing any results to emit.
+	process(rec Record, emit func(Record))
+	// snapshot returns the stage's state; restore replaces it.
+	snapshot() (json.RawMessage, error)
+	restore(state json.RawMessage) error
+}
+
+// Stream is a chain of processing steps. Its methods add a step and
+// return the Stream, so calls can be chained.
+type Stream struct {
+	stages []stage
+}
+
+// New returns an empty Stream, which passes records through unchanged.
+func New() *Stream {
+	return &Stream{}
+}
+
+// funcStage is a stateless step.
+type funcStage func(rec Record, emit func(Record))
+
+func (f funcStage) process(rec Record, emit func(Record)) { f(rec, emit) }
+func (funcStage) snapshot() (json.RawMessage, error)      { return nil, nil }
+func (funcStage) restore(json.RawMessage) error           { return nil }
+
+// Filter keeps the records for which keep returns true.
+func (s *Stream) Filter(keep func(Record) bool) *Stream {
+	return s.add(funcStage(func(rec Record, emit func(Record)) {
+		if keep(rec) {
+			emit(rec)
+		}
+	}))
+}
+
+// Map replaces each record with f's result.
+func (s *Stream) Map(f func(Record) Record) *Stream {
+	return s.add(funcStage(func(rec Record, emit func(Record)) {
+		emit(f(rec))
+	}))
+}
+
+// FlatMap replaces each record with any number of records.
+func (s *Stream) FlatMap(f func(Record) []Record) *Stream {
+	return s.add(funcStage(func(rec Record, emit func(Record)) {
+		for _, out := range f(rec) {
+			emit(out)
+		}
+	}))
+}
+
+func (s *Stream) add(st stage) *Stream {
+	s.stages = append(s.stages, st)
+	return s
+}
+
+// process runs rec through the stages from i on, passing what comes out
+// of the last to out.
+func (s *Stream) process(i int, rec Record, out func(Record)) {
+	if i == len(s.stages) {
+		out(rec)
+		return
+	}
+	s.stages[i].process(rec, func(next Record) {
+		if next.Timestamp.IsZero() {
+			// Keep event time flowing through steps that build new
+			// records.
+			next.Timestamp = rec.Timestamp
+		}
+		s.process(i+1, next, out)
+	})
+}
+
+// snapshot returns every stage's state.
+func (s *Stream) snapshot() ([]json.RawMessage, error) {
+	states := make([]json.RawMessage, len(s.stages))
+	for i, st := range s.stages {
+		state, err := st.snapshot()
+		if err != nil {
+			return nil, err
+		}
+		states[i] = state
+	}
+	return states, nil
+}
+
+// restore replaces every stage's state with a snapshot. A nil snapshot
+// resets them.
+func (s *Stream) restore(states []json.RawMessage) error {
+	for i, st := range s.stages {
+		var state json.RawMessage
+		if i < len(states) {
+			state = states[i]
+		}
+		if err := st.restore(state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventTime is a record's event time, or now for records without one.
+func eventTime(rec Record) time.Time {
+	if rec.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return rec.Timestamp
+}
@@ -0,0 +1,118 @@
+package stream
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// at returns a record keyed key at epoch plus sec seconds.
+func at(key string, sec int, value string) Record {
+	return Record{Key: key, Value: value, Timestamp: epoch.Add(time.Duration(sec) * time.Second)}
+}
+
+// run passes recs through s and describes what comes out, one
+// "key=value@second" per record.
+func run(s *Stream, recs ...Record) string {
+	var out []string
+	for _, rec := range recs {
+		s.process(0, rec, func(r Record) {
+			out = append(out, fmt.Sprintf("%s=%s@%d", r.Key, r.Value, int(r.Timestamp.Sub(epoch).Seconds())))
+		})
+	}
+	return strings.Join(out, " ")
+}
+
+func TestStatelessSteps(t *testing.T) {
+	s := New().
+		Filter(func(r Record) bool { return r.Key != "skip" }).
+		Map(func(r Record) Record { return Record{Key: r.Key, Value: strings.ToUpper(r.Value)} }).
+		FlatMap(func(r Record) []Record {
+			var out []Record
+			for _, w := range strings.Fields(r.Value) {
+				out = append(out, Record{Key: r.Key, Value: w})
+			}
+			return out
+		})
+	got := run(s, at("a", 1, "x y"), at("skip", 2, "z"), at("b", 3, "w"))
+	// Records built by Map keep their input's timestamp.
+	if want := "a=X@1 a=Y@1 b=W@3"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestWindowsFor(t *testing.T) {
+	w := Hopping(10*time.Second, 5*time.Second)
+	got := w.windowsFor(epoch.Add(12 * time.Second))
+	if len(got) != 2 || !got[0].Start.Equal(epoch.Add(5*time.Second)) || !got[1].End.Equal(epoch.Add(20*time.Second)) {
+		t.Errorf("windowsFor(12s) = %v, want [5s,15s) and [10s,20s)", got)
+	}
+	if got := Tumbling(time.Minute).windowsFor(epoch.Add(-time.Second)); len(got) != 1 || !got[0].End.Equal(epoch) {
+		t.Errorf("windowsFor before a boundary = %v, want the minute ending at it", got)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	s := New()
+	Aggregate(s, Tumbling(10*time.Second).WithGrace(2*time.Second), Count())
+	got := run(s,
+		at("a", 1, ""), at("b", 3, ""), at("a", 9, ""),
+		at("a", 11, ""), // stream time 11s: [0s,10s) stays open for its grace
+		at("b", 8, ""),  // out of order but within the grace period
+		at("a", 12, ""), // closes [0s,10s)
+		at("a", 5, ""),  // late: dropped
+		at("c", 25, ""), // closes [10s,20s)
+	)
+	if want := "a=2@10 b=2@10 a=2@20"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if late := s.stages[0].(*aggStage[int]).lateRecords(); late != 1 {
+		t.Errorf("late = %d, want 1", late)
+	}
+}
+
+func TestHoppingAggregate(t *testing.T) {
+	s := New()
+	Aggregate(s, Hopping(10*time.Second, 5*time.Second), Reduce(func(acc, v string) string { return acc + v }))
+	got := run(s, at("k", 1, "a"), at("k", 6, "b"), at("k", 11, "c"), at("k", 30, "d"))
+	if want := "k=a@5 k=ab@10 k=bc@15 k=c@20"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	newStream := func() *Stream {
+		s := New().Filter(func(r Record) bool { return r.Value != "ignore" })
+		return Aggregate(s, Tumbling(10*time.Second), Aggregator[map[string]int]{
+			Init: func() map[string]int { return map[string]int{} },
+			Add: func(acc map[string]int, r Record) map[string]int {
+				acc[r.Value]++
+				return acc
+			},
+		})
+	}
+	recs := []Record{at("a", 1, "x"), at("a", 2, "y"), at("a", 3, "ignore"), at("a", 4, "x"), at("b", 12, "x"), at("a", 21, "z")}
+	want := run(newStream(), recs...)
+
+	// Stop after three records and resume in a new Stream.
+	first := newStream()
+	got := run(first, recs[:3]...)
+	states, err := first.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := newStream()
+	if err := second.restore(states); err != nil {
+		t.Fatal(err)
+	}
+	got += run(second, recs[3:]...)
+	if got != want {
+		t.Errorf("output with a restart = %q, want %q", got, want)
+	}
+	if want != `a={"x":2,"y":1}@10 b={"x":1}@20` {
+		t.Errorf("output = %q", want)
+	}
+}
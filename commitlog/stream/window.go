@@ -0,0 +1,251 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Windows describes how records are grouped in time. Windows are Size
+// long and a new one starts every Advance, aligned to the Unix epoch, so
+// with an Advance below Size a record falls in several windows. A window
+// stays open for Grace past its end for records arriving out of order.
+type Windows struct {
+	Size    time.Duration
+	Advance time.Duration
+	Grace   time.Duration
+}
+
+// Tumbling returns back-to-back windows of the given size.
+func Tumbling(size time.Duration) Windows {
+	return Windows{Size: size, Advance: size}
+}
+
+// Hopping returns windows of the given size starting every advance.
+func Hopping(size, advance time.Duration) Windows {
+	return Windows{Size: size, Advance: advance}
+}
+
+// WithGrace returns w with its grace period set to d.
+func (w Windows) WithGrace(d time.Duration) Windows {
+	w.Grace = d
+	return w
+}
+
+func (w Windows) validate() error {
+	if w.Size <= 0 || w.Advance <= 0 || w.Advance > w.Size || w.Grace < 0 {
+		return fmt.Errorf("stream: invalid windows %+v: need 0 < Advance <= Size and Grace >= 0", w)
+	}
+	return nil
+}
+
+// Window is the time span [Start, End).
+type Window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// windowsFor returns the windows holding t, earliest first.
+func (w Windows) windowsFor(t time.Time) []Window {
+	ns := t.UnixNano()
+	last := ns - mod(ns, int64(w.Advance))
+	var ws []Window
+	for start := last; start > ns-int64(w.Size); start -= int64(w.Advance) {
+		ws = append(ws, Window{Start: time.Unix(0, start).UTC(), End: time.Unix(0, start+int64(w.Size)).UTC()})
+	}
+	sort.Slice(ws, func(i, j int) bool { return ws[i].Start.Before(ws[j].Start) })
+	return ws
+}
+
+// mod is a % b rounded towards negative infinity, for times before the
+// epoch.
+func mod(a, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
+
+// Aggregator combines the records of one key in one window. Init returns
+// an empty accumulator and Add folds a record into it. Emit builds the
+// output record for a closed window; if it is nil the record holds the
+// key and the accumulator encoded as JSON. An output record without a
+// timestamp gets the window's end. Accumulators are checkpointed as
+// JSON, so A must round-trip through encoding/json.
+type Aggregator[A any] struct {
+	Init func() A
+	Add  func(acc A, rec Record) A
+	Emit func(key string, w Window, acc A) Record
+}
+
+// Count counts records, emitting the count as the value.
+func Count() Aggregator[int] {
+	return Aggregator[int]{
+		Init: func() int { return 0 },
+		Add:  func(n int, _ Record) int { return n + 1 },
+		Emit: func(key string, _ Window, n int) Record {
+			return Record{Key: key, Value: strconv.Itoa(n)}
+		},
+	}
+}
+
+// Reduce combines record values with f, emitting the result as the
+// value. The first record's value starts the accumulator.
+func Reduce(f func(acc, value string) string) Aggregator[*string] {
+	return Aggregator[*string]{
+		Init: func() *string { return nil },
+		Add: func(acc *string, rec Record) *string {
+			if acc == nil {
+				v := rec.Value
+				return &v
+			}
+			v := f(*acc, rec.Value)
+			return &v
+		},
+		Emit: func(key string, _ Window, acc *string) Record {
+			return Record{Key: key, Value: *acc}
+		},
+	}
+}
+
+// Aggregate adds a step to s that groups records by key into windows and
+// combines each group with agg. Records leave the step only when their
+// window closes, one per key and window. Records for windows that have
+// already closed are dropped; App.Stats counts them as late.
+func Aggregate[A any](s *Stream, w Windows, agg Aggregator[A]) *Stream {
+	if err := w.validate(); err != nil {
+		panic(err)
+	}
+	return s.add(&aggStage[A]{windows: w, agg: agg, open: make(map[windowKey]A)})
+}
+
+type windowKey struct {
+	start int64 // Unix nanoseconds
+	key   string
+}
+
+// aggStage is the step added by Aggregate. Its stream time is the latest
+// event time it has seen.
+type aggStage[A any] struct {
+	windows Windows
+	agg     Aggregator[A]
+
+	open       map[windowKey]A
+	streamTime time.Time
+	late       atomic.Int64
+}
+
+func (a *aggStage[A]) process(rec Record, emit func(Record)) {
+	t := eventTime(rec)
+	if t.After(a.streamTime) {
+		a.streamTime = t
+	}
+	for _, win := range a.windows.windowsFor(t) {
+		if a.closed(win) {
+			a.late.Add(1)
+			continue
+		}
+		k := windowKey{win.Start.UnixNano(), rec.Key}
+		acc, ok := a.open[k]
+		if !ok {
+			acc = a.agg.Init()
+		}
+		a.open[k] = a.agg.Add(acc, rec)
+	}
+	a.closeWindows(emit)
+}
+
+func (a *aggStage[A]) closed(win Window) bool {
+	return !win.End.Add(a.windows.Grace).After(a.streamTime)
+}
+
+// closeWindows emits and forgets the windows that stream time has
+// passed, in order of their start and then key.
+func (a *aggStage[A]) closeWindows(emit func(Record)) {
+	var done []windowKey
+	for k := range a.open {
+		if a.closed(a.window(k)) {
+			done = append(done, k)
+		}
+	}
+	sort.Slice(done, func(i, j int) bool {
+		if done[i].start != done[j].start {
+			return done[i].start < done[j].start
+		}
+		return done[i].key < done[j].key
+	})
+	for _, k := range done {
+		acc := a.open[k]
+		delete(a.open, k)
+		emit(a.emit(k, acc))
+	}
+}
+
+func (a *aggStage[A]) window(k windowKey) Window {
+	start := time.Unix(0, k.start).UTC()
+	return Window{Start: start, End: start.Add(a.windows.Size)}
+}
+
+func (a *aggStage[A]) emit(k windowKey, acc A) Record {
+	win := a.window(k)
+	var out Record
+	if a.agg.Emit != nil {
+		out = a.agg.Emit(k.key, win, acc)
+	} else {
+		value, err := json.Marshal(acc)
+		if err != nil {
+			value = []byte(strconv.Quote(err.Error()))
+		}
+		out = Record{Key: k.key, Value: string(value)}
+	}
+	if out.Timestamp.IsZero() {
+		out.Timestamp = win.End
+	}
+	return out
+}
+
+// aggState is an aggStage's checkpointed state.
+type aggState[A any] struct {
+	StreamTime time.Time       `json:"stream_time"`
+	Late       int64           `json:"late"`
+	Windows    []openWindow[A] `json:"windows"`
+}
+
+type openWindow[A any] struct {
+	Start int64  `json:"start"`
+	Key   string `json:"key"`
+	Acc   A      `json:"acc"`
+}
+
+func (a *aggStage[A]) snapshot() (json.RawMessage, error) {
+	st := aggState[A]{StreamTime: a.streamTime, Late: a.late.Load(), Windows: []openWindow[A]{}}
+	for k, acc := range a.open {
+		st.Windows = append(st.Windows, openWindow[A]{Start: k.start, Key: k.key, Acc: acc})
+	}
+	return json.Marshal(st)
+}
+
+func (a *aggStage[A]) restore(state json.RawMessage) error {
+	a.open = make(map[windowKey]A)
+	a.streamTime = time.Time{}
+	a.late.Store(0)
+	if state == nil {
+		return nil
+	}
+	var st aggState[A]
+	if err := json.Unmarshal(state, &st); err != nil {
+		return fmt.Errorf("stream: restoring aggregation: %w", err)
+	}
+	a.streamTime = st.StreamTime
+	a.late.Store(st.Late)
+	for _, w := range st.Windows {
+		a.open[windowKey{w.Start, w.Key}] = w.Acc
+	}
+	return nil
+}
+
+func (a *aggStage[A]) lateRecords() int64 { return a.late.Load() }
@@ -0,0 +1,168 @@
+package commitlog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SyncMode selects when a FileLog fsyncs appended records.
+type SyncMode int
+
+const (
+	// SyncOS leaves flushing to the operating system.
+	SyncOS SyncMode = iota
+	// SyncAlways fsyncs before every Append returns. Concurrent appends
+	// share a single fsync (group commit).
+	SyncAlways
+	// SyncPeriodic fsyncs every Interval, or sooner once Records appends
+	// are pending. Append returns after the sync that covers it.
+	SyncPeriodic
+)
+
+// SyncPolicy is the durability policy of a FileLog.
+type SyncPolicy struct {
+	Mode     SyncMode
+	Interval time.Duration
+	Records  int
+}
+
+// ParseSyncMode parses a sync mode name: os, always or periodic.
+func ParseSyncMode(s string) (SyncMode, error) {
+	switch s {
+	case "os":
+		return SyncOS, nil
+	case "always":
+		return SyncAlways, nil
+	case "periodic":
+		return SyncPeriodic, nil
+	}
+	return 0, fmt.Errorf("unknown sync mode %q (want os, always or periodic)", s)
+}
+
+// syncer runs the fsyncs for a log according to its policy. Appends are
+// numbered by a sequence that never goes backwards; an appender waits for
+// the synced sequence to reach its own.
+type syncer struct {
+	policy SyncPolicy
+	// flush fsyncs everything written so far and returns the sequence
+	// number it covered.
+	flush func() (int64, error)
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	synced  int64
+	pending int
+	err     error
+
+	kick chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newSyncer(policy SyncPolicy, flush func() (int64, error)) *syncer {
+	s := &syncer{
+		policy: policy,
+		flush:  flush,
+		kick:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	if policy.Mode != SyncOS {
+		s.wg.Add(1)
+		go s.loop()
+	}
+	return s
+}
+
+// appended notes a new append and wakes the sync loop if the policy says
+// it is time to sync.
+func (s *syncer) appended() {
+	if s.policy.Mode == SyncOS {
+		return
+	}
+	s.mu.Lock()
+	s.pending++
+	trigger := s.policy.Mode == SyncAlways ||
+		(s.policy.Records > 0 && s.pending >= s.policy.Records)
+	s.mu.Unlock()
+	if trigger {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wait blocks until the append numbered seq is durable.
+func (s *syncer) wait(seq int64) error {
+	if s.policy.Mode == SyncOS {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.synced < seq && s.err == nil {
+		s.cond.Wait()
+	}
+	if s.synced >= seq {
+		return nil
+	}
+	return s.err
+}
+
+func (s *syncer) loop() {
+	defer s.wg.Done()
+	var tick <-chan time.Time
+	if s.policy.Mode == SyncPeriodic {
+		t := time.NewTicker(s.policy.Interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-s.kick:
+		case <-tick:
+		case <-s.done:
+			s.sync()
+			return
+		}
+		s.sync()
+	}
+}
+
+func (s *syncer) sync() {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.pending = 0
+	s.mu.Unlock()
+
+	seq, err := s.flush()
+	s.advance(seq, err)
+}
+
+// advance records that everything up to seq is durable, or that syncing
+// failed, and wakes the waiters.
+func (s *syncer) advance(seq int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		// A failed fsync may have dropped dirty pages; don't pretend
+		// later syncs cover them.
+		s.err = err
+	} else if seq > s.synced {
+		s.synced = seq
+	}
+	s.cond.Broadcast()
+}
+
+// close runs a final sync and fails any later waits with ErrClosed.
+func (s *syncer) close() {
+	if s.policy.Mode != SyncOS {
+		close(s.done)
+		s.wg.Wait()
+	}
+	s.advance(0, ErrClosed)
+}
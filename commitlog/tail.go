@@ -0,0 +1,98 @@
+package commitlog
+
+import (
+	"context"
+	"sync"
+)
+
+// Tailable wraps a Log so readers can block until records are appended
+// past the end of the log.
+type Tailable struct {
+	Log
+
+	mu      sync.Mutex
+	changed chan struct{}
+	closed  bool
+	// truncations counts the calls to TruncateAfter that succeeded.
+	truncations int
+}
+
+// NewTailable returns l wrapped for waiting on appends.
+func NewTailable(l Log) *Tailable {
+	return &Tailable{Log: l, changed: make(chan struct{})}
+}
+
+func (t *Tailable) Append(rec Record) (int, error) {
+	off, err := t.Log.Append(rec)
+	if err == nil {
+		t.notify()
+	}
+	return off, err
+}
+
+// AppendBatch appends recs with AppendBatch and wakes waiting readers.
+func (t *Tailable) AppendBatch(recs []Record) ([]int, error) {
+	offsets, err := AppendBatch(t.Log, recs)
+	if len(offsets) > 0 {
+		t.notify()
+	}
+	return offsets, err
+}
+
+func (t *Tailable) TruncateAfter(offset int) error {
+	err := t.Log.TruncateAfter(offset)
+	if err == nil {
+		t.mu.Lock()
+		t.truncations++
+		t.mu.Unlock()
+	}
+	t.notify()
+	return err
+}
+
+// Truncations returns how many times TruncateAfter has been called on
+// the log since it was wrapped. A reader that sees it change knows the
+// offsets it has read past may have been reused, even if the log has
+// grown back beyond them.
+func (t *Tailable) Truncations() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.truncations
+}
+
+// Close closes the log and wakes waiting readers, which get ErrClosed.
+func (t *Tailable) Close() error {
+	err := t.Log.Close()
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	t.notify()
+	return err
+}
+
+func (t *Tailable) notify() {
+	t.mu.Lock()
+	close(t.changed)
+	t.changed = make(chan struct{})
+	t.mu.Unlock()
+}
+
+// Wait blocks until offset is below the end of the log or ctx is done.
+func (t *Tailable) Wait(ctx context.Context, offset int) error {
+	for {
+		t.mu.Lock()
+		changed, closed := t.changed, t.closed
+		t.mu.Unlock()
+		if closed {
+			return ErrClosed
+		}
+		if offset < t.EndOffset() {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package commitlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ObjectStore holds the segments a FileLog offloads under tiered storage.
+// Keys are slash-separated paths. Implementations are in the objstore
+// package.
+type ObjectStore interface {
+	// Put stores size bytes read from r under key, replacing any
+	// existing object.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get returns the contents of the object at key, or an error
+	// wrapping ErrObjectNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object at key; deleting a missing object is
+	// not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns the objects whose keys start with prefix, sorted by
+	// key.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key  string
+	Size int64
+}
+
+// ErrObjectNotFound is returned by ObjectStore.Get for a missing key.
+var ErrObjectNotFound = errors.New("commitlog: object not found")
+
+// TierConfig turns on tiered storage for a FileLog: closed segments are
+// uploaded to Store, deleted from local disk, and fetched back when Read
+// asks for one of their offsets.
+type TierConfig struct {
+	// Store is where segments are offloaded. Tiering is off when it is
+	// nil.
+	Store ObjectStore
+	// Prefix is prepended to this log's object keys, e.g. "orders-0/",
+	// so several logs can share a store.
+	Prefix string
+	// LocalSegments is how many closed segments stay on local disk, in
+	// addition to the one taking appends, before being offloaded.
+	LocalSegments int
+	// CacheSegments is how many fetched segments are kept on local disk
+	// for further reads. Zero means DefaultCacheSegments.
+	CacheSegments int
+}
+
+// DefaultCacheSegments is the number of fetched segments a tiered
+// FileLog keeps when TierConfig.CacheSegments is zero.
+const DefaultCacheSegments = 4
+
+// offloadRetry is how often a failed or pending offload is retried when
+// no segment roll prompts one sooner.
+const offloadRetry = 30 * time.Second
+
+// cacheDir is the subdirectory fetched segments are kept in.
+const cacheDir = "tier-cache"
+
+// remoteSegment is a segment that lives only in the object store.
+type remoteSegment struct {
+	base    int
+	records int
+	bytes   int64
+}
+
+func (r remoteSegment) nextOffset() int {
+	return r.base + r.records
+}
+
+// tier is the tiered-storage side of a FileLog: the offload loop and the
+// cache of fetched segments.
+type tier struct {
+	cfg TierConfig
+	dir string // cache directory
+
+	mu    sync.Mutex // held while fetching, so each segment is fetched once
+	cache map[int]*cachedSegment
+	clock int64 // orders cache use for eviction
+
+	kick chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type cachedSegment struct {
+	seg  *segment
+	used int64
+}
+
+func (t *tier) key(base int, ext string) string {
+	return fmt.Sprintf("%s%020d%s", t.cfg.Prefix, base, ext)
+}
+
+// listRemote returns the segments in the store, in offset order. A
+// segment counts once its index, uploaded after its store, is present.
+func (t *tier) listRemote(ctx context.Context) ([]remoteSegment, error) {
+	objs, err := t.cfg.Store.List(ctx, t.cfg.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	stores := map[int]int64{}
+	var segs []remoteSegment
+	for _, o := range objs {
+		name := strings.TrimPrefix(o.Key, t.cfg.Prefix)
+		var base int
+		if _, err := fmt.Sscanf(name, "%020d", &base); err != nil || len(name) != 20+len(storeExt) {
+			continue
+		}
+		switch name[20:] {
+		case storeExt:
+			stores[base] = o.Size
+		case indexExt:
+			segs = append(segs, remoteSegment{base: base, records: int(o.Size / entrySize)})
+		}
+	}
+	complete := segs[:0]
+	for _, r := range segs {
+		if size, ok := stores[r.base]; ok {
+			r.bytes = size + int64(r.records)*entrySize
+			complete = append(complete, r)
+		}
+	}
+	sort.Slice(complete, func(i, j int) bool { return complete[i].base < complete[j].base })
+	return complete, nil
+}
+
+// upload copies a closed segment's files to the store, index last.
+func (t *tier) upload(ctx context.Context, s *segment, size int64, records int) error {
+	files := []struct {
+		path, key string
+		size      int64
+	}{
+		{s.store.Name(), t.key(s.base, storeExt), size},
+		{s.index.Name(), t.key(s.base, indexExt), int64(records) * entrySize},
+	}
+	for _, f := range files {
+		fh, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		err = t.cfg.Store.Put(ctx, f.key, io.LimitReader(fh, f.size), f.size)
+		fh.Close()
+		if err != nil {
+			return fmt.Errorf("uploading segment %d: %w", s.base, err)
+		}
+	}
+	return nil
+}
+
+// deleteRemote removes offloaded segments from the store and the cache.
+func (t *tier) deleteRemote(ctx context.Context, bases []int) error {
+	t.mu.Lock()
+	for _, base := range bases {
+		if c, ok := t.cache[base]; ok {
+			c.seg.remove()
+			delete(t.cache, base)
+		}
+	}
+	t.mu.Unlock()
+	for _, base := range bases {
+		// Index first, so a half-deleted segment is not listed.
+		for _, ext := range []string{indexExt, storeExt} {
+			if err := t.cfg.Store.Delete(ctx, t.key(base, ext)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// read returns offset from the offloaded segment r, fetching it into the
+// cache if needed.
+func (t *tier) read(r remoteSegment, offset int) (Record, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.cache[r.base]
+	if !ok {
+		seg, err := t.fetch(r)
+		if err != nil {
+			return Record{}, err
+		}
+		c = &cachedSegment{seg: seg}
+		t.cache[r.base] = c
+	}
+	t.clock++
+	c.used = t.clock
+	t.evict()
+	return c.seg.read(offset)
+}
+
+// fetch downloads an offloaded segment into the cache directory and
+// opens it.
+func (t *tier) fetch(r remoteSegment) (*segment, error) {
+	ctx := context.Background()
+	for _, ext := range []string{storeExt, indexExt} {
+		if err := t.download(ctx, t.key(r.base, ext), segmentPath(t.dir, r.base, ext)); err != nil {
+			return nil, fmt.Errorf("fetching segment %d: %w", r.base, err)
+		}
+	}
+	return openSegment(t.dir, r.base, false)
+}
+
+func (t *tier) download(ctx context.Context, key, path string) error {
+	body, err := t.cfg.Store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// evict drops the least recently used fetched segments beyond the cache
+// size. t.mu must be held.
+func (t *tier) evict() {
+	limit := t.cfg.CacheSegments
+	if limit <= 0 {
+		limit = DefaultCacheSegments
+	}
+	for len(t.cache) > limit {
+		oldest := -1
+		for base, c := range t.cache {
+			if oldest < 0 || c.used < t.cache[oldest].used {
+				oldest = base
+			}
+		}
+		t.cache[oldest].seg.remove()
+		delete(t.cache, oldest)
+	}
+}
+
+func (t *tier) close() {
+	close(t.done)
+	t.wg.Wait()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range t.cache {
+		c.seg.close()
+	}
+}
+
+// openTier sets up tiered storage for l and returns the offloaded
+// segments.
+func (l *FileLog) openTier() ([]remoteSegment, error) {
+	t := &tier{
+		cfg:   l.cfg.Tier,
+		dir:   filepath.Join(l.dir, cacheDir),
+		cache: make(map[int]*cachedSegment),
+		kick:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	// Fetched segments don't outlive the process.
+	if err := os.RemoveAll(t.dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return nil, err
+	}
+	remote, err := t.listRemote(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("listing offloaded segments: %w", err)
+	}
+	l.tier = t
+	return remote, nil
+}
+
+// kickOffload wakes the offload loop.
+func (l *FileLog) kickOffload() {
+	if l.tier == nil {
+		return
+	}
+	select {
+	case l.tier.kick <- struct{}{}:
+	default:
+	}
+}
+
+// offloadLoop uploads closed segments beyond the local allowance, one at
+// a time, whenever kicked and periodically.
+func (l *FileLog) offloadLoop() {
+	defer l.tier.wg.Done()
+	ticker := time.NewTicker(offloadRetry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.tier.done:
+			return
+		case <-l.tier.kick:
+		case <-ticker.C:
+		}
+		for {
+			more, err := l.offloadOne()
+			l.mu.Lock()
+			l.offloadErr = err
+			l.mu.Unlock()
+			if err != nil || !more {
+				break
+			}
+		}
+	}
+}
+
+// offloadOne uploads the oldest local segment if there are more closed
+// segments than the tier keeps, then removes it locally. It reports
+// whether it offloaded one.
+func (l *FileLog) offloadOne() (bool, error) {
+	l.mu.RLock()
+	if l.closed || len(l.segments)-1 <= l.tier.cfg.LocalSegments {
+		l.mu.RUnlock()
+		return false, nil
+	}
+	s := l.segments[0]
+	size, records := s.size, len(s.pos)
+	l.mu.RUnlock()
+
+	if err := s.sync(); err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-l.tier.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if err := l.tier.upload(ctx, s, size, records); err != nil {
+		return false, err
+	}
+
+	// Removing the segment must not overlap a flush that is syncing it.
+	l.fsyncMu.Lock()
+	l.mu.Lock()
+	if len(l.segments) == 0 || l.segments[0] != s {
+		// Deleted while uploading.
+		l.mu.Unlock()
+		l.fsyncMu.Unlock()
+		return true, l.tier.deleteRemote(ctx, []int{s.base})
+	}
+	if s.size != size || len(s.pos) != records {
+		// Truncated while uploading; the next round uploads it
+		// again.
+		l.mu.Unlock()
+		l.fsyncMu.Unlock()
+		return true, nil
+	}
+	l.segments = l.segments[1:]
+	l.remote = append(l.remote, remoteSegment{base: s.base, records: records, bytes: size + int64(records)*entrySize})
+	// It was synced before the upload and takes no appends since it was
+	// closed, so nothing is lost by not syncing it again.
+	delete(l.dirty, s)
+	err := s.remove()
+	l.mu.Unlock()
+	l.fsyncMu.Unlock()
+	return true, err
+}
+
+// remoteFor returns the offloaded segment holding offset, if any.
+func (l *FileLog) remoteFor(offset int) (remoteSegment, bool) {
+	i := sort.Search(len(l.remote), func(i int) bool {
+		return l.remote[i].nextOffset() > offset
+	})
+	if i == len(l.remote) || l.remote[i].base > offset {
+		return remoteSegment{}, false
+	}
+	return l.remote[i], true
+}
+
+// DeleteObjects removes every object under prefix from store, such as an
+// offloaded log whose local directory has been deleted.
+func DeleteObjects(ctx context.Context, store ObjectStore, prefix string) error {
+	objs, err := store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, o := range objs {
+		if err := store.Delete(ctx, o.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncateOffloaded is TruncateAfter for an offset within the offloaded
+// segments. The segment holding the new end is fetched back into the log
+// directory to take appends; everything after it, local or offloaded, is
+// removed. l.mu and l.fsyncMu must be held.
+func (l *FileLog) truncateOffloaded(offset int) error {
+	ctx := context.Background()
+	i := sort.Search(len(l.remote), func(i int) bool {
+		return l.remote[i].nextOffset() > offset+1
+	})
+	var s *segment
+	var err error
+	if i < len(l.remote) && l.remote[i].base <= offset {
+		r := l.remote[i]
+		for _, ext := range []string{storeExt, indexExt} {
+			if err := l.tier.download(ctx, l.tier.key(r.base, ext), segmentPath(l.dir, r.base, ext)); err != nil {
+				return fmt.Errorf("fetching segment %d: %w", r.base, err)
+			}
+		}
+		if s, err = openSegment(l.dir, r.base, true); err != nil {
+			return err
+		}
+		if err := s.truncate(offset + 1 - r.base); err != nil {
+			s.close()
+			return err
+		}
+	} else if s, err = openSegment(l.dir, offset+1, true); err != nil {
+		return err
+	}
+	if err := s.sync(); err != nil {
+		s.close()
+		return err
+	}
+
+	for _, old := range l.segments {
+		if err := old.remove(); err != nil {
+			return err
+		}
+	}
+	l.segments = []*segment{s}
+	var gone []int
+	for _, r := range l.remote[i:] {
+		gone = append(gone, r.base)
+	}
+	l.remote = l.remote[:i]
+	l.syncer.advance(l.seq, nil)
+	return l.tier.deleteRemote(ctx, gone)
+}
@@ -0,0 +1,182 @@
+package commitlog_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Ramykaz/Distributed-Systems-/commitlog"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/logtest"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/objstore"
+	"github.com/Ramykaz/Distributed-Systems-/commitlog/objstore/s3test"
+)
+
+func tieredConfig(store commitlog.ObjectStore) commitlog.Config {
+	return commitlog.Config{
+		MaxSegmentBytes: 128,
+		Tier:            commitlog.TierConfig{Store: store, Prefix: "log/", CacheSegments: 1},
+	}
+}
+
+// waitOffloaded waits until l has at most local segments on disk.
+func waitOffloaded(t *testing.T, l *commitlog.FileLog, local int) commitlog.Stats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := l.Stats()
+		if st.OffloadErr != nil {
+			t.Fatal(st.OffloadErr)
+		}
+		if st.Segments <= local {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("still %d local segments, want %d", st.Segments, local)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTieredFileLog(t *testing.T) {
+	logtest.Run(t, func(t *testing.T) commitlog.Log {
+		store, err := objstore.NewDir(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err := commitlog.OpenFileLog(t.TempDir(), tieredConfig(store))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	})
+}
+
+func TestTieredOffloadAndFetch(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	store, err := objstore.NewS3(objstore.S3Config{Endpoint: srv.URL, Bucket: "logs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := tieredConfig(store)
+
+	dir := t.TempDir()
+	l, err := commitlog.OpenFileLog(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 40; i++ {
+		if _, err := l.Append(commitlog.Record{Value: "value"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st := waitOffloaded(t, l, 1)
+	if st.OffloadedSegments == 0 {
+		t.Fatal("nothing offloaded")
+	}
+	for _, off := range []int{0, 39, 1, 20} {
+		rec, err := l.Read(off)
+		if err != nil || rec.Offset != off {
+			t.Fatalf("Read(%d) = %+v, %v", off, rec, err)
+		}
+	}
+
+	// Truncating into offloaded segments brings the new last one back.
+	if err := l.TruncateAfter(30); err != nil {
+		t.Fatal(err)
+	}
+	if off, err := l.Append(commitlog.Record{Value: "after"}); err != nil || off != 31 {
+		t.Fatalf("Append after TruncateAfter = %d, %v, want 31", off, err)
+	}
+	for i := 32; i < 40; i++ {
+		if _, err := l.Append(commitlog.Record{Value: "value"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitOffloaded(t, l, 1)
+	if rec, err := l.Read(31); err != nil || rec.Value != "after" {
+		t.Fatalf("Read(31) = %+v, %v", rec, err)
+	}
+	l.Close()
+
+	// A replacement node with an empty disk sees the offloaded records
+	// and carries on after them.
+	l, err = commitlog.OpenFileLog(t.TempDir(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if start := l.StartOffset(); start != 0 {
+		t.Fatalf("StartOffset = %d, want 0", start)
+	}
+	// Records in the old node's local segments are not in the store.
+	end := l.EndOffset()
+	if end == 0 || end >= 40 {
+		t.Fatalf("EndOffset = %d, want the end of the offloaded segments", end)
+	}
+	if rec, err := l.Read(end - 1); err != nil || rec.Offset != end-1 {
+		t.Fatalf("Read(%d) = %+v, %v", end-1, rec, err)
+	}
+
+	// Retention removes offloaded segments from the store.
+	before := len(srv.Objects("logs"))
+	if err := l.DeleteBefore(end); err != nil {
+		t.Fatal(err)
+	}
+	if after := len(srv.Objects("logs")); after >= before {
+		t.Fatalf("%d objects after DeleteBefore, had %d", after, before)
+	}
+	if err := commitlog.DeleteObjects(context.Background(), store, "log/"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Objects("logs")); n != 0 {
+		t.Fatalf("%d objects left", n)
+	}
+}
+
+// Offloading a segment must not leave it for the syncer to fsync after
+// it is removed, which would fail every later append.
+func TestTieredOffloadPeriodicSync(t *testing.T) {
+	for _, local := range []int{0, 2} {
+		store, err := objstore.NewDir(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := commitlog.Config{
+			MaxSegmentBytes: 200,
+			Sync:            commitlog.SyncPolicy{Mode: commitlog.SyncPeriodic, Interval: time.Millisecond},
+			Tier:            commitlog.TierConfig{Store: store, Prefix: "log/", LocalSegments: local},
+		}
+		l, err := commitlog.OpenFileLog(t.TempDir(), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next := 0
+		for round := 0; round < 20; round++ {
+			batch := make([]commitlog.Record, 10+round%4*10)
+			for i := range batch {
+				batch[i] = commitlog.Record{Value: "value"}
+			}
+			offsets, err := l.AppendBatch(batch)
+			if err != nil {
+				t.Fatalf("LocalSegments %d: AppendBatch in round %d: %v", local, round, err)
+			}
+			if offsets[0] != next {
+				t.Fatalf("LocalSegments %d: batch starts at %d, want %d", local, offsets[0], next)
+			}
+			next += len(batch)
+		}
+		st := waitOffloaded(t, l, local+1)
+		if st.OffloadedSegments == 0 {
+			t.Fatalf("LocalSegments %d: nothing offloaded", local)
+		}
+		for _, off := range []int{0, next / 2, next - 1} {
+			if rec, err := l.Read(off); err != nil || rec.Offset != off {
+				t.Fatalf("LocalSegments %d: Read(%d) = %+v, %v", local, off, rec, err)
+			}
+		}
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}